@@ -0,0 +1,48 @@
+package bearnotes
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxAltTextLength is the maximum number of characters of the alternative
+// texts given by an AltTextProvider, as screen readers cut longer texts.
+const maxAltTextLength = 125
+
+// AltTextProvider generates the alternative text of the embedded images
+// having none, for instance with optical character recognition (OCR) or a
+// vision model (see MigrateOptions.AltText).
+type AltTextProvider interface {
+	// AltText returns the alternative text of the image at path, or the
+	// empty string if there is nothing to describe.
+	AltText(ctx context.Context, path string) (string, error)
+}
+
+// noAltText is an AltTextProvider generating no alternative text.
+type noAltText struct{}
+
+// AltText implements the AltTextProvider interface.
+func (noAltText) AltText(ctx context.Context, path string) (string, error) {
+	return "", nil
+}
+
+// NoAltText is the default AltTextProvider: images without alternative
+// text are left as-is.
+var NoAltText AltTextProvider = noAltText{}
+
+// cleanAltText turns the text given by an AltTextProvider into an
+// alternative text: whitespace is collapsed, brackets are removed and long
+// texts are cut after the last complete word.
+func cleanAltText(text string) string {
+	text = strings.NewReplacer("[", "", "]", "").Replace(text)
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= maxAltTextLength {
+		return text
+	}
+	cut := string([]rune(text)[:maxAltTextLength])
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return cut + "…"
+}
@@ -0,0 +1,38 @@
+//go:build tesseract
+// +build tesseract
+
+package bearnotes
+
+import (
+	"context"
+	"os/exec"
+)
+
+// TesseractAltText is an AltTextProvider using the tesseract command to
+// recognize the text of the images (screenshots, scanned documents), as
+// their alternative text. It is available when built with the tesseract
+// build tag.
+type TesseractAltText struct {
+	// Command is the path of the tesseract command (defaults to tesseract)
+	Command string
+
+	// Language is the language of the text, as a tesseract language code
+	// (defaults to eng)
+	Language string
+}
+
+// AltText implements the AltTextProvider interface.
+func (t TesseractAltText) AltText(ctx context.Context, path string) (string, error) {
+	command, language := t.Command, t.Language
+	if command == "" {
+		command = "tesseract"
+	}
+	if language == "" {
+		language = "eng"
+	}
+	output, err := exec.CommandContext(ctx, command, path, "stdout", "-l", language).Output()
+	if err != nil {
+		return "", err
+	}
+	return string(output), nil
+}
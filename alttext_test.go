@@ -0,0 +1,22 @@
+package bearnotes
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanAltText(t *testing.T) {
+	for _, testCase := range []struct {
+		text     string
+		expected string
+	}{
+		{"", ""},
+		{"Invoice [2020]\n  Total:\t42 €\n", "Invoice 2020 Total: 42 €"},
+		{strings.Repeat("word ", 40), strings.Repeat("word ", 24) + "word…"},
+		{strings.Repeat("é", 150), strings.Repeat("é", 125) + "…"},
+	} {
+		assert.Equal(t, testCase.expected, cleanAltText(testCase.text), "%q must be cleaned", testCase.text)
+	}
+}
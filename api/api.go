@@ -0,0 +1,206 @@
+// Package api is the options-based API of bearnotes. Each operation takes a
+// context and a single option struct, so that new settings can be added
+// without breaking callers, and the extension points are interfaces
+// (Transform, Exporter, AltTextProvider and Logger).
+//
+// The functions of the bearnotes package (MigrateNotes, DiscoverNotes,
+// ConvertNote, etc.) are kept as-is: this package is a thin layer on top of
+// them and shares their types.
+//
+// Apart from the fields naming the directories and files to work on (From,
+// To, TagFile, Dir), the zero value of an option struct is the default
+// behavior. The exception is SimilarImageOptions.MaxDistance, where 0 only
+// groups identical images and a negative value stands for the default.
+package api
+
+import (
+	"context"
+
+	"github.com/nmasse-itix/bearnotes"
+)
+
+// Types shared with the bearnotes package
+type (
+	// Transform rewrites the content of a note before it is parsed
+	Transform = bearnotes.Transform
+
+	// Exporter exports the migrated notes in the formats listed by their
+	// tags (export_formats)
+	Exporter = bearnotes.Exporter
+
+	// AltTextProvider generates the alternative text of the images having
+	// none (OCR, vision models)
+	AltTextProvider = bearnotes.AltTextProvider
+
+	// Logger receives the messages of a migration
+	Logger = bearnotes.Logger
+
+	TagOptions       = bearnotes.TagOptions
+	HandlingStrategy = bearnotes.HandlingStrategy
+	SlugOptions      = bearnotes.SlugOptions
+	ParseOptions     = bearnotes.ParseOptions
+	DirectoryOptions = bearnotes.DirectoryOptions
+	Plan             = bearnotes.Plan
+	MigrationReport  = bearnotes.MigrationReport
+	CheckReport      = bearnotes.CheckReport
+	Bearism          = bearnotes.Bearism
+	NoteError        = bearnotes.NoteError
+	DuplicateCluster = bearnotes.DuplicateCluster
+	ImageCluster     = bearnotes.ImageCluster
+	Graph            = bearnotes.Graph
+)
+
+// Handling strategies of the notes (see bearnotes.HandlingStrategy)
+const (
+	StrategyNone             = bearnotes.StrategyNone
+	StrategySameFolder       = bearnotes.StrategySameFolder
+	StrategyOneNotePerFolder = bearnotes.StrategyOneNotePerFolder
+	StrategyGroupByInitial   = bearnotes.StrategyGroupByInitial
+)
+
+// MigrateOptions holds the settings of a migration.
+type MigrateOptions struct {
+	From    string // The Bear notes directory
+	To      string // The destination directory (unless InPlace)
+	TagFile string // The tag configuration file
+
+	bearnotes.MigrateOptions
+}
+
+// Migrate performs a Bear to Zettlr migration (see bearnotes.MigrateNotes).
+func Migrate(ctx context.Context, options MigrateOptions) (*MigrationReport, error) {
+	return bearnotes.MigrateNotes(ctx, options.From, options.To, options.TagFile, options.MigrateOptions)
+}
+
+// PlanMigration computes a migration without writing anything
+// (see bearnotes.PlanMigration).
+func PlanMigration(ctx context.Context, options MigrateOptions) (*Plan, error) {
+	return bearnotes.PlanMigration(ctx, options.From, options.To, options.TagFile, options.MigrateOptions)
+}
+
+// CheckMigration verifies that the migrated notes have kept their content,
+// without writing anything (see bearnotes.CheckMigration).
+func CheckMigration(ctx context.Context, options MigrateOptions) (*CheckReport, error) {
+	return bearnotes.CheckMigration(ctx, options.From, options.To, options.TagFile, options.MigrateOptions)
+}
+
+// DiscoverOptions holds the settings of a discovery.
+type DiscoverOptions struct {
+	From    string // The Bear notes directory
+	TagFile string // The tag configuration file to generate
+
+	bearnotes.DiscoverOptions
+}
+
+// Discover finds the tags of the notes and generates a tag configuration
+// file (see bearnotes.DiscoverNotes).
+func Discover(ctx context.Context, options DiscoverOptions) error {
+	return bearnotes.DiscoverNotes(ctx, options.From, options.TagFile, options.DiscoverOptions)
+}
+
+// ConvertOptions holds the settings of the conversion of a single note.
+type ConvertOptions struct {
+	// Tags rewrites the tags of the note, when not nil
+	Tags map[string]TagOptions
+}
+
+// Convert converts the content of a Bear note (see bearnotes.ConvertNote).
+func Convert(ctx context.Context, content []byte, options ConvertOptions) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return bearnotes.ConvertNote(content, options.Tags)
+}
+
+// ExtractOptions holds the settings of the extraction of tags.
+type ExtractOptions struct {
+	From  string // The Bear notes directory
+	Parse ParseOptions
+}
+
+// ExtractTags returns the tags of each note (see bearnotes.ExtractTagsFromDir).
+func ExtractTags(ctx context.Context, options ExtractOptions) (map[string][]string, error) {
+	return bearnotes.ExtractTagsFromDir(ctx, options.From, options.Parse)
+}
+
+// DuplicateOptions holds the settings of the search for duplicate notes.
+type DuplicateOptions struct {
+	From string // The Bear notes directory
+
+	// Threshold is the minimum similarity (between 0 and 1) of duplicate
+	// notes (defaults to 1, exact duplicates)
+	Threshold float64
+}
+
+// FindDuplicates returns the clusters of similar notes
+// (see bearnotes.FindDuplicates).
+func FindDuplicates(ctx context.Context, options DuplicateOptions) ([]DuplicateCluster, error) {
+	threshold := options.Threshold
+	if threshold <= 0 {
+		threshold = 1
+	}
+	return bearnotes.FindDuplicates(ctx, options.From, threshold)
+}
+
+// SimilarImageOptions holds the settings of the search for similar images.
+type SimilarImageOptions struct {
+	From string // The directory holding the images
+
+	// MaxDistance is the maximum number of bits differing between the
+	// perceptual hashes of similar images. Unlike the other fields, its zero
+	// value is not the default: 0 only groups images having the same hash
+	// and a negative value stands for bearnotes.DefaultImageDistance.
+	MaxDistance int
+}
+
+// FindSimilarImages returns the clusters of visually identical images
+// (see bearnotes.FindSimilarImages).
+func FindSimilarImages(ctx context.Context, options SimilarImageOptions) ([]ImageCluster, error) {
+	distance := options.MaxDistance
+	if distance < 0 {
+		distance = bearnotes.DefaultImageDistance
+	}
+	return bearnotes.FindSimilarImages(ctx, options.From, distance)
+}
+
+// GraphOptions holds the settings of the graph of notes.
+type GraphOptions struct {
+	From  string // The notes directory
+	Parse ParseOptions
+}
+
+// BuildGraph returns the graph of the links between notes and of their
+// tags (see bearnotes.BuildGraph).
+func BuildGraph(ctx context.Context, options GraphOptions) (*Graph, error) {
+	return bearnotes.BuildGraph(ctx, options.From, options.Parse)
+}
+
+// TransformOptions holds the settings of the rewriting of notes.
+type TransformOptions struct {
+	Dir        string // The notes directory
+	Transforms []Transform
+	NoBackup   bool // Disables the backup (.bak) of the original notes
+}
+
+// TransformNotes applies the transforms to the notes, in place
+// (see bearnotes.TransformNotes).
+func TransformNotes(ctx context.Context, options TransformOptions) (*MigrationReport, error) {
+	return bearnotes.TransformNotes(ctx, options.Dir, options.Transforms, !options.NoBackup)
+}
+
+// ScanOptions holds the settings of the search for leftover Bear syntax.
+type ScanOptions struct {
+	Dir string // The migrated notes directory
+}
+
+// ScanBearisms returns the Bear syntax left in the migrated notes
+// (see bearnotes.ScanBearisms).
+func ScanBearisms(ctx context.Context, options ScanOptions) ([]Bearism, error) {
+	return bearnotes.ScanBearisms(ctx, options.Dir)
+}
+
+// Slugify returns the slug of s, with the default options
+// (see bearnotes.Slugify and SlugOptions).
+func Slugify(s string) string {
+	return bearnotes.Slugify(s)
+}
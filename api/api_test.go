@@ -0,0 +1,74 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testLogger records the messages of a migration.
+type testLogger struct {
+	messages []string
+}
+
+func (logger *testLogger) Printf(format string, args ...interface{}) {
+	logger.messages = append(logger.messages, fmt.Sprintf(format, args...))
+}
+
+// testExporter records the exports of a migration.
+type testExporter struct {
+	exports []string
+}
+
+func (exporter *testExporter) Export(source string, dir string, format string) error {
+	exporter.exports = append(exporter.exports, filepath.Base(source)+" => "+format)
+	return nil
+}
+
+func TestMigrate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bearnotes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	from := filepath.Join(dir, "bear")
+	assert.NoError(t, os.MkdirAll(from, 0755), "source directory must be created")
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(from, "note.md"), []byte("#work\n"), 0644), "note must be written")
+	tagFile := filepath.Join(dir, "tags.yaml")
+	assert.NoError(t, ioutil.WriteFile(tagFile, []byte("work:\n  handling_strategy: same-folder\n  target_directory: work\n  target_tag_name: job\n  export_formats: [docx]\n"), 0644), "tag file must be written")
+
+	var standard bytes.Buffer
+	log.SetOutput(&standard)
+	defer log.SetOutput(os.Stderr)
+
+	var logger testLogger
+	var exporter testExporter
+	options := MigrateOptions{From: from, To: filepath.Join(dir, "zettlr"), TagFile: tagFile}
+	options.Logger = &logger
+	options.Pandoc = true
+	options.Exporter = &exporter
+	report, err := Migrate(context.Background(), options)
+	assert.NoError(t, err, "migration must succeed")
+	assert.Equal(t, 1, report.Successes, "the note must be migrated")
+	assert.Equal(t, []string{"note.md => docx"}, exporter.exports, "notes must be exported with the exporter")
+	assert.Contains(t, strings.Join(logger.messages, "\n"), "Processed 1 notes with 1 successes and 0 failures", "messages must go to the logger")
+	assert.Contains(t, strings.Join(logger.messages, "\n"), "Processing note.md...", "messages of the notes must go to the logger")
+	assert.Empty(t, standard.String(), "the standard logger must be left untouched")
+
+	content, err := Convert(context.Background(), []byte("#work"), ConvertOptions{Tags: map[string]TagOptions{"work": {TargetTagName: "job"}}})
+	assert.NoError(t, err, "conversion must succeed")
+	assert.Equal(t, "#job", content, "tags must be rewritten")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = Convert(ctx, []byte("#work"), ConvertOptions{})
+	assert.Error(t, err, "cancelled conversions must fail")
+}
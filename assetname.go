@@ -0,0 +1,116 @@
+package bearnotes
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DefaultAssetSuffixes holds the noise suffixes that Bear adds to the
+// filenames of images and file attachments: duplicate markers (" (1)")
+// and resolution suffixes ("@2x", "_1024x768").
+var DefaultAssetSuffixes = []string{`[ ]?\(\d+\)`, `@[23]x`, `[-_ ]\d+x\d+`}
+
+// compileAssetSuffixes compiles the suffix patterns (see
+// MigrateOptions.AssetSuffixes), anchored at the end of the filename.
+func compileAssetSuffixes(suffixes []string) ([]*regexp.Regexp, error) {
+	var result []*regexp.Regexp
+	for _, suffix := range suffixes {
+		re, err := regexp.Compile(`(?:` + suffix + `)$`)
+		if err != nil {
+			return nil, fmt.Errorf("asset suffix '%s': %w", suffix, err)
+		}
+		result = append(result, re)
+	}
+	return result, nil
+}
+
+// cleanAssetName strips the suffixes from the filename (without its
+// extension), repeatedly so that "image (1)@2x.png" becomes "image.png".
+// The filename is kept as-is if nothing would be left.
+func cleanAssetName(name string, suffixes []*regexp.Regexp) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for changed := true; changed; {
+		changed = false
+		for _, re := range suffixes {
+			if cleaned := re.ReplaceAllString(base, ""); cleaned != base && cleaned != "" {
+				base, changed = cleaned, true
+			}
+		}
+	}
+	return base + ext
+}
+
+// slugAssetName slugifies the filename (without its extension), the
+// extension being lowercased. The filename is kept as-is if nothing would
+// be left.
+func slugAssetName(name string, options SlugOptions) string {
+	ext := filepath.Ext(name)
+	slug := options.Slugify(strings.TrimSuffix(name, ext))
+	if slug == "" {
+		return name
+	}
+	return slug + strings.ToLower(ext)
+}
+
+// assetNames allocates the filenames of the assets, cleaned if asked to, so
+// that two different assets never end up with the same name in a directory
+// shared by several notes (same-folder strategy, Notable layout, central
+// asset directories). Identical assets share their name.
+type assetNames struct {
+	suffixes []*regexp.Regexp
+	slug     *SlugOptions      // Slugifies the filenames, when not nil
+	sources  map[string]string // destination => source
+}
+
+// newAssetNames creates an empty allocation of cleaned asset names.
+func newAssetNames(suffixes []*regexp.Regexp) *assetNames {
+	return &assetNames{suffixes: suffixes, sources: make(map[string]string)}
+}
+
+// clean returns the cleaned filename of the asset at source, going to dir.
+// The original filename is kept if the cleaned one is already taken by
+// another asset, and numbered (image-2.png) if it is taken as well.
+func (names *assetNames) clean(dir string, fileName string, source string) string {
+	cleaned := fileName
+	if len(names.suffixes) > 0 {
+		cleaned = cleanAssetName(cleaned, names.suffixes)
+	}
+	if names.slug != nil {
+		cleaned = slugAssetName(cleaned, *names.slug)
+	}
+	if names.claim(dir, cleaned, source) {
+		return cleaned
+	}
+	if names.claim(dir, fileName, source) {
+		return fileName
+	}
+	for n := 2; ; n++ {
+		if numbered := numberedName(cleaned, n); names.claim(dir, numbered, source) {
+			return numbered
+		}
+	}
+}
+
+// claim allocates the filename in dir to the asset at source and returns
+// true, unless it is already taken by a different asset.
+func (names *assetNames) claim(dir string, fileName string, source string) bool {
+	destination := filepath.Join(dir, fileName)
+	owner, ok := names.sources[destination]
+	if !ok {
+		// Missing assets, reported when copied, leave the name free.
+		// Remote images are told apart by their URL.
+		if _, err := os.Stat(source); err == nil || isRemote(source) {
+			names.sources[destination] = source
+		}
+		return true
+	}
+	if owner == source {
+		return true
+	}
+	same, err := sameContent(owner, source)
+	return err == nil && same
+}
@@ -0,0 +1,126 @@
+package bearnotes
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// assetIndex maps the normalized basename of the assets (images and file
+// attachments) of the source tree to their paths.
+//
+// Bear sometimes exports the attachment folder of a note under a name that
+// differs from the note filename (truncated, emojis stripped, etc.), so assets
+// cannot always be found where they are expected.
+type assetIndex struct {
+	root  string
+	paths map[string][]string
+}
+
+// assetKey normalizes an asset basename.
+func assetKey(name string) string {
+	return strings.ToLower(norm.NFC.String(name))
+}
+
+// buildAssetIndex walks through recursively the source directory and
+// indexes all the files that are not notes.
+func buildAssetIndex(ctx context.Context, from string) (*assetIndex, error) {
+	index := &assetIndex{root: from, paths: make(map[string][]string)}
+	err := filepath.Walk(from,
+		func(p string, info os.FileInfo, err error) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			// Errors are reported during the migration, not here
+			if err != nil || info.IsDir() || strings.HasSuffix(info.Name(), ".md") {
+				return nil
+			}
+
+			key := assetKey(info.Name())
+			index.paths[key] = append(index.paths[key], p)
+			return nil
+		})
+	for _, paths := range index.paths {
+		sort.Strings(paths)
+	}
+	return index, err
+}
+
+// resolve returns the path of an asset of the note noteName. If the asset
+// does not exist at the expected path (source), it is searched by its
+// basename in the index, among the folders whose name matches the note name.
+// Assets of other notes are never returned.
+func (index *assetIndex) resolve(source string, noteName string) string {
+	if index == nil {
+		return source
+	}
+	if _, err := os.Stat(source); err == nil {
+		return source
+	}
+
+	// Bear may truncate the folder name or strip some characters (emojis),
+	// so the folder and note names are compared once slugified.
+	noteSlug := Slugify(noteName)
+	for _, candidate := range index.paths[assetKey(filepath.Base(source))] {
+		relDir, err := filepath.Rel(index.root, filepath.Dir(candidate))
+		if err != nil {
+			continue
+		}
+		for _, dir := range strings.Split(relDir, string(filepath.Separator)) {
+			dirSlug := Slugify(dir)
+			if dirSlug != "" && (strings.HasPrefix(noteSlug, dirSlug) || strings.HasPrefix(dirSlug, noteSlug)) {
+				return candidate
+			}
+		}
+	}
+
+	return source
+}
+
+// fileChecksum returns the SHA-256 checksum of the file at p.
+func fileChecksum(p string) ([]byte, error) {
+	fd, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	h := sha256.New()
+	_, err = io.Copy(h, fd)
+	if err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// sameContent returns true if the files at a and b have the same content.
+func sameContent(a string, b string) (bool, error) {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	infoB, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	if infoA.Size() != infoB.Size() {
+		return false, nil
+	}
+
+	sumA, err := fileChecksum(a)
+	if err != nil {
+		return false, err
+	}
+	sumB, err := fileChecksum(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(sumA, sumB), nil
+}
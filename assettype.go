@@ -0,0 +1,75 @@
+package bearnotes
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Asset types of the asset directory rules (see MigrateOptions.AssetDirectories)
+const (
+	AssetTypeImage = "image"
+	AssetTypePDF   = "pdf"
+	AssetTypeAudio = "audio"
+	AssetTypeVideo = "video"
+)
+
+// assetTypes maps the extensions of the images and file attachments to
+// their asset type.
+var assetTypes = map[string]string{
+	".png": AssetTypeImage, ".jpg": AssetTypeImage, ".jpeg": AssetTypeImage,
+	".gif": AssetTypeImage, ".webp": AssetTypeImage, ".heic": AssetTypeImage,
+	".heif": AssetTypeImage, ".svg": AssetTypeImage, ".bmp": AssetTypeImage,
+	".tif": AssetTypeImage, ".tiff": AssetTypeImage,
+	".pdf": AssetTypePDF,
+	".mp3": AssetTypeAudio, ".m4a": AssetTypeAudio, ".wav": AssetTypeAudio,
+	".aac": AssetTypeAudio, ".ogg": AssetTypeAudio, ".flac": AssetTypeAudio,
+	".aiff": AssetTypeAudio,
+	".mp4":  AssetTypeVideo, ".mov": AssetTypeVideo, ".m4v": AssetTypeVideo,
+	".avi": AssetTypeVideo, ".mkv": AssetTypeVideo, ".webm": AssetTypeVideo,
+}
+
+// Regular expression to validate the extensions used as asset types
+var reAssetExtension = regexp.MustCompile(`^\.[a-z0-9]+$`)
+
+// checkAssetDirectories returns an error if an asset directory rule is
+// neither for a known asset type nor for an extension (.epub).
+func checkAssetDirectories(directories map[string]string) error {
+	for kind := range directories {
+		switch kind {
+		case AssetTypeImage, AssetTypePDF, AssetTypeAudio, AssetTypeVideo:
+			continue
+		}
+		if !reAssetExtension.MatchString(kind) {
+			return fmt.Errorf("unknown asset type '%s' (available types: %s, %s, %s, %s or an extension such as .epub)", kind, AssetTypeImage, AssetTypePDF, AssetTypeAudio, AssetTypeVideo)
+		}
+	}
+	return nil
+}
+
+// assetDirectory returns the directory of an asset given by the asset
+// directory rules, the rule of its extension taking precedence over the
+// rule of its type. Embedded images having no known extension are images.
+func assetDirectory(directories map[string]string, fileName string, image bool) (string, bool) {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	if dir, ok := directories[ext]; ok {
+		return dir, true
+	}
+	kind, ok := assetTypes[ext]
+	if !ok && image {
+		kind = AssetTypeImage
+	}
+	dir, ok := directories[kind]
+	return dir, ok
+}
+
+// resolveAssetDirectory returns the path of the directory of an asset
+// given by a rule: relative to the root of the destination directory when
+// starting with a slash (/library), to the directory of the note otherwise.
+func resolveAssetDirectory(dir string, noteDir string, root string) string {
+	if strings.HasPrefix(dir, "/") {
+		return filepath.Join(root, filepath.FromSlash(dir))
+	}
+	return filepath.Join(noteDir, filepath.FromSlash(dir))
+}
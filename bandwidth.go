@@ -0,0 +1,108 @@
+package bearnotes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	// defaultProgressThreshold is the size from which the progress of the
+	// copy of an asset is reported (see MigrateOptions.ProgressThreshold)
+	defaultProgressThreshold = 100 * 1024 * 1024
+
+	// progressInterval is the delay between two progress messages of the
+	// copy of an asset
+	progressInterval = 5 * time.Second
+)
+
+// copyThrottle limits the throughput of the copies of the assets (see
+// MigrateOptions.BandwidthLimit) and reports the progress of the copies of
+// the large ones (see MigrateOptions.ProgressThreshold). A nil copyThrottle
+// copies at full speed, silently.
+type copyThrottle struct {
+	limit     int64            // Maximum throughput, in bytes per second (0 means no limit)
+	threshold int64            // Size from which the progress of a copy is reported
+	log       *migrationLogger // Receives the progress of the copies
+}
+
+// newCopyThrottle creates a copyThrottle, returning an error if the
+// bandwidth limit is negative.
+func newCopyThrottle(limit int64, threshold int64) (*copyThrottle, error) {
+	if limit < 0 {
+		return nil, fmt.Errorf("invalid bandwidth limit %d (expected a number of bytes per second)", limit)
+	}
+	if threshold <= 0 {
+		threshold = defaultProgressThreshold
+	}
+	return &copyThrottle{limit: limit, threshold: threshold}, nil
+}
+
+// copy copies the content of the file name (of the given size) from r to w,
+// waiting as needed to stay under the bandwidth limit. Copies of at least
+// threshold bytes are reported every progressInterval.
+func (t *copyThrottle) copy(ctx context.Context, w io.Writer, r io.Reader, name string, size int64) error {
+	if t == nil || (t.limit == 0 && size < t.threshold) {
+		_, err := io.Copy(w, r)
+		return err
+	}
+
+	progress := size >= t.threshold
+	if progress {
+		t.log.Printf("Copying %s (%s)...\n", name, formatSize(size))
+	}
+	buf := make([]byte, 32*1024)
+	started := time.Now()
+	reported := started
+	var written int64
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return err
+			}
+			written += int64(n)
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		// The copy waits until it has taken the time the written bytes
+		// take at the bandwidth limit
+		if t.limit > 0 {
+			expected := time.Duration(float64(written) / float64(t.limit) * float64(time.Second))
+			if wait := expected - time.Since(started); wait > 0 {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(wait):
+				}
+			}
+		}
+		if progress && time.Since(reported) >= progressInterval {
+			t.log.Printf("Copying %s: %s of %s (%d%%)\n", name, formatSize(written), formatSize(size), written*100/size)
+			reported = time.Now()
+		}
+	}
+	if progress {
+		t.log.Printf("Copied %s in %s\n", name, time.Since(started).Round(time.Second))
+	}
+	return nil
+}
+
+// formatSize returns a size in bytes in a human readable form (2.0 GB).
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value, exponent := float64(size)/unit, 0
+	for value >= unit && exponent < 3 {
+		value /= unit
+		exponent++
+	}
+	return fmt.Sprintf("%.1f %cB", value, "KMGT"[exponent])
+}
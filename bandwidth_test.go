@@ -0,0 +1,24 @@
+package bearnotes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatSize(t *testing.T) {
+	for _, testCase := range []struct {
+		size     int64
+		expected string
+	}{
+		{0, "0 B"},
+		{512, "512 B"},
+		{1024, "1.0 KB"},
+		{1536 * 1024, "1.5 MB"},
+		{2 * 1024 * 1024 * 1024, "2.0 GB"},
+		{3 * 1024 * 1024 * 1024 * 1024, "3.0 TB"},
+		{2048 * 1024 * 1024 * 1024 * 1024, "2048.0 TB"},
+	} {
+		assert.Equal(t, testCase.expected, formatSize(testCase.size), "%d bytes must be formatted", testCase.size)
+	}
+}
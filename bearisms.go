@@ -0,0 +1,114 @@
+package bearnotes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Bearism is a piece of Bear-specific syntax left in a migrated note, that
+// the target applications do not understand (see ScanBearisms).
+type Bearism struct {
+	File string // Path of the note
+	Line int    // Line of the note, starting at 1
+	Kind string // Kind of syntax (x-callback link, highlight, etc.)
+	Text string // The Bear syntax, as found in the note
+
+	// Transform is the name of the transform rewriting this kind of
+	// syntax, if any (see LookupTransforms)
+	Transform string
+}
+
+// String returns the location, kind and text of the Bear syntax.
+func (b Bearism) String() string {
+	return fmt.Sprintf("%s:%d: %s: %s", b.File, b.Line, b.Kind, b.Text)
+}
+
+// bearismKind describes a kind of Bear-specific syntax.
+type bearismKind struct {
+	name      string
+	re        *regexp.Regexp
+	transform string
+}
+
+// bearismKinds lists the kinds of Bear-specific syntax looked for by
+// ScanBearisms.
+var bearismKinds = []bearismKind{
+	// Example: [My note](bear://x-callback-url/open-note?id=...)
+	{name: "x-callback link", re: regexp.MustCompile(`bear://x-callback-url/[^\s()<>\]"']*`)},
+	// Example: ::some text::
+	{name: "highlight", re: regexp.MustCompile(`::[^:\n]+::`), transform: "highlights"},
+	// Example: #multi word tag#
+	{name: "multi-word tag", re: regexp.MustCompile(`(?m)(?:^|[ \t])#[\p{L}\p{N}][^#\n]*[ \t][^#\n]*[^ \t#]#(?:[ \t]|$)`), transform: "tag-style"},
+	// Example: <a href='my%20file.pdf'>my file.pdf</a>
+	{name: "HTML attachment", re: regexp.MustCompile(`<a +href=['"][^'"]+['"]>[^<]+</a>`)},
+}
+
+// ScanBearisms walks through recursively a directory of migrated notes and
+// returns the Bear-specific syntax left in the notes (x-callback links,
+// ::highlights::, #multi word tags# and <a href> file attachments), sorted
+// by file and line, to tell whether the transforms of the migration were
+// enough for a given set of notes. Fenced code blocks are left out, as well
+// as hidden directories (.obsidian, .git, etc.) and the directory of the
+// notes that failed to migrate (see DefaultFailedDirectory).
+func ScanBearisms(ctx context.Context, dir string) ([]Bearism, error) {
+	var bearisms []Bearism
+	err := filepath.Walk(dir,
+		func(p string, info os.FileInfo, err error) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil {
+				return err
+			}
+
+			if info.IsDir() {
+				if p != dir && (strings.HasPrefix(info.Name(), ".") || p == filepath.Join(dir, DefaultFailedDirectory)) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !isNoteFile(info.Name(), false) {
+				return nil
+			}
+
+			content, err := ioutil.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			bearisms = append(bearisms, scanBearisms(p, content)...)
+			return nil
+		})
+	return bearisms, err
+}
+
+// scanBearisms returns the Bear-specific syntax of a note, sorted by line.
+func scanBearisms(p string, content []byte) []Bearism {
+	// Code blocks are masked, keeping the line breaks for the line numbers
+	masked := reFencedCode.ReplaceAllFunc(content, func(code []byte) []byte {
+		return bytes.Repeat([]byte("\n"), bytes.Count(code, []byte("\n")))
+	})
+
+	var bearisms []Bearism
+	for _, kind := range bearismKinds {
+		for _, match := range kind.re.FindAllIndex(masked, -1) {
+			bearisms = append(bearisms, Bearism{
+				File:      p,
+				Line:      bytes.Count(masked[:match[0]], []byte("\n")) + 1,
+				Kind:      kind.name,
+				Text:      strings.TrimSpace(string(masked[match[0]:match[1]])),
+				Transform: kind.transform,
+			})
+		}
+	}
+	sort.SliceStable(bearisms, func(i, j int) bool {
+		return bearisms[i].Line < bearisms[j].Line
+	})
+	return bearisms
+}
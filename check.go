@@ -0,0 +1,178 @@
+package bearnotes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Regular expression to detect the Markdown links (text and target)
+var reMarkdownLink = regexp.MustCompile(`\[([^\]\n]*)\]\(([^()\s]*)(?:\s+"[^"\n]*")?\)`)
+
+// Regular expression to detect the words of a note
+var reWord = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// CheckReport summarizes the verification of a migration (see
+// CheckMigration).
+type CheckReport struct {
+	Notes    int     // Number of migrated notes checked
+	Verified int     // Number of migrated notes having the content of the original note
+	Errors   []error // Notes that are missing (ErrReadFailed) or differ (ErrContentMismatch)
+
+	log *migrationLogger // Receives the errors, as they occur
+}
+
+// fail logs and records a note that failed the verification.
+func (report *CheckReport) fail(note string, kind error, err error) {
+	e := &NoteError{Note: note, Kind: kind, Err: err}
+	report.log.Printf("ERROR: %s\n", e)
+	report.Errors = append(report.Errors, e)
+}
+
+// CheckMigration verifies that the notes migrated from the source directory
+// (from) to the destination directory (to) have kept their content, without
+// modifying anything. The migration is planned again with the tag file and
+// options of the migration, to find the migrated notes, and the words of
+// each migrated note are compared to the words of the original note, once
+// converted (HTML notes, see MigrateOptions.ConvertHTML) and transformed.
+// Tags, images, file attachments, links to notes and front matter are
+// rewritten by the migration, so they are left out.
+//
+// Notes whose words differ are reported as *NoteError values of kind
+// ErrContentMismatch, notes that cannot be found as ErrReadFailed.
+func CheckMigration(ctx context.Context, from string, to string, tagFile string, options MigrateOptions) (*CheckReport, error) {
+	if options.InPlace {
+		return nil, fmt.Errorf("notes rewritten in place cannot be checked")
+	}
+	plan, err := PlanMigration(ctx, from, to, tagFile, options)
+	if err != nil {
+		return nil, err
+	}
+	return plan.Check(ctx)
+}
+
+// Check verifies that the notes of the plan, once migrated, have kept their
+// content (see CheckMigration).
+func (plan *Plan) Check(ctx context.Context) (*CheckReport, error) {
+	options := plan.options
+	report := CheckReport{log: options.log}
+	options.log.printf("Checking the migrated notes in %s...\n", plan.To)
+	var buf bytes.Buffer
+	for _, planned := range plan.Notes {
+		if ctx.Err() != nil {
+			return &report, ctx.Err()
+		}
+		report.Notes++
+
+		// HTML notes are compared once converted, as they were migrated
+		source, err := readNoteFile(planned.Source, &buf)
+		if err != nil {
+			report.fail(planned.name, ErrReadFailed, err)
+			continue
+		}
+		migrated, err := ioutil.ReadFile(planned.Destination)
+		if err != nil {
+			report.fail(planned.name, ErrReadFailed, err)
+			continue
+		}
+
+		lost, added := compareWords(checkWords(plan.expectedContent(source), options.Parse), checkWords(migrated, options.Parse))
+		if len(lost) == 0 && len(added) == 0 {
+			report.Verified++
+			continue
+		}
+		var differences []string
+		if len(lost) > 0 {
+			differences = append(differences, fmt.Sprintf("%d words lost (%s)", len(lost), sampleWords(lost)))
+		}
+		if len(added) > 0 {
+			differences = append(differences, fmt.Sprintf("%d words added (%s)", len(added), sampleWords(added)))
+		}
+		report.fail(planned.name, ErrContentMismatch, fmt.Errorf("%s in %s", strings.Join(differences, ", "), planned.Destination))
+	}
+
+	options.log.printf("\n")
+	options.log.printf("Checked %d notes: %d intact, %d missing or differing\n", report.Notes, report.Verified, len(report.Errors))
+	return &report, nil
+}
+
+// expectedContent returns the content of a Bear note, as rewritten by the
+// migration before parsing: encoding repaired, conflicts resolved and
+// transforms applied.
+func (plan *Plan) expectedContent(content []byte) []byte {
+	options := plan.options
+	if check := checkIntegrity(content); check.String() != "" {
+		content = check.repair(content)
+	}
+	content, _ = resolveConflicts(content, options.Conflicts)
+	note := LoadNoteWithOptions(content, options.Parse)
+	plan.renamer.renameTags(note.Tags, options.Parse.CaseSensitiveTags)
+	extra, _ := tagTransforms(note.Tags, plan.tags, options.Parse.CaseSensitiveTags, options.Transforms)
+	return applyTransforms(content, append(append([]Transform(nil), options.Transforms...), extra...))
+}
+
+// checkWords returns the words of a note, lowercased, leaving out what the
+// migration rewrites: front matter, tags, images, file attachments and
+// links to anything but web pages (only their text is kept).
+func checkWords(content []byte, options ParseOptions) []string {
+	content = reFrontMatter.ReplaceAll(content, nil)
+	note := LoadNoteWithOptions(content, options)
+	masked := []byte(string(content))
+	for _, item := range note.items() {
+		for i := item.position[0]; i < item.position[1] && i < len(masked); i++ {
+			masked[i] = ' '
+		}
+	}
+	masked = reWikiLink.ReplaceAll(masked, nil)
+	masked = reMarkdownLink.ReplaceAllFunc(masked, func(match []byte) []byte {
+		parts := reMarkdownLink.FindSubmatch(match)
+		target := strings.ToLower(string(parts[2]))
+		if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") || strings.HasPrefix(target, "mailto:") {
+			return parts[1]
+		}
+		return nil
+	})
+
+	var words []string
+	for _, word := range reWord.FindAll(bytes.ToLower(masked), -1) {
+		words = append(words, string(word))
+	}
+	return words
+}
+
+// compareWords returns the words of expected missing from actual and the
+// words of actual missing from expected, regardless of their order.
+func compareWords(expected []string, actual []string) ([]string, []string) {
+	counts := make(map[string]int)
+	for _, word := range expected {
+		counts[word]++
+	}
+	for _, word := range actual {
+		counts[word]--
+	}
+	var lost, added []string
+	for word, count := range counts {
+		for ; count > 0; count-- {
+			lost = append(lost, word)
+		}
+		for ; count < 0; count++ {
+			added = append(added, word)
+		}
+	}
+	sort.Strings(lost)
+	sort.Strings(added)
+	return lost, added
+}
+
+// sampleWords returns the first words of a list, for the report.
+func sampleWords(words []string) string {
+	const max = 5
+	if len(words) > max {
+		return strings.Join(words[:max], ", ") + ", ..."
+	}
+	return strings.Join(words, ", ")
+}
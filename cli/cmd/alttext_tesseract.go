@@ -0,0 +1,38 @@
+//go:build tesseract
+// +build tesseract
+
+/*
+Copyright © 2020 Nicolas Massé <nicolas.masse@itix.fr>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"github.com/nmasse-itix/bearnotes"
+)
+
+// tesseractAltText recognizes the text of the images with tesseract
+var tesseractAltText bearnotes.TesseractAltText
+
+func init() {
+	altTextProviders["tesseract"] = &tesseractAltText
+	migrateCmd.Flags().StringVar(&tesseractAltText.Command, "tesseract-command", "tesseract", "path of the tesseract command, for --alt-text tesseract")
+	migrateCmd.Flags().StringVar(&tesseractAltText.Language, "tesseract-language", "eng", "language of the text of the images (e.g. eng or fra+eng), for --alt-text tesseract")
+}
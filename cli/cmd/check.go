@@ -0,0 +1,62 @@
+/*
+Copyright © 2020 Nicolas Massé <nicolas.masse@itix.fr>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"log"
+	"os"
+
+	"github.com/nmasse-itix/bearnotes"
+	"github.com/spf13/cobra"
+)
+
+// checkCmd represents the check command
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Checks that the migrated notes have kept their content",
+	Long: `Compares the words of the migrated notes with the words of the original
+notes, leaving out what the migration rewrites (tags, images, file
+attachments, links to notes and front matter), and reports the notes whose
+content has been lost or corrupted. Nothing is modified.
+
+It takes the flags of the migrate command, so that the migrated notes are
+found where the migration put them: run it with the same command line.
+The --from, --to and --tag-file flags are required. HTML notes converted
+with --convert-html are converted again with pandoc to be compared.`,
+	PreRun: applyNamedProfile,
+	Run: func(cmd *cobra.Command, args []string) {
+		from := setupMigration(cmd)
+		// Images are left out of the comparison
+		migrateOptions.AltText = nil
+		report, err := bearnotes.CheckMigration(cmd.Context(), from, toDir, tagFile, migrateOptions)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(report.Errors) > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(checkCmd)
+}
@@ -0,0 +1,58 @@
+/*
+Copyright © 2020 Nicolas Massé <nicolas.masse@itix.fr>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"log"
+
+	"github.com/nmasse-itix/bearnotes"
+	"github.com/spf13/cobra"
+)
+
+var convertTagsInput string
+var convertTagsOutput string
+
+// convertTagsCmd represents the convert-tags command
+var convertTagsCmd = &cobra.Command{
+	Use:   "convert-tags",
+	Short: "Converts a tag file between YAML and CSV",
+	Long: `Converts a tag file between the YAML and CSV formats, based on the
+file extensions (.csv for CSV, anything else for YAML).`,
+	Run: func(cmd *cobra.Command, args []string) {
+		tags, err := bearnotes.LoadTagFile(convertTagsInput)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = bearnotes.SaveTagFile(convertTagsOutput, tags)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	convertTagsCmd.Flags().StringVar(&convertTagsInput, "input", "", "tag file to convert")
+	convertTagsCmd.Flags().StringVar(&convertTagsOutput, "output", "", "converted tag file")
+	convertTagsCmd.MarkFlagRequired("input")
+	convertTagsCmd.MarkFlagRequired("output")
+	rootCmd.AddCommand(convertTagsCmd)
+}
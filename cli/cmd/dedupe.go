@@ -0,0 +1,81 @@
+/*
+Copyright © 2020 Nicolas Massé <nicolas.masse@itix.fr>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/nmasse-itix/bearnotes"
+	"github.com/spf13/cobra"
+)
+
+var duplicateThreshold float64
+var dedupeImages bool
+var imageDistance int
+
+// dedupeCmd represents the dedupe command
+var dedupeCmd = &cobra.Command{
+	Use:   "dedupe",
+	Short: "Finds duplicate notes",
+	Long: `Finds notes having a similar content (sync conflicts, copies, etc.)
+and reports them by groups, from the newest to the oldest.
+
+With --images, finds the images that are visually identical instead
+(screenshots saved under different names, resized copies, etc.).`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if dedupeImages {
+			clusters, err := bearnotes.FindSimilarImages(cmd.Context(), fromDir, imageDistance)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("Found %d groups of visually similar images.\n", len(clusters))
+			for _, cluster := range clusters {
+				fmt.Println("")
+				for _, image := range cluster.Images {
+					fmt.Println(image)
+				}
+			}
+			return
+		}
+		clusters, err := bearnotes.FindDuplicates(cmd.Context(), fromDir, duplicateThreshold)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Found %d groups of duplicate notes.\n", len(clusters))
+		for _, cluster := range clusters {
+			fmt.Println("")
+			for _, note := range cluster.Notes {
+				fmt.Println(note)
+			}
+		}
+	},
+}
+
+func init() {
+	dedupeCmd.Flags().StringVar(&fromDir, "from", "", "directory holding your Bear notes")
+	dedupeCmd.Flags().Float64Var(&duplicateThreshold, "threshold", 1, "minimum similarity (between 0 and 1) of duplicate notes")
+	dedupeCmd.Flags().BoolVar(&dedupeImages, "images", false, "find visually identical images (PNG, JPEG, GIF) instead of duplicate notes")
+	dedupeCmd.Flags().IntVar(&imageDistance, "image-distance", bearnotes.DefaultImageDistance, "maximum number of bits (out of 64) differing between the perceptual hashes of similar images")
+	dedupeCmd.MarkFlagRequired("from")
+	rootCmd.AddCommand(dedupeCmd)
+}
@@ -28,13 +28,23 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// discoverOptions holds the optional settings of the discover command
+var discoverOptions bearnotes.DiscoverOptions
+
 // discoverCmd represents the discover command
 var discoverCmd = &cobra.Command{
-	Use:   "discover",
-	Short: "Discovers your notes to extract tags",
-	Long:  `Parses your notes to extract tags.`,
+	Use:    "discover",
+	Short:  "Discovers your notes to extract tags",
+	Long:   `Parses your notes to extract tags.`,
+	PreRun: applyNamedProfile,
 	Run: func(cmd *cobra.Command, args []string) {
-		err := bearnotes.DiscoverNotes(fromDir, tagFile)
+		applyProfile(cmd)
+		var err error
+		discoverOptions.Transforms, err = bearnotes.LookupTransforms(transformNames)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = bearnotes.DiscoverNotes(cmd.Context(), fromDir, tagFile, discoverOptions)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -42,8 +52,28 @@ var discoverCmd = &cobra.Command{
 }
 
 func init() {
+	addProfileFlag(discoverCmd)
 	discoverCmd.Flags().StringVar(&fromDir, "from", "", "directory holding your Bear notes")
 	discoverCmd.Flags().StringVar(&tagFile, "tag-file", "", "filename for the generated tag file")
+	discoverCmd.Flags().BoolVar(&discoverOptions.Directories.Flatten, "flatten-directories", false, "generate a single directory for nested tags")
+	discoverCmd.Flags().BoolVar(&discoverOptions.Directories.Slugify, "slugify-directories", false, "lowercase directory names and replace special characters with dashes")
+	discoverCmd.Flags().BoolVar(&discoverOptions.Directories.Slug.Transliterate, "slug-transliterate", false, "replace accented letters with ASCII letters and drop emojis in slugified directory names")
+	discoverCmd.Flags().IntVar(&discoverOptions.Directories.Slug.MaxLength, "slug-max-length", 0, "maximum length of slugified directory names (0 means no limit)")
+	discoverCmd.Flags().StringVar(&discoverOptions.Directories.Slug.Separator, "slug-separator", "-", "separator of the words of slugified directory names")
+	discoverCmd.Flags().IntVar(&discoverOptions.Directories.MaxDepth, "max-directory-depth", 0, "maximum number of nested directories (0 means no limit)")
+	discoverCmd.Flags().BoolVar(&discoverOptions.ListNotes, "list-notes", false, "list the notes having each tag")
+	discoverCmd.Flags().StringSliceVar(&discoverOptions.OnlyTags, "tag", nil, "only display this tag (can be repeated)")
+	discoverCmd.Flags().StringVar(&discoverOptions.Parse.TagSection, "tag-section", "", "only parse the tags in the section having this heading (e.g. Tags)")
+	discoverCmd.Flags().BoolVar(&discoverOptions.Parse.NumericTags, "numeric-tags", false, "accept tags starting with a digit (#2023, #1password)")
+	discoverCmd.Flags().BoolVar(&discoverOptions.Parse.CaseSensitiveTags, "case-sensitive-tags", false, "consider tags differing only by case (#Work and #work) as distinct tags")
+	discoverCmd.Flags().StringSliceVar(&discoverOptions.Parse.StopList, "stop-tag", nil, "tag that is noise from prose (e.g. #rt), left untouched (can be repeated)")
+	discoverCmd.Flags().IntVar(&discoverOptions.Parse.MinTagLength, "min-tag-length", 0, "minimum length of the tags, shorter tags are left untouched")
+	discoverCmd.Flags().BoolVar(&discoverOptions.FolderTags, "folder-tags", false, "give the untagged notes a pseudo-tag named after their folder (exports by tag)")
+	discoverCmd.Flags().StringSliceVar(&transformNames, "transform", nil, "transform to apply to the notes before parsing (can be repeated)")
+	discoverCmd.Flags().BoolVar(&discoverOptions.ConvertHTML, "convert-html", false, "convert the notes exported as HTML to Markdown with pandoc")
+	discoverCmd.Flags().BoolVar(&discoverOptions.Spotlight, "spotlight", false, "locate the notes with Spotlight instead of walking through the directory (macOS only)")
+	discoverCmd.Flags().BoolVar(&discoverOptions.Merge, "merge", false, "add the new tags to an existing tag file, keeping its entries and comments")
+	discoverCmd.Flags().Float64Var(&discoverOptions.OneNotePerFolderThreshold, "one-note-per-folder-threshold", 3, "number of images and file attachments per note, on average, from which the one-note-per-folder strategy is suggested for a tag")
 	discoverCmd.MarkFlagRequired("from")
 	discoverCmd.MarkFlagRequired("tag-file")
 	rootCmd.AddCommand(discoverCmd)
@@ -0,0 +1,78 @@
+/*
+Copyright © 2020 Nicolas Massé <nicolas.masse@itix.fr>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"log"
+	"os"
+
+	"github.com/nmasse-itix/bearnotes"
+	"github.com/spf13/cobra"
+)
+
+var graphFormat string
+var graphOutput string
+var graphParseOptions bearnotes.ParseOptions
+
+// graphCmd represents the graph command
+var graphCmd = &cobra.Command{
+	Use:   "graph",
+	Short: "Exports the graph of links and tags",
+	Long: `Exports the graph of the links between notes ([[Note title]]) and of the
+relations between notes and tags, for analysis in Gephi or similar tools.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		graph, err := bearnotes.BuildGraph(cmd.Context(), fromDir, graphParseOptions)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		w := os.Stdout
+		if graphOutput != "" {
+			w, err = os.Create(graphOutput)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer w.Close()
+		}
+		switch graphFormat {
+		case "json":
+			err = graph.WriteJSON(w)
+		case "gexf":
+			err = graph.WriteGEXF(w)
+		default:
+			log.Fatalf("unknown graph format '%s' (available formats: json, gexf)", graphFormat)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	graphCmd.Flags().StringVar(&fromDir, "from", "", "directory holding your notes")
+	graphCmd.Flags().StringVar(&graphFormat, "format", "json", "output format (json or gexf)")
+	graphCmd.Flags().StringVar(&graphOutput, "output", "", "output file (defaults to the standard output)")
+	graphCmd.Flags().StringVar(&graphParseOptions.TagSection, "tag-section", "", "only parse the tags in the section having this heading (e.g. Tags)")
+	graphCmd.Flags().BoolVar(&graphParseOptions.NumericTags, "numeric-tags", false, "accept tags starting with a digit (#2023, #1password)")
+	graphCmd.MarkFlagRequired("from")
+	rootCmd.AddCommand(graphCmd)
+}
@@ -23,30 +23,235 @@ package cmd
 
 import (
 	"log"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/nmasse-itix/bearnotes"
 	"github.com/spf13/cobra"
 )
 
+// migrateOptions holds the optional settings of the migrate command
+var migrateOptions bearnotes.MigrateOptions
+
+// transformNames holds the names of the transforms to apply
+var transformNames []string
+
+// dirMode and fileMode hold the permissions of the created directories and
+// files, in octal
+var dirMode, fileMode string
+
+// parseFilenames, filenamePattern and filenameDateLayout configure the
+// extraction of the metadata embedded in filenames
+var parseFilenames bool
+var filenamePattern, filenameDateLayout string
+
+// cleanAssetNames and assetSuffixes configure the cleaning of the filenames
+// of images and file attachments
+var cleanAssetNames bool
+var assetSuffixes []string
+
+// previewPatterns selects the notes whose rewrite is previewed, instead of
+// migrating them
+var previewPatterns []string
+
+// tagFiles holds the tag files given to --tag-file: the tag file of the
+// migration, followed by the tag files layered on top of it
+var tagFiles []string
+
+// overridesFile holds the adjustments of single notes, reviewed with
+// plan --interactive
+var overridesFile string
+
+// altTextProviders holds the providers of alternative texts available to
+// --alt-text. Other providers are registered by the files built with their
+// build tag.
+var altTextProviders = map[string]bearnotes.AltTextProvider{"none": bearnotes.NoAltText}
+var altTextProvider string
+
+// parseMode parses the octal permissions given to the flag name.
+func parseMode(name string, value string) os.FileMode {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 0777 {
+		log.Fatalf("invalid --%s '%s': expected octal permissions (e.g. 0755)", name, value)
+	}
+	return os.FileMode(mode)
+}
+
+// setupMigration sets the options of the migration from the flags of cmd
+// and returns the source directory.
+func setupMigration(cmd *cobra.Command) string {
+	if toDir == "" && !migrateOptions.InPlace {
+		log.Fatal("required flag \"to\" not set")
+	}
+	// The first tag file is the base, the next ones are layered on top
+	tagFile = tagFiles[0]
+	migrateOptions.TagFileOverrides = tagFiles[1:]
+	// The profile can be stored in the global section of the tag files,
+	// the last one taking precedence
+	for i := len(tagFiles) - 1; i >= 0 && profileName == ""; i-- {
+		if global, err := bearnotes.LoadGlobalOptions(tagFiles[i]); err == nil {
+			profileName = global.Profile
+		}
+	}
+	applyProfile(cmd)
+	var err error
+	migrateOptions.Arguments = os.Args
+	migrateOptions.DirMode = parseMode("dir-mode", dirMode)
+	migrateOptions.FileMode = parseMode("file-mode", fileMode)
+	if parseFilenames {
+		migrateOptions.Filenames, err = bearnotes.NewFilenameParser(filenamePattern, filenameDateLayout)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if cleanAssetNames {
+		migrateOptions.AssetSuffixes = assetSuffixes
+	}
+	migrateOptions.Transforms, err = bearnotes.LookupTransforms(transformNames)
+	if err != nil {
+		log.Fatal(err)
+	}
+	provider, ok := altTextProviders[altTextProvider]
+	if !ok {
+		log.Fatalf("unknown alternative text provider '%s'", altTextProvider)
+	}
+	migrateOptions.AltText = provider
+	if overridesFile != "" {
+		migrateOptions.Overrides, err = bearnotes.LoadOverrides(overridesFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	return fromDir
+}
+
 // migrateCmd represents the migrate command
 var migrateCmd = &cobra.Command{
-	Use:   "migrate",
-	Short: "Migrates your notes from Bear to Zettlr",
-	Long:  `Migrates your notes from Bear to Zettlr`,
+	Use:    "migrate",
+	Short:  "Migrates your notes from Bear to Zettlr",
+	Long:   `Migrates your notes from Bear to Zettlr`,
+	PreRun: applyNamedProfile,
 	Run: func(cmd *cobra.Command, args []string) {
-		err := bearnotes.MigrateNotes(fromDir, toDir, tagFile)
+		from := setupMigration(cmd)
+		stopProfiling := startProfiling(pprofTarget)
+		defer stopProfiling()
+		// Deferred calls are skipped on exit, the profiles are written first
+		fatal := func(v ...interface{}) {
+			stopProfiling()
+			log.Fatal(v...)
+		}
+		if len(previewPatterns) > 0 {
+			plan, err := bearnotes.PlanMigration(cmd.Context(), from, toDir, tagFile, migrateOptions)
+			if err != nil {
+				fatal(err)
+			}
+			matched, err := plan.Preview(os.Stdout, previewPatterns)
+			if err != nil {
+				fatal(err)
+			}
+			if matched == 0 {
+				fatal("no planned note matches the --preview patterns")
+			}
+			return
+		}
+		report, err := bearnotes.MigrateNotes(cmd.Context(), from, toDir, tagFile, migrateOptions)
 		if err != nil {
-			log.Fatal(err)
+			fatal(err)
+		}
+		if len(report.Errors) > 0 {
+			stopProfiling()
+			os.Exit(1)
 		}
 	},
 }
 
 func init() {
+	addProfileFlag(migrateCmd)
 	migrateCmd.Flags().StringVar(&fromDir, "from", "", "directory holding your Bear notes")
-	migrateCmd.Flags().StringVar(&toDir, "to", "", "target directory for your new Zettlr notes")
-	migrateCmd.Flags().StringVar(&tagFile, "tag-file", "", "path to the tag file generated by the 'discover' command")
+	migrateCmd.Flags().StringVar(&toDir, "to", "", "target directory for your new Zettlr notes (required unless --in-place)")
+	migrateCmd.Flags().StringArrayVar(&tagFiles, "tag-file", nil, "path to the tag file generated by the 'discover' command (repeat to layer overrides on top of it, in order)")
+	migrateCmd.Flags().StringVar(&migrateOptions.Parse.TagSection, "tag-section", "", "only parse the tags in the section having this heading (e.g. Tags)")
+	migrateCmd.Flags().BoolVar(&migrateOptions.Parse.NumericTags, "numeric-tags", false, "accept tags starting with a digit (#2023, #1password)")
+	migrateCmd.Flags().BoolVar(&migrateOptions.Parse.CaseSensitiveTags, "case-sensitive-tags", false, "consider tags differing only by case (#Work and #work) as distinct tags")
+	migrateCmd.Flags().StringSliceVar(&migrateOptions.Parse.StopList, "stop-tag", nil, "tag that is noise from prose (e.g. #rt), left untouched (can be repeated)")
+	migrateCmd.Flags().IntVar(&migrateOptions.Parse.MinTagLength, "min-tag-length", 0, "minimum length of the tags, shorter tags are left untouched")
+	migrateCmd.Flags().BoolVar(&migrateOptions.FolderTags, "folder-tags", false, "route the untagged notes as if they had a tag named after their folder (exports by tag)")
+	migrateCmd.Flags().StringSliceVar(&transformNames, "transform", nil, "transform to apply to the notes (can be repeated)")
+	migrateCmd.Flags().StringVar(&altTextProvider, "alt-text", "none", "generate the alternative text of the images having none with this provider: none or tesseract (OCR, when built with -tags tesseract)")
+	migrateCmd.Flags().BoolVar(&migrateOptions.DownloadRemoteImages, "download-remote-images", false, "download the remote images and store them along with the notes")
+	migrateCmd.Flags().DurationVar(&migrateOptions.RemoteImageTimeout, "remote-image-timeout", 30*time.Second, "maximum time allowed to download a remote image")
+	migrateCmd.Flags().Int64Var(&migrateOptions.RemoteImageMaxSize, "remote-image-max-size", 20*1024*1024, "maximum size in bytes of a remote image")
+	migrateCmd.Flags().StringToStringVar(&migrateOptions.Vaults, "vault", nil, "destination directory of a vault, as name=directory (can be repeated)")
+	migrateCmd.Flags().BoolVar(&migrateOptions.InPlace, "in-place", false, "rewrite the notes in the source directory instead of migrating them")
+	migrateCmd.Flags().BoolVar(&migrateOptions.NoBackup, "no-backup", false, "do not keep a backup (.bak) of the original notes in --in-place mode")
+	migrateCmd.Flags().BoolVar(&migrateOptions.SkipDuplicates, "skip-duplicates", false, "migrate only the newest note of each group of duplicate notes")
+	migrateCmd.Flags().Float64Var(&migrateOptions.DuplicateThreshold, "duplicate-threshold", 1, "minimum similarity (between 0 and 1) of duplicate notes")
+	migrateCmd.Flags().BoolVar(&migrateOptions.SimilarImages, "similar-images", false, "report the groups of visually identical images among the migrated images")
+	migrateCmd.Flags().IntVar(&migrateOptions.SimilarImageDistance, "similar-image-distance", bearnotes.DefaultImageDistance, "maximum number of bits (out of 64) differing between the perceptual hashes of similar images")
+	migrateCmd.Flags().BoolVar(&migrateOptions.Pandoc, "pandoc", false, "export the notes with pandoc in the formats listed by their tags")
+	migrateCmd.Flags().StringVar(&migrateOptions.ExportDirectory, "export-dir", "exports", "directory holding the pandoc exports, relative to the target directory")
+	migrateCmd.Flags().StringVar(&migrateOptions.FailedDirectory, "failed-dir", bearnotes.DefaultFailedDirectory, "directory receiving a copy of the notes that could not be migrated along with their errors, relative to the target directory (empty to disable)")
+	migrateCmd.Flags().BoolVar(&migrateOptions.GitCommit, "git-commit", false, "commit the migrated notes in a git repository in the target directory")
+	migrateCmd.Flags().BoolVar(&migrateOptions.SkipPreflight, "skip-preflight", false, "skip the disk space and permission checks")
+	migrateCmd.Flags().StringVar(&migrateOptions.LinkAssets, "link-assets", "copy", "how images and file attachments are transferred: hardlink, clone (copy-on-write) or copy")
+	migrateCmd.Flags().Int64Var(&migrateOptions.BandwidthLimit, "bandwidth-limit", 0, "maximum throughput in bytes per second of the copies of images and file attachments, for destinations on network drives (0 means no limit)")
+	migrateCmd.Flags().Int64Var(&migrateOptions.ProgressThreshold, "progress-threshold", 100*1024*1024, "size in bytes from which the progress of the copy of an image or file attachment is reported")
+	migrateCmd.Flags().StringVar((*string)(&migrateOptions.DefaultHandlingStrategy), "default-handling-strategy", "", "handling strategy of the notes whose tags set none: same-folder, one-note-per-folder or group-by-initial (default: the root of the target directory)")
+	migrateCmd.Flags().StringVar(&migrateOptions.AssetDirectory, "asset-dir", "", "directory receiving the images and file attachments, relative to the directory of each note (default: next to the note)")
+	migrateCmd.Flags().StringToStringVar(&migrateOptions.AssetDirectories, "asset-dir-for", nil, "directory receiving the assets of a type, as type=directory: image, pdf, audio, video or an extension such as .epub (can be repeated, /library is relative to the destination directory)")
+	migrateCmd.Flags().BoolVar(&migrateOptions.SlugifyAssets, "slugify-assets", false, "slugify the filenames of the images and file attachments")
+	migrateCmd.Flags().BoolVar(&migrateOptions.Slug.Transliterate, "slug-transliterate", false, "replace accented letters with ASCII letters and drop emojis in slugified names")
+	migrateCmd.Flags().IntVar(&migrateOptions.Slug.MaxLength, "slug-max-length", 0, "maximum length of slugified names (0 means no limit)")
+	migrateCmd.Flags().StringVar(&migrateOptions.Slug.Separator, "slug-separator", "-", "separator of the words of slugified names")
+	migrateCmd.Flags().StringVar(&migrateOptions.Timezone, "timezone", "", "time zone of the dates written in the notes and their filenames, e.g. UTC or Europe/Paris (default: local time)")
+	migrateCmd.Flags().StringVar(&migrateOptions.UnclassifiedDirectory, "unclassified-dir", "", "directory receiving the notes whose tags are all ignored, relative to the target directory (default: the target directory)")
+	migrateCmd.Flags().StringVar(&migrateOptions.NoteExtension, "note-extension", bearnotes.DefaultNoteExtension, "extension of the migrated notes (e.g. .md, .markdown or .txt)")
+	migrateCmd.Flags().StringVar(&migrateOptions.Layout, "layout", "", "layout of the target directory: notable (notes/ and attachments/ directories, tags in the front matter), hugo (content/ and static/ directories), jekyll (_drafts/ and assets/ directories) or empty to follow the tag file")
+	migrateCmd.Flags().BoolVar(&migrateOptions.InferExtensions, "infer-extensions", false, "append the extension matching their content to the images and file attachments having none")
+	migrateCmd.Flags().BoolVar(&migrateOptions.FinderTags, "finder-tags", false, "apply the tags of the notes as Finder tags on the migrated files (macOS only)")
+	migrateCmd.Flags().StringVar(&migrateOptions.MetricsFile, "metrics-file", "", "write the outcome of the migration to this file in the Prometheus text format (textfile collector)")
+	migrateCmd.Flags().BoolVar(&migrateOptions.RepairEncoding, "repair-encoding", false, "migrate the notes that are not valid UTF-8 text (invalid sequences, null bytes, UTF-16) once repaired")
+	migrateCmd.Flags().StringVar(&overridesFile, "overrides", "", "file holding the adjustments of single notes (skipped notes, target directories)")
+	migrateCmd.Flags().StringSliceVar(&previewPatterns, "preview", nil, "print a unified diff of the rewrite of the notes whose name or path matches this pattern, without migrating anything (can be repeated)")
+	migrateCmd.Flags().StringVar(&migrateOptions.LogFile, "log-file", "", "append a timestamped log of the migration, with the decision trail of every note, to this file (none by default)")
+	migrateCmd.Flags().StringSliceVar(&migrateOptions.Trace, "trace", nil, "print the decision trail of the notes matching this name or glob pattern (can be repeated)")
+	migrateCmd.Flags().StringVar(&migrateOptions.Numbering, "numbering", "", "prefix the notes with a sequence number (sequence) or their creation date (date)")
+	migrateCmd.Flags().BoolVar(&migrateOptions.AllowNested, "allow-nested", false, "allow the target directory to be inside the source directory (or the other way around)")
+	migrateCmd.Flags().BoolVar(&migrateOptions.ConvertHTML, "convert-html", false, "convert the notes exported as HTML to Markdown with pandoc")
+	migrateCmd.Flags().StringVar(&dirMode, "dir-mode", "0755", "permissions of the created directories, in octal (before the umask is applied)")
+	migrateCmd.Flags().StringVar(&fileMode, "file-mode", "0644", "permissions of the created notes and copies of images and file attachments, in octal (before the umask is applied)")
+	migrateCmd.Flags().BoolVar(&migrateOptions.AbortOnPermissionError, "abort-on-permission-error", false, "stop the migration on the first permission error instead of skipping the notes going to the directories that are not writable")
+	migrateCmd.Flags().BoolVar(&parseFilenames, "parse-filenames", false, "extract the title, date and conflict counter embedded in the filenames of the notes")
+	migrateCmd.Flags().StringVar(&filenamePattern, "filename-pattern", bearnotes.DefaultFilenamePattern, "regular expression having title, date and counter named groups, for --parse-filenames")
+	migrateCmd.Flags().StringVar(&filenameDateLayout, "filename-date-layout", bearnotes.DefaultFilenameDateLayout, "layout of the dates embedded in filenames (Go time format), for --parse-filenames")
+	migrateCmd.Flags().IntVar(&migrateOptions.MaxFolders, "max-folders", 1000, "warn when the one-note-per-folder strategy creates more folders in a tag directory (0 means no limit)")
+	migrateCmd.Flags().IntVar(&migrateOptions.MaxFolderDepth, "max-folder-depth", 0, "warn when notes are stored deeper below the target directory (0 means no limit)")
+	migrateCmd.Flags().StringVar(&migrateOptions.Keywords.Field, "keywords-field", "", "front matter field listing the tags of the notes (e.g. tags or keywords)")
+	migrateCmd.Flags().StringVar(&migrateOptions.Keywords.Nesting, "keywords-nesting", "path", "representation of nested tags in the front matter: path (foo/bar), flat (foo-bar) or hierarchy (foo, foo/bar)")
+	migrateCmd.Flags().StringVar(&migrateOptions.Keywords.Delimiter, "keywords-delimiter", "-", "separator of the components of nested tags, with --keywords-nesting flat")
+	migrateCmd.Flags().BoolVar(&migrateOptions.Keywords.Scalar, "keywords-scalar", false, "write the tags in the front matter as a comma-separated string instead of a list")
+	migrateCmd.Flags().StringVar(&migrateOptions.Keywords.Categories, "categories-field", "", "front matter field listing the components of the first nested tag of the notes (e.g. categories)")
+	migrateCmd.Flags().IntVar(&migrateOptions.Retries, "retries", 3, "number of times a write is retried after a transient error (network and cloud drives)")
+	migrateCmd.Flags().DurationVar(&migrateOptions.RetryDelay, "retry-delay", 500*time.Millisecond, "delay before the first retry, doubled for each subsequent retry")
+	migrateCmd.Flags().StringVar(&migrateOptions.Zettlr.Sorting, "zettlr-sorting", "", "write Zettlr settings (.ztr-directory) in the created directories, with this sorting method: name-up, name-down, time-up or time-down")
+	migrateCmd.Flags().BoolVar(&migrateOptions.ObsidianGraph, "obsidian-graph", false, "color the tags in the Obsidian graph view (.obsidian/graph.json) as given by the color of the tags in the tag file")
+	migrateCmd.Flags().BoolVar(&migrateOptions.ObsidianConfig, "obsidian-config", false, "configure the Obsidian vaults (.obsidian/app.json) so that new attachments go to the asset directory and new links are wiki links")
+	migrateCmd.Flags().BoolVar(&migrateOptions.Zettlr.Projects, "zettlr-projects", false, "turn the top-level directories into Zettlr projects, with --zettlr-sorting")
+	migrateCmd.Flags().StringSliceVar(&migrateOptions.Zettlr.ProjectFormats, "zettlr-project-format", nil, "export format of the Zettlr projects (defaults to html and chromium-pdf, can be repeated)")
+	migrateCmd.Flags().BoolVar(&cleanAssetNames, "clean-asset-names", false, "strip the noise suffixes (duplicate markers, resolutions) from the filenames of images and file attachments")
+	migrateCmd.Flags().StringSliceVar(&assetSuffixes, "asset-suffix", bearnotes.DefaultAssetSuffixes, "pattern (regular expression) of a noise suffix, for --clean-asset-names (can be repeated)")
+	migrateCmd.Flags().StringVar(&migrateOptions.Conflicts, "conflicts", "", "side of the conflict markers (<<<<<<< ======= >>>>>>>) to keep: first or second (by default, they are kept as-is and reported)")
+	migrateCmd.Flags().StringVar(&migrateOptions.LinkText, "link-text", "", "handling of the text of file attachment links: check (report texts differing from the filename) or filename (regenerate them)")
+	migrateCmd.Flags().BoolVar(&migrateOptions.HeadingLinks, "heading-links", false, "rewrite the Bear links to the headings of other notes to the [[Note#Heading]] syntax of Zettlr and Obsidian")
+	migrateCmd.Flags().StringVar(&migrateOptions.SourceLink, "source-link", "", "add a link opening the original note in Bear: front-matter (bear_url field) or footer")
+	migrateCmd.Flags().BoolVar(&migrateOptions.StripTagLine, "strip-tag-line", false, "remove the last line of the notes when it holds only tags")
+	migrateCmd.Flags().StringVar(&pprofTarget, "pprof", "", "serve the CPU and memory profiles of the migration on this address (localhost:6060) or write them to this directory (cpu.pprof and heap.pprof)")
 	migrateCmd.MarkFlagRequired("from")
-	migrateCmd.MarkFlagRequired("to")
 	migrateCmd.MarkFlagRequired("tag-file")
 	rootCmd.AddCommand(migrateCmd)
+
+	// The check and plan commands find the notes as the migration does
+	checkCmd.Flags().AddFlagSet(migrateCmd.Flags())
+	planCmd.Flags().AddFlagSet(migrateCmd.Flags())
 }
@@ -0,0 +1,91 @@
+/*
+Copyright © 2020 Nicolas Massé <nicolas.masse@itix.fr>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/nmasse-itix/bearnotes"
+	"github.com/spf13/cobra"
+)
+
+// interactive opens the terminal UI reviewing the plan
+var interactive bool
+
+// planCmd represents the plan command
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Lists the planned destinations of your notes",
+	Long: `Plans the migration, without migrating anything, and lists the
+destination of each note.
+
+It takes the flags of the migrate command: run it with the same command
+line. With --interactive, the planned destinations are reviewed in a
+terminal UI instead, and the adjustments (skipped notes, target
+directories) are saved to the file given by --overrides, to be applied by
+the migrate command.`,
+	PreRun: applyNamedProfile,
+	Run: func(cmd *cobra.Command, args []string) {
+		from := setupMigration(cmd)
+		if !interactive {
+			plan, err := bearnotes.PlanMigration(cmd.Context(), from, toDir, tagFile, migrateOptions)
+			if err != nil {
+				log.Fatal(err)
+			}
+			for _, planned := range plan.Notes {
+				fmt.Printf("%s -> %s\n", plan.RelativePath(planned), planned.Destination)
+			}
+			return
+		}
+
+		if overridesFile == "" {
+			log.Fatal("--interactive requires --overrides")
+		}
+		// The plan is reviewed as given by the tags, so that skipped
+		// notes are listed and overridden directories can be restored
+		planOptions := migrateOptions
+		planOptions.Overrides = nil
+		plan, err := bearnotes.PlanMigration(cmd.Context(), from, toDir, tagFile, planOptions)
+		if err != nil {
+			log.Fatal(err)
+		}
+		saved, err := reviewPlan(plan, migrateOptions.Overrides)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !saved {
+			log.Println("Review abandoned, nothing saved")
+			return
+		}
+		err = bearnotes.SaveOverrides(overridesFile, migrateOptions.Overrides)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Adjustments saved to %s, migrate with --overrides %s to apply them.\n", overridesFile, overridesFile)
+	},
+}
+
+func init() {
+	planCmd.Flags().BoolVar(&interactive, "interactive", false, "review the plan in a terminal UI and save the adjustments to --overrides")
+	rootCmd.AddCommand(planCmd)
+}
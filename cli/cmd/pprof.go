@@ -0,0 +1,96 @@
+/*
+Copyright © 2020 Nicolas Massé <nicolas.masse@itix.fr>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"path/filepath"
+	"runtime"
+	rpprof "runtime/pprof"
+	"strings"
+)
+
+// pprofTarget is the address serving the profiles (localhost:6060) or the
+// directory receiving them (cpu.pprof and heap.pprof)
+var pprofTarget string
+
+// startProfiling serves the profiles of the running process on target, if
+// it is an address (host:port), or starts writing a CPU profile in the
+// target directory. The returned function stops profiling and, for a
+// directory, writes the heap profile.
+func startProfiling(target string) func() {
+	if target == "" {
+		return func() {}
+	}
+
+	if _, _, err := net.SplitHostPort(target); err == nil && !strings.ContainsAny(target, `/\`) {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		listener, err := net.Listen("tcp", target)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Serving the profiles on http://%s/debug/pprof/\n", listener.Addr())
+		go http.Serve(listener, mux)
+		return func() { listener.Close() }
+	}
+
+	err := os.MkdirAll(target, 0755)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cpu, err := os.Create(filepath.Join(target, "cpu.pprof"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = rpprof.StartCPUProfile(cpu)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return func() {
+		rpprof.StopCPUProfile()
+		cpu.Close()
+
+		heap, err := os.Create(filepath.Join(target, "heap.pprof"))
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		defer heap.Close()
+		// The heap profile holds the allocations up to the last garbage collection
+		runtime.GC()
+		err = rpprof.WriteHeapProfile(heap)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		log.Printf("Profiles written to %s (go tool pprof %s)\n", target, filepath.Join(target, "cpu.pprof"))
+	}
+}
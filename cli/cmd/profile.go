@@ -0,0 +1,140 @@
+/*
+Copyright © 2020 Nicolas Massé <nicolas.masse@itix.fr>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/nmasse-itix/bearnotes"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// profileName holds the name of the target application profile or of a
+// named profile of the config file
+var profileName string
+
+// applyNamedProfile sets the flags of cmd that have not been given
+// explicitly to the settings of the named profile of the config file
+// (profiles.<name>), if --profile selects one. Settings are flag names
+// (from, to, tag-file, transform, etc.), those of other commands being
+// ignored. The "profile" setting selects the target application profile.
+func applyNamedProfile(cmd *cobra.Command, args []string) {
+	if profileName == "" || !viper.IsSet("profiles."+profileName) {
+		return
+	}
+	name := profileName
+	profileName = ""
+	for key, value := range viper.GetStringMap("profiles." + name) {
+		if key == "profile" {
+			profileName = fmt.Sprint(value)
+			continue
+		}
+		flag := cmd.Flags().Lookup(key)
+		if flag == nil || flag.Changed {
+			continue
+		}
+		// Flags are set as given on the command line, so that required
+		// flags are satisfied. The items of a list are given one by one, as
+		// repeated flags, so that an item of a string array flag (such as
+		// --tag-file) is never split or joined.
+		values := []string{profileValue(value)}
+		if items, ok := value.([]interface{}); ok {
+			values = make([]string, len(items))
+			for i, item := range items {
+				values[i] = profileValue(item)
+			}
+		}
+		for _, v := range values {
+			if err := cmd.Flags().Set(key, v); err != nil {
+				log.Fatalf("profile '%s': invalid %s: %s", name, key, err)
+			}
+		}
+	}
+}
+
+// profileValue formats the value of a setting of a named profile as a flag
+// value: lists are comma-separated, maps are key=value pairs and paths
+// starting with ~ are expanded.
+func profileValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		if expanded, err := homedir.Expand(v); err == nil {
+			return expanded
+		}
+		return v
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = profileValue(item)
+		}
+		return strings.Join(items, ",")
+	case map[string]interface{}:
+		var pairs []string
+		for key, item := range v {
+			pairs = append(pairs, key+"="+profileValue(item))
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ",")
+	}
+	return fmt.Sprint(value)
+}
+
+// applyProfile sets the flags of cmd that have not been given explicitly
+// to the defaults of the selected profile.
+func applyProfile(cmd *cobra.Command) {
+	if profileName == "" {
+		return
+	}
+	profile, err := bearnotes.LookupProfile(profileName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	defaults := map[string]string{
+		"transform":           strings.Join(profile.Transforms, ","),
+		"flatten-directories": strconv.FormatBool(profile.Directories.Flatten),
+		"slugify-directories": strconv.FormatBool(profile.Directories.Slugify),
+		"max-directory-depth": strconv.Itoa(profile.Directories.MaxDepth),
+		"layout":              profile.Layout,
+	}
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		value, ok := defaults[flag.Name]
+		if !ok || flag.Changed || value == "" {
+			return
+		}
+		if err := flag.Value.Set(value); err != nil {
+			log.Fatal(err)
+		}
+	})
+}
+
+// addProfileFlag adds the --profile flag to cmd.
+func addProfileFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&profileName, "profile", "", "target application ("+strings.Join(bearnotes.ProfileNames(), "|")+") or named profile of the config file, sets the defaults of the other flags")
+}
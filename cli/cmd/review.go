@@ -0,0 +1,87 @@
+/*
+Copyright © 2020 Nicolas Massé <nicolas.masse@itix.fr>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/nmasse-itix/bearnotes"
+)
+
+// arrowKeys maps the final character of the escape sequences sent by the
+// arrow keys (ESC [ A) to the keys of the review.
+var arrowKeys = map[rune]rune{'A': bearnotes.KeyUp, 'B': bearnotes.KeyDown, 'C': bearnotes.KeyRight, 'D': bearnotes.KeyLeft}
+
+// readKey reads a key from in, translating the escape sequences of the
+// arrow keys. A lone Escape is sent as is.
+func readKey(in *bufio.Reader) (rune, error) {
+	key, _, err := in.ReadRune()
+	if err != nil || key != '\x1b' || in.Buffered() < 2 {
+		return key, err
+	}
+	if next, err := in.Peek(1); err != nil || next[0] != '[' {
+		return key, nil
+	}
+	in.ReadRune()
+	final, _, err := in.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	if arrow, ok := arrowKeys[final]; ok {
+		return arrow, nil
+	}
+	return key, nil
+}
+
+// reviewPlan opens the terminal UI reviewing the planned destinations of
+// the notes (see bearnotes.Review). The adjustments of the user are
+// recorded in overrides, which are to be saved if it returns true.
+func reviewPlan(plan *bearnotes.Plan, overrides bearnotes.Overrides) (bool, error) {
+	fd := int(os.Stdin.Fd())
+	restore, err := makeRaw(fd)
+	if err != nil {
+		return false, err
+	}
+	defer restore()
+
+	// The review happens in the alternate screen, without cursor
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\x1b[?1049l")
+
+	review := bearnotes.NewReview(plan, overrides)
+	in := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Print("\x1b[H\x1b[2J" + review.Render(terminalHeight(fd)))
+		key, err := readKey(in)
+		if err != nil {
+			return false, err
+		}
+		switch review.HandleKey(key) {
+		case bearnotes.ReviewSaved:
+			return true, nil
+		case bearnotes.ReviewAbandoned:
+			return false, nil
+		}
+	}
+}
@@ -22,8 +22,11 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"os"
+	"os/signal"
 
 	"github.com/spf13/cobra"
 
@@ -47,12 +50,35 @@ in Zettlr.`,
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	ctx, cancel := signalContext()
+	defer cancel()
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 }
 
+// signalContext returns a context that is cancelled when the user hits Ctrl-C.
+// A second Ctrl-C terminates the program immediately.
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	go func() {
+		select {
+		case <-c:
+			log.Println("Interrupted! Finishing the current note...")
+			cancel()
+		case <-ctx.Done():
+			signal.Stop(c)
+			return
+		}
+		<-c
+		os.Exit(130)
+	}()
+	return ctx, cancel
+}
+
 func init() {
 	cobra.OnInitialize(initConfig)
 
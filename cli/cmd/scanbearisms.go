@@ -0,0 +1,81 @@
+/*
+Copyright © 2020 Nicolas Massé <nicolas.masse@itix.fr>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/nmasse-itix/bearnotes"
+	"github.com/spf13/cobra"
+)
+
+// scanBearismsCmd represents the scan-bearisms command
+var scanBearismsCmd = &cobra.Command{
+	Use:   "scan-bearisms",
+	Short: "Finds the Bear syntax left in migrated notes",
+	Long: `Searches the migrated notes for the Bear syntax that the target
+applications do not understand (x-callback links, ::highlights::,
+#multi word tags# and <a href> file attachments) and reports them by file
+and line, along with the transforms rewriting them, to tell whether the
+transforms of the migration were enough for your notes.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		bearisms, err := bearnotes.ScanBearisms(cmd.Context(), toDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		counts := make(map[string]int)
+		transforms := make(map[string]string)
+		files := make(map[string]bool)
+		for _, bearism := range bearisms {
+			fmt.Println(bearism)
+			counts[bearism.Kind]++
+			transforms[bearism.Kind] = bearism.Transform
+			files[bearism.File] = true
+		}
+
+		fmt.Printf("\nFound %d pieces of Bear syntax in %d notes.\n", len(bearisms), len(files))
+		var kinds []string
+		for kind := range counts {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		for _, kind := range kinds {
+			if transforms[kind] != "" {
+				fmt.Printf("%s: %d (see the %s transform)\n", kind, counts[kind], transforms[kind])
+			} else {
+				fmt.Printf("%s: %d\n", kind, counts[kind])
+			}
+		}
+		if len(bearisms) > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	scanBearismsCmd.Flags().StringVar(&toDir, "to", "", "directory holding the migrated notes")
+	scanBearismsCmd.MarkFlagRequired("to")
+	rootCmd.AddCommand(scanBearismsCmd)
+}
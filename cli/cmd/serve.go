@@ -0,0 +1,77 @@
+/*
+Copyright © 2020 Nicolas Massé <nicolas.masse@itix.fr>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/nmasse-itix/bearnotes"
+	"github.com/spf13/cobra"
+)
+
+var listenAddr string
+
+// serveOptions holds the optional settings of the serve command
+var serveOptions bearnotes.ServerOptions
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Exposes the conversion features over a REST API",
+	Long: `Starts an HTTP server exposing the conversion and discovery features:
+
+  POST /convert   converts the Bear note sent as request body
+  POST /discover  generates the tag file of the zip archive sent as request body`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if tagFile != "" {
+			tags, err := bearnotes.LoadTagFile(tagFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+			serveOptions.Tags = tags
+		}
+
+		server := &http.Server{Addr: listenAddr, Handler: bearnotes.NewServer(serveOptions)}
+		go func() {
+			<-cmd.Context().Done()
+			server.Close()
+		}()
+
+		log.Printf("Listening on %s...\n", listenAddr)
+		err := server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&listenAddr, "listen", "127.0.0.1:8080", "address to listen on")
+	serveCmd.Flags().StringVar(&tagFile, "tag-file", "", "path to the tag file used to rewrite tags (optional)")
+	serveCmd.Flags().StringVar(&serveOptions.Parse.TagSection, "tag-section", "", "only parse the tags in the section having this heading (e.g. Tags)")
+	serveCmd.Flags().BoolVar(&serveOptions.Parse.NumericTags, "numeric-tags", false, "accept tags starting with a digit (#2023, #1password)")
+	serveCmd.Flags().BoolVar(&serveOptions.Parse.CaseSensitiveTags, "case-sensitive-tags", false, "consider tags differing only by case (#Work and #work) as distinct tags")
+	serveCmd.Flags().StringSliceVar(&serveOptions.Parse.StopList, "stop-tag", nil, "tag that is noise from prose (e.g. #rt), left untouched (can be repeated)")
+	serveCmd.Flags().IntVar(&serveOptions.Parse.MinTagLength, "min-tag-length", 0, "minimum length of the tags, shorter tags are left untouched")
+	rootCmd.AddCommand(serveCmd)
+}
@@ -0,0 +1,67 @@
+/*
+Copyright © 2020 Nicolas Massé <nicolas.masse@itix.fr>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/nmasse-itix/bearnotes"
+	"github.com/spf13/cobra"
+)
+
+var transformDir string
+var transformNoBackup bool
+
+// transformCmd represents the transform command
+var transformCmd = &cobra.Command{
+	Use:   "transform",
+	Short: "Applies transforms to a directory of Markdown files",
+	Long: fmt.Sprintf(`Applies transforms to all the Markdown files of a directory, in place,
+without relocating them. Useful to clean up notes migrated with an older version.
+
+Available transforms: %s`, strings.Join(bearnotes.TransformNames(), ", ")),
+	Run: func(cmd *cobra.Command, args []string) {
+		transforms, err := bearnotes.LookupTransforms(transformNames)
+		if err != nil {
+			log.Fatal(err)
+		}
+		report, err := bearnotes.TransformNotes(cmd.Context(), transformDir, transforms, !transformNoBackup)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(report.Errors) > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	transformCmd.Flags().StringVar(&transformDir, "dir", "", "directory holding the Markdown files")
+	transformCmd.Flags().StringSliceVar(&transformNames, "transform", nil, "transform to apply (can be repeated)")
+	transformCmd.Flags().BoolVar(&transformNoBackup, "no-backup", false, "do not keep a backup (.bak) of the original files")
+	transformCmd.MarkFlagRequired("dir")
+	transformCmd.MarkFlagRequired("transform")
+	rootCmd.AddCommand(transformCmd)
+}
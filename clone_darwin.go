@@ -0,0 +1,11 @@
+//go:build darwin
+// +build darwin
+
+package bearnotes
+
+import "golang.org/x/sys/unix"
+
+// cloneFile creates dest as a copy-on-write clone of src (APFS).
+func cloneFile(src string, dest string) error {
+	return unix.Clonefile(src, dest, 0)
+}
@@ -0,0 +1,30 @@
+//go:build linux
+// +build linux
+
+package bearnotes
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// cloneFile creates dest as a copy-on-write clone of src (Btrfs, XFS).
+func cloneFile(src string, dest string) error {
+	source, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	destination, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	err = unix.IoctlFileClone(int(destination.Fd()), int(source.Fd()))
+	destination.Close()
+	if err != nil {
+		os.Remove(dest)
+	}
+	return err
+}
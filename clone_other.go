@@ -0,0 +1,11 @@
+//go:build !darwin && !linux
+// +build !darwin,!linux
+
+package bearnotes
+
+import "errors"
+
+// cloneFile is not supported on this platform.
+func cloneFile(src string, dest string) error {
+	return errors.New("copy-on-write clones are not supported on this platform")
+}
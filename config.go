@@ -1,12 +1,26 @@
 package bearnotes
 
-import "strings"
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
 
 // TagOptions specifies how to convert notes having this tag.
 type TagOptions struct {
 	// count is used in the discover phase to count notes having this tag
 
 	count int `yaml:"-"`
+
+	// reason explains the suggested handling strategy, in the discover
+	// phase, and is written as a comment above the entry of the tag
+	reason string `yaml:"-"`
+
 	// When true, Ignore specifies that this tag is not relevant.
 	// It can be useful when a tag is wrongly identified.
 	Ignore bool `yaml:"ignore"`
@@ -15,8 +29,11 @@ type TagOptions struct {
 	// - same-folder:         all notes having this tag are stored in the TargetDirectory
 	//                        along with their embedded images and file attachments.
 	// - one-note-per-folder: each note will get a sub-folder in the TargetDirectory
+	// - group-by-initial:    notes are bucketed in sub-folders of the TargetDirectory
+	//                        named after their initial (A, B, ..., 0-9 or #)
 	// - "" (empty string):   no handling specified for this tag
-	HandlingStrategy string `yaml:"handling_strategy"`
+	// (see the Strategy constants). Unknown strategies are rejected on load.
+	HandlingStrategy HandlingStrategy `yaml:"handling_strategy"`
 
 	// TargetDirectory specifies where to store notes, along with their images and files
 	TargetDirectory string `yaml:"target_directory"`
@@ -26,6 +43,184 @@ type TagOptions struct {
 	//
 	// If TargetTagName is the empty string, the tag is removed from the note.
 	TargetTagName string `yaml:"target_tag_name"`
+
+	// Vault assigns the notes having this tag to a named vault, stored in
+	// a separate destination directory. If Vault is the empty string, the
+	// notes go to the default destination directory.
+	Vault string `yaml:"vault,omitempty"`
+
+	// ExportFormats lists the pandoc output formats (docx, pdf, latex, etc.)
+	// in which the notes having this tag are additionally exported.
+	ExportFormats []string `yaml:"export_formats,omitempty"`
+
+	// FrontMatter holds extra front matter fields (e.g. type: literature-note)
+	// added to the notes having this tag.
+	FrontMatter map[string]string `yaml:"front_matter,omitempty"`
+
+	// Transforms lists the transforms (see LookupTransforms) applied to the
+	// notes having this tag, on top of the transforms of the migration.
+	Transforms []string `yaml:"transforms,omitempty"`
+
+	// SizeRules override the handling strategy and target directory of the
+	// notes having this tag, based on their size (see SizeRule).
+	SizeRules []SizeRule `yaml:"size_rules,omitempty"`
+
+	// AssetDirectories sends the images and file attachments of the notes
+	// having this tag to a directory depending on their type (see
+	// MigrateOptions.AssetDirectories).
+	AssetDirectories map[string]string `yaml:"asset_directories,omitempty"`
+
+	// Color (#rrggbb) and Icon are presentation hints for the target
+	// applications supporting them: the color of the tag in the Obsidian
+	// graph view (see MigrateOptions.ObsidianGraph) and the icon of the
+	// target directory in Zettlr (see ZettlrOptions).
+	Color string `yaml:"color,omitempty"`
+	Icon  string `yaml:"icon,omitempty"`
+}
+
+// LoadTagFile reads a tag configuration file, as generated by DiscoverNotes.
+// Files having the .csv extension are read in CSV format, other files in YAML.
+func LoadTagFile(tagFile string) (map[string]TagOptions, error) {
+	fileContent, err := ioutil.ReadFile(tagFile)
+	if err != nil {
+		return nil, err
+	}
+	parse := ParseTagFile
+	if isCSV(tagFile) {
+		parse = ParseTagFileCSV
+	}
+	tags, err := parse(fileContent)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", tagFile, err)
+	}
+	return tags, nil
+}
+
+// SaveTagFile writes a tag configuration file. Files having the .csv
+// extension are written in CSV format, other files in YAML.
+func SaveTagFile(tagFile string, tags map[string]TagOptions) error {
+	var fileContent bytes.Buffer
+	if isCSV(tagFile) {
+		err := WriteTagFileCSV(&fileContent, tags)
+		if err != nil {
+			return err
+		}
+	} else {
+		err := WriteTagFile(&fileContent, tags)
+		if err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(tagFile, fileContent.Bytes(), 0644)
+}
+
+// WriteTagFile writes the tag configuration in YAML format, sorted by tag
+// name and grouped by top-level tag (foo, foo/bar, etc.), each group being
+// introduced by a comment, so that the file can be reviewed in an editor.
+// The handling strategies suggested by DiscoverNotes are explained by a
+// comment above the entry of their tag.
+func WriteTagFile(w io.Writer, tags map[string]TagOptions) error {
+	var tagNames []string
+	for tagName := range tags {
+		tagNames = append(tagNames, tagName)
+	}
+	sort.Strings(tagNames)
+
+	group := ""
+	for i, tagName := range tagNames {
+		if prefix := strings.SplitN(tagName, "/", 2)[0]; i == 0 || prefix != group {
+			separator := "\n"
+			if i == 0 {
+				separator = ""
+			}
+			_, err := fmt.Fprintf(w, "%s# %s\n", separator, prefix)
+			if err != nil {
+				return err
+			}
+			group = prefix
+		}
+
+		if reason := tags[tagName].reason; reason != "" {
+			_, err := fmt.Fprintf(w, "# %s\n", reason)
+			if err != nil {
+				return err
+			}
+		}
+		content, err := yaml.Marshal(map[string]TagOptions{tagName: tags[tagName]})
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(content)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// settingsEntry is the entry of a YAML tag file holding the settings of the
+// migration (global, rename_rules and title_rules) instead of the options
+// of a tag. Tag names start with a letter, so no tag can be named after it.
+const settingsEntry = "_settings"
+
+// reservedEntries lists the entries of a tag file that no tag can be named
+// after: the settings of the migration and the defaults entry.
+var reservedEntries = map[string]bool{settingsEntry: true, DefaultsTagName: true}
+
+// ParseTagFile parses the content of a tag configuration file.
+// The settings of the migration, if any, are left out (see
+// LoadGlobalOptions, LoadRenameRules and LoadTitleRules).
+func ParseTagFile(fileContent []byte) (map[string]TagOptions, error) {
+	var entries map[string]yaml.Node
+	err := yaml.Unmarshal(fileContent, &entries)
+	if err != nil {
+		return nil, err
+	}
+	var tags map[string]TagOptions = make(map[string]TagOptions)
+	for tagName, node := range entries {
+		if tagName == settingsEntry {
+			continue
+		}
+		var tagOption TagOptions
+		err = node.Decode(&tagOption)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", tagName, err)
+		}
+		tags[tagName] = tagOption
+	}
+	return tags, nil
+}
+
+// loadSettingsEntry decodes an entry of the settings of a YAML tag file (see
+// settingsEntry) into value, which is left untouched if there is no such
+// entry. Tag files in CSV format have no settings.
+func loadSettingsEntry(tagFile string, entry string, value interface{}) error {
+	if isCSV(tagFile) {
+		return nil
+	}
+	fileContent, err := ioutil.ReadFile(tagFile)
+	if err != nil {
+		return err
+	}
+	var entries map[string]yaml.Node
+	err = yaml.Unmarshal(fileContent, &entries)
+	if err != nil {
+		return fmt.Errorf("%s: %w", tagFile, err)
+	}
+	var settings map[string]yaml.Node
+	if node, ok := entries[settingsEntry]; ok {
+		err = node.Decode(&settings)
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", tagFile, settingsEntry, err)
+		}
+	}
+	if node, ok := settings[entry]; ok {
+		err = node.Decode(value)
+		if err != nil {
+			return fmt.Errorf("%s: %s.%s: %w", tagFile, settingsEntry, entry, err)
+		}
+	}
+	return nil
 }
 
 // NewTagOptions initializes a new TagOptions from a Tag object, with sane defaults
@@ -33,5 +228,144 @@ type TagOptions struct {
 func NewTagOptions(tag Tag) TagOptions {
 	tagComponents := strings.Split(tag.Name, "/")
 	lastComponent := tagComponents[len(tagComponents)-1]
-	return TagOptions{count: 1, HandlingStrategy: "same-folder", TargetDirectory: tag.Name, TargetTagName: lastComponent}
+	return TagOptions{count: 1, HandlingStrategy: StrategySameFolder, TargetDirectory: tag.Name, TargetTagName: lastComponent}
+}
+
+// DirectoryOptions specifies how the default target directory of a tag is
+// generated from its name.
+type DirectoryOptions struct {
+	// Flatten generates a single directory for nested tags (foo/bar => foo-bar)
+	Flatten bool
+
+	// Slugify lowercases directory names and replaces any character that is
+	// not a letter or a number (punctuation, emojis, etc.) with a dash
+	Slugify bool
+
+	// Slug specifies how directory names are slugified (see SlugOptions)
+	Slug SlugOptions
+
+	// MaxDepth limits the number of nested directories (0 means no limit)
+	MaxDepth int
+}
+
+// DefaultTargetDirectory computes the default target directory for a tag.
+func DefaultTargetDirectory(tagName string, options DirectoryOptions) string {
+	components := strings.Split(tagName, "/")
+	if options.MaxDepth > 0 && len(components) > options.MaxDepth {
+		components = components[:options.MaxDepth]
+	}
+
+	if options.Slugify {
+		var slugs []string
+		for _, component := range components {
+			slug := options.Slug.Slugify(component)
+			if slug != "" {
+				slugs = append(slugs, slug)
+			}
+		}
+		components = slugs
+	}
+
+	if options.Flatten {
+		return strings.Join(components, "-")
+	}
+	return strings.Join(components, "/")
+}
+
+// DefaultsTagName is the name of the tag file entry applied to the tags
+// that have no entry of their own. Tag names start with a letter or a
+// digit, so no tag can be named after it.
+const DefaultsTagName = "_defaults"
+
+// lookupTagOptions returns the options of a tag from the tag configuration:
+// the entry of the tag itself, or else the most specific wildcard entry
+// matching its name (work/*), or else the defaults entry (unless
+// useDefaults is false).
+//
+// Since wildcard and defaults entries are shared by many tags, an empty
+// TargetTagName keeps the last component of the tag instead of removing it,
+// and an empty TargetDirectory is derived from the full name of the tag
+// when there is a handling strategy, so that the notes of different tags
+// (work/a/x and home/b/x) do not end up in the same directory.
+func lookupTagOptions(tags map[string]TagOptions, tagName string, useDefaults bool) (TagOptions, bool) {
+	_, tagOption, ok := lookupTagEntry(tags, tagName, useDefaults)
+	return tagOption, ok
+}
+
+// lookupTagEntry is like lookupTagOptions but also returns the name of the
+// matching entry of the tag configuration (the tag itself, a wildcard
+// pattern or DefaultsTagName).
+func lookupTagEntry(tags map[string]TagOptions, tagName string, useDefaults bool) (string, TagOptions, bool) {
+	if tagOption, ok := tags[tagName]; ok {
+		return tagName, tagOption, true
+	}
+
+	pattern := ""
+	for candidate := range tags {
+		if !strings.Contains(candidate, "*") || !matchWildcard(candidate, tagName) {
+			continue
+		}
+		// The longest pattern is the most specific
+		if len(candidate) > len(pattern) || len(candidate) == len(pattern) && candidate < pattern {
+			pattern = candidate
+		}
+	}
+
+	tagOption, ok := tags[pattern]
+	if pattern == "" {
+		if !useDefaults {
+			return "", TagOptions{}, false
+		}
+		pattern = DefaultsTagName
+		tagOption, ok = tags[DefaultsTagName]
+		if !ok {
+			return "", TagOptions{}, false
+		}
+	}
+	if tagOption.TargetTagName == "" {
+		tagComponents := strings.Split(tagName, "/")
+		tagOption.TargetTagName = tagComponents[len(tagComponents)-1]
+	}
+	if tagOption.TargetDirectory == "" && tagOption.HandlingStrategy != StrategyNone {
+		tagOption.TargetDirectory = DefaultTargetDirectory(tagName, DirectoryOptions{})
+	}
+	return pattern, tagOption, ok
+}
+
+// unusedTagEntries returns the entries of the tag configuration that are
+// not in used, along with the target directories that are not in
+// usedDirectories, both sorted.
+func unusedTagEntries(tags map[string]TagOptions, used map[string]bool, usedDirectories map[string]bool) ([]string, []string) {
+	var entries, directories []string
+	for tagName, tagOption := range tags {
+		if !used[tagName] {
+			entries = append(entries, tagName)
+		}
+		if tagOption.TargetDirectory != "" && !usedDirectories[tagOption.TargetDirectory] && !containsString(directories, tagOption.TargetDirectory) {
+			directories = append(directories, tagOption.TargetDirectory)
+		}
+	}
+	sort.Strings(entries)
+	sort.Strings(directories)
+	return entries, directories
+}
+
+// matchWildcard returns true if name matches pattern, in which each '*'
+// matches any sequence of characters, including slashes (work/* matches
+// work/meetings as well as work/meetings/2020).
+func matchWildcard(pattern, name string) bool {
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(name, parts[0]) {
+		return false
+	}
+	name = name[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(name, part)
+		if i < 0 {
+			return false
+		}
+		name = name[i+len(part):]
+	}
+	return len(parts) > 1 && strings.HasSuffix(name, last)
 }
@@ -0,0 +1,339 @@
+package bearnotes
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultTargetDirectory(t *testing.T) {
+	testCases := []struct {
+		options  DirectoryOptions
+		expected string
+	}{
+		{DirectoryOptions{}, "Work/100% Projets/🚀 Alpha"},
+		{DirectoryOptions{Flatten: true}, "Work-100% Projets-🚀 Alpha"},
+		{DirectoryOptions{Slugify: true}, "work/100-projets/alpha"},
+		{DirectoryOptions{MaxDepth: 2}, "Work/100% Projets"},
+		{DirectoryOptions{Flatten: true, Slugify: true, MaxDepth: 2}, "work-100-projets"},
+		{DirectoryOptions{Slugify: true, Slug: SlugOptions{Separator: "_"}}, "work/100_projets/alpha"},
+	}
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expected, DefaultTargetDirectory("Work/100% Projets/🚀 Alpha", testCase.options), "directory must be equal")
+	}
+}
+
+func TestSlugify(t *testing.T) {
+	testCases := []struct {
+		options  SlugOptions
+		input    string
+		expected string
+	}{
+		{SlugOptions{}, "Été à Paris 🚀 2020!", "été-à-paris-2020"},
+		{SlugOptions{Transliterate: true}, "Été à Paris 🚀 2020!", "ete-a-paris-2020"},
+		{SlugOptions{Transliterate: true}, "Straße Œuvre", "strasse-oeuvre"},
+		{SlugOptions{Separator: "_"}, "My  Nice -- Title", "my_nice_title"},
+		{SlugOptions{MaxLength: 10}, "a very long title", "a-very"},
+		{SlugOptions{MaxLength: 6}, "a very long title", "a-very"},
+		{SlugOptions{MaxLength: 3}, "incredible", "inc"},
+		{SlugOptions{Transliterate: true}, "日本語", ""},
+	}
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expected, testCase.options.Slugify(testCase.input), "slug of '%s' must be equal", testCase.input)
+	}
+	assert.Equal(t, "hello-world", Slugify("Hello, World!"), "default slugs use dashes")
+	assert.Equal(t, "ete-2020.png", slugAssetName("Été 2020.PNG", SlugOptions{Transliterate: true}), "asset extensions must be kept")
+}
+
+func TestTagFileCSV(t *testing.T) {
+	tags := map[string]TagOptions{
+		"foo/bar": {HandlingStrategy: "same-folder", TargetDirectory: "foo/bar", TargetTagName: "bar"},
+		"reports": {HandlingStrategy: "one-note-per-folder", TargetDirectory: "Reports, 2020", TargetTagName: "reports", ExportFormats: []string{"docx", "pdf"}, FrontMatter: map[string]string{"type": "report", "status": "final"}, Transforms: []string{"strip-html", "tasks"}, Color: "#e04040", Icon: "book"},
+		"trap":    {Ignore: true},
+	}
+
+	var csv bytes.Buffer
+	assert.NoError(t, WriteTagFileCSV(&csv, tags), "CSV must be written")
+	assert.Equal(t, `tag,ignore,handling_strategy,target_directory,target_tag_name,vault,export_formats,front_matter,transforms,color,icon
+foo/bar,false,same-folder,foo/bar,bar,,,,,,
+reports,false,one-note-per-folder,"Reports, 2020",reports,,docx;pdf,status=final;type=report,strip-html;tasks,#e04040,book
+trap,true,,,,,,,,,
+`, csv.String(), "CSV must be sorted by tag name")
+
+	parsed, err := ParseTagFileCSV(csv.Bytes())
+	assert.NoError(t, err, "CSV must be parsed")
+	assert.Equal(t, tags, parsed, "tags must survive a round-trip")
+
+	parsed, err = ParseTagFileCSV([]byte("target_directory,tag\nfoo,foo/bar\n"))
+	assert.NoError(t, err, "CSV with missing columns must be parsed")
+	assert.Equal(t, "foo", parsed["foo/bar"].TargetDirectory, "columns must be identified by the header")
+}
+
+func TestLookupTagOptions(t *testing.T) {
+	tags, err := ParseTagFile([]byte(`
+work/*:
+  target_directory: Work
+work/clients/*:
+  target_directory: Clients
+  target_tag_name: client
+work/secret:
+  ignore: true
+home/*:
+  handling_strategy: same-folder
+_defaults:
+  handling_strategy: same-folder
+  target_directory: Misc
+defaults:
+  target_tag_name: defaults
+`))
+	assert.NoError(t, err, "tag file must be parsed")
+
+	testCases := []struct {
+		tag      string
+		expected TagOptions
+	}{
+		{"work/secret", TagOptions{Ignore: true}},
+		{"work/meetings", TagOptions{TargetDirectory: "Work", TargetTagName: "meetings"}},
+		{"work/meetings/2020", TagOptions{TargetDirectory: "Work", TargetTagName: "2020"}},
+		{"work/clients/acme", TagOptions{TargetDirectory: "Clients", TargetTagName: "client"}},
+		{"personal", TagOptions{HandlingStrategy: "same-folder", TargetDirectory: "Misc", TargetTagName: "personal"}},
+		{"home/b/x", TagOptions{HandlingStrategy: "same-folder", TargetDirectory: "home/b/x", TargetTagName: "x"}},
+		{"defaults", TagOptions{TargetTagName: "defaults"}},
+	}
+	for _, testCase := range testCases {
+		tagOption, ok := lookupTagOptions(tags, testCase.tag, true)
+		assert.True(t, ok, "tag %s must be found", testCase.tag)
+		assert.Equal(t, testCase.expected, tagOption, "options of tag %s must be equal", testCase.tag)
+	}
+
+	_, ok := lookupTagOptions(tags, "personal", false)
+	assert.False(t, ok, "defaults must not apply when disabled")
+	_, ok = lookupTagOptions(tags, "workshop", true)
+	assert.True(t, ok, "work/* must not match workshop but defaults must")
+	assert.False(t, matchWildcard("work/*", "workshop"), "work/* must not match workshop")
+	assert.True(t, matchWildcard("*/2020", "work/meetings/2020"), "wildcards must match slashes")
+}
+
+func TestWriteTagFile(t *testing.T) {
+	tags := map[string]TagOptions{
+		"work/meetings": {TargetDirectory: "work/meetings", TargetTagName: "meetings"},
+		"trap":          {Ignore: true},
+		"work":          {TargetDirectory: "work", TargetTagName: "work"},
+	}
+
+	var yaml bytes.Buffer
+	assert.NoError(t, WriteTagFile(&yaml, tags), "YAML must be written")
+	assert.Equal(t, `# trap
+trap:
+    ignore: true
+    handling_strategy: ""
+    target_directory: ""
+    target_tag_name: ""
+
+# work
+work:
+    ignore: false
+    handling_strategy: ""
+    target_directory: work
+    target_tag_name: work
+work/meetings:
+    ignore: false
+    handling_strategy: ""
+    target_directory: work/meetings
+    target_tag_name: meetings
+`, yaml.String(), "YAML must be sorted and grouped by top-level tag")
+
+	parsed, err := ParseTagFile(yaml.Bytes())
+	assert.NoError(t, err, "YAML must be parsed")
+	assert.Equal(t, tags, parsed, "tags must survive a round-trip")
+}
+
+func TestHandlingStrategy(t *testing.T) {
+	tags, err := ParseTagFile([]byte("foo:\n  handling_strategy: group-by-initial\nbar:\n  handling_strategy: \"\"\n"))
+	assert.NoError(t, err, "known strategies must be parsed")
+	assert.Equal(t, StrategyGroupByInitial, tags["foo"].HandlingStrategy, "strategy must be parsed")
+	assert.Equal(t, StrategyNone, tags["bar"].HandlingStrategy, "empty strategy must be parsed")
+
+	_, err = ParseTagFile([]byte("foo:\n  handling_strategy: same-folders\n"))
+	assert.Error(t, err, "unknown strategies must be rejected on load")
+	_, err = ParseTagFileCSV([]byte("tag,handling_strategy\nfoo,same-folders\n"))
+	assert.Error(t, err, "unknown strategies must be rejected on load (CSV)")
+
+	strategy, err := ParseHandlingStrategy("one-note-per-folder")
+	assert.NoError(t, err, "known strategies must be parsed")
+	assert.Equal(t, StrategyOneNotePerFolder, strategy, "strategy must be parsed")
+	_, err = ParseHandlingStrategy("unknown")
+	assert.EqualError(t, err, "unknown handling strategy 'unknown' (available strategies: same-folder, one-note-per-folder, group-by-initial)")
+}
+
+func TestMergeTagFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bearnotes")
+	assert.NoError(t, err, "temporary directory must be created")
+	defer os.RemoveAll(dir)
+
+	tagFile := filepath.Join(dir, "tags.yaml")
+	assert.NoError(t, ioutil.WriteFile(tagFile, []byte(`# My projects
+work:
+    target_directory: Projects # moved on 2020-01-01
+    target_tag_name: work
+archive/*:
+    ignore: true
+`), 0644), "tag file must be written")
+
+	tags := map[string]TagOptions{
+		"work":         {TargetDirectory: "work", TargetTagName: "work"},
+		"archive/2019": {TargetDirectory: "archive/2019", TargetTagName: "2019"},
+		"home":         {TargetDirectory: "home", TargetTagName: "home"},
+	}
+	added, err := MergeTagFile(tagFile, tags)
+	assert.NoError(t, err, "tag file must be merged")
+	assert.Equal(t, 1, added, "only new tags must be added")
+
+	content, _ := ioutil.ReadFile(tagFile)
+	assert.Equal(t, `# My projects
+work:
+    target_directory: Projects # moved on 2020-01-01
+    target_tag_name: work
+archive/*:
+    ignore: true
+# New tags
+home:
+    ignore: false
+    handling_strategy: ""
+    target_directory: home
+    target_tag_name: home
+`, string(content), "comments and existing entries must be preserved")
+
+	added, err = MergeTagFile(tagFile, tags)
+	assert.NoError(t, err, "tag file must be merged")
+	assert.Equal(t, 0, added, "tags must not be added twice")
+}
+
+func TestLoadGlobalOptions(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"tags.yaml": "_settings:\n  global:\n    profile: obsidian\n    handling_strategy: same-folder\n    asset_directory: assets\n    keywords_field: tags\nwork:\n  target_tag_name: work\n",
+	})
+	defer os.RemoveAll(dir)
+
+	global, err := LoadGlobalOptions(filepath.Join(dir, "tags.yaml"))
+	assert.NoError(t, err, "global options must be read")
+	assert.Equal(t, GlobalOptions{Profile: "obsidian", HandlingStrategy: "same-folder", AssetDirectory: "assets", KeywordsField: "tags"}, global, "global options must be parsed")
+	tags, err := LoadTagFile(filepath.Join(dir, "tags.yaml"))
+	assert.NoError(t, err, "tag file must be read")
+	assert.Equal(t, map[string]TagOptions{"work": {TargetTagName: "work"}}, tags, "the global section is not a tag")
+
+	options := MigrateOptions{Keywords: KeywordOptions{Field: "keywords"}}
+	global.apply(&options)
+	assert.Equal(t, "keywords", options.Keywords.Field, "options take precedence over the global section")
+	assert.Equal(t, "assets", options.AssetDirectory, "global options must apply")
+}
+
+func TestSettingsEntry(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"tags.yaml":   "_settings:\n  global:\n    timezone: UTC\nwork:\n  target_tag_name: work\n",
+		"global.yaml": "global:\n  handling_strategy: one-note-per-folder\n  target_directory: Global\n",
+		"rules.yaml":  "rename_rules:\n  - pattern: ^todo$\n    replacement: tasks\n",
+	})
+	defer os.RemoveAll(dir)
+
+	// A #global tag is merged as any other tag, next to the settings
+	tagFile := filepath.Join(dir, "tags.yaml")
+	added, err := MergeTagFile(tagFile, map[string]TagOptions{"global": {TargetDirectory: "global", TargetTagName: "global"}, settingsEntry: {}})
+	assert.NoError(t, err, "tag file must be merged")
+	assert.Equal(t, 1, added, "reserved names must not be added")
+	tags, err := LoadTagFile(tagFile)
+	assert.NoError(t, err, "merged tag file must be readable")
+	assert.Equal(t, map[string]TagOptions{"work": {TargetTagName: "work"}, "global": {TargetDirectory: "global", TargetTagName: "global"}}, tags, "the #global tag must be an entry")
+	global, err := LoadGlobalOptions(tagFile)
+	assert.NoError(t, err, "global options must be readable")
+	assert.Equal(t, "UTC", global.Timezone, "settings must be kept apart from the #global tag")
+
+	// Entries named after a setting configure the tag of that name
+	globalTag := filepath.Join(dir, "global.yaml")
+	tags, err = LoadTagFile(globalTag)
+	assert.NoError(t, err, "tag file must be readable")
+	assert.Equal(t, StrategyOneNotePerFolder, tags["global"].HandlingStrategy, "the global entry must configure the #global tag")
+	global, _ = LoadGlobalOptions(globalTag)
+	assert.Equal(t, StrategyNone, global.HandlingStrategy, "the global entry must not hold settings")
+
+	_, err = LoadTagFile(filepath.Join(dir, "rules.yaml"))
+	assert.Error(t, err, "rules outside of the settings must be rejected")
+
+	_, err = ParseTagFileCSV([]byte("tag,target_directory\n_settings,foo\n"))
+	assert.Error(t, err, "reserved names must be rejected in CSV")
+}
+
+func TestLoadRenameRules(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"tags.yaml":  "_settings:\n  rename_rules:\n    - pattern: ^people/(.*)$\n      replacement: contacts/$1\n    - pattern: ^todo$\n      replacement: tasks\ncontacts/*:\n  target_directory: Contacts\n",
+		"bad.yaml":   "_settings:\n  rename_rules:\n    - pattern: ^people/(.*$\n      replacement: contacts/$1\n",
+		"empty.yaml": "_settings:\n  rename_rules:\n    - replacement: contacts\n",
+	})
+	defer os.RemoveAll(dir)
+
+	rules, err := LoadRenameRules(filepath.Join(dir, "tags.yaml"))
+	assert.NoError(t, err, "rename rules must be read")
+	assert.Equal(t, []RenameRule{{Pattern: "^people/(.*)$", Replacement: "contacts/$1"}, {Pattern: "^todo$", Replacement: "tasks"}}, rules, "rename rules must be parsed")
+	tags, err := LoadTagFile(filepath.Join(dir, "tags.yaml"))
+	assert.NoError(t, err, "tag file must be read")
+	assert.Equal(t, map[string]TagOptions{"contacts/*": {TargetDirectory: "Contacts"}}, tags, "the rename rules are not a tag")
+
+	renamer, err := newTagRenamer(rules)
+	assert.NoError(t, err, "rename rules must compile")
+	for tagName, expected := range map[string]string{
+		"people/john": "contacts/john",
+		"people/a/b":  "contacts/a/b",
+		"todo":        "tasks",
+		"todo/later":  "todo/later",
+		"work":        "work",
+	} {
+		name, _ := renamer.rename(tagName)
+		assert.Equal(t, expected, name, "tag %s must be renamed by the first matching rule", tagName)
+	}
+
+	for _, file := range []string{"bad.yaml", "empty.yaml"} {
+		rules, err = LoadRenameRules(filepath.Join(dir, file))
+		assert.NoError(t, err, "rename rules must be read")
+		_, err = newTagRenamer(rules)
+		assert.Error(t, err, "invalid rename rules must be rejected (%s)", file)
+	}
+}
+
+func TestLoadTagFiles(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"base.yaml":     "_settings:\n  global:\n    asset_directory: assets\n    timezone: UTC\n  rename_rules:\n    - pattern: ^todo$\n      replacement: tasks\nwork:\n  target_directory: Work\nhome:\n  target_directory: Home\n",
+		"personal.yaml": "_settings:\n  global:\n    timezone: Europe/Paris\n  rename_rules:\n    - pattern: ^todo$\n      replacement: later\n\nwork:\n  target_directory: Job\nhome:\n  target_directory: Home\n",
+		"extra.csv":     "tag,target_directory\nreading,Books\nwork,Office\n",
+	})
+	defer os.RemoveAll(dir)
+	base, personal, extra := filepath.Join(dir, "base.yaml"), filepath.Join(dir, "personal.yaml"), filepath.Join(dir, "extra.csv")
+
+	var messages bytes.Buffer
+	log.SetOutput(&messages)
+	defer log.SetOutput(os.Stderr)
+	tags, err := LoadTagFiles([]string{base, personal, extra})
+	assert.NoError(t, err, "tag files must be read")
+	assert.Equal(t, map[string]TagOptions{
+		"work":    {TargetDirectory: "Office"},
+		"home":    {TargetDirectory: "Home"},
+		"reading": {TargetDirectory: "Books"},
+	}, tags, "entries must be replaced by the following tag files")
+	assert.Contains(t, messages.String(), personal+":8: tag file override: entry 'work' overrides the entry of "+base+":8", "conflicts must be reported with their file and line")
+	assert.Contains(t, messages.String(), extra+":3: tag file override: entry 'work' overrides the entry of "+personal+":8", "conflicts must be reported with their file and line")
+	assert.NotContains(t, messages.String(), "'home'", "identical entries are no conflict")
+
+	var options MigrateOptions
+	rules, _, err := loadLayeredSettings([]string{base, personal, extra}, &options)
+	assert.NoError(t, err, "settings must be read")
+	assert.Equal(t, []RenameRule{{Pattern: "^todo$", Replacement: "later"}, {Pattern: "^todo$", Replacement: "tasks"}}, rules, "the rename rules of the following tag files must come first")
+	assert.Equal(t, "Europe/Paris", options.Timezone, "the global settings of the following tag files must take precedence")
+	assert.Equal(t, "assets", options.AssetDirectory, "the global settings of the base tag file must apply")
+
+	_, err = LoadTagFiles([]string{base, filepath.Join(dir, "missing.yaml")})
+	assert.Error(t, err, "missing tag files must be reported")
+}
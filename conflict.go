@@ -0,0 +1,97 @@
+package bearnotes
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+)
+
+// Resolution of the conflict markers found in notes (see MigrateOptions.Conflicts)
+const (
+	ConflictKeep   = ""       // Conflicts are kept as-is and reported
+	ConflictFirst  = "first"  // The first side of each conflict is kept
+	ConflictSecond = "second" // The second side of each conflict is kept
+)
+
+// Regular expression to detect the titles of the conflicted copies created
+// by Bear and iCloud.
+// Examples:
+//  - My note - conflict
+//  - My note - Conflict 2
+var reConflictTitle = regexp.MustCompile(`(?i)\s+-\s+conflict(?:\s+\d+)?$`)
+
+// Conflict markers, at the beginning of a line
+var (
+	conflictStart     = []byte("<<<<<<<")
+	conflictSeparator = []byte("=======")
+	conflictEnd       = []byte(">>>>>>>")
+)
+
+// checkConflicts returns an error if the resolution of conflicts is unknown.
+func checkConflicts(side string) error {
+	if side != ConflictKeep && side != ConflictFirst && side != ConflictSecond {
+		return fmt.Errorf("unknown conflict resolution '%s' (available resolutions: %s, %s)", side, ConflictFirst, ConflictSecond)
+	}
+	return nil
+}
+
+// isConflictTitle returns true if the title of a note (its filename, without
+// extension) looks like a conflicted copy ("Title - conflict").
+func isConflictTitle(title string) bool {
+	return reConflictTitle.MatchString(title)
+}
+
+// resolveConflicts keeps one side (ConflictFirst or ConflictSecond) of the
+// blocks of content delimited by conflict markers (<<<<<<<, ======= and
+// >>>>>>>) and returns the content along with the number of conflicts.
+// With ConflictKeep, the content is returned as-is and the conflicts are
+// only counted. Unterminated blocks are left untouched.
+func resolveConflicts(content []byte, side string) ([]byte, int) {
+	var result bytes.Buffer
+	var conflicts int
+	var first, second []byte // Sides of the current conflict
+	var block []byte         // The current conflict, as-is
+	state := 0               // 0: outside, 1: first side, 2: second side
+	for len(content) > 0 {
+		end := bytes.IndexByte(content, '\n') + 1
+		if end == 0 {
+			end = len(content)
+		}
+		line := content[:end]
+		content = content[end:]
+
+		switch {
+		case state == 0 && bytes.HasPrefix(line, conflictStart):
+			state = 1
+			first, second, block = nil, nil, line
+			continue
+		case state == 1 && bytes.HasPrefix(line, conflictSeparator):
+			state = 2
+		case state == 2 && bytes.HasPrefix(line, conflictEnd):
+			state = 0
+			conflicts++
+			switch side {
+			case ConflictFirst:
+				result.Write(first)
+			case ConflictSecond:
+				result.Write(second)
+			default:
+				result.Write(block)
+				result.Write(line)
+			}
+			block = nil
+			continue
+		case state == 1:
+			first = append(first, line...)
+		case state == 2:
+			second = append(second, line...)
+		default:
+			result.Write(line)
+			continue
+		}
+		block = append(block, line...)
+	}
+	result.Write(block)
+
+	return result.Bytes(), conflicts
+}
@@ -0,0 +1,173 @@
+package bearnotes
+
+import (
+	"context"
+	"crypto/sha1"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// shingleSize is the number of consecutive words in a shingle
+const shingleSize = 3
+
+// DuplicateCluster is a group of notes having a similar content.
+type DuplicateCluster struct {
+	// Notes holds the path of the notes (relative to the notes directory),
+	// from the newest to the oldest
+	Notes []string
+}
+
+// dedupeCandidate holds the data required to compare a note with other notes.
+type dedupeCandidate struct {
+	path     string              // Path relative to the notes directory
+	modTime  int64               // Modification time (UnixNano)
+	hash     [sha1.Size]byte     // Hash of the normalized content
+	shingles map[uint64]struct{} // Hashed shingles of the normalized content
+}
+
+// normalizeContent lowercases content and splits it into words,
+// so that whitespace and case differences are not taken into account.
+func normalizeContent(content []byte) []string {
+	return strings.Fields(strings.ToLower(string(content)))
+}
+
+// computeShingles returns the set of hashed word n-grams.
+func computeShingles(words []string) map[uint64]struct{} {
+	shingles := make(map[uint64]struct{})
+	add := func(shingle []string) {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(shingle, " ")))
+		shingles[h.Sum64()] = struct{}{}
+	}
+
+	// Short notes are made of a single shingle
+	if len(words) > 0 && len(words) < shingleSize {
+		add(words)
+	}
+	for i := 0; i+shingleSize <= len(words); i++ {
+		add(words[i : i+shingleSize])
+	}
+	return shingles
+}
+
+// jaccard returns the Jaccard similarity of two sets of shingles.
+func jaccard(a, b map[uint64]struct{}) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	var intersection int
+	for k := range a {
+		if _, ok := b[k]; ok {
+			intersection++
+		}
+	}
+	return float64(intersection) / float64(len(a)+len(b)-intersection)
+}
+
+// FindDuplicates walks through recursively the Bear notes directory and
+// returns the clusters of notes whose content similarity is at least
+// threshold (between 0 and 1, 1 meaning identical once normalized).
+func FindDuplicates(ctx context.Context, notesDir string, threshold float64) ([]DuplicateCluster, error) {
+	var candidates []dedupeCandidate
+	err := filepath.Walk(notesDir,
+		func(p string, info os.FileInfo, err error) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			// Errors are reported during the migration, not here
+			if err != nil || info.IsDir() || !strings.HasSuffix(info.Name(), ".md") {
+				return nil
+			}
+
+			content, err := ioutil.ReadFile(p)
+			if err != nil {
+				return nil
+			}
+			relPath, _ := filepath.Rel(notesDir, p)
+			words := normalizeContent(content)
+			candidate := dedupeCandidate{
+				path:    relPath,
+				modTime: info.ModTime().UnixNano(),
+				hash:    sha1.Sum([]byte(strings.Join(words, " "))),
+			}
+			if threshold < 1 {
+				candidate.shingles = computeShingles(words)
+			}
+			candidates = append(candidates, candidate)
+
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	// Union-find of similar notes
+	parent := make([]int, len(candidates))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := range candidates {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		for j := i + 1; j < len(candidates); j++ {
+			a, b := &candidates[i], &candidates[j]
+			similar := a.hash == b.hash
+			if !similar && threshold < 1 {
+				// The Jaccard similarity cannot exceed the ratio of set sizes
+				small, large := len(a.shingles), len(b.shingles)
+				if small > large {
+					small, large = large, small
+				}
+				if large > 0 && float64(small)/float64(large) >= threshold {
+					similar = jaccard(a.shingles, b.shingles) >= threshold
+				}
+			}
+			if similar {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	// Group notes by cluster
+	groups := make(map[int][]dedupeCandidate)
+	for i, candidate := range candidates {
+		root := find(i)
+		groups[root] = append(groups[root], candidate)
+	}
+	var clusters []DuplicateCluster
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		sort.Slice(group, func(i, j int) bool {
+			return group[i].modTime > group[j].modTime
+		})
+		var cluster DuplicateCluster
+		for _, candidate := range group {
+			cluster.Notes = append(cluster.Notes, candidate.path)
+		}
+		clusters = append(clusters, cluster)
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		return clusters[i].Notes[0] < clusters[j].Notes[0]
+	})
+
+	return clusters, nil
+}
@@ -0,0 +1,77 @@
+package bearnotes
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindDuplicates(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"note.md":            "The quick brown fox jumps over the lazy dog. #animals",
+		"note (conflict).md": "The quick  brown fox\njumps over the LAZY dog. #animals",
+		"similar.md":         "The quick brown fox jumps over the lazy cat. #animals",
+		"other.md":           "Lorem ipsum dolor sit amet",
+	})
+	defer os.RemoveAll(from)
+
+	clusters, err := FindDuplicates(context.Background(), from, 1)
+	assert.NoError(t, err, "search must succeed")
+	assert.Len(t, clusters, 1, "there must be 1 cluster of exact duplicates")
+	assert.ElementsMatch(t, []string{"note.md", "note (conflict).md"}, clusters[0].Notes, "exact duplicates must be found")
+
+	clusters, err = FindDuplicates(context.Background(), from, 0.5)
+	assert.NoError(t, err, "search must succeed")
+	assert.Len(t, clusters, 1, "there must be 1 cluster of similar notes")
+	assert.ElementsMatch(t, []string{"note.md", "note (conflict).md", "similar.md"}, clusters[0].Notes, "similar notes must be found")
+}
+
+// encodeTestImage returns a size x size mosaic of 8x8 random gray tiles
+// (seeded by seed), in PNG or JPEG format.
+func encodeTestImage(t *testing.T, seed int64, size int, jpg bool) string {
+	r := rand.New(rand.NewSource(seed))
+	var tiles [8][8]uint8
+	for i := range tiles {
+		for j := range tiles[i] {
+			tiles[i][j] = uint8(r.Intn(256))
+		}
+	}
+	img := image.NewGray(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			img.SetGray(x, y, color.Gray{Y: tiles[y*8/size][x*8/size]})
+		}
+	}
+	var buf bytes.Buffer
+	var err error
+	if jpg {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 75})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	assert.NoError(t, err, "image must be encoded")
+	return buf.String()
+}
+
+func TestFindSimilarImages(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"note/screenshot.png":         encodeTestImage(t, 1, 64, false),
+		"other/Screen Shot 2.jpg":     encodeTestImage(t, 1, 200, true),
+		"other/different.png":         encodeTestImage(t, 2, 64, false),
+		"other/not an image.png":      "not a PNG",
+		"note/not an image at all.md": "#note",
+	})
+	defer os.RemoveAll(from)
+
+	clusters, err := FindSimilarImages(context.Background(), from, DefaultImageDistance)
+	assert.NoError(t, err, "search must succeed")
+	assert.Equal(t, []ImageCluster{{Images: []string{"note/screenshot.png", "other/Screen Shot 2.jpg"}}}, clusters, "resized and recompressed copies must be found")
+}
@@ -1,97 +1,431 @@
 package bearnotes
 
 import (
+	"bytes"
+	"context"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"unicode"
 
 	"golang.org/x/text/unicode/norm"
-	"gopkg.in/yaml.v3"
 )
 
+// DiscoverOptions holds the optional settings of a discovery.
+type DiscoverOptions struct {
+	// Directories specifies how default target directories are generated
+	Directories DirectoryOptions
+
+	// ListNotes displays, for each tag, the notes having this tag
+	ListNotes bool
+
+	// Parse specifies how notes are parsed
+	Parse ParseOptions
+
+	// Transforms are applied to the content of each note, before parsing.
+	// They have to match those given to MigrateNotes.
+	Transforms []Transform
+
+	// FolderTags gives the untagged notes a pseudo-tag named after their
+	// parent folder (see MigrateOptions.FolderTags), so that it is written
+	// to the tag file.
+	FolderTags bool
+
+	// OnlyTags restricts the displayed tag list to those tags (all tags are
+	// still written to the tag file)
+	OnlyTags []string
+
+	// ConvertHTML converts the notes exported by Bear as HTML to Markdown,
+	// using pandoc, and discovers them as well.
+	ConvertHTML bool
+
+	// Spotlight locates the notes with Spotlight (mdfind) instead of a
+	// walk through the whole directory (macOS only). It falls back to the
+	// walk when Spotlight is not available or finds no note.
+	Spotlight bool
+
+	// Merge adds the new tags to an existing tag file instead of
+	// overwriting it (see MergeTagFile)
+	Merge bool
+
+	// OneNotePerFolderThreshold is the number of images and file
+	// attachments per note, on average, from which the one-note-per-folder
+	// strategy is suggested for the notes of a tag, instead of same-folder,
+	// so that the assets of a note stay together (defaults to 3).
+	OneNotePerFolderThreshold float64
+}
+
+// defaultOneNotePerFolderThreshold is the default number of assets per note
+// from which the one-note-per-folder strategy is suggested (see
+// DiscoverOptions.OneNotePerFolderThreshold).
+const defaultOneNotePerFolderThreshold = 3
+
+// discovery accumulates the tags found in notes.
+type discovery struct {
+	options     DiscoverOptions
+	tags        map[string]TagOptions
+	occurrences map[string]map[string]int // tag => note => count
+	tagTasks    map[string]taskCounts     // tag => tasks of the notes having this tag
+	tagAssets   map[string]int            // tag => images and attachments of the notes having this tag
+	skipped     map[string]map[string]int // noise tag => note => count
+	conflicts   map[string]string         // note => conflict artifacts found
+	corrupt     map[string]string         // note => encoding issues found
+	tasks       taskCounts
+	imageCount  int
+	fileCount   int
+	noteCount   int
+}
+
+// taskCounts holds the number of open and completed tasks (checklist items).
+type taskCounts struct {
+	open      int
+	completed int
+}
+
+// countTasks returns the number of open ([ ]) and completed ([x]) tasks in content.
+func countTasks(content []byte) taskCounts {
+	var counts taskCounts
+	for _, match := range reTask.FindAllSubmatch(content, -1) {
+		if string(match[2]) == " " {
+			counts.open++
+		} else {
+			counts.completed++
+		}
+	}
+	return counts
+}
+
+// add returns the sum of the task counts.
+func (counts taskCounts) add(other taskCounts) taskCounts {
+	return taskCounts{open: counts.open + other.open, completed: counts.completed + other.completed}
+}
+
+// String returns a human readable summary of the task counts.
+func (counts taskCounts) String() string {
+	return fmt.Sprintf("%d open and %d completed tasks", counts.open, counts.completed)
+}
+
+// newDiscovery creates an empty discovery.
+func newDiscovery(options DiscoverOptions) *discovery {
+	return &discovery{
+		options:     options,
+		tags:        make(map[string]TagOptions),
+		occurrences: make(map[string]map[string]int),
+		tagTasks:    make(map[string]taskCounts),
+		tagAssets:   make(map[string]int),
+		skipped:     make(map[string]map[string]int),
+		conflicts:   make(map[string]string),
+		corrupt:     make(map[string]string),
+	}
+}
+
+// addNote parses the note at notePath (relative to the notes directory)
+// and accounts for its tags, images and file attachments.
+func (d *discovery) addNote(notePath string, content []byte) {
+	// Noise tags are parsed as well, to be reported for review
+	parse := d.options.Parse
+	parse.StopList, parse.MinTagLength = nil, 0
+	// A byte order mark is removed, but the note is not corrupted
+	if check := checkIntegrity(content); check.String() != "" {
+		if check.corrupt() {
+			d.corrupt[notePath] = check.String()
+		}
+		content = check.repair(content)
+	}
+	var artifacts []string
+	if isConflictTitle(strings.TrimSuffix(filepath.Base(notePath), filepath.Ext(notePath))) {
+		artifacts = append(artifacts, "conflict title")
+	}
+	if _, conflicts := resolveConflicts(content, ConflictKeep); conflicts > 0 {
+		artifacts = append(artifacts, fmt.Sprintf("%d conflict markers", conflicts))
+	}
+	if len(artifacts) > 0 {
+		d.conflicts[notePath] = strings.Join(artifacts, ", ")
+	}
+	content = applyTransforms(content, d.options.Transforms)
+	note := LoadNoteWithOptions(content, parse)
+	d.imageCount += len(note.Images)
+	d.fileCount += len(note.Files)
+	d.noteCount++
+	if d.options.FolderTags && len(note.Tags) == 0 {
+		if tag, ok := folderTag(notePath); ok {
+			note.Tags = []Tag{tag}
+		}
+	}
+	tasks := countTasks(content)
+	d.tasks = d.tasks.add(tasks)
+
+	for _, tag := range note.Tags {
+		// just to be safe, normalize the tag name since it is used
+		// afterwards to generate paths and filenames
+		tag.Name = norm.NFC.String(tag.Name)
+
+		// all tags are lowercase in Bear, unless asked otherwise
+		tagName := tagKey(tag.Name, d.options.Parse.CaseSensitiveTags)
+
+		// Folder pseudo-tags can be named after a reserved entry of the
+		// tag file, unlike tags
+		if reservedEntries[tagName] {
+			log.Printf("WARNING: %s: #%s is a reserved name of the tag file, skipped\n", notePath, tagName)
+			continue
+		}
+
+		if d.options.Parse.isNoise(tag.Name) {
+			if d.skipped[tagName] == nil {
+				d.skipped[tagName] = make(map[string]int)
+			}
+			d.skipped[tagName][notePath]++
+			continue
+		}
+
+		if d.occurrences[tagName] == nil {
+			d.occurrences[tagName] = make(map[string]int)
+		}
+		// The tasks and assets of a note are counted once per tag
+		if d.occurrences[tagName][notePath] == 0 {
+			d.tagTasks[tagName] = d.tagTasks[tagName].add(tasks)
+			d.tagAssets[tagName] += len(note.Images) + len(note.Files)
+		}
+		d.occurrences[tagName][notePath]++
+
+		tagEntry, ok := d.tags[tagName]
+		if !ok {
+			tagEntry = NewTagOptions(tag)
+			tagEntry.TargetDirectory = DefaultTargetDirectory(tag.Name, d.options.Directories)
+			// Purely numeric tags are most likely false positives ("issue
+			// #1"): they are left unclassified, for the user to decide
+			if strings.TrimFunc(tag.Name, unicode.IsDigit) == "" {
+				tagEntry = TagOptions{count: 1, TargetTagName: tag.Name}
+				tagEntry.reason = fmt.Sprintf("unclassified: purely numeric tags are most likely false positives (issue #%s), set a handling strategy and a target directory to route their notes", tag.Name)
+			}
+			d.tags[tagName] = tagEntry
+		} else {
+			tagEntry.count++
+			d.tags[tagName] = tagEntry
+		}
+	}
+}
+
+// suggestStrategies suggests a handling strategy for each tag, based on
+// the number of images and file attachments of its notes: one-note-per-folder
+// when they have many, each note getting a folder along with its assets,
+// same-folder otherwise. The reasoning is kept for the tag file.
+func (d *discovery) suggestStrategies() {
+	threshold := d.options.OneNotePerFolderThreshold
+	if threshold <= 0 {
+		threshold = defaultOneNotePerFolderThreshold
+	}
+	for tagName, tagEntry := range d.tags {
+		notes := len(d.occurrences[tagName])
+		if tagEntry.Ignore || tagEntry.HandlingStrategy == StrategyNone || notes == 0 {
+			continue
+		}
+		average := float64(d.tagAssets[tagName]) / float64(notes)
+		if average >= threshold {
+			tagEntry.HandlingStrategy = StrategyOneNotePerFolder
+			tagEntry.reason = fmt.Sprintf("one-note-per-folder: %.1f images and attachments per note on average (%d notes, %g or more)", average, notes, threshold)
+		} else {
+			tagEntry.HandlingStrategy = StrategySameFolder
+			tagEntry.reason = fmt.Sprintf("same-folder: %.1f images and attachments per note on average (%d notes, less than %g)", average, notes, threshold)
+		}
+		d.tags[tagName] = tagEntry
+	}
+}
+
+// tagFile returns the tag configuration file in YAML format, with the
+// suggested handling strategies.
+func (d *discovery) tagFile() ([]byte, error) {
+	d.suggestStrategies()
+	var content bytes.Buffer
+	err := WriteTagFile(&content, d.tags)
+	return content.Bytes(), err
+}
+
 // DiscoverNotes walk through recursively the Bear notes directory to find notes.
-// It generates a tag configuration file, suitable for migration.
-func DiscoverNotes(notesDir string, tagFile string) error {
-	var tags map[string]TagOptions = make(map[string]TagOptions)
-	var imageCount int
-	var fileCount int
-	var noteCount int
-
-	fmt.Printf("Looking for Bear notes into %s...\n", notesDir)
-
-	err := filepath.Walk(notesDir,
-		func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				log.Printf("stat: %s: %s\n", path, err)
-				return nil
+// It generates a tag configuration file, suitable for migration, with a
+// suggested handling strategy for each tag (see
+// DiscoverOptions.OneNotePerFolderThreshold).
+//
+// When ctx is cancelled, the discovery stops and no tag file is written.
+func DiscoverNotes(ctx context.Context, notesDir string, tagFile string, options DiscoverOptions) error {
+	d := newDiscovery(options)
+
+	// The read buffer is reused from one note to another
+	var buf bytes.Buffer
+	addNote := func(path string) {
+		content, err := readNoteFile(path, &buf)
+		if err != nil {
+			log.Printf("open: %s: %s\n", path, err)
+			return
+		}
+		relPath, _ := filepath.Rel(notesDir, path)
+		d.addNote(relPath, content)
+	}
+
+	// Spotlight finds the notes without walking through the whole directory
+	var paths []string
+	if options.Spotlight {
+		fmt.Printf("Looking for Bear notes into %s with Spotlight...\n", notesDir)
+		var err error
+		paths, err = spotlightNotes(ctx, notesDir, options.ConvertHTML)
+		if err != nil {
+			log.Printf("WARNING: Spotlight cannot be used: %s\n", err)
+		} else if len(paths) == 0 {
+			log.Printf("WARNING: Spotlight found no note, %s may not be indexed yet\n", notesDir)
+		}
+	}
+	if len(paths) > 0 {
+		for _, path := range paths {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if isNoteFile(filepath.Base(path), options.ConvertHTML) {
+				addNote(path)
 			}
+		}
+	} else {
+		err := checkExportFormat(ctx, notesDir, options.ConvertHTML, nil)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Looking for Bear notes into %s...\n", notesDir)
+		err = filepath.Walk(notesDir,
+			func(path string, info os.FileInfo, err error) error {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
 
-			if strings.HasSuffix(info.Name(), ".md") && !info.IsDir() { // it's a Markdown file!
-				content, err := ioutil.ReadFile(path)
 				if err != nil {
-					log.Printf("open: %s: %s\n", path, err)
+					log.Printf("stat: %s: %s\n", path, err)
 					return nil
 				}
-				note := LoadNote(string(content))
-				imageCount += len(note.Images)
-				fileCount += len(note.Files)
-				noteCount++
-
-				for _, tag := range note.Tags {
-					// just to be safe, normalize the tag name since it is used
-					// afterwards to generate paths and filenames
-					tag.Name = norm.NFC.String(tag.Name)
-
-					// all tags are lowercase in Bear
-					tagName := strings.ToLower(tag.Name)
-
-					tagEntry, ok := tags[tagName]
-					if !ok {
-						tags[tagName] = NewTagOptions(tag)
-					} else {
-						tagEntry.count++
-						tags[tagName] = tagEntry
-					}
+
+				if isNoteFile(info.Name(), options.ConvertHTML) && !info.IsDir() { // it's a Markdown file!
+					addNote(path)
 				}
-			}
 
-			return nil
-		})
-	if err != nil {
-		return err
+				return nil
+			})
+		if err != nil {
+			return err
+		}
 	}
 
-	fmt.Printf("Found %d notes, %d embedded images, %d attachments and %d unique tags.\n", noteCount, imageCount, fileCount, len(tags))
+	fmt.Printf("Found %d notes, %d embedded images, %d attachments and %d unique tags.\n", d.noteCount, d.imageCount, d.fileCount, len(d.tags))
+	fmt.Printf("Found %s.\n", d.tasks)
 	fmt.Println("")
 
 	// Displays all tags, sorted by their name
 	fmt.Println("Tag list:")
-	tagNames := make([]string, len(tags))
-	i := 0
-	for k := range tags {
-		tagNames[i] = k
-		i++
+	var tagNames []string
+	for k := range d.tags {
+		if len(options.OnlyTags) > 0 && !containsTag(options.OnlyTags, k) {
+			continue
+		}
+		tagNames = append(tagNames, k)
 	}
 	sort.Strings(tagNames)
 	for _, tagName := range tagNames {
-		fmt.Printf("#%s\n", tagName)
+		// Tasks are only displayed for the tags having some
+		tasks := ""
+		if counts := d.tagTasks[tagName]; counts.open > 0 || counts.completed > 0 {
+			tasks = counts.String()
+		}
+		if !options.ListNotes {
+			if tasks != "" {
+				fmt.Printf("#%s (%s)\n", tagName, tasks)
+			} else {
+				fmt.Printf("#%s\n", tagName)
+			}
+			continue
+		}
+
+		// Displays the notes having this tag, sorted by their path
+		notes := d.occurrences[tagName]
+		if tasks != "" {
+			fmt.Printf("#%s (%d notes, %s)\n", tagName, len(notes), tasks)
+		} else {
+			fmt.Printf("#%s (%d notes)\n", tagName, len(notes))
+		}
+		notePaths := make([]string, 0, len(notes))
+		for notePath := range notes {
+			notePaths = append(notePaths, notePath)
+		}
+		sort.Strings(notePaths)
+		for _, notePath := range notePaths {
+			fmt.Printf("    %s (%d)\n", notePath, notes[notePath])
+		}
+	}
+
+	// Noise tags are not written to the tag file, but they may hide
+	// real tags
+	if len(d.skipped) > 0 {
+		fmt.Println("")
+		fmt.Println("Skipped tags (stop-list or minimum length):")
+		var skippedNames []string
+		for tagName := range d.skipped {
+			skippedNames = append(skippedNames, tagName)
+		}
+		sort.Strings(skippedNames)
+		for _, tagName := range skippedNames {
+			fmt.Printf("#%s (%d notes)\n", tagName, len(d.skipped[tagName]))
+		}
+	}
+
+	// Conflicted copies are better resolved in Bear, before the migration
+	if len(d.conflicts) > 0 {
+		fmt.Println("")
+		fmt.Println("Conflicted copies (resolve them in Bear or migrate with --conflicts):")
+		var notePaths []string
+		for notePath := range d.conflicts {
+			notePaths = append(notePaths, notePath)
+		}
+		sort.Strings(notePaths)
+		for _, notePath := range notePaths {
+			fmt.Printf("%s (%s)\n", notePath, d.conflicts[notePath])
+		}
+	}
+
+	// Corrupted exports are better exported again from Bear
+	if len(d.corrupt) > 0 {
+		fmt.Println("")
+		fmt.Println("Corrupted notes (export them again from Bear or migrate with --repair-encoding):")
+		var notePaths []string
+		for notePath := range d.corrupt {
+			notePaths = append(notePaths, notePath)
+		}
+		sort.Strings(notePaths)
+		for _, notePath := range notePaths {
+			fmt.Printf("%s (%s)\n", notePath, d.corrupt[notePath])
+		}
 	}
 
 	// Write the tag configuration file
+	d.suggestStrategies()
 	fmt.Println("")
-	fmt.Printf("Writing all tags into %s...\n", tagFile)
-	fileContent, err := yaml.Marshal(tags)
-	if err != nil {
-		return err
-	}
-	err = ioutil.WriteFile(tagFile, fileContent, 0644)
-	if err != nil {
-		return err
+	if options.Merge {
+		added, err := MergeTagFile(tagFile, d.tags)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Added %d new tags to %s.\n", added, tagFile)
+		return nil
 	}
+	fmt.Printf("Writing all tags into %s...\n", tagFile)
+	return SaveTagFile(tagFile, d.tags)
+}
 
-	return nil
+// containsTag returns true if tagName is in the list, ignoring case and
+// leading hashtag.
+func containsTag(list []string, tagName string) bool {
+	for _, item := range list {
+		if strings.ToLower(strings.TrimPrefix(item, "#")) == tagName {
+			return true
+		}
+	}
+	return false
 }
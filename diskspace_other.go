@@ -0,0 +1,9 @@
+//go:build windows || js || wasip1
+// +build windows js wasip1
+
+package bearnotes
+
+// freeSpace is not implemented on Windows and WebAssembly and returns -1 (unknown).
+func freeSpace(dir string) (int64, error) {
+	return -1, nil
+}
@@ -0,0 +1,17 @@
+//go:build !windows && !js && !wasip1
+// +build !windows,!js,!wasip1
+
+package bearnotes
+
+import "syscall"
+
+// freeSpace returns the number of bytes available to an unprivileged user
+// on the filesystem holding dir.
+func freeSpace(dir string) (int64, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(dir, &stat)
+	if err != nil {
+		return 0, err
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
@@ -0,0 +1,129 @@
+package bearnotes
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Default settings of the remote image downloader
+const (
+	defaultRemoteImageTimeout = 30 * time.Second
+	defaultRemoteImageMaxSize = 20 * 1024 * 1024
+)
+
+// isRemote returns true if the location of an image is an HTTP(S) URL.
+func isRemote(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
+
+// remoteFileName returns the name of the local copy of a remote image:
+// the last component of the URL path.
+func remoteFileName(location string) string {
+	u, err := url.Parse(location)
+	if err != nil {
+		return "image"
+	}
+	fileName := path.Base(u.Path)
+	if fileName == "/" || fileName == "." {
+		fileName = "image"
+	}
+	return fileName
+}
+
+// imageDownloader fetches remote images into a temporary cache directory
+// so that an image referenced by several notes is downloaded only once.
+type imageDownloader struct {
+	client   *http.Client
+	maxSize  int64
+	cacheDir string
+	cache    map[string]string // URL => path to the downloaded file
+}
+
+// newImageDownloader creates an imageDownloader with its cache directory.
+// The caller has to call close() to remove the cache directory.
+func newImageDownloader(timeout time.Duration, maxSize int64) (*imageDownloader, error) {
+	if timeout <= 0 {
+		timeout = defaultRemoteImageTimeout
+	}
+	if maxSize <= 0 {
+		maxSize = defaultRemoteImageMaxSize
+	}
+	cacheDir, err := ioutil.TempDir("", "bearnotes-images")
+	if err != nil {
+		return nil, err
+	}
+	return &imageDownloader{
+		client:   &http.Client{Timeout: timeout},
+		maxSize:  maxSize,
+		cacheDir: cacheDir,
+		cache:    make(map[string]string),
+	}, nil
+}
+
+// close removes the cache directory.
+func (d *imageDownloader) close() error {
+	return os.RemoveAll(d.cacheDir)
+}
+
+// fetch downloads the image at location and returns the path to the local copy.
+// The local copy is named after the last component of the URL path.
+func (d *imageDownloader) fetch(ctx context.Context, location string) (string, error) {
+	if p, ok := d.cache[location]; ok {
+		return p, nil
+	}
+
+	fileName := remoteFileName(location)
+	req, err := http.NewRequest(http.MethodGet, location, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := d.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GET %s: %s", location, resp.Status)
+	}
+	if resp.ContentLength > d.maxSize {
+		return "", fmt.Errorf("GET %s: image is larger than %d bytes", location, d.maxSize)
+	}
+
+	// Each URL gets its own sub-directory in the cache to prevent
+	// collisions between images having the same filename
+	hash := sha1.Sum([]byte(location))
+	dir := filepath.Join(d.cacheDir, hex.EncodeToString(hash[:]))
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", err
+	}
+	p := filepath.Join(dir, fileName)
+	fd, err := os.Create(p)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+
+	// Read one more byte than allowed to detect oversized images
+	n, err := io.Copy(fd, io.LimitReader(resp.Body, d.maxSize+1))
+	if err != nil {
+		return "", err
+	}
+	if n > d.maxSize {
+		return "", fmt.Errorf("GET %s: image is larger than %d bytes", location, d.maxSize)
+	}
+
+	d.cache[location] = p
+	return p, nil
+}
@@ -0,0 +1,121 @@
+package bearnotes
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownTag is reported when a note has a tag that is not present in the
+// tag configuration file.
+var ErrUnknownTag = errors.New("unknown tag")
+
+// ErrUnknownVault is reported when a note is assigned to a vault that has
+// no destination directory.
+var ErrUnknownVault = errors.New("unknown vault")
+
+// ErrAssetMissing is reported when an embedded image or a file attachment
+// cannot be found in the source directory.
+var ErrAssetMissing = errors.New("asset missing")
+
+// ErrAssetConflict is reported when an embedded image or a file attachment
+// cannot be copied because a different file with the same name already
+// exists in the target directory.
+var ErrAssetConflict = errors.New("asset conflict")
+
+// ErrNameCollision is reported when a note would go to the same file as
+// another note: titles slugified alike (Notes! and Notes?) or notes of
+// different folders stored in a single directory. The note is numbered
+// instead (notes-2.md).
+var ErrNameCollision = errors.New("name collision")
+
+// ErrTagsIgnored is reported when all the tags of a note are ignored, so
+// that nothing tells where the note should go.
+var ErrTagsIgnored = errors.New("all tags ignored")
+
+// ErrPathTraversal is reported when a link of a note or a target directory
+// of the tag file points outside of the source or destination directory
+// (../../ for instance).
+var ErrPathTraversal = errors.New("path traversal")
+
+// ErrConflictedCopy is reported when a note looks like a conflicted copy
+// of another note (Title 2 next to Title, Title - conflict) or holds
+// conflict markers (see MigrateOptions.Conflicts).
+var ErrConflictedCopy = errors.New("conflicted copy")
+
+// ErrTooManyFolders is reported when the migration would create more
+// folders, or deeper folders, than allowed (see MigrateOptions.MaxFolders).
+var ErrTooManyFolders = errors.New("too many folders")
+
+// ErrInvalidNote is reported when a note cannot be written back because the
+// positions of its tags, images or file attachments overlap or are out of
+// bounds (see Note.Validate).
+var ErrInvalidNote = errors.New("invalid note")
+
+// ErrLinkTextMismatch is reported when the visible name of a file attachment
+// differs from its filename (see MigrateOptions.LinkText).
+var ErrLinkTextMismatch = errors.New("link text mismatch")
+
+// ErrReadFailed is reported when a note cannot be read from the source directory.
+var ErrReadFailed = errors.New("read failed")
+
+// ErrWriteFailed is reported when a note, an image or a file attachment
+// cannot be written to the target directory.
+var ErrWriteFailed = errors.New("write failed")
+
+// ErrExportFailed is reported when a note cannot be exported with pandoc.
+var ErrExportFailed = errors.New("export failed")
+
+// ErrCorruptNote is reported when a note is not valid UTF-8 text: invalid
+// byte sequences, null bytes or UTF-16 encoding, as found in corrupted
+// exports (see MigrateOptions.RepairEncoding). Byte order marks are
+// reported as well, once removed.
+var ErrCorruptNote = errors.New("corrupt note")
+
+// ErrHeadingMissing is reported when a link points to a heading that cannot
+// be found in the linked note, as when the heading has been edited since.
+// The link is rewritten to point to the note (see MigrateOptions.HeadingLinks).
+var ErrHeadingMissing = errors.New("heading missing")
+
+// ErrAltTextFailed is reported when the alternative text of an image
+// cannot be generated (see MigrateOptions.AltText). The image is migrated
+// without alternative text.
+var ErrAltTextFailed = errors.New("alt text failed")
+
+// ErrContentMismatch is reported when the words of a migrated note differ
+// from the words of the original note (see CheckMigration).
+var ErrContentMismatch = errors.New("content mismatch")
+
+// ErrTagFileOverride is reported when an entry of a layered tag file
+// replaces the entry of the same name of a previous tag file by different
+// options (see LoadTagFiles). The note of the error is the file and line of
+// the replacing entry.
+var ErrTagFileOverride = errors.New("tag file override")
+
+// NoteError records an error that occurred while processing a note.
+//
+// Kind is one of the ErrXXX values defined in this package so that callers
+// can use errors.Is to distinguish failure modes. Err holds the underlying
+// cause, if any.
+type NoteError struct {
+	Note string // The note filename
+	Kind error  // The failure mode (ErrUnknownTag, ErrAssetMissing, etc.)
+	Err  error  // The underlying cause
+}
+
+// Error implements the error interface.
+func (e *NoteError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("%s: %s", e.Note, e.Kind)
+	}
+	return fmt.Sprintf("%s: %s: %s", e.Note, e.Kind, e.Err)
+}
+
+// Unwrap returns the underlying cause.
+func (e *NoteError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the failure mode of this error.
+func (e *NoteError) Is(target error) bool {
+	return e.Kind == target
+}
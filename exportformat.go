@@ -0,0 +1,120 @@
+package bearnotes
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrNotMarkdownExport is returned when the source directory holds no
+// Markdown notes but notes exported by Bear in another format.
+var ErrNotMarkdownExport = errors.New("the Bear notes have not been exported as Markdown")
+
+// exportFormats maps the file extensions of the formats Bear can export
+// notes to, other than Markdown, to a human readable name.
+var exportFormats = map[string]string{
+	".html": "HTML",
+	".rtf":  "RTF",
+	".rtfd": "RTF",
+	".txt":  "plain text",
+	".docx": "DOCX",
+}
+
+// isNoteFile returns true if the file name is a note to process.
+// HTML notes are processed only if convertHTML is true.
+func isNoteFile(name string, convertHTML bool) bool {
+	return strings.HasSuffix(name, ".md") || (convertHTML && strings.HasSuffix(name, ".html"))
+}
+
+// readNoteFile returns the Markdown content of the note at p, converting
+// HTML notes with pandoc. The content is read into buf, which is reset first,
+// so that the same buffer can be reused from one note to another. The returned
+// slice is valid until the next use of buf.
+func readNoteFile(p string, buf *bytes.Buffer) ([]byte, error) {
+	buf.Reset()
+	if !strings.HasSuffix(p, ".html") {
+		fd, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		defer fd.Close()
+		_, err = buf.ReadFrom(fd)
+		return buf.Bytes(), err
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("pandoc", "--from", "html", "--to", "gfm", "--wrap", "none", filepath.Base(p))
+	cmd.Dir = filepath.Dir(p)
+	cmd.Stdout = buf
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("pandoc --from html: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return buf.Bytes(), nil
+}
+
+// checkExportFormat walks through recursively the source directory and
+// returns ErrNotMarkdownExport (with guidance) if it holds no Markdown notes
+// but notes exported in another format. HTML exports are accepted if
+// convertHTML is true and pandoc is available, with a warning to logger.
+func checkExportFormat(ctx context.Context, from string, convertHTML bool, logger *migrationLogger) error {
+	var markdown int
+	others := make(map[string]int)
+	err := filepath.Walk(from,
+		func(p string, info os.FileInfo, err error) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			// Errors are reported during the migration, not here
+			if err != nil {
+				return nil
+			}
+
+			ext := strings.ToLower(filepath.Ext(info.Name()))
+			if ext == ".md" && !info.IsDir() {
+				markdown++
+			} else if format, ok := exportFormats[ext]; ok && (ext == ".rtfd" || !info.IsDir()) {
+				others[format]++
+				// RTFD notes are directories holding the note and its attachments
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+			}
+
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+
+	if markdown > 0 || len(others) == 0 {
+		return nil
+	}
+
+	if others["HTML"] > 0 && convertHTML {
+		if _, err := exec.LookPath("pandoc"); err != nil {
+			return fmt.Errorf("%w: HTML notes cannot be converted because pandoc cannot be found: %s", ErrNotMarkdownExport, err)
+		}
+		logger.Printf("WARNING: converting %d HTML notes to Markdown with pandoc, the result may differ from a Markdown export\n", others["HTML"])
+		return nil
+	}
+
+	var found []string
+	for format, count := range others {
+		found = append(found, fmt.Sprintf("%d %s files", count, format))
+	}
+	sort.Strings(found)
+	guidance := "in Bear, select the notes, use File > Export Notes, choose Markdown and check Export attachments"
+	if others["HTML"] > 0 {
+		guidance += " (HTML notes can also be converted with pandoc)"
+	}
+	return fmt.Errorf("%w: %s holds %s but no Markdown notes, %s", ErrNotMarkdownExport, from, strings.Join(found, ", "), guidance)
+}
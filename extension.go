@@ -0,0 +1,62 @@
+package bearnotes
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// extensionsByContentType maps the content types detected by
+// http.DetectContentType to the usual file extension.
+var extensionsByContentType = map[string]string{
+	"image/png":          ".png",
+	"image/jpeg":         ".jpg",
+	"image/gif":          ".gif",
+	"image/webp":         ".webp",
+	"image/bmp":          ".bmp",
+	"image/x-icon":       ".ico",
+	"application/pdf":    ".pdf",
+	"application/zip":    ".zip",
+	"application/x-gzip": ".gz",
+	"audio/mpeg":         ".mp3",
+	"audio/wave":         ".wav",
+	"audio/aiff":         ".aiff",
+	"application/ogg":    ".ogg",
+	"video/mp4":          ".mp4",
+	"video/webm":         ".webm",
+}
+
+// inferExtension sniffs the content type of a file from its first bytes
+// (magic bytes) and returns the matching extension (with the leading dot),
+// or the empty string if the type is unknown or the file cannot be read.
+func inferExtension(p string) string {
+	f, err := os.Open(p)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	header := make([]byte, 512)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return ""
+	}
+	header = header[:n]
+
+	// HEIC pictures (the default format of iPhone photos) are not
+	// detected by http.DetectContentType
+	if len(header) >= 12 && bytes.Equal(header[4:8], []byte("ftyp")) {
+		switch string(header[8:12]) {
+		case "heic", "heix", "mif1":
+			return ".heic"
+		}
+	}
+
+	contentType := http.DetectContentType(header)
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = contentType[:i]
+	}
+	return extensionsByContentType[contentType]
+}
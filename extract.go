@@ -0,0 +1,64 @@
+package bearnotes
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+)
+
+// ExtractTags returns the names of the tags of a Bear note, without
+// duplicates, in order of appearance. Unlike LoadNote, it does not look for
+// images and file attachments, so it is faster when only tags are needed.
+func ExtractTags(content string) []string {
+	return ExtractTagsWithOptions([]byte(content), ParseOptions{})
+}
+
+// ExtractTagsWithOptions is like ExtractTags, the note being parsed as
+// specified by options. Tag names are normalized as in the tag file
+// (Unicode normalization and, unless options.CaseSensitiveTags is true,
+// lowercase).
+func ExtractTagsWithOptions(content []byte, options ParseOptions) []string {
+	var names []string
+	for _, tag := range parseTags(content, options, mathRegions(content)) {
+		name := tagKey(tag.Name, options.CaseSensitiveTags)
+		if !containsString(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// ExtractTagsFromDir walks through recursively the notes directory and
+// returns the tags of each Markdown note (see ExtractTagsWithOptions),
+// indexed by their path relative to notesDir.
+func ExtractTagsFromDir(ctx context.Context, notesDir string, options ParseOptions) (map[string][]string, error) {
+	tags := make(map[string][]string)
+
+	// The read buffer is reused from one note to another
+	var buf bytes.Buffer
+	err := filepath.Walk(notesDir,
+		func(p string, info os.FileInfo, err error) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil {
+				return err
+			}
+			if info.IsDir() || !isNoteFile(info.Name(), false) {
+				return nil
+			}
+
+			content, err := readNoteFile(p, &buf)
+			if err != nil {
+				return err
+			}
+			relPath, _ := filepath.Rel(notesDir, p)
+			tags[filepath.ToSlash(relPath)] = ExtractTagsWithOptions(content, options)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
@@ -0,0 +1,74 @@
+package bearnotes
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultFailedDirectory is the directory receiving the notes that could
+// not be migrated, as used by the command line (see
+// MigrateOptions.FailedDirectory).
+const DefaultFailedDirectory = "_failed"
+
+// failedNote records the errors of a note that could not be migrated.
+type failedNote struct {
+	source string  // Path of the Bear note
+	errors []error // Errors that prevented the note from being migrated
+}
+
+// recordFailures returns a WalkFunc calling walkFn and recording the notes
+// for which walkFn reported errors, so that they can be quarantined.
+func (plan *Plan) recordFailures(walkFn filepath.WalkFunc) filepath.WalkFunc {
+	return func(p string, info os.FileInfo, err error) error {
+		before := len(plan.report.Errors)
+		result := walkFn(p, info, err)
+		if err == nil && len(plan.report.Errors) > before {
+			plan.failed = append(plan.failed, failedNote{source: p, errors: append([]error(nil), plan.report.Errors[before:]...)})
+		}
+		return result
+	}
+}
+
+// quarantine copies the notes that could not be migrated, unmodified, to
+// the failed directory (see MigrateOptions.FailedDirectory), each with a
+// sidecar file (note.md.error.txt) describing its errors, so that nothing
+// is lost and they can be fixed and migrated again. It returns the number
+// of notes copied.
+func (plan *Plan) quarantine(failed []failedNote) int {
+	options := plan.options
+	root := filepath.Join(plan.To, options.FailedDirectory)
+	var copied int
+	for _, note := range failed {
+		relPath, err := filepath.Rel(plan.From, note.source)
+		if err != nil {
+			relPath = filepath.Base(note.source)
+		}
+		dest := filepath.Join(root, relPath)
+		err = os.MkdirAll(filepath.Dir(dest), options.dirMode())
+		if err != nil {
+			options.log.Printf("WARNING: cannot copy the failed note %s: %s\n", relPath, err)
+			continue
+		}
+
+		var description strings.Builder
+		fmt.Fprintf(&description, "%s could not be migrated:\n", note.source)
+		for _, e := range note.errors {
+			fmt.Fprintf(&description, "- %s\n", e)
+		}
+		// The note may be the cause of the failure (it cannot be read)
+		if err = copyFile(context.Background(), note.source, dest, options.fileMode(), nil); err != nil {
+			fmt.Fprintf(&description, "- the note could not be copied: %s\n", err)
+		} else {
+			copied++
+		}
+		err = ioutil.WriteFile(dest+".error.txt", []byte(description.String()), options.fileMode())
+		if err != nil {
+			options.log.Printf("WARNING: cannot describe the failed note %s: %s\n", relPath, err)
+		}
+	}
+	return copied
+}
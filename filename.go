@@ -0,0 +1,131 @@
+package bearnotes
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultFilenamePattern matches the Bear export filenames having an
+// optional leading date (2020-01-31 Title) and an optional conflict
+// counter (Title 2).
+const DefaultFilenamePattern = `^(?:(?P<date>\d{4}-\d{2}-\d{2}) +)?(?P<title>.+?)(?: +(?P<counter>\d+))?$`
+
+// DefaultFilenameDateLayout is the layout (see time.Parse) of the dates
+// matched by DefaultFilenamePattern.
+const DefaultFilenameDateLayout = "2006-01-02"
+
+// FilenameMetadata holds the metadata embedded in the filename of a note.
+type FilenameMetadata struct {
+	Title   string    // The clean title, without date nor counter
+	Counter int       // The conflict counter (Title 2), 0 if there is none
+	Date    time.Time // The date, zero if there is none
+}
+
+// FilenameParser extracts the metadata embedded in the filename of notes.
+type FilenameParser struct {
+	re         *regexp.Regexp
+	dateLayout string
+}
+
+// NewFilenameParser returns a FilenameParser matching filenames (without
+// extension) against pattern, a regular expression having a "title" named
+// group and optionally "counter" and "date" named groups. Dates are parsed
+// with dateLayout (see time.Parse).
+func NewFilenameParser(pattern string, dateLayout string) (*FilenameParser, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if subexpIndex(re, "title") < 0 {
+		return nil, fmt.Errorf("filename pattern '%s' has no 'title' named group", pattern)
+	}
+	return &FilenameParser{re: re, dateLayout: dateLayout}, nil
+}
+
+// Parse extracts the metadata from the filename of a note (without
+// extension). The title is the name itself when it does not match.
+// Dates are in local time.
+func (parser *FilenameParser) Parse(name string) FilenameMetadata {
+	return parser.ParseInLocation(name, time.Local)
+}
+
+// ParseInLocation is like Parse but dates are in the given location.
+func (parser *FilenameParser) ParseInLocation(name string, location *time.Location) FilenameMetadata {
+	metadata := FilenameMetadata{Title: name}
+	match := parser.re.FindStringSubmatch(name)
+	if match == nil {
+		return metadata
+	}
+	if title := strings.TrimSpace(match[subexpIndex(parser.re, "title")]); title != "" {
+		metadata.Title = title
+	}
+	if i := subexpIndex(parser.re, "counter"); i >= 0 && match[i] != "" {
+		metadata.Counter, _ = strconv.Atoi(match[i])
+	}
+	if i := subexpIndex(parser.re, "date"); i >= 0 && match[i] != "" {
+		metadata.Date, _ = time.ParseInLocation(parser.dateLayout, match[i], location)
+	}
+	return metadata
+}
+
+// subexpIndex returns the index of the named group of re, -1 if there is none.
+func subexpIndex(re *regexp.Regexp, name string) int {
+	for i, subexp := range re.SubexpNames() {
+		if subexp == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// numberedName returns the filename with a counter before its extension
+// (notes-2.md), to tell apart files having the same name.
+func numberedName(name string, n int) string {
+	ext := filepath.Ext(name)
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, ext), n, ext)
+}
+
+// applyFilenameMetadata flags the notes that look like a conflicted copy of
+// another note (Title 2 next to Title) and renames the other notes after
+// their clean title, unless it collides with another note. The titles of
+// static site notes are slugified as specified by slug.
+func applyFilenameMetadata(notes []*PlannedNote, report *MigrationReport, rename bool, slug SlugOptions) {
+	originals := make(map[string]bool)    // source directory + title
+	destinations := make(map[string]bool) // destination paths
+	for _, planned := range notes {
+		if planned.Metadata.Counter == 0 {
+			originals[filepath.Join(filepath.Dir(planned.Source), planned.Metadata.Title)] = true
+		}
+		destinations[planned.Destination] = true
+	}
+
+	for _, planned := range notes {
+		if planned.Metadata.Counter > 0 {
+			if originals[filepath.Join(filepath.Dir(planned.Source), planned.Metadata.Title)] {
+				report.warn(planned.name, ErrConflictedCopy, fmt.Errorf("the note looks like a conflicted copy of '%s'", planned.Metadata.Title))
+			}
+			continue
+		}
+
+		ext := filepath.Ext(planned.Destination)
+		name := strings.TrimSuffix(filepath.Base(planned.Destination), ext)
+		fileName := planned.Metadata.Title
+		if planned.siteRoot != "" {
+			fileName = siteFilename(fileName, slug)
+		}
+		destination := filepath.Join(filepath.Dir(planned.Destination), fileName+ext)
+		if !rename || name == fileName || destinations[destination] {
+			continue
+		}
+		delete(destinations, planned.Destination)
+		destinations[destination] = true
+		planned.Destination = destination
+		if planned.Note.FrontMatter["title"] == strings.TrimSuffix(planned.name, filepath.Ext(planned.name)) {
+			planned.Note.FrontMatter["title"] = planned.Metadata.Title
+		}
+	}
+}
@@ -0,0 +1,19 @@
+//go:build darwin
+// +build darwin
+
+package bearnotes
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// creationTime returns the creation time of a file. Bear sets it to the
+// creation date of the note when exporting.
+func creationTime(info os.FileInfo) time.Time {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return time.Unix(stat.Birthtimespec.Unix())
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,15 @@
+//go:build !darwin
+// +build !darwin
+
+package bearnotes
+
+import (
+	"os"
+	"time"
+)
+
+// creationTime returns the creation time of a file. Since it is not
+// available on this platform, the modification time is used instead.
+func creationTime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
@@ -0,0 +1,29 @@
+//go:build darwin
+// +build darwin
+
+package bearnotes
+
+import (
+	"bytes"
+	"encoding/xml"
+
+	"golang.org/x/sys/unix"
+)
+
+// finderTagsSupported is true on platforms supporting Finder tags.
+const finderTagsSupported = true
+
+// setFinderTags sets the Finder tags of the file at p, so that Finder and
+// Spotlight can search for them. Tags are stored as a property list in the
+// com.apple.metadata:_kMDItemUserTags extended attribute.
+func setFinderTags(p string, tags []string) error {
+	var plist bytes.Buffer
+	plist.WriteString(`<?xml version="1.0" encoding="UTF-8"?><!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd"><plist version="1.0"><array>`)
+	for _, tag := range tags {
+		plist.WriteString("<string>")
+		xml.EscapeText(&plist, []byte(tag))
+		plist.WriteString("</string>")
+	}
+	plist.WriteString("</array></plist>")
+	return unix.Setxattr(p, "com.apple.metadata:_kMDItemUserTags", plist.Bytes(), 0)
+}
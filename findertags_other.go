@@ -0,0 +1,14 @@
+//go:build !darwin
+// +build !darwin
+
+package bearnotes
+
+import "errors"
+
+// finderTagsSupported is true on platforms supporting Finder tags.
+const finderTagsSupported = false
+
+// setFinderTags is not supported on this platform.
+func setFinderTags(p string, tags []string) error {
+	return errors.New("Finder tags are only supported on macOS")
+}
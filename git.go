@@ -0,0 +1,59 @@
+package bearnotes
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// git runs a git command in dir and returns its standard output.
+func git(dir string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// gitCommit initializes a git repository in dir (if there is none yet)
+// and commits all changes with the given message.
+// Nothing is committed if there is no change.
+func gitCommit(dir string, message string) error {
+	_, err := os.Stat(filepath.Join(dir, ".git"))
+	if os.IsNotExist(err) {
+		_, err = git(dir, "init")
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = git(dir, "add", "-A")
+	if err != nil {
+		return err
+	}
+
+	status, err := git(dir, "status", "--porcelain")
+	if err != nil {
+		return err
+	}
+	if status == "" {
+		return nil
+	}
+
+	// Provide a default identity if the user did not configure one
+	args := []string{"commit", "-q", "-m", message}
+	_, err = git(dir, "config", "user.email")
+	if err != nil {
+		args = append([]string{"-c", "user.name=bearnotes", "-c", "user.email=bearnotes@localhost"}, args...)
+	}
+	_, err = git(dir, args...)
+	return err
+}
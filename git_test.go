@@ -0,0 +1,66 @@
+package bearnotes
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGitCommit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	from := writeTestFiles(t, map[string]string{
+		"note.md": "#work\n",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml": "work:\n  handling_strategy: same-folder\n  target_directory: work\n  target_tag_name: work\n",
+	})
+	defer os.RemoveAll(to)
+	dir := filepath.Join(to, "notes")
+	commits := func() string {
+		count, err := git(dir, "rev-list", "--count", "HEAD")
+		assert.NoError(t, err, "commits must be counted")
+		return strings.TrimSpace(count)
+	}
+
+	// The repository is created by the first migration
+	options := MigrateOptions{GitCommit: true}
+	_, err := MigrateNotes(context.Background(), from, dir, filepath.Join(to, "tags.yaml"), options)
+	assert.NoError(t, err, "migration must succeed")
+	assert.Equal(t, "1", commits(), "the migrated notes must be committed")
+	files, err := git(dir, "ls-files")
+	assert.NoError(t, err, "committed files must be listed")
+	assert.Contains(t, files, "work/note.md", "the migrated notes must be committed")
+
+	// Nothing is committed without change
+	assert.NoError(t, gitCommit(dir, "No change"), "nothing must be committed")
+	assert.Equal(t, "1", commits(), "there must be no empty commit")
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(from, "note.md"), []byte("#work\nEdited\n"), 0644), "note must be written")
+	_, err = MigrateNotes(context.Background(), from, dir, filepath.Join(to, "tags.yaml"), options)
+	assert.NoError(t, err, "migration must succeed")
+	assert.Equal(t, "2", commits(), "changes must be committed")
+
+	// A destination that cannot be a repository is reported
+	broken := filepath.Join(to, "broken")
+	assert.NoError(t, os.MkdirAll(broken, 0755), "directory must be created")
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(broken, ".git"), []byte("not a repository\n"), 0644), "file must be written")
+	err = gitCommit(broken, "Broken")
+	assert.Error(t, err, "destinations that are not a repository must be reported")
+
+	// A missing git command is reported
+	path := os.Getenv("PATH")
+	defer os.Setenv("PATH", path)
+	os.Setenv("PATH", to)
+	err = gitCommit(to, "No git")
+	if assert.Error(t, err, "a missing git command must be reported") {
+		assert.Contains(t, err.Error(), "git init", "the command must be named")
+	}
+}
@@ -0,0 +1,86 @@
+package bearnotes
+
+import (
+	"fmt"
+)
+
+// globalEntry is the entry of the settings of the tag file (see
+// settingsEntry) holding the global options.
+const globalEntry = "global"
+
+// GlobalOptions holds the settings of a migration stored in the global
+// section of a YAML tag file, so that a migration can be reproduced from
+// the tag file alone. They apply when the matching setting is not given
+// to the migration (options and command line flags take precedence).
+type GlobalOptions struct {
+	// Profile is the name of the target application profile (see
+	// LookupProfile). It is applied by the command line only.
+	Profile string `yaml:"profile,omitempty"`
+
+	// HandlingStrategy is the handling strategy of the notes whose tags
+	// set none (see MigrateOptions.DefaultHandlingStrategy)
+	HandlingStrategy HandlingStrategy `yaml:"handling_strategy,omitempty"`
+
+	// AssetDirectory is the directory receiving the images and file
+	// attachments (see MigrateOptions.AssetDirectory)
+	AssetDirectory string `yaml:"asset_directory,omitempty"`
+
+	// AssetDirectories are the directories receiving the images and file
+	// attachments, by type (see MigrateOptions.AssetDirectories)
+	AssetDirectories map[string]string `yaml:"asset_directories,omitempty"`
+
+	// KeywordsField and CategoriesField are the front matter fields
+	// listing the tags of the notes (see KeywordOptions)
+	KeywordsField   string `yaml:"keywords_field,omitempty"`
+	CategoriesField string `yaml:"categories_field,omitempty"`
+
+	// SourceLink adds a link opening the original note in Bear
+	// (see MigrateOptions.SourceLink)
+	SourceLink string `yaml:"source_link,omitempty"`
+
+	// Timezone is the time zone of the dates written in the notes
+	// (see MigrateOptions.Timezone)
+	Timezone string `yaml:"timezone,omitempty"`
+}
+
+// LoadGlobalOptions reads the global section of a tag configuration file.
+// Tag files in CSV format have no global section.
+func LoadGlobalOptions(tagFile string) (GlobalOptions, error) {
+	var global GlobalOptions
+	err := loadSettingsEntry(tagFile, globalEntry, &global)
+	return global, err
+}
+
+// apply sets the options that are not set yet from the global options.
+func (global GlobalOptions) apply(options *MigrateOptions) {
+	if options.DefaultHandlingStrategy == "" {
+		options.DefaultHandlingStrategy = global.HandlingStrategy
+	}
+	if options.AssetDirectory == "" {
+		options.AssetDirectory = global.AssetDirectory
+	}
+	if options.AssetDirectories == nil {
+		options.AssetDirectories = global.AssetDirectories
+	}
+	if options.Keywords.Field == "" {
+		options.Keywords.Field = global.KeywordsField
+	}
+	if options.Keywords.Categories == "" {
+		options.Keywords.Categories = global.CategoriesField
+	}
+	if options.SourceLink == SourceLinkNone {
+		options.SourceLink = global.SourceLink
+	}
+	if options.Timezone == "" {
+		options.Timezone = global.Timezone
+	}
+}
+
+// checkDefaultHandlingStrategy returns an error if the default handling
+// strategy is unknown.
+func checkDefaultHandlingStrategy(strategy HandlingStrategy) error {
+	if !strategy.known() {
+		return fmt.Errorf("unknown default handling strategy '%s' (available strategies: %s)", strategy, strategyNames())
+	}
+	return nil
+}
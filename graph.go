@@ -0,0 +1,211 @@
+package bearnotes
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Regular expression to detect links between notes.
+// Examples:
+//  - [[My note]]
+//  - [[My note/Some heading]]
+//  - [[My note|alias]]
+var reWikiLink = regexp.MustCompile(`\[\[([^\]|/#]+)[^\]]*\]\]`)
+
+// Node types of a Graph
+const (
+	GraphNote = "note"
+	GraphTag  = "tag"
+)
+
+// GraphNode is a note or a tag of a Graph.
+type GraphNode struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+	Type  string `json:"type"` // GraphNote or GraphTag
+}
+
+// GraphEdge is a link between two notes or between a note and a tag.
+type GraphEdge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Type   string `json:"type"` // "link" or "tag"
+}
+
+// Graph holds the links between notes and the relations between notes
+// and tags.
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// BuildGraph walks through recursively the notes directory and returns the
+// graph of the links between notes ([[Note title]]) and of their tags.
+// Links to notes that cannot be found are left out.
+func BuildGraph(ctx context.Context, notesDir string, options ParseOptions) (*Graph, error) {
+	type graphNote struct {
+		id    string
+		links []string
+		tags  []string
+	}
+	var notes []graphNote
+	titles := make(map[string]string) // normalized title => note id
+
+	err := filepath.Walk(notesDir,
+		func(p string, info os.FileInfo, err error) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			// Errors are reported during the migration, not here
+			if err != nil || info.IsDir() || !strings.HasSuffix(info.Name(), ".md") {
+				return nil
+			}
+
+			content, err := ioutil.ReadFile(p)
+			if err != nil {
+				return nil
+			}
+			relPath, _ := filepath.Rel(notesDir, p)
+			note := graphNote{id: filepath.ToSlash(relPath)}
+			titles[graphTitle(strings.TrimSuffix(info.Name(), ".md"))] = note.id
+			for _, tag := range LoadNoteWithOptions(content, options).Tags {
+				note.tags = append(note.tags, tagKey(tag.Name, options.CaseSensitiveTags))
+			}
+			for _, match := range reWikiLink.FindAllSubmatch(content, -1) {
+				note.links = append(note.links, graphTitle(string(match[1])))
+			}
+			notes = append(notes, note)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	var graph Graph
+	tags := make(map[string]bool)
+	edges := make(map[GraphEdge]bool)
+	addEdge := func(edge GraphEdge) {
+		if !edges[edge] {
+			edges[edge] = true
+			graph.Edges = append(graph.Edges, edge)
+		}
+	}
+	for _, note := range notes {
+		graph.Nodes = append(graph.Nodes, GraphNode{ID: note.id, Label: strings.TrimSuffix(path.Base(note.id), ".md"), Type: GraphNote})
+		for _, link := range note.links {
+			if target, ok := titles[link]; ok && target != note.id {
+				addEdge(GraphEdge{Source: note.id, Target: target, Type: "link"})
+			}
+		}
+		for _, tag := range note.tags {
+			if !tags[tag] {
+				tags[tag] = true
+				graph.Nodes = append(graph.Nodes, GraphNode{ID: "#" + tag, Label: "#" + tag, Type: GraphTag})
+			}
+			addEdge(GraphEdge{Source: note.id, Target: "#" + tag, Type: "tag"})
+		}
+	}
+	sort.SliceStable(graph.Nodes, func(i, j int) bool {
+		return graph.Nodes[i].ID < graph.Nodes[j].ID
+	})
+
+	return &graph, nil
+}
+
+// graphTitle normalizes a note title, so that links match titles
+// regardless of Unicode encoding and case.
+func graphTitle(title string) string {
+	return strings.ToLower(strings.TrimSpace(norm.NFC.String(title)))
+}
+
+// WriteJSON writes the graph in JSON format.
+func (graph *Graph) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(graph)
+}
+
+// gexf is the XML document of the GEXF format (https://gexf.net/).
+type gexf struct {
+	XMLName xml.Name `xml:"http://gexf.net/1.3 gexf"`
+	Version string   `xml:"version,attr"`
+	Graph   struct {
+		DefaultEdgeType string `xml:"defaultedgetype,attr"`
+		Attributes      struct {
+			Class     string `xml:"class,attr"`
+			Attribute struct {
+				ID    string `xml:"id,attr"`
+				Title string `xml:"title,attr"`
+				Type  string `xml:"type,attr"`
+			} `xml:"attribute"`
+		} `xml:"attributes"`
+		Nodes []gexfNode `xml:"nodes>node"`
+		Edges []gexfEdge `xml:"edges>edge"`
+	} `xml:"graph"`
+}
+
+type gexfNode struct {
+	ID        string `xml:"id,attr"`
+	Label     string `xml:"label,attr"`
+	AttValues struct {
+		AttValue struct {
+			For   string `xml:"for,attr"`
+			Value string `xml:"value,attr"`
+		} `xml:"attvalue"`
+	} `xml:"attvalues"`
+}
+
+type gexfEdge struct {
+	ID     string `xml:"id,attr"`
+	Source string `xml:"source,attr"`
+	Target string `xml:"target,attr"`
+	Label  string `xml:"label,attr"`
+}
+
+// WriteGEXF writes the graph in GEXF format, suitable for Gephi.
+// The type of the nodes (note or tag) is stored in the "type" attribute.
+func (graph *Graph) WriteGEXF(w io.Writer) error {
+	var doc gexf
+	doc.Version = "1.3"
+	doc.Graph.DefaultEdgeType = "directed"
+	doc.Graph.Attributes.Class = "node"
+	doc.Graph.Attributes.Attribute.ID = "type"
+	doc.Graph.Attributes.Attribute.Title = "type"
+	doc.Graph.Attributes.Attribute.Type = "string"
+	for _, node := range graph.Nodes {
+		n := gexfNode{ID: node.ID, Label: node.Label}
+		n.AttValues.AttValue.For = "type"
+		n.AttValues.AttValue.Value = node.Type
+		doc.Graph.Nodes = append(doc.Graph.Nodes, n)
+	}
+	for i, edge := range graph.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, gexfEdge{ID: strconv.Itoa(i), Source: edge.Source, Target: edge.Target, Label: edge.Type})
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	err = encoder.Encode(doc)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w)
+	return err
+}
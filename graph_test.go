@@ -0,0 +1,40 @@
+package bearnotes
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildGraph(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"First note.md":        "#foo\nSee [[Second note]] and [[Missing note]].\n",
+		"sub/Second note.md":   "#foo #bar\nBack to [[first NOTE|the first one]].\n",
+		"sub/Isolated note.md": "Nothing here\n",
+	})
+	defer os.RemoveAll(dir)
+
+	graph, err := BuildGraph(context.Background(), dir, ParseOptions{})
+	assert.NoError(t, err, "graph must be built")
+	assert.Equal(t, []GraphNode{
+		{ID: "#bar", Label: "#bar", Type: GraphTag},
+		{ID: "#foo", Label: "#foo", Type: GraphTag},
+		{ID: "First note.md", Label: "First note", Type: GraphNote},
+		{ID: "sub/Isolated note.md", Label: "Isolated note", Type: GraphNote},
+		{ID: "sub/Second note.md", Label: "Second note", Type: GraphNote},
+	}, graph.Nodes, "all notes and tags must be nodes")
+	assert.ElementsMatch(t, []GraphEdge{
+		{Source: "First note.md", Target: "sub/Second note.md", Type: "link"},
+		{Source: "First note.md", Target: "#foo", Type: "tag"},
+		{Source: "sub/Second note.md", Target: "First note.md", Type: "link"},
+		{Source: "sub/Second note.md", Target: "#foo", Type: "tag"},
+		{Source: "sub/Second note.md", Target: "#bar", Type: "tag"},
+	}, graph.Edges, "links and tags must be edges")
+
+	var gexf bytes.Buffer
+	assert.NoError(t, graph.WriteGEXF(&gexf), "GEXF must be written")
+	assert.Contains(t, gexf.String(), `<edge id="0" source="First note.md" target="sub/Second note.md" label="link"></edge>`, "edges must be written")
+}
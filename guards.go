@@ -0,0 +1,72 @@
+package bearnotes
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// initial returns the name of the group-by-initial bucket of a note: its
+// uppercase initial letter, "0-9" for digits or "#" for anything else.
+func initial(noteName string) string {
+	for _, r := range strings.TrimSpace(noteName) {
+		if unicode.IsLetter(r) {
+			return strings.ToUpper(string(r))
+		}
+		if unicode.IsDigit(r) {
+			return "0-9"
+		}
+		break
+	}
+	return "#"
+}
+
+// checkFolderGuards records a warning in the plan when the
+// one-note-per-folder strategy creates more than MaxFolders folders in a
+// tag directory, and when notes are stored more than MaxFolderDepth
+// directories below the destination.
+func (plan *Plan) checkFolderGuards() {
+	folders := make(map[string]int) // tag directory => number of folders
+	var deepest string
+	var tooDeep int
+	for _, planned := range plan.Notes {
+		if planned.strategy == StrategyOneNotePerFolder {
+			folders[planned.numberingDir]++
+		}
+		if planned.root == "" {
+			continue
+		}
+		rel, err := filepath.Rel(planned.root, filepath.Dir(planned.Destination))
+		if err != nil || rel == "." {
+			continue
+		}
+		if depth := len(strings.Split(rel, string(filepath.Separator))); plan.options.MaxFolderDepth > 0 && depth > plan.options.MaxFolderDepth {
+			tooDeep++
+			if len(rel) > len(deepest) {
+				deepest = rel
+			}
+		}
+	}
+
+	var dirs []string
+	for dir, count := range folders {
+		if plan.options.MaxFolders > 0 && count > plan.options.MaxFolders {
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		plan.warn(fmt.Errorf("%w: the one-note-per-folder strategy creates %d folders in %s (more than %d), consider the group-by-initial strategy", ErrTooManyFolders, folders[dir], dir, plan.options.MaxFolders))
+	}
+	if tooDeep > 0 {
+		plan.warn(fmt.Errorf("%w: %d notes are stored more than %d directories deep (for instance in %s)", ErrTooManyFolders, tooDeep, plan.options.MaxFolderDepth, deepest))
+	}
+}
+
+// warn logs and records an issue that does not affect a single note.
+func (plan *Plan) warn(err error) {
+	plan.options.log.Printf("WARNING: %s\n", err)
+	plan.Warnings = append(plan.Warnings, err)
+}
@@ -0,0 +1,153 @@
+package bearnotes
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Regular expression to detect the Bear links to the heading of a note.
+// Examples:
+//  - [[My note/Some heading]]
+//  - [[My note/Some heading|alias]]
+var reWikiHeadingLink = regexp.MustCompile(`\[\[([^\]|#]+/[^\]|#]+)(\|[^\]]*)?\]\]`)
+
+// Regular expression to detect the Bear URLs opening a note at a heading,
+// in Markdown links.
+// Examples:
+//  - [Some heading](bear://x-callback-url/open-note?title=My%20note&header=Some%20heading)
+var reBearHeadingLink = regexp.MustCompile(`\[([^\]\n]*)\]\((bear://x-callback-url/open-note\?[^()\s]*)\)`)
+
+// headingIndex holds the headings of the notes, by normalized title (see
+// graphTitle), so that links to headings can be checked.
+type headingIndex map[string]map[string]string // note title => normalized heading => heading
+
+// buildHeadingIndex walks through recursively the notes directory and
+// returns the headings of its notes.
+func buildHeadingIndex(ctx context.Context, from string, convertHTML bool) (headingIndex, error) {
+	index := make(headingIndex)
+	err := filepath.Walk(from,
+		func(p string, info os.FileInfo, err error) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			// Errors are reported during the migration, not here
+			if err != nil || info.IsDir() || !isNoteFile(info.Name(), convertHTML) {
+				return nil
+			}
+
+			content, err := ioutil.ReadFile(p)
+			if err != nil {
+				return nil
+			}
+			headings := make(map[string]string)
+			for _, match := range reHeading.FindAllSubmatch(content, -1) {
+				heading := strings.TrimSpace(strings.TrimRight(string(match[2]), "#"))
+				headings[graphTitle(heading)] = heading
+			}
+			index[graphTitle(strings.TrimSuffix(info.Name(), filepath.Ext(info.Name())))] = headings
+			return nil
+		})
+	return index, err
+}
+
+// heading returns the title of the note and the heading of this note
+// matching the given ones. Headings are compared regardless of case, then
+// once slugified, in case of minor edits. If the heading cannot be found,
+// the returned heading is empty. If the note cannot be found, ok is false.
+func (index headingIndex) heading(title string, heading string) (string, string, bool) {
+	headings, ok := index[graphTitle(title)]
+	if !ok {
+		return "", "", false
+	}
+	if found, ok := headings[graphTitle(heading)]; ok {
+		return title, found, true
+	}
+	slug := Slugify(heading)
+	for _, found := range headings {
+		if Slugify(found) == slug {
+			return title, found, true
+		}
+	}
+	return title, "", true
+}
+
+// wikiHeading splits a Bear link to a heading ([[My note/Some heading]])
+// into the title of the note and the heading. Since titles may contain
+// slashes, the longest title found in the index wins.
+func (index headingIndex) wikiHeading(link string) (string, string, bool) {
+	if _, ok := index[graphTitle(link)]; ok {
+		return "", "", false
+	}
+	for i := strings.LastIndex(link, "/"); i > 0; i = strings.LastIndex(link[:i], "/") {
+		if title, heading, ok := index.heading(strings.TrimSpace(link[:i]), strings.TrimSpace(link[i+1:])); ok {
+			if heading == "" {
+				return title, strings.TrimSpace(link[i+1:]), false
+			}
+			return title, heading, true
+		}
+	}
+	return "", "", false
+}
+
+// rewriteHeadingLinks rewrites the Bear links to the headings of other
+// notes ([[My note/Some heading]] and bear://x-callback-url/open-note
+// URLs with a header) to the [[My note#Some heading]] syntax of Zettlr and
+// Obsidian. Links to headings that cannot be found in the linked note
+// point to the note instead and are returned as errors (ErrHeadingMissing).
+// Links to notes that cannot be found are left untouched.
+func (index headingIndex) rewriteHeadingLinks(content []byte) ([]byte, []error) {
+	var errs []error
+	link := func(title string, heading string, alias string) []byte {
+		if heading == "" {
+			return []byte("[[" + title + alias + "]]")
+		}
+		return []byte("[[" + title + "#" + heading + alias + "]]")
+	}
+
+	content = reWikiHeadingLink.ReplaceAllFunc(content, func(match []byte) []byte {
+		parts := reWikiHeadingLink.FindSubmatch(match)
+		title, heading, ok := index.wikiHeading(string(parts[1]))
+		if title == "" {
+			return match
+		}
+		if !ok {
+			errs = append(errs, fmt.Errorf("heading '%s' not found in note '%s', linking to the note", heading, title))
+			heading = ""
+		}
+		return link(title, heading, string(parts[2]))
+	})
+
+	content = reBearHeadingLink.ReplaceAllFunc(content, func(match []byte) []byte {
+		parts := reBearHeadingLink.FindSubmatch(match)
+		u, err := url.Parse(string(parts[2]))
+		if err != nil {
+			return match
+		}
+		query := u.Query()
+		title, header := query.Get("title"), query.Get("header")
+		if title == "" || header == "" {
+			return match
+		}
+		title, heading, ok := index.heading(title, header)
+		if !ok {
+			return match
+		}
+		if heading == "" {
+			errs = append(errs, fmt.Errorf("heading '%s' not found in note '%s', linking to the note", header, title))
+		}
+		var alias string
+		if text := string(parts[1]); text != "" && text != heading {
+			alias = "|" + text
+		}
+		return link(title, heading, alias)
+	})
+
+	return content, errs
+}
@@ -0,0 +1,76 @@
+package bearnotes
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+// stripHTMLTransform is the name of the transform removing the HTML clutter.
+const stripHTMLTransform = "strip-html"
+
+// Regular expression to detect the HTML residue of notes clipped from
+// emails or web pages: formatting elements (div, span, p, font, br, b,
+// strong, i, em, o:p) and non-breaking spaces. Links (<a href>) are left
+// out since Bear uses them for file attachments.
+// Examples:
+//  - <div class="gmail_quote">
+//  - <span style="font-size: 12px">
+//  - &nbsp;
+var reHTMLClutter = regexp.MustCompile(`(?i)</?(div|span|p|font|o:p|br|b|strong|i|em)(?:\s[^<>]*)?/?>|&nbsp;|&#160;|&#xa0;`)
+
+// Regular expression to detect the blank lines left by the removed elements
+var reExtraBlankLines = regexp.MustCompile(`\n[ \t]*\n(?:[ \t]*\n)+`)
+
+// stripHTML removes the HTML clutter from content, converting what can be
+// to Markdown: line breaks and the end of blocks become newlines, bold and
+// italic elements become ** and *, and non-breaking spaces become spaces.
+// It returns the cleaned up content and the number of elements removed.
+func stripHTML(content []byte) ([]byte, int) {
+	var removed int
+	content = reHTMLClutter.ReplaceAllFunc(content, func(match []byte) []byte {
+		removed++
+		if match[0] == '&' {
+			return []byte(" ")
+		}
+		parts := reHTMLClutter.FindSubmatch(match)
+		closing := bytes.HasPrefix(match, []byte("</"))
+		switch strings.ToLower(string(parts[1])) {
+		case "br":
+			return []byte("\n")
+		case "div", "p":
+			if closing {
+				return []byte("\n")
+			}
+		case "b", "strong":
+			return []byte("**")
+		case "i", "em":
+			return []byte("*")
+		}
+		return nil
+	})
+	if removed > 0 {
+		content = reExtraBlankLines.ReplaceAll(content, []byte("\n\n"))
+	}
+	return content, removed
+}
+
+// countHTMLRemoval returns a copy of transforms where the strip-html
+// transform adds the number of elements it removes to removed.
+func countHTMLRemoval(transforms []Transform, removed *int) []Transform {
+	result := make([]Transform, len(transforms))
+	for i, t := range transforms {
+		result[i] = t
+		if t.Name() == stripHTMLTransform {
+			result[i] = &funcTransform{
+				name: stripHTMLTransform,
+				apply: func(content []byte) []byte {
+					content, n := stripHTML(content)
+					*removed += n
+					return content
+				},
+			}
+		}
+	}
+	return result
+}
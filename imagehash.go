@@ -0,0 +1,211 @@
+package bearnotes
+
+import (
+	"context"
+	"image"
+	"math"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	// Image formats whose perceptual hash can be computed
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// DefaultImageDistance is the maximum number of bits differing between the
+// perceptual hashes of two visually identical images (out of 64).
+const DefaultImageDistance = 4
+
+// phashSize is the size of the grayscale thumbnail whose DCT is computed
+// and phashBits the size of the block of low frequencies kept in the hash.
+const (
+	phashSize = 32
+	phashBits = 8
+)
+
+// ImageCluster is a group of visually identical images.
+type ImageCluster struct {
+	// Images holds the path of the images, sorted
+	Images []string
+}
+
+// imageHash holds the perceptual hash of an image.
+type imageHash struct {
+	path string
+	hash uint64
+}
+
+// perceptualHash returns the perceptual hash (pHash) of the image at p: the
+// signs of the low frequencies of the DCT of a 32x32 grayscale thumbnail,
+// compared to their median. Resized, recompressed or slightly altered
+// copies of an image have hashes differing by a few bits only.
+func perceptualHash(p string) (uint64, error) {
+	fd, err := os.Open(p)
+	if err != nil {
+		return 0, err
+	}
+	defer fd.Close()
+	img, _, err := image.Decode(fd)
+	if err != nil {
+		return 0, err
+	}
+
+	// Grayscale thumbnail, each pixel being the average of the pixels it covers
+	var pixels [phashSize][phashSize]float64
+	bounds := img.Bounds()
+	if bounds.Dx() == 0 || bounds.Dy() == 0 {
+		return 0, nil
+	}
+	for y := 0; y < phashSize; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/phashSize
+		y1 := bounds.Min.Y + (y+1)*bounds.Dy()/phashSize
+		if y1 == y0 {
+			y1++
+		}
+		for x := 0; x < phashSize; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/phashSize
+			x1 := bounds.Min.X + (x+1)*bounds.Dx()/phashSize
+			if x1 == x0 {
+				x1++
+			}
+			var sum float64
+			for j := y0; j < y1; j++ {
+				for i := x0; i < x1; i++ {
+					r, g, b, _ := img.At(i, j).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+				}
+			}
+			pixels[y][x] = sum / float64((x1-x0)*(y1-y0))
+		}
+	}
+
+	// Low frequencies of the DCT-II of the thumbnail
+	var cosines [phashBits][phashSize]float64
+	for u := 0; u < phashBits; u++ {
+		for x := 0; x < phashSize; x++ {
+			cosines[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / (2 * phashSize))
+		}
+	}
+	var frequencies []float64
+	for v := 0; v < phashBits; v++ {
+		for u := 0; u < phashBits; u++ {
+			var sum float64
+			for y := 0; y < phashSize; y++ {
+				for x := 0; x < phashSize; x++ {
+					sum += pixels[y][x] * cosines[u][x] * cosines[v][y]
+				}
+			}
+			frequencies = append(frequencies, sum)
+		}
+	}
+
+	// The first frequency (the average color) is left out of the median
+	sorted := append([]float64(nil), frequencies[1:]...)
+	sort.Float64s(sorted)
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+	var hash uint64
+	for i, frequency := range frequencies {
+		if frequency > median {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash, nil
+}
+
+// clusterImages groups the images whose perceptual hashes differ by at
+// most maxDistance bits. Images that cannot be decoded are left out, with
+// a message to the migration log file of logger.
+func clusterImages(ctx context.Context, paths []string, maxDistance int, logger *migrationLogger) ([]ImageCluster, error) {
+	var hashes []imageHash
+	for _, p := range paths {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		hash, err := perceptualHash(p)
+		if err != nil {
+			logger.debugf("DEBUG %s: no perceptual hash: %s\n", p, err)
+			continue
+		}
+		hashes = append(hashes, imageHash{path: p, hash: hash})
+	}
+
+	// Union-find of similar images
+	parent := make([]int, len(hashes))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i := range hashes {
+		for j := i + 1; j < len(hashes); j++ {
+			if bits.OnesCount64(hashes[i].hash^hashes[j].hash) <= maxDistance {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	groups := make(map[int][]string)
+	for i, hash := range hashes {
+		root := find(i)
+		groups[root] = append(groups[root], hash.path)
+	}
+	var clusters []ImageCluster
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		sort.Strings(group)
+		clusters = append(clusters, ImageCluster{Images: group})
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		return clusters[i].Images[0] < clusters[j].Images[0]
+	})
+	return clusters, nil
+}
+
+// FindSimilarImages walks through recursively the directory and returns the
+// clusters of visually identical images (PNG, JPEG and GIF), whose
+// perceptual hashes differ by at most maxDistance bits (see
+// DefaultImageDistance). Paths are relative to the directory.
+//
+// Images are only reported: which copy to keep is up to the user.
+func FindSimilarImages(ctx context.Context, dir string, maxDistance int) ([]ImageCluster, error) {
+	var paths []string
+	err := filepath.Walk(dir,
+		func(p string, info os.FileInfo, err error) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil || info.IsDir() {
+				return nil
+			}
+			switch strings.ToLower(filepath.Ext(p)) {
+			case ".png", ".jpg", ".jpeg", ".gif":
+				paths = append(paths, p)
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	clusters, err := clusterImages(ctx, paths, maxDistance, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, cluster := range clusters {
+		for i, p := range cluster.Images {
+			cluster.Images[i], _ = filepath.Rel(dir, p)
+		}
+	}
+	return clusters, nil
+}
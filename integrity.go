@@ -0,0 +1,88 @@
+package bearnotes
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/unicode"
+)
+
+// Byte order marks found at the start of text files
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// integrity holds the encoding issues of the content of a note, that
+// would make the parser produce garbage.
+type integrity struct {
+	bom         bool // UTF-8 byte order mark
+	utf16       bool // UTF-16 encoding, told by its byte order mark
+	invalid     int  // Number of invalid UTF-8 sequences
+	invalidLine int  // Line of the first invalid UTF-8 sequence
+	nulls       int  // Number of null bytes
+}
+
+// checkIntegrity returns the encoding issues of content.
+func checkIntegrity(content []byte) integrity {
+	var check integrity
+	if bytes.HasPrefix(content, bomUTF16LE) || bytes.HasPrefix(content, bomUTF16BE) {
+		check.utf16 = true
+		return check
+	}
+	check.bom = bytes.HasPrefix(content, bomUTF8)
+	check.nulls = bytes.Count(content, []byte{0})
+	for i := 0; i < len(content); {
+		r, size := utf8.DecodeRune(content[i:])
+		if r == utf8.RuneError && size == 1 {
+			if check.invalid == 0 {
+				check.invalidLine = bytes.Count(content[:i], []byte("\n")) + 1
+			}
+			check.invalid++
+		}
+		i += size
+	}
+	return check
+}
+
+// corrupt returns true if the note cannot be migrated without being
+// repaired.
+func (check integrity) corrupt() bool {
+	return check.utf16 || check.invalid > 0 || check.nulls > 0
+}
+
+// String describes the issues, "" if there is none.
+func (check integrity) String() string {
+	var issues []string
+	if check.utf16 {
+		issues = append(issues, "UTF-16 encoding")
+	}
+	if check.bom {
+		issues = append(issues, "byte order mark")
+	}
+	if check.invalid > 0 {
+		issues = append(issues, fmt.Sprintf("%d invalid UTF-8 sequences (first at line %d)", check.invalid, check.invalidLine))
+	}
+	if check.nulls > 0 {
+		issues = append(issues, fmt.Sprintf("%d null bytes", check.nulls))
+	}
+	return strings.Join(issues, ", ")
+}
+
+// repair returns content as valid UTF-8 text: UTF-16 is decoded, the byte
+// order mark and null bytes are removed and invalid sequences are replaced
+// with the replacement character (U+FFFD).
+func (check integrity) repair(content []byte) []byte {
+	if check.utf16 {
+		decoded, err := unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM).NewDecoder().Bytes(content)
+		if err == nil {
+			return decoded
+		}
+	}
+	content = bytes.TrimPrefix(content, bomUTF8)
+	content = bytes.ReplaceAll(content, []byte{0}, nil)
+	return bytes.ToValidUTF8(content, []byte(string(utf8.RuneError)))
+}
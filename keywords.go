@@ -0,0 +1,116 @@
+package bearnotes
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Representations of nested tags in the front matter (see KeywordOptions)
+const (
+	NestingPath      = "path"      // foo/bar
+	NestingFlat      = "flat"      // foo-bar (see KeywordOptions.Delimiter)
+	NestingHierarchy = "hierarchy" // foo, foo/bar
+)
+
+// KeywordOptions specifies how the tags of a note are listed in its front
+// matter. The zero value lists no tag.
+type KeywordOptions struct {
+	// Field is the name of the front matter field ("tags", "keywords", etc.).
+	// If Field is the empty string, tags are not listed in the front matter.
+	Field string
+
+	// Nesting is the representation of nested tags: NestingPath (default),
+	// NestingFlat or NestingHierarchy (each tag along with its parents).
+	Nesting string
+
+	// Delimiter replaces the slashes of nested tags with NestingFlat
+	// (default "-").
+	Delimiter string
+
+	// Scalar writes the tags as a comma-separated string instead of a
+	// YAML list.
+	Scalar bool
+
+	// Categories is the name of the front matter field ("categories")
+	// receiving the components of the first nested tag of the note
+	// (#work/project/alpha gives work, project and alpha), separately from
+	// Field. If Categories is the empty string, no categories are written.
+	Categories string
+}
+
+// checkKeywordOptions returns an error if the representation of nested tags
+// is unknown.
+func checkKeywordOptions(options KeywordOptions) error {
+	switch options.Nesting {
+	case "", NestingPath, NestingFlat, NestingHierarchy:
+		return nil
+	}
+	return fmt.Errorf("unknown nested tag representation '%s' (available representations: %s, %s, %s)", options.Nesting, NestingPath, NestingFlat, NestingHierarchy)
+}
+
+// keywords returns the tags as represented in the front matter, without
+// duplicates.
+func (options KeywordOptions) keywords(tags []string) []string {
+	var keywords []string
+	add := func(keyword string) {
+		if !containsString(keywords, keyword) {
+			keywords = append(keywords, keyword)
+		}
+	}
+	for _, tag := range tags {
+		switch options.Nesting {
+		case NestingFlat:
+			delimiter := options.Delimiter
+			if delimiter == "" {
+				delimiter = "-"
+			}
+			add(strings.ReplaceAll(tag, "/", delimiter))
+		case NestingHierarchy:
+			components := strings.Split(tag, "/")
+			for i := range components {
+				add(strings.Join(components[:i+1], "/"))
+			}
+		default:
+			add(tag)
+		}
+	}
+	return keywords
+}
+
+// categories returns the components of the first nested tag, if any.
+func categories(tags []string) []string {
+	for _, tag := range tags {
+		if strings.Contains(tag, "/") {
+			return strings.Split(tag, "/")
+		}
+	}
+	return nil
+}
+
+// apply lists the tags (and categories) in the front matter of the note,
+// as specified by the options.
+func (options KeywordOptions) apply(note *Note, tags []string) {
+	if options.Categories != "" {
+		if categories := categories(tags); categories != nil {
+			if note.FrontMatterLists == nil {
+				note.FrontMatterLists = make(map[string][]string)
+			}
+			note.FrontMatterLists[options.Categories] = categories
+		}
+	}
+	if options.Field == "" || len(tags) == 0 {
+		return
+	}
+	keywords := options.keywords(tags)
+	if options.Scalar {
+		if note.FrontMatter == nil {
+			note.FrontMatter = make(map[string]string)
+		}
+		note.FrontMatter[options.Field] = strings.Join(keywords, ", ")
+		return
+	}
+	if note.FrontMatterLists == nil {
+		note.FrontMatterLists = make(map[string][]string)
+	}
+	note.FrontMatterLists[options.Field] = keywords
+}
@@ -0,0 +1,88 @@
+package bearnotes
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Layouts of the target directory (see MigrateOptions.Layout)
+const (
+	// LayoutDefault stores the notes as instructed by the tag file,
+	// along with their images and file attachments.
+	LayoutDefault = ""
+
+	// LayoutNotable stores all the notes in notes/ and all the images and
+	// file attachments in attachments/. Tags are listed in the front matter
+	// (tags: [...]), as expected by Notable.
+	LayoutNotable = "notable"
+
+	// LayoutHugo stores the notes as drafts in content/<section>/ and their
+	// images and file attachments in static/<section>/, the section being
+	// the target directory of the tag file (posts by default).
+	LayoutHugo = "hugo"
+
+	// LayoutJekyll stores the notes as drafts in _drafts/ and their images
+	// and file attachments in assets/.
+	LayoutJekyll = "jekyll"
+)
+
+// checkLayout returns an error if the layout of the target directory is unknown.
+func checkLayout(layout string) error {
+	switch layout {
+	case LayoutDefault, LayoutNotable, LayoutHugo, LayoutJekyll:
+		return nil
+	}
+	return fmt.Errorf("unknown layout '%s' (available layouts: %s, %s, %s)", layout, LayoutNotable, LayoutHugo, LayoutJekyll)
+}
+
+// isStaticSite returns true if the layout targets a static site generator.
+func isStaticSite(layout string) bool {
+	return layout == LayoutHugo || layout == LayoutJekyll
+}
+
+// siteSection returns the Hugo section of a note, from its target directory.
+func siteSection(targetDirectory string, slug SlugOptions) string {
+	var components []string
+	for _, component := range strings.Split(targetDirectory, "/") {
+		if component := slug.Slugify(component); component != "" {
+			components = append(components, component)
+		}
+	}
+	if len(components) == 0 {
+		return "posts"
+	}
+	return filepath.Join(components...)
+}
+
+// siteFilename returns the filename (without extension) of a note in a
+// static site: its slugified title.
+func siteFilename(noteName string, options SlugOptions) string {
+	if slug := options.Slugify(noteName); slug != "" {
+		return slug
+	}
+	return noteName
+}
+
+// setSiteFrontMatter adds the title, date and draft status expected by
+// static site generators to the front matter of the note. Fields already
+// present are kept.
+func setSiteFrontMatter(note *Note, layout string, title string, created time.Time) {
+	if note.FrontMatter == nil {
+		note.FrontMatter = make(map[string]string)
+	}
+	if _, ok := note.FrontMatter["title"]; !ok {
+		note.FrontMatter["title"] = title
+	}
+	if _, ok := note.FrontMatter["date"]; !ok && !created.IsZero() {
+		note.FrontMatter["date"] = created.Format(time.RFC3339)
+	}
+	// Jekyll drafts are told apart by their directory
+	if layout == LayoutHugo {
+		if note.FrontMatterFlags == nil {
+			note.FrontMatterFlags = make(map[string]bool)
+		}
+		note.FrontMatterFlags["draft"] = true
+	}
+}
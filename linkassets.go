@@ -0,0 +1,49 @@
+package bearnotes
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// Transfer modes of the embedded images and file attachments
+// (see MigrateOptions.LinkAssets)
+const (
+	AssetCopy     = "copy"     // Assets are copied (default)
+	AssetHardlink = "hardlink" // Assets are hard links to the Bear export
+	AssetClone    = "clone"    // Assets are copy-on-write clones (APFS, Btrfs, XFS)
+)
+
+// checkAssetMode returns an error if the transfer mode of assets is unknown.
+func checkAssetMode(mode string) error {
+	if mode != "" && mode != AssetCopy && mode != AssetHardlink && mode != AssetClone {
+		return fmt.Errorf("unknown asset transfer mode '%s' (available modes: %s, %s, %s)", mode, AssetCopy, AssetHardlink, AssetClone)
+	}
+	return nil
+}
+
+// transferAsset creates dest from src, as specified by mode. Hard links and
+// clones fall back to a regular copy when they are not possible (different
+// filesystems, unsupported filesystem, etc.). Copies get the permissions
+// fileMode, while hard links and clones keep those of src. Copies go
+// through throttle, which may be nil.
+func transferAsset(ctx context.Context, src string, dest string, mode string, fileMode os.FileMode, throttle *copyThrottle) error {
+	var err error
+	switch mode {
+	case AssetHardlink:
+		err = os.Link(src, dest)
+	case AssetClone:
+		err = cloneFile(src, dest)
+	default:
+		return copyFile(ctx, src, dest, fileMode, throttle)
+	}
+	if err == nil {
+		return nil
+	}
+
+	// The source must exist to fall back to a copy
+	if _, statErr := os.Stat(src); statErr != nil {
+		return statErr
+	}
+	return copyFile(ctx, src, dest, fileMode, throttle)
+}
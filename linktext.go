@@ -0,0 +1,40 @@
+package bearnotes
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Handling of the text of file attachment links (see MigrateOptions.LinkText)
+const (
+	LinkTextKeep     = ""         // The text is kept as-is
+	LinkTextCheck    = "check"    // Texts differing from the filename are reported
+	LinkTextFilename = "filename" // The text is regenerated from the filename
+)
+
+// checkLinkText returns an error if the handling of link texts is unknown.
+func checkLinkText(mode string) error {
+	if mode != LinkTextKeep && mode != LinkTextCheck && mode != LinkTextFilename {
+		return fmt.Errorf("unknown link text handling '%s' (available handlings: %s, %s)", mode, LinkTextCheck, LinkTextFilename)
+	}
+	return nil
+}
+
+// fixLinkText compares the visible name of a file attachment with its final
+// filename (fileName) and, as specified by mode, regenerates the name or
+// returns an error describing the mismatch.
+func fixLinkText(file *File, fileName string, mode string) error {
+	name := strings.TrimSpace(file.Name)
+	if mode == LinkTextKeep || name == fileName {
+		return nil
+	}
+	if mode == LinkTextFilename {
+		file.Name = fileName
+		return nil
+	}
+	if strings.ContainsAny(name, "/\\") && filepath.Base(filepath.FromSlash(name)) == fileName {
+		return fmt.Errorf("the text of the link to '%s' contains the old path '%s'", fileName, name)
+	}
+	return fmt.Errorf("the text of the link to '%s' is '%s'", fileName, name)
+}
@@ -0,0 +1,37 @@
+package bearnotes
+
+import (
+	"regexp"
+	"sort"
+)
+
+// Regular expression to detect math regions: $$...$$ (display math, possibly
+// spanning multiple lines) and $...$ (inline math). As in pandoc, inline math
+// cannot start with a space nor end with a space, so that amounts ("$5 and
+// $10") are not mistaken for math.
+var reMath = regexp.MustCompile(`(?s)\$\$.+?\$\$|\$[^\s$](?:[^$\n]*[^\s$\\])?\$`)
+
+// mathRegions returns the positions of the math regions of content, sorted.
+// An inline math region cannot be escaped (\$) nor directly followed by a
+// digit (pandoc rules).
+func mathRegions(content []byte) [][]int {
+	var regions [][]int
+	for _, match := range reMath.FindAllIndex(content, -1) {
+		if match[0] > 0 && content[match[0]-1] == '\\' {
+			continue
+		}
+		if match[1] < len(content) && content[match[1]] >= '0' && content[match[1]] <= '9' {
+			continue
+		}
+		regions = append(regions, match)
+	}
+	return regions
+}
+
+// inRegions returns true if position is inside one of the sorted regions.
+func inRegions(regions [][]int, position int) bool {
+	i := sort.Search(len(regions), func(i int) bool {
+		return regions[i][1] > position
+	})
+	return i < len(regions) && regions[i][0] <= position
+}
@@ -0,0 +1,41 @@
+package bearnotes
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// writeMetrics writes the outcome of a migration, started at started, to
+// the file at p in the Prometheus text format, suitable for the textfile
+// collector of the node exporter. The file is replaced atomically, so that
+// the collector never reads a partial file.
+func writeMetrics(p string, report *MigrationReport, started time.Time, migrationErr error, fileMode os.FileMode) error {
+	success := 1
+	if migrationErr != nil || len(report.Errors) > 0 {
+		success = 0
+	}
+
+	var buffer bytes.Buffer
+	metric := func(name string, help string, value interface{}) {
+		fmt.Fprintf(&buffer, "# HELP bearnotes_%s %s\n# TYPE bearnotes_%s gauge\nbearnotes_%s %v\n", name, help, name, name, value)
+	}
+	metric("notes_processed", "Number of notes processed by the last migration.", report.Notes)
+	metric("notes_succeeded", "Number of notes migrated by the last migration.", report.Successes)
+	metric("notes_failed", "Number of notes that could not be migrated by the last migration.", report.Failures())
+	metric("notes_skipped", "Number of notes skipped (duplicates or overrides) by the last migration.", report.Skipped)
+	metric("warnings", "Number of warnings of the last migration.", len(report.Warnings))
+	metric("bytes_copied", "Size in bytes of the images and file attachments transferred by the last migration.", report.BytesCopied)
+	metric("duration_seconds", "Duration of the last migration.", time.Since(started).Seconds())
+	metric("last_run_timestamp_seconds", "Time at which the last migration started.", started.Unix())
+	metric("last_run_success", "Whether the last migration migrated all notes without error (1) or not (0).", success)
+
+	tmp := p + ".tmp"
+	err := ioutil.WriteFile(tmp, buffer.Bytes(), fileMode)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
@@ -1,199 +1,465 @@
 package bearnotes
 
 import (
+	"context"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"log"
 	"os"
-	"path"
 	"path/filepath"
-	"strings"
-
-	"golang.org/x/text/unicode/norm"
-	"gopkg.in/yaml.v2"
+	"time"
 )
 
+// MigrateOptions holds the optional settings of a migration.
+type MigrateOptions struct {
+	// Parse specifies how notes are parsed
+	Parse ParseOptions
+
+	// Transforms are applied to the content of each note, before parsing
+	Transforms []Transform
+
+	// FolderTags routes the untagged notes as if they had a tag named after
+	// their parent folder in the source directory (foo/bar for a note in
+	// the foo/bar folder), as Bear does when exporting notes by tag.
+	// The pseudo-tag has to be in the tag file (see DiscoverOptions.FolderTags)
+	// and is listed in the front matter if Keywords says so.
+	FolderTags bool
+
+	// DownloadRemoteImages fetches the embedded images served over HTTP(S)
+	// and stores them along with the note, so that the vault is usable offline.
+	DownloadRemoteImages bool
+
+	// RemoteImageTimeout is the maximum time allowed to download a remote
+	// image (defaults to 30 seconds).
+	RemoteImageTimeout time.Duration
+
+	// RemoteImageMaxSize is the maximum size in bytes of a remote image
+	// (defaults to 20 MB).
+	RemoteImageMaxSize int64
+
+	// Vaults maps vault names (as found in the tag file) to their destination
+	// directory. Notes that are not assigned to a vault go to the "to" directory.
+	Vaults map[string]string
+
+	// InPlace rewrites the notes in the source directory instead of migrating
+	// them to the destination directory. Notes are not relocated and their
+	// embedded images and file attachments are left untouched.
+	InPlace bool
+
+	// NoBackup disables the backup (.bak) of the original notes in InPlace
+	// mode. Existing backups are never overwritten: the backups of the next
+	// runs are numbered (note.md-2.bak).
+	NoBackup bool
+
+	// SkipDuplicates migrates only the newest note of each cluster of
+	// similar notes (see FindDuplicates).
+	SkipDuplicates bool
+
+	// DuplicateThreshold is the minimum similarity (between 0 and 1) between
+	// two notes to consider them duplicates (defaults to 1, exact duplicates).
+	DuplicateThreshold float64
+
+	// SimilarImages reports the groups of visually identical images among
+	// the migrated images (screenshots saved under different names, resized
+	// copies, etc.), based on their perceptual hash, so that they can be
+	// consolidated afterwards. Nothing is deleted.
+	SimilarImages bool
+
+	// SimilarImageDistance is the maximum number of bits differing between
+	// the perceptual hashes of two similar images. Unlike the other fields,
+	// its zero value is not the default: 0 only groups images having the
+	// same hash and a negative value stands for DefaultImageDistance.
+	SimilarImageDistance int
+
+	// Pandoc exports the notes in the formats listed by their tags
+	// (export_formats), using pandoc, in a parallel directory tree.
+	Pandoc bool
+
+	// AltText, when not nil, generates the alternative text of the local
+	// images having none, once the transforms are applied (see
+	// AltTextProvider). Texts are cleaned up and cut to 125 characters.
+	AltText AltTextProvider
+
+	// Exporter, when not nil, replaces pandoc for the exports of the notes
+	// (Pandoc has to be true).
+	Exporter Exporter
+
+	// ExportDirectory is the directory, relative to the destination directory,
+	// holding the pandoc exports (defaults to "exports").
+	ExportDirectory string
+
+	// FailedDirectory, when not empty, is the directory (relative to the
+	// destination directory) receiving an unmodified copy of the notes that
+	// could not be migrated, each with a sidecar file (note.md.error.txt)
+	// describing its errors. It has no effect in InPlace mode.
+	FailedDirectory string
+
+	// GitCommit initializes a git repository in the destination directory
+	// (if there is none yet) and commits the migrated notes, so that
+	// successive migrations can be compared and rolled back.
+	GitCommit bool
+
+	// SkipPreflight disables the disk space and permission checks performed
+	// before copying anything.
+	SkipPreflight bool
+
+	// LinkAssets specifies how embedded images and file attachments are
+	// transferred: AssetCopy (default), AssetHardlink or AssetClone.
+	// Hard links and clones fall back to a copy when they are not possible.
+	LinkAssets string
+
+	// BandwidthLimit, when not zero, is the maximum throughput of the
+	// copies of the images and file attachments, in bytes per second, not
+	// to saturate the link to a network drive. Remote images are downloaded
+	// at full speed.
+	BandwidthLimit int64
+
+	// ProgressThreshold is the size in bytes from which the progress of the
+	// copy of an image or file attachment is reported (defaults to 100 MB),
+	// so that a large video is not mistaken for a stuck migration.
+	ProgressThreshold int64
+
+	// DefaultHandlingStrategy is the handling strategy of the notes whose
+	// tags set none (see TagOptions.HandlingStrategy). By default, they go
+	// to the root of the target directory.
+	DefaultHandlingStrategy HandlingStrategy
+
+	// AssetDirectory, when not empty, is the directory (relative to the
+	// directory of each note) receiving its images and file attachments.
+	// By default, they are stored next to the note. It has no effect with
+	// the Notable and static site layouts, which have their own.
+	AssetDirectory string
+
+	// AssetDirectories sends the images and file attachments to a directory
+	// depending on their type: an asset type (AssetTypeImage, AssetTypePDF,
+	// AssetTypeAudio or AssetTypeVideo) or an extension (.epub). Directories
+	// starting with a slash (/library) are relative to the destination
+	// directory, the other ones to the directory of each note. The rules of
+	// the tags of a note take precedence. They do not apply to static sites.
+	AssetDirectories map[string]string
+
+	// Slug specifies how the filenames and directories of static sites
+	// (see Layout) and, with SlugifyAssets, the filenames of the images and
+	// file attachments are slugified (see SlugOptions)
+	Slug          SlugOptions
+	SlugifyAssets bool
+
+	// RepairEncoding migrates the notes that are not valid UTF-8 text
+	// (invalid byte sequences, null bytes, UTF-16 encoding) once repaired,
+	// instead of reporting them as errors (see ErrCorruptNote)
+	RepairEncoding bool
+
+	// HeadingLinks rewrites the Bear links to the headings of other notes
+	// ([[My note/Some heading]] or bear://x-callback-url/open-note URLs with
+	// a header) to the [[My note#Some heading]] syntax of Zettlr and
+	// Obsidian. Links to headings that have changed point to the note
+	// instead and are reported (see ErrHeadingMissing).
+	HeadingLinks bool
+
+	// Overrides adjusts the migration of single notes: skipped notes and
+	// target directories (see LoadOverrides)
+	Overrides Overrides
+
+	// TagFileOverrides are tag files layered on top of the tag file of the
+	// migration, in order, so that shared conventions can be completed by
+	// personal settings without copying them (see LoadTagFiles).
+	TagFileOverrides []string
+
+	// Timezone is the IANA time zone (UTC, Europe/Paris, etc.) of the
+	// dates written in the front matter (RFC3339) and filenames of the
+	// notes, and of the dates embedded in their filenames, so that vaults
+	// shared across time zones sort consistently. Defaults to local time.
+	Timezone string
+
+	// ObsidianGraph writes the colors of the tags (see TagOptions.Color) as
+	// color groups of the Obsidian graph view (.obsidian/graph.json) in the
+	// destination directories that have none yet. It has no effect in
+	// InPlace mode.
+	ObsidianGraph bool
+
+	// ObsidianConfig writes the "Files and links" settings of Obsidian
+	// (.obsidian/app.json) matching the migration in the destination
+	// directories that have none yet, so that the vaults open configured:
+	// new attachments go to the asset directory of the images (see
+	// AssetDirectory and AssetDirectories) and new links are wiki links.
+	// It has no effect in InPlace mode.
+	ObsidianConfig bool
+
+	// UnclassifiedDirectory, when not empty, is the directory (relative to
+	// the target directory) receiving the notes whose tags are all ignored.
+	// By default, they go to the root of the target directory.
+	UnclassifiedDirectory string
+
+	// Keywords specifies how the tags of the notes are listed in their
+	// front matter. The Notable layout lists them in the "tags" field by
+	// default.
+	Keywords KeywordOptions
+
+	// Zettlr specifies the Zettlr settings (.ztr-directory files) of the
+	// created directories, so that they behave as expected the first time
+	// they are opened in Zettlr. It has no effect in InPlace mode.
+	Zettlr ZettlrOptions
+
+	// LinkText specifies how the visible names of the file attachment links
+	// are handled, since only their location is rewritten: LinkTextKeep
+	// (default), LinkTextCheck (names differing from the final filename are
+	// reported) or LinkTextFilename (names are regenerated from the final
+	// filename).
+	LinkText string
+
+	// Conflicts specifies how the blocks of content delimited by conflict
+	// markers (<<<<<<<, ======= and >>>>>>>) are handled: ConflictKeep
+	// (default, they are kept as-is and reported), ConflictFirst or
+	// ConflictSecond (only one side of each block is migrated).
+	Conflicts string
+
+	// SourceLink adds a link opening the original note in Bear
+	// (bear://x-callback-url/open-note) to the migrated notes:
+	// SourceLinkNone (default), SourceLinkFrontMatter or SourceLinkFooter.
+	SourceLink string
+
+	// StripTagLine removes the last line of the notes when it holds only
+	// tags, once the tags have been processed (routing, front matter).
+	// Tags embedded in prose are left untouched.
+	StripTagLine bool
+
+	// NoteExtension is the extension of the migrated notes (defaults to
+	// DefaultNoteExtension), for the tools expecting .markdown or .txt files.
+	// The Markdown links between notes ([My note](My%20note.md)) are
+	// rewritten accordingly. It has no effect in InPlace mode.
+	NoteExtension string
+
+	// Layout specifies how the migrated notes are laid out in the target
+	// directory: LayoutDefault (as instructed by the tag file) or
+	// LayoutNotable.
+	Layout string
+
+	// InferExtensions appends the extension matching the content type
+	// (sniffed from the magic bytes) to the embedded images and file
+	// attachments having no extension, and updates their links.
+	InferExtensions bool
+
+	// AssetSuffixes holds the patterns (regular expressions) of the noise
+	// suffixes stripped from the filenames of the images and file
+	// attachments (see DefaultAssetSuffixes), before their extension.
+	// Filenames are kept when the cleaned one is taken by another asset,
+	// and numbered (image-2.png) when they are taken as well.
+	AssetSuffixes []string
+
+	// FinderTags applies the tags of the migrated notes as Finder tags, so
+	// that Finder and Spotlight can search for them (macOS only).
+	FinderTags bool
+
+	// MetricsFile is the path of a file receiving the outcome of the
+	// migration (notes processed, failures, bytes copied, duration) in the
+	// Prometheus text format, for the textfile collector of the node
+	// exporter. It is written even if the migration fails.
+	MetricsFile string
+
+	// Logger, when not nil, receives the messages of the migration
+	// (progress, warnings and errors) instead of the standard output and
+	// the standard logger, which is left untouched.
+	Logger Logger
+
+	// LogFile is the path of a log file receiving a timestamped copy of the
+	// messages of the migration, along with the decision trail of every note
+	// (see Trace), regardless of what is printed on the console. Messages
+	// are appended to the file. If LogFile is empty, there is no log file.
+	LogFile string
+
+	// Trace prints the decision trail (tags, options, target directory,
+	// assets) of the notes whose name or path matches one of these patterns
+	// (see filepath.Match).
+	Trace []string
+
+	// Numbering prefixes the migrated notes with a sequence number
+	// (NumberingSequence) or their creation date (NumberingDate), so that
+	// they are sorted by creation date within each target directory.
+	// The links between the notes follow the numbered names.
+	// It has no effect in InPlace mode.
+	Numbering string
+
+	// AllowNested disables the check that the destination directories are
+	// neither inside the source directory nor containing it.
+	AllowNested bool
+
+	// ConvertHTML converts the notes exported by Bear as HTML to Markdown,
+	// using pandoc, and migrates them as well.
+	ConvertHTML bool
+
+	// DirMode and FileMode are the permissions of the created directories
+	// and files (notes, copies of images and file attachments), before the
+	// umask is applied. They default to 0755 and 0644.
+	DirMode  os.FileMode
+	FileMode os.FileMode
+
+	// AbortOnPermissionError stops the migration on the first permission
+	// error. By default, the notes going to a directory that cannot be
+	// written are skipped and reported, without trying to write them.
+	AbortOnPermissionError bool
+
+	// Filenames, when not nil, extracts the metadata embedded in the
+	// filename of the notes: the notes are renamed after their clean title
+	// (unless it collides with another note), the embedded date replaces
+	// the creation date and conflicted copies (Title 2 next to Title) are
+	// reported.
+	Filenames *FilenameParser
+
+	// MaxFolders, when positive, issues a warning when the
+	// one-note-per-folder strategy would create more than MaxFolders
+	// folders in a tag directory (some sync services throttle them).
+	MaxFolders int
+
+	// MaxFolderDepth, when positive, issues a warning when notes would be
+	// stored more than MaxFolderDepth directories below the destination.
+	MaxFolderDepth int
+
+	// Retries is the number of times a note or an asset is written again
+	// after a transient error (busy or timeout errors of network and cloud
+	// drives). The delay between two attempts starts at RetryDelay
+	// (default 500ms) and doubles each time.
+	Retries    int
+	RetryDelay time.Duration
+
+	// Arguments holds the command line of the migration, recorded in the
+	// .bearnotes-migration.yaml file written in each destination directory
+	Arguments []string
+
+	log *migrationLogger // Receives the messages of the migration (see Logger)
+}
+
+// dirMode returns the permissions of the created directories.
+func (options MigrateOptions) dirMode() os.FileMode {
+	if options.DirMode == 0 {
+		return 0755
+	}
+	return options.DirMode
+}
+
+// fileMode returns the permissions of the created files.
+func (options MigrateOptions) fileMode() os.FileMode {
+	if options.FileMode == 0 {
+		return 0644
+	}
+	return options.FileMode
+}
+
+// destinations returns all the directories written by a migration.
+func (options MigrateOptions) destinations(from string, to string) []string {
+	if options.InPlace {
+		return []string{from}
+	}
+	destinations := []string{to}
+	for _, dir := range options.Vaults {
+		destinations = append(destinations, dir)
+	}
+	return destinations
+}
+
 // MigrateNotes takes a source directory (from), a destination directory (to),
-// a tag configuration file (tagFile) and performs a Bear to Zettlr migration.
-func MigrateNotes(from string, to string, tagFile string) error {
-	var tags map[string]TagOptions = make(map[string]TagOptions)
+// a tag configuration file (tagFile) and performs a Bear to Zettlr migration,
+// as specified by options. It is a shortcut for PlanMigration followed by
+// Plan.Execute.
+//
+// Errors affecting a single note do not stop the migration: they are
+// recorded in the returned report as *NoteError values.
+//
+// When ctx is cancelled, the migration stops after the current note and
+// the partial report is returned along with the context error.
+func MigrateNotes(ctx context.Context, from string, to string, tagFile string, options MigrateOptions) (*MigrationReport, error) {
+	options.log = &migrationLogger{console: options.Logger}
+	if options.LogFile != "" {
+		file, closeLog, err := openMigrationLog(options.LogFile, options.Arguments, options.dirMode(), options.fileMode())
+		if err != nil {
+			return &MigrationReport{}, fmt.Errorf("log file: %w", err)
+		}
+		defer closeLog()
+		options.log.file = file
+	}
+
+	started := time.Now()
+	report, err := migrateNotes(ctx, from, to, tagFile, options)
+	if options.MetricsFile != "" {
+		if metricsErr := writeMetrics(options.MetricsFile, report, started, err, options.fileMode()); metricsErr != nil {
+			options.log.Printf("WARNING: metrics file: %s\n", metricsErr)
+		}
+	}
+	return report, err
+}
 
-	fmt.Printf("Reading the tag file from %s...\n", tagFile)
-	fileContent, err := ioutil.ReadFile(tagFile)
+// migrateNotes plans and executes the migration (see MigrateNotes).
+func migrateNotes(ctx context.Context, from string, to string, tagFile string, options MigrateOptions) (*MigrationReport, error) {
+	plan, err := PlanMigration(ctx, from, to, tagFile, options)
+	if err != nil {
+		// Return the partial report of the notes planned so far
+		var report MigrationReport
+		if plan != nil {
+			report = plan.report
+		}
+		return &report, err
+	}
+	report, err := plan.Execute(ctx)
+	if report == nil {
+		report = &MigrationReport{}
+	}
+	return report, err
+}
+
+// writeNote writes the converted note to the file at p, created with the
+// permissions fileMode if it does not exist.
+func writeNote(p string, note *Note, fileMode os.FileMode) error {
+	// The note is checked first, not to truncate the file for nothing
+	err := note.Validate()
 	if err != nil {
 		return err
 	}
-	err = yaml.Unmarshal(fileContent, &tags)
+	fd, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fileMode)
 	if err != nil {
 		return err
 	}
-
-	fmt.Printf("Migrating Bear notes from %s to %s...\n", from, to)
-	var success int = 0
-	var allNotes int = 0
-	err = filepath.Walk(from,
-		func(p string, info os.FileInfo, err error) error {
-			if err != nil {
-				log.Printf("stat: %s: %s\n", p, err)
-				return nil
-			}
-
-			// If it's not a markdown file, skip it.
-			if info.IsDir() || !strings.HasSuffix(info.Name(), ".md") {
-				return nil
-			}
-
-			log.Printf("Processing %s...\n", info.Name())
-			allNotes++
-
-			// Load the note
-			content, err := ioutil.ReadFile(p)
-			if err != nil {
-				log.Printf("open: %s: %s\n", p, err)
-				return nil
-			}
-			note := LoadNote(string(content))
-
-			// Iterate over the note's tags to compute the target directory & handling strategy.
-			// Since a note can have multiple tags, the first tag that defines a valid (non-empty)
-			// target directory and/or handling strategy sets the value.
-			// If another one specifies a different value, we issue a warning.
-			var targetDir string
-			var handlingStrategy string
-			for i, tag := range note.Tags {
-				// Normalize tag names to prevent file not found errors because of Unicode encoding.
-				tag.Name = norm.NFC.String(tag.Name)
-				// And make it lowercase since all tags are lower-case in Bear.
-				tagName := strings.ToLower(tag.Name)
-
-				tagOption, ok := tags[tagName]
-				if !ok {
-					log.Printf("ERROR: Unknown tag name '%s' in %s! Re-run the discover command!\n", tagName, info.Name())
-					return nil
-				}
-
-				if tagOption.Ignore {
-					continue
-				}
-
-				// Rewrite the tag name as instructed
-				note.Tags[i].Name = tagOption.TargetTagName
-
-				if tagOption.TargetDirectory != "" && targetDir != "" && targetDir != tagOption.TargetDirectory {
-					log.Printf("WARNING: Target directory '%s' for tag '%s' conflict with directives (%s) from another tag. Continuing with existing value.\n", tagOption.TargetDirectory, tagName, targetDir)
-				} else if targetDir == "" {
-					targetDir = tagOption.TargetDirectory
-				}
-
-				if tagOption.HandlingStrategy != "" && handlingStrategy != "" && handlingStrategy != tagOption.HandlingStrategy {
-					log.Printf("WARNING: Handling strategy '%s' for tag '%s' conflict with directives (%s) from another tag. Continuing with existing value.\n", tagOption.HandlingStrategy, tagName, handlingStrategy)
-				} else if handlingStrategy == "" {
-					if tagOption.HandlingStrategy == "same-folder" || tagOption.HandlingStrategy == "one-note-per-folder" || tagOption.HandlingStrategy == "" {
-						handlingStrategy = tagOption.HandlingStrategy
-					} else {
-						log.Printf("WARNING: Unknown handling strategy '%s' for tag '%s'.\n", tagOption.HandlingStrategy, tagName)
-					}
-				}
-			}
-
-			// Compute the final target directory, based on the handling strategy
-			noteName := strings.TrimSuffix(info.Name(), ".md")
-			if handlingStrategy == "one-note-per-folder" {
-				targetDir = path.Join(to, targetDir, noteName)
-			} else if handlingStrategy == "same-folder" {
-				targetDir = path.Join(to, targetDir)
-			} else {
-				// If no tag set an handling strategy or if the note has no tag,
-				// then it goes at the root of the target directory
-				targetDir = to
-			}
-
-			// Creates all the directory hierarchy
-			err = os.MkdirAll(targetDir, 0755)
-			if err != nil {
-				log.Printf("mkdir: %s: %s\n", targetDir, err)
-				return nil
-			}
-
-			// Migrate embedded images
-			for i, image := range note.Images {
-				// Normalize filenames to prevent 'file not found' errors
-				imageFileName := filepath.Base(norm.NFC.String(image.Location))
-				source := filepath.Join(from, norm.NFC.String(image.Location))
-
-				destination := filepath.Join(targetDir, imageFileName)
-				_, err := os.Stat(destination)
-				if os.IsNotExist(err) {
-					// Copy the image only if we don't overwrite an existing one
-					err = copyFile(source, destination)
-					if os.IsNotExist(err) {
-						log.Printf("WARNING: source image '%s' in note %s cannot be found!\n", imageFileName, noteName)
-					} else if err != nil {
-						log.Printf("copy: %s -> %s: %s\n", source, destination, err)
-						return nil
-					}
-				} else if err != nil {
-					log.Printf("stat: %s: %s\n", destination, err)
-					return nil
-				} else {
-					log.Printf("WARNING: embedded image '%s' of note %s already exists in the target directory %s!\n", imageFileName, noteName, destination)
-				}
-				note.Images[i].Location = imageFileName
-			}
-
-			// Migrate file attachments
-			for i, file := range note.Files {
-				// Normalize filenames to prevent 'file not found' errors
-				fileName := filepath.Base(norm.NFC.String(file.Location))
-				source := filepath.Join(from, noteName, norm.NFC.String(file.Location))
-
-				destination := filepath.Join(targetDir, fileName)
-				_, err := os.Stat(destination)
-				if os.IsNotExist(err) {
-					// Copy the file attachment if we don't overwrite an existing one
-					err = copyFile(source, destination)
-					if os.IsNotExist(err) {
-						log.Printf("WARNING: source file '%s' in note %s cannot be found!\n", fileName, noteName)
-					} else if err != nil {
-						log.Printf("copy: %s -> %s: %s\n", source, destination, err)
-						return nil
-					}
-				} else if err != nil {
-					log.Printf("stat: %s: %s\n", destination, err)
-					return nil
-				} else {
-					log.Printf("WARNING: file attachment '%s' of note %s already exists in the target directory %s!\n", fileName, noteName, destination)
-				}
-				note.Files[i].Location = fileName
-			}
-
-			// Write back the updated note
-			newNote := note.WriteNote()
-			targetNoteFileName := filepath.Join(targetDir, info.Name())
-			fd, err := os.Create(targetNoteFileName)
-			if err != nil {
-				log.Printf("open: %s: %s\n", targetNoteFileName, err)
-				return nil
-			}
-			defer fd.Close()
-			fd.WriteString(newNote)
-			success++
-
-			return nil
-		})
+	_, err = note.WriteTo(fd)
 	if err != nil {
+		fd.Close()
 		return err
 	}
+	return fd.Close()
+}
 
-	fmt.Println()
-	fmt.Printf("Processed %d notes with %d successes and %d failures\n", allNotes, success, allNotes-success)
+// rewriteInPlace replaces the note at p with its converted version,
+// after having saved the original content in a .bak file if backup is true.
+func rewriteInPlace(p string, content []byte, note *Note, backup bool, fileMode os.FileMode) error {
+	if backup {
+		err := writeBackup(p, content, fileMode)
+		if err != nil {
+			return err
+		}
+	}
+	return writeNote(p, note, fileMode)
+}
 
-	return nil
+// writeBackup saves the content of the note at p in a new .bak file, next
+// to the note. Existing backups are left untouched: the backups of the
+// next runs are numbered (note.md-2.bak), so that the original note is
+// never lost.
+func writeBackup(p string, content []byte, fileMode os.FileMode) error {
+	backup := p + ".bak"
+	for n := 2; ; n++ {
+		fd, err := os.OpenFile(backup, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fileMode)
+		if os.IsExist(err) {
+			backup = numberedName(p+".bak", n)
+			continue
+		} else if err != nil {
+			return err
+		}
+		_, err = fd.Write(content)
+		if err != nil {
+			fd.Close()
+			return err
+		}
+		return fd.Close()
+	}
 }
 
 // from https://opensource.com/article/18/6/copying-files-go
-func copyFile(src string, dest string) error {
+func copyFile(ctx context.Context, src string, dest string, fileMode os.FileMode, throttle *copyThrottle) error {
 	sourceFileStat, err := os.Stat(src)
 	if err != nil {
 		return err
@@ -209,11 +475,10 @@ func copyFile(src string, dest string) error {
 	}
 	defer source.Close()
 
-	destination, err := os.Create(dest)
+	destination, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fileMode)
 	if err != nil {
 		return err
 	}
 	defer destination.Close()
-	_, err = io.Copy(destination, source)
-	return err
+	return throttle.copy(ctx, destination, source, filepath.Base(dest), sourceFileStat.Size())
 }
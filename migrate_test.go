@@ -0,0 +1,1862 @@
+package bearnotes
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+// writeTestFiles creates a temporary directory holding the given files
+// (path => content) and returns its path.
+func writeTestFiles(t testing.TB, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "bearnotes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestMigrateNotesErrors(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"ok.md":        "#foo\n\n![](ok/image.png)\n",
+		"ok/image.png": "PNG",
+		"unknown.md":   "#bar\n",
+		"missing.md":   "#foo\n\n![](missing/image.png)\n",
+	})
+	defer os.RemoveAll(from)
+	config := writeTestFiles(t, map[string]string{
+		"tags.yaml": "foo:\n  handling_strategy: same-folder\n  target_directory: foo\n  target_tag_name: foo\n",
+	})
+	defer os.RemoveAll(config)
+	to, err := ioutil.TempDir("", "bearnotes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(to)
+
+	report, err := MigrateNotes(context.Background(), from, to, filepath.Join(config, "tags.yaml"), MigrateOptions{})
+	assert.NoError(t, err, "migration must succeed")
+	assert.Equal(t, 3, report.Notes, "there must be 3 notes")
+	assert.Equal(t, 2, report.Successes, "there must be 2 successes")
+	assert.Equal(t, 1, report.Failures(), "there must be 1 failure")
+
+	assert.Len(t, report.Errors, 1, "there must be 1 error")
+	assert.True(t, errors.Is(report.Errors[0], ErrUnknownTag), "error must be ErrUnknownTag")
+	assert.Len(t, report.Warnings, 1, "there must be 1 warning")
+	assert.True(t, errors.Is(report.Warnings[0], ErrAssetMissing), "warning must be ErrAssetMissing")
+
+	var noteErr *NoteError
+	assert.True(t, errors.As(report.Errors[0], &noteErr), "error must be a NoteError")
+	assert.Equal(t, "unknown.md", noteErr.Note, "error must reference the failed note")
+
+	assert.FileExists(t, filepath.Join(to, "foo", "ok.md"), "note must be migrated")
+	assert.FileExists(t, filepath.Join(to, "foo", "image.png"), "image must be migrated")
+}
+
+func TestMigrateNotesCancel(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"note.md": "no tag\n",
+	})
+	defer os.RemoveAll(from)
+	config := writeTestFiles(t, map[string]string{
+		"tags.yaml": "{}\n",
+	})
+	defer os.RemoveAll(config)
+	to, err := ioutil.TempDir("", "bearnotes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(to)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report, err := MigrateNotes(ctx, from, to, filepath.Join(config, "tags.yaml"), MigrateOptions{})
+	assert.True(t, errors.Is(err, context.Canceled), "migration must be cancelled")
+	assert.NotNil(t, report, "a partial report must be returned")
+	assert.Equal(t, 0, report.Notes, "no note must be processed")
+}
+
+func TestMigrateNotesRemoteImages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer server.Close()
+
+	from := writeTestFiles(t, map[string]string{
+		"note.md":  "![remote](" + server.URL + "/img/remote.png)\n",
+		"other.md": "![remote](" + server.URL + "/other/remote.png)\n",
+	})
+	defer os.RemoveAll(from)
+	config := writeTestFiles(t, map[string]string{
+		"tags.yaml": "{}\n",
+	})
+	defer os.RemoveAll(config)
+	to, err := ioutil.TempDir("", "bearnotes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(to)
+
+	report, err := MigrateNotes(context.Background(), from, to, filepath.Join(config, "tags.yaml"), MigrateOptions{DownloadRemoteImages: true})
+	assert.NoError(t, err, "migration must succeed")
+	assert.Empty(t, report.Warnings, "there must be no warning")
+	content, _ := ioutil.ReadFile(filepath.Join(to, "remote.png"))
+	assert.Equal(t, "/img/remote.png", string(content), "remote image must be downloaded")
+	content, _ = ioutil.ReadFile(filepath.Join(to, "note.md"))
+	assert.Equal(t, "![remote](remote.png)\n", string(content), "image link must be rewritten")
+	content, _ = ioutil.ReadFile(filepath.Join(to, "remote-2.png"))
+	assert.Equal(t, "/other/remote.png", string(content), "remote images of the same name must be numbered")
+	content, _ = ioutil.ReadFile(filepath.Join(to, "other.md"))
+	assert.Equal(t, "![remote](remote-2.png)\n", string(content), "image link must follow the numbered image")
+}
+
+func TestMigrateNotesVaults(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"work.md":     "#work\n",
+		"personal.md": "#personal\n",
+		"other.md":    "#other\n",
+	})
+	defer os.RemoveAll(from)
+	config := writeTestFiles(t, map[string]string{
+		"tags.yaml": `work:
+  handling_strategy: same-folder
+  vault: work
+personal:
+  handling_strategy: same-folder
+other:
+  handling_strategy: same-folder
+  vault: unknown
+`,
+	})
+	defer os.RemoveAll(config)
+	to := writeTestFiles(t, nil)
+	defer os.RemoveAll(to)
+	work := writeTestFiles(t, nil)
+	defer os.RemoveAll(work)
+
+	report, err := MigrateNotes(context.Background(), from, to, filepath.Join(config, "tags.yaml"), MigrateOptions{Vaults: map[string]string{"work": work}})
+	assert.NoError(t, err, "migration must succeed")
+	assert.FileExists(t, filepath.Join(work, "work.md"), "note must go to the work vault")
+	assert.FileExists(t, filepath.Join(to, "personal.md"), "note must go to the default destination")
+	assert.Len(t, report.Errors, 1, "there must be 1 error")
+	assert.True(t, errors.Is(report.Errors[0], ErrUnknownVault), "error must be ErrUnknownVault")
+}
+
+func TestMigrateNotesInPlace(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"note.md":          "#foo/bar\n\n<a href='note/my%20file.pdf'>my file.pdf</a>\n",
+		"note/my file.pdf": "PDF",
+	})
+	defer os.RemoveAll(from)
+	config := writeTestFiles(t, map[string]string{
+		"tags.yaml": "foo/bar:\n  handling_strategy: same-folder\n  target_directory: foo/bar\n  target_tag_name: bar\nbar:\n  target_tag_name: bar\n",
+	})
+	defer os.RemoveAll(config)
+
+	report, err := MigrateNotes(context.Background(), from, "", filepath.Join(config, "tags.yaml"), MigrateOptions{InPlace: true})
+	assert.NoError(t, err, "migration must succeed")
+	assert.Equal(t, 1, report.Successes, "there must be 1 success")
+	content, _ := ioutil.ReadFile(filepath.Join(from, "note.md"))
+	assert.Equal(t, "#bar\n\n[my file.pdf](note/my%20file.pdf)\n", string(content), "note must be rewritten")
+	backup, _ := ioutil.ReadFile(filepath.Join(from, "note.md.bak"))
+	assert.Equal(t, "#foo/bar\n\n<a href='note/my%20file.pdf'>my file.pdf</a>\n", string(backup), "backup must hold the original note")
+
+	report, err = MigrateNotes(context.Background(), from, "", filepath.Join(config, "tags.yaml"), MigrateOptions{InPlace: true})
+	assert.NoError(t, err, "second migration must succeed")
+	assert.Equal(t, 1, report.Successes, "there must be 1 success")
+	backup, _ = ioutil.ReadFile(filepath.Join(from, "note.md.bak"))
+	assert.Equal(t, "#foo/bar\n\n<a href='note/my%20file.pdf'>my file.pdf</a>\n", string(backup), "the backup of the first run must be left untouched")
+	backup, _ = ioutil.ReadFile(filepath.Join(from, "note.md-2.bak"))
+	assert.Equal(t, "#bar\n\n[my file.pdf](note/my%20file.pdf)\n", string(backup), "the backup of the second run must be numbered")
+}
+
+func TestMigrateNotesAssetIndex(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"🚀 My long note title.md":               "<a href='file.pdf'>file.pdf</a>\n![](elsewhere/image.png)\n",
+		"My long note/file.pdf":                 "PDF",
+		"Another note/file.pdf":                 "PDF2",
+		"🚀 My long note title/images/image.png": "PNG",
+	})
+	defer os.RemoveAll(from)
+	config := writeTestFiles(t, map[string]string{
+		"tags.yaml": "{}\n",
+	})
+	defer os.RemoveAll(config)
+	to := writeTestFiles(t, nil)
+	defer os.RemoveAll(to)
+
+	report, err := MigrateNotes(context.Background(), from, to, filepath.Join(config, "tags.yaml"), MigrateOptions{})
+	assert.NoError(t, err, "migration must succeed")
+	assert.Empty(t, report.Warnings, "all assets must be found")
+	content, _ := ioutil.ReadFile(filepath.Join(to, "file.pdf"))
+	assert.Equal(t, "PDF", string(content), "the attachment of the note must be preferred")
+	assert.FileExists(t, filepath.Join(to, "image.png"), "image must be found by its name")
+}
+
+func TestMigrateNotesHTMLExport(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"note.html":      "<p>Hello</p>\n",
+		"note/image.png": "PNG",
+	})
+	defer os.RemoveAll(from)
+	config := writeTestFiles(t, map[string]string{
+		"tags.yaml": "{}\n",
+	})
+	defer os.RemoveAll(config)
+	to := writeTestFiles(t, nil)
+	defer os.RemoveAll(to)
+
+	_, err := MigrateNotes(context.Background(), from, to, filepath.Join(config, "tags.yaml"), MigrateOptions{})
+	assert.True(t, errors.Is(err, ErrNotMarkdownExport), "HTML exports must be detected")
+	assert.Contains(t, err.Error(), "1 HTML files", "the error must describe the export")
+}
+
+func TestMigrateNotesNested(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"note.md": "Hello\n",
+	})
+	defer os.RemoveAll(from)
+	config := writeTestFiles(t, map[string]string{
+		"tags.yaml": "{}\n",
+	})
+	defer os.RemoveAll(config)
+	tagFile := filepath.Join(config, "tags.yaml")
+
+	_, err := MigrateNotes(context.Background(), from, filepath.Join(from, "out"), tagFile, MigrateOptions{})
+	assert.True(t, errors.Is(err, ErrNestedDirectories), "a destination inside the source must be rejected")
+	_, err = MigrateNotes(context.Background(), from, filepath.Dir(from), tagFile, MigrateOptions{SkipPreflight: true})
+	assert.True(t, errors.Is(err, ErrNestedDirectories), "a destination containing the source must be rejected")
+	_, err = MigrateNotes(context.Background(), from, filepath.Join(from, "out"), tagFile, MigrateOptions{AllowNested: true})
+	assert.NoError(t, err, "nested directories must be accepted when allowed")
+}
+
+func TestMigrateNotesNumbering(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"second.md": "#foo\n",
+		"first.md":  "#foo\n",
+		"other.md":  "Hello\n",
+	})
+	defer os.RemoveAll(from)
+	now := time.Now()
+	os.Chtimes(filepath.Join(from, "first.md"), now, now.Add(-time.Hour))
+	os.Chtimes(filepath.Join(from, "second.md"), now, now)
+	config := writeTestFiles(t, map[string]string{
+		"tags.yaml": "foo:\n  handling_strategy: same-folder\n  target_directory: foo\n  target_tag_name: foo\n",
+	})
+	defer os.RemoveAll(config)
+	to := writeTestFiles(t, nil)
+	defer os.RemoveAll(to)
+
+	_, err := MigrateNotes(context.Background(), from, to, filepath.Join(config, "tags.yaml"), MigrateOptions{Numbering: NumberingSequence})
+	assert.NoError(t, err, "migration must succeed")
+	assert.FileExists(t, filepath.Join(to, "foo", "001 - first.md"), "the oldest note must come first")
+	assert.FileExists(t, filepath.Join(to, "foo", "002 - second.md"), "the newest note must come last")
+	assert.FileExists(t, filepath.Join(to, "001 - other.md"), "notes must be numbered by directory")
+
+	_, err = MigrateNotes(context.Background(), from, to, filepath.Join(config, "tags.yaml"), MigrateOptions{Numbering: "unknown"})
+	assert.Error(t, err, "unknown numbering schemes must be rejected")
+}
+
+func TestMigrateNotesNumberingFolders(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"second.md":        "#foo\n![](second/image.png)\n",
+		"second/image.png": "PNG",
+		"first.md":         "#foo\n",
+	})
+	defer os.RemoveAll(from)
+	now := time.Now()
+	os.Chtimes(filepath.Join(from, "first.md"), now, now.Add(-time.Hour))
+	os.Chtimes(filepath.Join(from, "second.md"), now, now)
+	config := writeTestFiles(t, map[string]string{
+		"tags.yaml": "foo:\n  handling_strategy: one-note-per-folder\n  target_directory: foo\n  target_tag_name: foo\n",
+	})
+	defer os.RemoveAll(config)
+	to := writeTestFiles(t, nil)
+	defer os.RemoveAll(to)
+
+	options := MigrateOptions{Numbering: NumberingSequence}
+	report, err := MigrateNotes(context.Background(), from, to, filepath.Join(config, "tags.yaml"), options)
+	assert.NoError(t, err, "migration must succeed")
+	assert.Empty(t, report.Warnings, "there must be no warning")
+	assert.FileExists(t, filepath.Join(to, "foo", "001 - first", "first.md"), "the folder of the oldest note must come first")
+	assert.FileExists(t, filepath.Join(to, "foo", "002 - second", "second.md"), "the folder of the newest note must come last")
+	assert.FileExists(t, filepath.Join(to, "foo", "002 - second", "image.png"), "assets must follow their note")
+
+	check, err := CheckMigration(context.Background(), from, to, filepath.Join(config, "tags.yaml"), options)
+	assert.NoError(t, err, "check must succeed")
+	assert.Empty(t, check.Errors, "numbered folders must be found")
+}
+
+func TestMigrateNotesNumberingLinks(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"Alpha.md":        "#foo\nSee [Beta](Beta.md#intro) and [Beta](Beta.md) #foo\n",
+		"Beta.md":         "#foo\n# Intro\n",
+		"Gamma.md":        "#bar\n![](Gamma/image.png)\n",
+		"Gamma/image.png": "PNG",
+	})
+	defer os.RemoveAll(from)
+	now := time.Now()
+	for i, name := range []string{"Alpha.md", "Beta.md", "Gamma.md"} {
+		date := now.Add(time.Duration(i) * time.Hour)
+		os.Chtimes(filepath.Join(from, name), date, date)
+	}
+	config := writeTestFiles(t, map[string]string{
+		"tags.yaml": "foo:\n  handling_strategy: same-folder\n  target_directory: foo\n  target_tag_name: foo\nbar:\n  handling_strategy: one-note-per-folder\n  target_directory: foo\n  target_tag_name: bar\n",
+	})
+	defer os.RemoveAll(config)
+	to := writeTestFiles(t, nil)
+	defer os.RemoveAll(to)
+
+	options := MigrateOptions{Numbering: NumberingSequence}
+	plan, err := PlanMigration(context.Background(), from, to, filepath.Join(config, "tags.yaml"), options)
+	assert.NoError(t, err, "migration must be planned")
+	var destinations []string
+	for _, planned := range plan.Notes {
+		destinations = append(destinations, planned.Destination)
+	}
+	assert.ElementsMatch(t, []string{filepath.Join(to, "foo", "001 - Alpha.md"), filepath.Join(to, "foo", "002 - Beta.md"), filepath.Join(to, "foo", "003 - Gamma", "Gamma.md")}, destinations, "notes must be numbered by the plan")
+
+	for i := 0; i < 2; i++ {
+		report, err := plan.Execute(context.Background())
+		assert.NoError(t, err, "migration must succeed")
+		assert.Empty(t, report.Warnings, "there must be no warning, even when migrating again")
+		assert.Equal(t, 3, report.Successes, "all notes must be migrated")
+	}
+	content, err := ioutil.ReadFile(filepath.Join(to, "foo", "001 - Alpha.md"))
+	assert.NoError(t, err, "the note must be numbered")
+	assert.Equal(t, "#foo\nSee [Beta](002%20-%20Beta.md#intro) and [Beta](002%20-%20Beta.md) #foo\n", string(content), "links must follow the numbered notes")
+	assert.FileExists(t, filepath.Join(to, "foo", "003 - Gamma", "image.png"), "assets must follow their note")
+	assert.NoFileExists(t, filepath.Join(to, "foo", "Beta.md"), "notes must only be written numbered")
+
+	check, err := CheckMigration(context.Background(), from, to, filepath.Join(config, "tags.yaml"), options)
+	assert.NoError(t, err, "check must succeed")
+	assert.Empty(t, check.Errors, "numbered notes must be found")
+}
+
+func TestPlanMigration(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"note.md":        "#foo\n![](note/image.png)\n",
+		"note/image.png": "PNG",
+		"unknown.md":     "#bar\n",
+	})
+	defer os.RemoveAll(from)
+	config := writeTestFiles(t, map[string]string{
+		"tags.yaml": "foo:\n  handling_strategy: same-folder\n  target_directory: foo\n  target_tag_name: baz\n",
+	})
+	defer os.RemoveAll(config)
+	to := writeTestFiles(t, nil)
+	defer os.RemoveAll(to)
+
+	plan, err := PlanMigration(context.Background(), from, to, filepath.Join(config, "tags.yaml"), MigrateOptions{})
+	assert.NoError(t, err, "planning must succeed")
+	assert.Len(t, plan.Errors(), 1, "the note having an unknown tag must be reported")
+	if assert.Len(t, plan.Notes, 1, "one note must be planned") {
+		planned := plan.Notes[0]
+		assert.Equal(t, filepath.Join(to, "foo", "note.md"), planned.Destination, "destination must be planned")
+		assert.Equal(t, []PlannedAsset{{Source: filepath.Join(from, "note", "image.png"), Destination: filepath.Join(to, "foo", "image.png"), Image: true}}, planned.Assets, "image copy must be planned")
+		assert.Equal(t, "#baz\n![](image.png)\n", mustWriteNote(t, planned.Note), "note rewrite must be planned")
+		assert.Equal(t, []string{"baz"}, planned.Tags, "tags of the migrated note must be planned")
+	}
+	assert.NoFileExists(t, filepath.Join(to, "foo", "note.md"), "nothing must be written when planning")
+
+	report, err := plan.Execute(context.Background())
+	assert.NoError(t, err, "execution must succeed")
+	assert.Equal(t, 1, report.Successes, "the planned note must be migrated")
+	assert.Len(t, report.Errors, 1, "the report must include the planning errors")
+	assert.FileExists(t, filepath.Join(to, "foo", "note.md"), "note must be written")
+	assert.FileExists(t, filepath.Join(to, "foo", "image.png"), "image must be copied")
+}
+
+func TestMigrateNotesRerun(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"note.md":        "![](note/image.png)\n",
+		"note/image.png": "PNG",
+	})
+	defer os.RemoveAll(from)
+	config := writeTestFiles(t, map[string]string{
+		"tags.yaml": "{}\n",
+	})
+	defer os.RemoveAll(config)
+	to := writeTestFiles(t, nil)
+	defer os.RemoveAll(to)
+	tagFile := filepath.Join(config, "tags.yaml")
+
+	report, err := MigrateNotes(context.Background(), from, to, tagFile, MigrateOptions{})
+	assert.NoError(t, err, "migration must succeed")
+	report, err = MigrateNotes(context.Background(), from, to, tagFile, MigrateOptions{})
+	assert.NoError(t, err, "migration must succeed")
+	assert.Empty(t, report.Warnings, "identical assets must be skipped silently")
+
+	ioutil.WriteFile(filepath.Join(from, "note", "image.png"), []byte("JPG"), 0644)
+	report, err = MigrateNotes(context.Background(), from, to, tagFile, MigrateOptions{})
+	assert.NoError(t, err, "migration must succeed")
+	if assert.Len(t, report.Warnings, 1, "there must be 1 warning") {
+		assert.True(t, errors.Is(report.Warnings[0], ErrAssetConflict), "warning must be ErrAssetConflict")
+	}
+}
+
+func TestMigrateNotesCaseSensitiveTags(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"work.md":  "#Work\n",
+		"other.md": "#work\n",
+	})
+	defer os.RemoveAll(from)
+	config := writeTestFiles(t, map[string]string{
+		"tags.yaml": "Work:\n  handling_strategy: same-folder\n  target_directory: Work\n  target_tag_name: Work\nwork:\n  handling_strategy: same-folder\n  target_directory: misc\n  target_tag_name: misc\n",
+	})
+	defer os.RemoveAll(config)
+	to := writeTestFiles(t, nil)
+	defer os.RemoveAll(to)
+
+	options := MigrateOptions{Parse: ParseOptions{CaseSensitiveTags: true}}
+	report, err := MigrateNotes(context.Background(), from, to, filepath.Join(config, "tags.yaml"), options)
+	assert.NoError(t, err, "migration must succeed")
+	assert.Empty(t, report.Errors, "there must be no error")
+	assert.FileExists(t, filepath.Join(to, "Work", "work.md"), "tags must be routed case-sensitively")
+	assert.FileExists(t, filepath.Join(to, "misc", "other.md"), "tags must be routed case-sensitively")
+	assert.Equal(t, map[string]string{"work": "misc"}, report.RenamedTags, "renamed tags must be reported with their original case")
+}
+
+func TestMigrateNotesTagFileOverrides(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"work.md": "#work\n",
+		"home.md": "#home\n",
+	})
+	defer os.RemoveAll(from)
+	config := writeTestFiles(t, map[string]string{
+		"base.yaml":     "work:\n  handling_strategy: same-folder\n  target_directory: Work\n  target_tag_name: work\nhome:\n  handling_strategy: same-folder\n  target_directory: Home\n  target_tag_name: home\n",
+		"personal.yaml": "work:\n  handling_strategy: same-folder\n  target_directory: Job\n  target_tag_name: job\n",
+	})
+	defer os.RemoveAll(config)
+	to := writeTestFiles(t, nil)
+	defer os.RemoveAll(to)
+
+	options := MigrateOptions{TagFileOverrides: []string{filepath.Join(config, "personal.yaml")}}
+	report, err := MigrateNotes(context.Background(), from, to, filepath.Join(config, "base.yaml"), options)
+	assert.NoError(t, err, "migration must succeed")
+	assert.Empty(t, report.Errors, "there must be no error")
+	assert.FileExists(t, filepath.Join(to, "Job", "work.md"), "the entries of the overrides must take precedence")
+	assert.FileExists(t, filepath.Join(to, "Home", "home.md"), "the entries of the base tag file must apply")
+	if assert.Len(t, report.Warnings, 1, "the conflicting entry must be reported") {
+		assert.True(t, errors.Is(report.Warnings[0], ErrTagFileOverride), "warning must be ErrTagFileOverride")
+		assert.Contains(t, report.Warnings[0].Error(), "personal.yaml:1: tag file override: entry 'work' overrides the entry of "+filepath.Join(config, "base.yaml")+":1", "warning must locate both entries")
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(to, ".bearnotes-migration.yaml"))
+	assert.NoError(t, err, "snapshot must be written")
+	var snapshot runSnapshot
+	assert.NoError(t, yaml.Unmarshal(content, &snapshot), "snapshot must be valid YAML")
+	checksum := sha256.Sum256([]byte("work:\n  handling_strategy: same-folder\n  target_directory: Job\n  target_tag_name: job\n"))
+	assert.Equal(t, []snapshotTagFile{{Path: filepath.Join(config, "personal.yaml"), SHA256: hex.EncodeToString(checksum[:])}}, snapshot.TagOverrides, "each override must be recorded with its hash")
+}
+
+func TestMigrateNotesRenameRules(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"john.md": "# John\n#People/John\n",
+		"todo.md": "# Todo\n#todo\n",
+	})
+	defer os.RemoveAll(from)
+	config := writeTestFiles(t, map[string]string{
+		"tags.yaml": "_settings:\n  rename_rules:\n    - pattern: ^people/(.*)$\n      replacement: contacts/$1\npeople/*:\n  target_directory: People\ncontacts/*:\n  handling_strategy: same-folder\n  target_directory: Contacts\n  target_tag_name: contact\ntodo:\n  target_tag_name: todo\n",
+	})
+	defer os.RemoveAll(config)
+	to := writeTestFiles(t, nil)
+	defer os.RemoveAll(to)
+
+	report, err := MigrateNotes(context.Background(), from, to, filepath.Join(config, "tags.yaml"), MigrateOptions{})
+	assert.NoError(t, err, "migration must succeed")
+	assert.Empty(t, report.Errors, "there must be no error")
+	assert.FileExists(t, filepath.Join(to, "Contacts", "john.md"), "renamed tags must be looked up by their new name")
+	assert.FileExists(t, filepath.Join(to, "todo.md"), "other tags must be looked up as is")
+	content, err := ioutil.ReadFile(filepath.Join(to, "Contacts", "john.md"))
+	assert.NoError(t, err, "note must be readable")
+	assert.Equal(t, "# John\n#contact\n", string(content), "renamed tags must be rewritten by their entry")
+	assert.Equal(t, map[string]string{"People/John": "contact"}, report.RenamedTags, "renamed tags must be reported with their original name")
+
+	config2 := writeTestFiles(t, map[string]string{
+		"tags.yaml": "_settings:\n  rename_rules:\n    - pattern: ^people/(.*$\n      replacement: contacts/$1\n",
+	})
+	defer os.RemoveAll(config2)
+	_, err = MigrateNotes(context.Background(), from, to, filepath.Join(config2, "tags.yaml"), MigrateOptions{})
+	assert.Error(t, err, "invalid rename rules must be rejected")
+}
+
+func TestMigrateNotesLinkAssets(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"note.md":        "![](note/image.png)\n",
+		"note/image.png": "PNG",
+	})
+	defer os.RemoveAll(from)
+	config := writeTestFiles(t, map[string]string{
+		"tags.yaml": "{}\n",
+	})
+	defer os.RemoveAll(config)
+	tagFile := filepath.Join(config, "tags.yaml")
+
+	for _, mode := range []string{AssetHardlink, AssetClone, AssetCopy} {
+		to := writeTestFiles(t, nil)
+		defer os.RemoveAll(to)
+
+		report, err := MigrateNotes(context.Background(), from, to, tagFile, MigrateOptions{LinkAssets: mode})
+		assert.NoError(t, err, "migration must succeed")
+		assert.Empty(t, report.Warnings, "image must be transferred (%s)", mode)
+		content, _ := ioutil.ReadFile(filepath.Join(to, "image.png"))
+		assert.Equal(t, "PNG", string(content), "image must be transferred (%s)", mode)
+
+		if mode == AssetHardlink {
+			source, _ := os.Stat(filepath.Join(from, "note", "image.png"))
+			destination, _ := os.Stat(filepath.Join(to, "image.png"))
+			assert.True(t, os.SameFile(source, destination), "image must be a hard link")
+		}
+	}
+
+	_, err := MigrateNotes(context.Background(), from, from+"-out", tagFile, MigrateOptions{LinkAssets: "unknown"})
+	assert.Error(t, err, "unknown modes must be rejected")
+}
+
+func TestMigrateNotesBandwidthLimit(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"note.md":        "![](note/image.png)\n",
+		"note/image.png": strings.Repeat("x", 64*1024),
+	})
+	defer os.RemoveAll(from)
+	config := writeTestFiles(t, map[string]string{
+		"tags.yaml": "{}\n",
+	})
+	defer os.RemoveAll(config)
+	tagFile := filepath.Join(config, "tags.yaml")
+	to := writeTestFiles(t, nil)
+	defer os.RemoveAll(to)
+
+	started := time.Now()
+	report, err := MigrateNotes(context.Background(), from, to, tagFile, MigrateOptions{BandwidthLimit: 128 * 1024, ProgressThreshold: 1024})
+	assert.NoError(t, err, "migration must succeed")
+	assert.Empty(t, report.Warnings, "image must be copied")
+	assert.True(t, time.Since(started) >= 400*time.Millisecond, "copy must be throttled")
+	content, _ := ioutil.ReadFile(filepath.Join(to, "image.png"))
+	assert.Equal(t, 64*1024, len(content), "image must be copied entirely")
+
+	_, err = MigrateNotes(context.Background(), from, from+"-out", tagFile, MigrateOptions{BandwidthLimit: -1})
+	assert.Error(t, err, "negative bandwidth limits must be rejected")
+}
+
+func TestMigrateNotesInferExtensions(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"note.md":      "![](note/image) <a href='doc'>doc</a> ![](note/unknown)\n",
+		"note/image":   "\x89PNG\x0d\x0a\x1a\x0a",
+		"note/doc":     "%PDF-1.4\n",
+		"note/unknown": "\x00\x01\x02",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml": "{}\n",
+	})
+	defer os.RemoveAll(to)
+
+	report, err := MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{InferExtensions: true})
+	assert.NoError(t, err, "migration must succeed")
+	assert.Empty(t, report.Errors, "there must be no error")
+	assert.FileExists(t, filepath.Join(to, "notes", "image.png"), "image must get an extension")
+	assert.FileExists(t, filepath.Join(to, "notes", "doc.pdf"), "file attachment must get an extension")
+	assert.FileExists(t, filepath.Join(to, "notes", "unknown"), "unknown types must be left untouched")
+	content, _ := ioutil.ReadFile(filepath.Join(to, "notes", "note.md"))
+	assert.Equal(t, "![](image.png) [doc](doc.pdf) ![](unknown)\n", string(content), "links must be updated")
+}
+
+func TestMigrateNotesNotableLayout(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"note.md":        "#work/project\n![](note/image.png)\n",
+		"note/image.png": "PNG",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml": "work/project:\n  handling_strategy: one-note-per-folder\n  target_directory: work\n  target_tag_name: project\n",
+	})
+	defer os.RemoveAll(to)
+
+	report, err := MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{Layout: LayoutNotable})
+	assert.NoError(t, err, "migration must succeed")
+	assert.Empty(t, report.Errors, "there must be no error")
+	assert.Empty(t, report.Warnings, "there must be no warning")
+	assert.FileExists(t, filepath.Join(to, "notes", "attachments", "image.png"), "image must go to attachments/")
+	content, err := ioutil.ReadFile(filepath.Join(to, "notes", "notes", "note.md"))
+	assert.NoError(t, err, "note must go to notes/")
+	assert.Equal(t, "---\ntags:\n  - work/project\ntitle: note\n---\n#project\n![](../attachments/image.png)\n", string(content), "tags must be in the front matter")
+
+	_, err = MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{Layout: "unknown"})
+	assert.Error(t, err, "unknown layouts must be rejected")
+}
+
+func TestMigrateNotesNotableCollisions(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"a/note.md":   "![](a/image.png)\n",
+		"a/image.png": "PNG A",
+		"b/note.md":   "![](b/image.png)\n",
+		"b/image.png": "PNG B",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml": "{}\n",
+	})
+	defer os.RemoveAll(to)
+
+	report, err := MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{Layout: LayoutNotable})
+	assert.NoError(t, err, "migration must succeed")
+	assert.Empty(t, report.Errors, "there must be no error")
+	if assert.Len(t, report.Warnings, 1, "there must be a warning") {
+		assert.True(t, errors.Is(report.Warnings[0], ErrNameCollision), "warning must be ErrNameCollision")
+	}
+	content, _ := ioutil.ReadFile(filepath.Join(to, "notes", "notes", "note.md"))
+	assert.Equal(t, "---\ntitle: note\n---\n![](../attachments/image.png)\n", string(content), "the first note must keep its name")
+	content, _ = ioutil.ReadFile(filepath.Join(to, "notes", "notes", "note-2.md"))
+	assert.Equal(t, "---\ntitle: note\n---\n![](../attachments/image-2.png)\n", string(content), "the second note must be numbered")
+	content, _ = ioutil.ReadFile(filepath.Join(to, "notes", "attachments", "image.png"))
+	assert.Equal(t, "PNG A", string(content), "the first image must keep its name")
+	content, _ = ioutil.ReadFile(filepath.Join(to, "notes", "attachments", "image-2.png"))
+	assert.Equal(t, "PNG B", string(content), "the second image must be numbered")
+}
+
+func TestMigrateNotesAllTagsIgnored(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"ignored.md":  "#trap and #other\n",
+		"mixed.md":    "#trap and #work\n",
+		"untagged.md": "no tag\n",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml": "trap:\n  ignore: true\nother:\n  ignore: true\nwork:\n  handling_strategy: same-folder\n  target_directory: work\n  target_tag_name: work\n",
+	})
+	defer os.RemoveAll(to)
+
+	report, err := MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{UnclassifiedDirectory: "unclassified"})
+	assert.NoError(t, err, "migration must succeed")
+	assert.Equal(t, 1, report.Unclassified, "only the note whose tags are all ignored must be counted")
+	if assert.Len(t, report.Warnings, 1, "there must be a warning") {
+		assert.True(t, errors.Is(report.Warnings[0], ErrTagsIgnored), "warning must be ErrTagsIgnored")
+	}
+	assert.FileExists(t, filepath.Join(to, "notes", "unclassified", "ignored.md"), "note must go to the unclassified directory")
+	assert.FileExists(t, filepath.Join(to, "notes", "work", "mixed.md"), "note must be routed by its other tag")
+	assert.FileExists(t, filepath.Join(to, "notes", "untagged.md"), "untagged notes must go to the root")
+}
+
+func TestMigrateNotesSnapshot(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"note.md": "some text\n",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml": "{}\n",
+	})
+	defer os.RemoveAll(to)
+
+	transforms, _ := LookupTransforms([]string{"highlights"})
+	_, err := MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{Transforms: transforms, Arguments: []string{"bearnotes", "migrate"}})
+	assert.NoError(t, err, "migration must succeed")
+
+	content, err := ioutil.ReadFile(filepath.Join(to, "notes", ".bearnotes-migration.yaml"))
+	assert.NoError(t, err, "snapshot must be written")
+	var snapshot runSnapshot
+	assert.NoError(t, yaml.Unmarshal(content, &snapshot), "snapshot must be valid YAML")
+	assert.Equal(t, Version, snapshot.Version, "version must be recorded")
+	assert.Equal(t, []string{"bearnotes", "migrate"}, snapshot.Arguments, "arguments must be recorded")
+	assert.Equal(t, []string{"highlights"}, snapshot.Transforms, "transforms must be recorded")
+	assert.Equal(t, "ca3d163bab055381827226140568f3bef7eaac187cebd76878e0b63e9e442356", snapshot.TagFileSHA256, "tag file hash must be recorded")
+	assert.Equal(t, 1, snapshot.Successes, "outcome must be recorded")
+	assert.False(t, snapshot.Finished.Before(snapshot.Started), "timestamps must be recorded")
+}
+
+func TestMigrateNotesPathTraversal(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"notes/image.md": "![](../../../etc/passwd)\n",
+		"notes/file.md":  "<a href='../../../../etc/passwd'>passwd</a>\n",
+		"notes/tag.md":   "#escape\n",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml": "escape:\n  handling_strategy: same-folder\n  target_directory: ../../escape\n  target_tag_name: escape\n",
+	})
+	defer os.RemoveAll(to)
+
+	report, err := MigrateNotes(context.Background(), filepath.Join(from, "notes"), filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{})
+	assert.NoError(t, err, "migration must succeed")
+	assert.Equal(t, 3, report.Failures(), "all notes must fail")
+	for _, e := range report.Errors {
+		assert.True(t, errors.Is(e, ErrPathTraversal), "error must be ErrPathTraversal: %s", e)
+	}
+	assert.NoFileExists(t, filepath.Join(to, "notes", "passwd"), "files outside of the source directory must not be read")
+}
+
+func TestMigrateNotesPermissions(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"a.md":        "#locked\n",
+		"b.md":        "#locked\n",
+		"c.md":        "#work\n![](c/image.png)\n",
+		"c/image.png": "PNG",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml": "locked:\n  handling_strategy: same-folder\n  target_directory: locked\n  target_tag_name: locked\nwork:\n  handling_strategy: same-folder\n  target_directory: work\n  target_tag_name: work\n",
+	})
+	defer os.RemoveAll(to)
+
+	// Directories and files get the requested permissions
+	_, err := MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{DirMode: 0700, FileMode: 0600})
+	assert.NoError(t, err, "migration must succeed")
+	for p, mode := range map[string]os.FileMode{"work": os.ModeDir | 0700, "work/c.md": 0600, "work/image.png": 0600} {
+		info, err := os.Stat(filepath.Join(to, "notes", p))
+		if assert.NoError(t, err, "%s must exist", p) {
+			assert.Equal(t, mode, info.Mode(), "%s must have the requested permissions", p)
+		}
+	}
+
+	if os.Geteuid() == 0 {
+		t.Skip("permissions are not enforced for root")
+	}
+
+	// Notes going to a read-only directory are skipped and reported
+	locked := filepath.Join(to, "readonly", "locked")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(locked), 0755), "destination directory must be created")
+	assert.NoError(t, os.Mkdir(locked, 0555), "locked directory must be created")
+	defer os.Chmod(locked, 0755)
+	report, err := MigrateNotes(context.Background(), from, filepath.Join(to, "readonly"), filepath.Join(to, "tags.yaml"), MigrateOptions{})
+	assert.NoError(t, err, "migration must succeed")
+	assert.Equal(t, 2, report.Failures(), "notes going to the locked directory must fail")
+	for _, e := range report.Errors {
+		assert.True(t, errors.Is(e, os.ErrPermission), "error must be a permission error: %s", e)
+	}
+
+	_, err = MigrateNotes(context.Background(), from, filepath.Join(to, "readonly"), filepath.Join(to, "tags.yaml"), MigrateOptions{AbortOnPermissionError: true})
+	assert.True(t, errors.Is(err, os.ErrPermission), "migration must be aborted")
+}
+
+func TestMigrateNotesFilenames(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"Meeting.md":              "original\n",
+		"Meeting 2.md":            "conflicted copy\n",
+		"Chapter 2.md":            "not a copy\n",
+		"2020-01-31 Report.md":    "dated\n",
+		"2020-02-29 Duplicate.md": "first\n",
+		"Duplicate.md":            "second\n",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml": "{}\n",
+	})
+	defer os.RemoveAll(to)
+
+	parser, err := NewFilenameParser(DefaultFilenamePattern, DefaultFilenameDateLayout)
+	assert.NoError(t, err, "default pattern must be valid")
+	plan, err := PlanMigration(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{Filenames: parser})
+	assert.NoError(t, err, "planning must succeed")
+
+	destinations := make(map[string]string)
+	for _, planned := range plan.Notes {
+		destinations[filepath.Base(planned.Source)] = filepath.Base(planned.Destination)
+		if filepath.Base(planned.Source) == "2020-01-31 Report.md" {
+			assert.Equal(t, FilenameMetadata{Title: "Report", Date: time.Date(2020, 1, 31, 0, 0, 0, 0, time.Local)}, planned.Metadata, "metadata must be extracted")
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"Meeting.md":              "Meeting.md",
+		"Meeting 2.md":            "Meeting 2.md",
+		"Chapter 2.md":            "Chapter 2.md",
+		"2020-01-31 Report.md":    "Report.md",
+		"2020-02-29 Duplicate.md": "2020-02-29 Duplicate.md",
+		"Duplicate.md":            "Duplicate.md",
+	}, destinations, "notes must be renamed after their clean title, unless it collides")
+
+	report, err := plan.Execute(context.Background())
+	assert.NoError(t, err, "migration must succeed")
+	if assert.Len(t, report.Warnings, 1, "the conflicted copy must be reported") {
+		assert.True(t, errors.Is(report.Warnings[0], ErrConflictedCopy), "warning must be ErrConflictedCopy")
+		assert.Contains(t, report.Warnings[0].Error(), "Meeting 2.md", "warning must name the conflicted copy")
+	}
+
+	_, err = NewFilenameParser(`^(?P<name>.*)$`, "")
+	assert.Error(t, err, "patterns without title must be rejected")
+}
+
+func TestMigrateNotesFolderGuards(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"apple.md":   "#fruits #deep\n",
+		"banana.md":  "#fruits #deep\n",
+		"Avocado.md": "#fruits #deep\n",
+		"42.md":      "#fruits #deep\n",
+		"a.md":       "#folders\n",
+		"b.md":       "#folders\n",
+		"c.md":       "#folders\n",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml": `fruits:
+  handling_strategy: group-by-initial
+  target_directory: fruits
+  target_tag_name: fruits
+deep:
+  target_directory: ""
+  target_tag_name: deep
+folders:
+  handling_strategy: one-note-per-folder
+  target_directory: a/b/c
+  target_tag_name: folders
+`,
+	})
+	defer os.RemoveAll(to)
+
+	plan, err := PlanMigration(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{MaxFolders: 2, MaxFolderDepth: 3})
+	assert.NoError(t, err, "planning must succeed")
+	if assert.Len(t, plan.Warnings, 2, "both guards must be triggered") {
+		assert.True(t, errors.Is(plan.Warnings[0], ErrTooManyFolders), "warning must be ErrTooManyFolders")
+		assert.Contains(t, plan.Warnings[0].Error(), "creates 3 folders", "folders must be counted")
+		assert.Contains(t, plan.Warnings[1].Error(), "3 notes are stored more than 3 directories deep", "deep notes must be counted")
+	}
+
+	_, err = plan.Execute(context.Background())
+	assert.NoError(t, err, "migration must succeed")
+	for _, p := range []string{"A/apple.md", "A/Avocado.md", "B/banana.md", "0-9/42.md"} {
+		assert.FileExists(t, filepath.Join(to, "notes", "fruits", p), "notes must be grouped by initial")
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var report MigrationReport
+	options := MigrateOptions{Retries: 3, RetryDelay: time.Millisecond}
+
+	attempts := 0
+	err := options.retry(context.Background(), &report, func() error {
+		attempts++
+		if attempts < 3 {
+			return &os.PathError{Op: "write", Path: "note.md", Err: syscall.EBUSY}
+		}
+		return nil
+	})
+	assert.NoError(t, err, "transient errors must be retried")
+	assert.Equal(t, 2, report.Retries, "retries must be counted")
+
+	attempts = 0
+	err = options.retry(context.Background(), &report, func() error {
+		attempts++
+		return &os.PathError{Op: "write", Path: "note.md", Err: syscall.ETIMEDOUT}
+	})
+	assert.Error(t, err, "retries must be limited")
+	assert.Equal(t, 4, attempts, "the number of retries must be respected")
+
+	attempts = 0
+	err = options.retry(context.Background(), &report, func() error {
+		attempts++
+		return os.ErrNotExist
+	})
+	assert.Error(t, err, "other errors must be returned")
+	assert.Equal(t, 1, attempts, "other errors must not be retried")
+}
+
+func TestMigrateNotesInvalid(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"invalid.md":    "![my #foo picture](invalid/a.png)\n",
+		"invalid/a.png": "PNG",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml": "foo:\n  target_tag_name: foo\n",
+	})
+	defer os.RemoveAll(to)
+
+	report, err := MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{})
+	assert.NoError(t, err, "migration must succeed")
+	if assert.Len(t, report.Errors, 1, "there must be an error") {
+		assert.True(t, errors.Is(report.Errors[0], ErrInvalidNote), "error must be ErrInvalidNote: %s", report.Errors[0])
+	}
+	assert.NoFileExists(t, filepath.Join(to, "notes", "invalid.md"), "invalid notes must not be written")
+}
+
+func TestMigrateNotesStaticSite(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"My Blog Idea.md":        "#blog\n![](My Blog Idea/image.png)\n",
+		"My Blog Idea/image.png": "PNG",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml": "blog:\n  handling_strategy: same-folder\n  target_directory: Blog Ideas\n  target_tag_name: blog\n",
+	})
+	defer os.RemoveAll(to)
+
+	_, err := MigrateNotes(context.Background(), from, filepath.Join(to, "hugo"), filepath.Join(to, "tags.yaml"), MigrateOptions{Layout: LayoutHugo})
+	assert.NoError(t, err, "migration must succeed")
+	content, err := ioutil.ReadFile(filepath.Join(to, "hugo", "content", "blog-ideas", "my-blog-idea.md"))
+	if assert.NoError(t, err, "note must be in its section, with a slugified filename") {
+		assert.Contains(t, string(content), "draft: true\n", "note must be a draft")
+		assert.Contains(t, string(content), "title: My Blog Idea\n", "title must be in the front matter")
+		assert.Contains(t, string(content), "tags:\n  - blog\n", "tags must be in the front matter")
+		assert.Contains(t, string(content), "![](/blog-ideas/image.png)", "image must be linked from the site root")
+	}
+	assert.FileExists(t, filepath.Join(to, "hugo", "static", "blog-ideas", "image.png"), "image must be in the static directory")
+
+	_, err = MigrateNotes(context.Background(), from, filepath.Join(to, "jekyll"), filepath.Join(to, "tags.yaml"), MigrateOptions{Layout: LayoutJekyll})
+	assert.NoError(t, err, "migration must succeed")
+	content, err = ioutil.ReadFile(filepath.Join(to, "jekyll", "_drafts", "my-blog-idea.md"))
+	if assert.NoError(t, err, "note must be a draft") {
+		assert.Contains(t, string(content), "date: ", "date must be in the front matter")
+		assert.Contains(t, string(content), "![](/assets/image.png)", "image must be linked from the site root")
+	}
+	assert.FileExists(t, filepath.Join(to, "jekyll", "assets", "image.png"), "image must be in the assets directory")
+}
+
+func TestMigrateNotesStaticSiteCollisions(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"Notes!.md": "#blog\nFirst\n",
+		"Notes?.md": "#blog\nSecond\n",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml": "blog:\n  handling_strategy: same-folder\n  target_directory: blog\n  target_tag_name: blog\n",
+	})
+	defer os.RemoveAll(to)
+
+	report, err := MigrateNotes(context.Background(), from, filepath.Join(to, "jekyll"), filepath.Join(to, "tags.yaml"), MigrateOptions{Layout: LayoutJekyll})
+	assert.NoError(t, err, "migration must succeed")
+	assert.Equal(t, 2, report.Successes, "both notes must be migrated")
+	if assert.Len(t, report.Warnings, 1, "there must be a warning") {
+		assert.True(t, errors.Is(report.Warnings[0], ErrNameCollision), "warning must be ErrNameCollision")
+	}
+	content, _ := ioutil.ReadFile(filepath.Join(to, "jekyll", "_drafts", "notes.md"))
+	assert.Contains(t, string(content), "First\n", "the first note must keep its slug")
+	content, _ = ioutil.ReadFile(filepath.Join(to, "jekyll", "_drafts", "notes-2.md"))
+	assert.Contains(t, string(content), "Second\n", "the second note must be numbered")
+}
+
+func TestMigrateNotesLogFile(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"note.md": "#foo\n",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml": "foo:\n  target_tag_name: foo\n",
+	})
+	defer os.RemoveAll(to)
+
+	var messages bytes.Buffer
+	log.SetOutput(&messages)
+	defer log.SetOutput(os.Stderr)
+
+	logFile := filepath.Join(to, "logs", "migration.log")
+	for i := 0; i < 2; i++ {
+		_, err := MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{LogFile: logFile, Arguments: []string{"bearnotes", "migrate"}})
+		assert.NoError(t, err, "migration must succeed")
+	}
+
+	content, err := ioutil.ReadFile(logFile)
+	if assert.NoError(t, err, "log file must be written") {
+		assert.Equal(t, 2, strings.Count(string(content), "bearnotes dev: bearnotes migrate\n"), "runs must be appended")
+		assert.Contains(t, string(content), "Processed 1 notes with 1 successes and 0 failures\n", "console messages must be logged")
+		assert.Contains(t, string(content), "DEBUG note.md: ", "decision trail must be logged")
+		assert.Contains(t, string(content), "Processing note.md...\n", "messages of the notes must be logged")
+	}
+	assert.Contains(t, messages.String(), "Processing note.md...\n", "messages of the notes must go to the standard logger")
+	assert.NotContains(t, messages.String(), "DEBUG", "the decision trail must not go to the standard logger")
+	assert.Equal(t, &messages, log.Writer(), "the standard logger must be left untouched")
+}
+
+func TestMigrateNotesUnusedTags(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"note.md":  "#work/meetings\n",
+		"other.md": "#home\n",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml": "work/*:\n  handling_strategy: same-folder\n  target_directory: work\nhome:\n  target_tag_name: home\n  target_directory: home\nstale:\n  handling_strategy: same-folder\n  target_directory: stale\n_defaults:\n  ignore: true\n",
+	})
+	defer os.RemoveAll(to)
+
+	report, err := MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{})
+	assert.NoError(t, err, "migration must succeed")
+	assert.Equal(t, []string{"_defaults", "stale"}, report.UnusedTags, "entries matching no tag must be reported")
+	assert.Equal(t, []string{"home", "stale"}, report.UnusedDirectories, "directories receiving no note must be reported")
+}
+
+func TestMigrateNotesZettlrDirectories(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"note.md": "#work/meetings\n",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml":                          "work/meetings:\n  handling_strategy: same-folder\n  target_directory: Work/Meetings\n",
+		"notes/Work/Meetings/.ztr-directory": "{}",
+	})
+	defer os.RemoveAll(to)
+
+	_, err := MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{Zettlr: ZettlrOptions{Sorting: ZettlrSortTimeDown, Projects: true}})
+	assert.NoError(t, err, "migration must succeed")
+
+	content, err := ioutil.ReadFile(filepath.Join(to, "notes", "Work", ".ztr-directory"))
+	assert.NoError(t, err, "settings must be written")
+	assert.JSONEq(t, `{"sorting":"time-down","project":{"title":"Work","formats":["html","chromium-pdf"],"filters":[],"cslStyle":"","templates":{"tex":"","html":""}},"icon":null}`, string(content), "top-level directories must be projects")
+	content, err = ioutil.ReadFile(filepath.Join(to, "notes", ".ztr-directory"))
+	assert.NoError(t, err, "settings must be written in the root directory")
+	assert.JSONEq(t, `{"sorting":"time-down","project":null,"icon":null}`, string(content), "the root directory is not a project")
+	content, err = ioutil.ReadFile(filepath.Join(to, "notes", "Work", "Meetings", ".ztr-directory"))
+	assert.NoError(t, err, "existing settings must be kept")
+	assert.Equal(t, "{}", string(content), "existing settings must be kept")
+
+	_, err = MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{Zettlr: ZettlrOptions{Sorting: "unknown"}})
+	assert.Error(t, err, "unknown sorting methods must be rejected")
+}
+
+func TestMigrateNotesTagPresentation(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"note.md":  "#work/meetings\n",
+		"other.md": "#home\n",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml": "work/meetings:\n  handling_strategy: same-folder\n  target_directory: Work/Meetings\n  target_tag_name: meetings\n  color: \"#ff0000\"\n  icon: calendar\nhome:\n  handling_strategy: same-folder\n  target_directory: Home\n  target_tag_name: home\n",
+	})
+	defer os.RemoveAll(to)
+
+	_, err := MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{ObsidianGraph: true, Zettlr: ZettlrOptions{Sorting: ZettlrSortNameUp}})
+	assert.NoError(t, err, "migration must succeed")
+	content, err := ioutil.ReadFile(filepath.Join(to, "notes", ".obsidian", "graph.json"))
+	assert.NoError(t, err, "the Obsidian graph settings must be written")
+	assert.JSONEq(t, `{"colorGroups":[{"query":"tag:#meetings","color":{"a":1,"rgb":16711680}}]}`, string(content), "tags must be colored by their migrated name")
+	content, err = ioutil.ReadFile(filepath.Join(to, "notes", "Work", "Meetings", ".ztr-directory"))
+	assert.NoError(t, err, "settings must be written")
+	assert.JSONEq(t, `{"sorting":"name-up","project":null,"icon":"calendar"}`, string(content), "target directories must get the icon of their tag")
+	content, err = ioutil.ReadFile(filepath.Join(to, "notes", "Home", ".ztr-directory"))
+	assert.NoError(t, err, "settings must be written")
+	assert.JSONEq(t, `{"sorting":"name-up","project":null,"icon":null}`, string(content), "tags without icon set none")
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(to, "tags.yaml"), []byte("home:\n  target_tag_name: home\n  color: red\n"), 0644), "tag file must be written")
+	_, err = MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{})
+	assert.Error(t, err, "invalid colors must be rejected")
+}
+
+func TestMigrateNotesObsidianConfig(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"note.md": "# Note\n",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml":                "{}\n",
+		"vault/.obsidian/app.json": "{\"attachmentFolderPath\":\"mine\"}",
+	})
+	defer os.RemoveAll(to)
+
+	options := MigrateOptions{ObsidianConfig: true, AssetDirectory: "assets", Vaults: map[string]string{"vault": filepath.Join(to, "vault")}}
+	_, err := MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), options)
+	assert.NoError(t, err, "migration must succeed")
+	content, err := ioutil.ReadFile(filepath.Join(to, "notes", ".obsidian", "app.json"))
+	assert.NoError(t, err, "the Obsidian settings must be written")
+	assert.JSONEq(t, `{"attachmentFolderPath":"./assets","newLinkFormat":"shortest","useMarkdownLinks":false}`, string(content), "the Obsidian settings must match the migration")
+	content, err = ioutil.ReadFile(filepath.Join(to, "vault", ".obsidian", "app.json"))
+	assert.NoError(t, err, "the Obsidian settings must be readable")
+	assert.Equal(t, `{"attachmentFolderPath":"mine"}`, string(content), "existing settings must be left untouched")
+}
+
+func TestMigrateNotesMetrics(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"note.md":        "#foo\n![](note/image.png)\n",
+		"note/image.png": "PNG",
+		"unknown.md":     "#bar\n",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml": "foo:\n  target_tag_name: foo\n",
+	})
+	defer os.RemoveAll(to)
+
+	metricsFile := filepath.Join(to, "bearnotes.prom")
+	_, err := MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{MetricsFile: metricsFile})
+	assert.NoError(t, err, "migration must succeed")
+
+	content, err := ioutil.ReadFile(metricsFile)
+	if assert.NoError(t, err, "metrics must be written") {
+		for _, metric := range []string{"bearnotes_notes_processed 2\n", "bearnotes_notes_failed 1\n", "bearnotes_bytes_copied 3\n", "bearnotes_last_run_success 0\n", "# TYPE bearnotes_duration_seconds gauge\n"} {
+			assert.Contains(t, string(content), metric, "metrics must be written")
+		}
+	}
+}
+
+func TestCleanAssetName(t *testing.T) {
+	suffixes, err := compileAssetSuffixes(DefaultAssetSuffixes)
+	assert.NoError(t, err, "default suffixes must compile")
+	testCases := map[string]string{
+		"image (1).png":       "image.png",
+		"image(2)@2x.png":     "image.png",
+		"photo_1024x768.jpeg": "photo.jpeg",
+		"report-2023.pdf":     "report-2023.pdf",
+		"(1).png":             "(1).png",
+		"no extension (3)":    "no extension",
+	}
+	for name, expected := range testCases {
+		assert.Equal(t, expected, cleanAssetName(name, suffixes), "suffixes of '%s' must be stripped", name)
+	}
+
+	from := writeTestFiles(t, map[string]string{
+		"a/image (1).png": "PNG A",
+		"b/image (2).png": "PNG B",
+		"c/image.png":     "PNG C",
+		"d/image.png":     "PNG D",
+	})
+	defer os.RemoveAll(from)
+	names := newAssetNames(suffixes)
+	assert.Equal(t, "image.png", names.clean("/to", "image (1).png", filepath.Join(from, "a/image (1).png")), "cleaned names must be allocated")
+	assert.Equal(t, "image.png", names.clean("/to", "image (1).png", filepath.Join(from, "a/image (1).png")), "the same asset must get the same name")
+	assert.Equal(t, "image (2).png", names.clean("/to", "image (2).png", filepath.Join(from, "b/image (2).png")), "taken names must not be reused")
+	assert.Equal(t, "image-2.png", names.clean("/to", "image.png", filepath.Join(from, "c/image.png")), "taken original names must be numbered")
+	assert.Equal(t, "image-3.png", names.clean("/to", "image.png", filepath.Join(from, "d/image.png")), "numbers must not be reused")
+	assert.Equal(t, "image-2.png", names.clean("/to", "image.png", filepath.Join(from, "c/image.png")), "the same asset must get the same number")
+	assert.Equal(t, "image-4.png", names.clean("/to", "image.png", filepath.Join(from, "e/image.png")), "missing assets must not take a name")
+	assert.Equal(t, "image-4.png", names.clean("/to", "image.png", filepath.Join(from, "f/image.png")), "missing assets must not take a name")
+
+	_, err = compileAssetSuffixes([]string{"("})
+	assert.Error(t, err, "invalid patterns must be rejected")
+}
+
+func TestMigrateNotesAssetSuffixes(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"a.md":            "![](a/image (1).png)\n",
+		"a/image (1).png": "PNG A",
+		"b.md":            "![](b/image.png)\n",
+		"b/image.png":     "PNG B",
+	})
+	defer os.RemoveAll(from)
+	config := writeTestFiles(t, map[string]string{
+		"tags.yaml": "{}\n",
+	})
+	defer os.RemoveAll(config)
+	to := writeTestFiles(t, nil)
+	defer os.RemoveAll(to)
+
+	report, err := MigrateNotes(context.Background(), from, to, filepath.Join(config, "tags.yaml"), MigrateOptions{AssetSuffixes: DefaultAssetSuffixes})
+	assert.NoError(t, err, "migration must succeed")
+	assert.Empty(t, report.Warnings, "assets must not conflict")
+	content, _ := ioutil.ReadFile(filepath.Join(to, "image.png"))
+	assert.Equal(t, "PNG A", string(content), "the first asset must get the cleaned name")
+	content, _ = ioutil.ReadFile(filepath.Join(to, "image-2.png"))
+	assert.Equal(t, "PNG B", string(content), "the second asset must be numbered")
+	content, _ = ioutil.ReadFile(filepath.Join(to, "b.md"))
+	assert.Equal(t, "![](image-2.png)\n", string(content), "the link must follow the numbered asset")
+}
+
+func TestExtractTagsFromDir(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"a.md":               "#foo #bar\n",
+		"sub/b.md":           "#foo\n",
+		"sub/b/image.md.png": "PNG",
+	})
+	defer os.RemoveAll(from)
+
+	tags, err := ExtractTagsFromDir(context.Background(), from, ParseOptions{})
+	assert.NoError(t, err, "tags must be extracted")
+	assert.Equal(t, map[string][]string{"a.md": {"foo", "bar"}, "sub/b.md": {"foo"}}, tags, "tags must be indexed by note")
+}
+
+func TestPlanPreview(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"note.md":  "# Title\n\none\ntwo\nthree\nfour\n#work\n",
+		"other.md": "#work\n",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml": "work:\n  target_tag_name: job\n  handling_strategy: same-folder\n  target_directory: Job\n",
+	})
+	defer os.RemoveAll(to)
+
+	plan, err := PlanMigration(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{})
+	assert.NoError(t, err, "planning must succeed")
+	var out strings.Builder
+	matched, err := plan.Preview(&out, []string{"note.md"})
+	assert.NoError(t, err, "preview must succeed")
+	assert.Equal(t, 1, matched, "only the selected note must be previewed")
+	expected := fmt.Sprintf("--- %s\n+++ %s\n@@ -4,4 +4,4 @@\n two\n three\n four\n-#work\n+#job\n", filepath.Join(from, "note.md"), filepath.Join(to, "notes", "Job", "note.md"))
+	assert.Equal(t, expected, out.String(), "the rewrite must be shown as a unified diff")
+
+	_, err = plan.Preview(&out, []string{"["})
+	assert.Error(t, err, "malformed patterns must be rejected")
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	testCases := []struct {
+		a, b     string
+		expected string
+	}{
+		{"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n", "1\nX\n3\n4\n5\n6\n7\n8\n9\nY\n", "@@ -1,5 +1,5 @@\n 1\n-2\n+X\n 3\n 4\n 5\n@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+Y\n"},
+		{"", "x\n", "@@ -0,0 +1,1 @@\n+x\n"},
+		{"a\nb", "a\nc", "@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n"},
+		{"same\n", "same\n", ""},
+	}
+	for _, testCase := range testCases {
+		var out strings.Builder
+		err := writeUnifiedDiff(&out, "a", "b", testCase.a, testCase.b)
+		assert.NoError(t, err, "diff must be written")
+		if testCase.expected != "" {
+			testCase.expected = "--- a\n+++ b\n" + testCase.expected
+		}
+		assert.Equal(t, testCase.expected, out.String(), "diff must be in the unified format")
+	}
+
+	// Beyond maxDiffCells, the changed lines are replaced as a whole, even
+	// those common to both sides
+	var a, b, removed, added strings.Builder
+	for i := 0; i <= 1100; i++ {
+		line := fmt.Sprintf("common %d\n", i)
+		if i%2 == 0 {
+			line = fmt.Sprintf("line %d\n", i)
+			b.WriteString(fmt.Sprintf("changed %d\n", i))
+			added.WriteString(fmt.Sprintf("+changed %d\n", i))
+		} else {
+			b.WriteString(line)
+			added.WriteString("+" + line)
+		}
+		a.WriteString(line)
+		removed.WriteString("-" + line)
+	}
+	var out strings.Builder
+	err := writeUnifiedDiff(&out, "a", "b", "first\n"+a.String()+"last\n", "first\n"+b.String()+"last\n")
+	assert.NoError(t, err, "diff must be written")
+	assert.Equal(t, "--- a\n+++ b\n@@ -1,1103 +1,1103 @@\n first\n"+removed.String()+added.String()+" last\n", out.String(), "large changes must be replaced as a whole")
+}
+
+func TestMigrateNotesFolderTags(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"Work/Meetings/untagged.md": "No tag here\n",
+		"Work/tagged.md":            "#home\n",
+		"root.md":                   "No tag either\n",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml": "work/meetings:\n  handling_strategy: same-folder\n  target_directory: Meetings\n  target_tag_name: meetings\nhome:\n  handling_strategy: same-folder\n  target_directory: Home\n  target_tag_name: home\n",
+	})
+	defer os.RemoveAll(to)
+
+	report, err := MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{FolderTags: true, Keywords: KeywordOptions{Field: "tags"}})
+	assert.NoError(t, err, "migration must succeed")
+	assert.Empty(t, report.Errors, "pseudo-tags must be routed")
+	content, err := ioutil.ReadFile(filepath.Join(to, "notes", "Meetings", "untagged.md"))
+	assert.NoError(t, err, "untagged notes must be routed by their folder")
+	assert.Equal(t, "---\ntags:\n  - meetings\n---\nNo tag here\n", string(content), "the pseudo-tag must only appear in the front matter")
+	assert.FileExists(t, filepath.Join(to, "notes", "Home", "tagged.md"), "tagged notes must be routed by their tags")
+	assert.FileExists(t, filepath.Join(to, "notes", "root.md"), "notes at the root have no pseudo-tag")
+
+	tagFile := filepath.Join(to, "discovered.yaml")
+	err = DiscoverNotes(context.Background(), from, tagFile, DiscoverOptions{FolderTags: true})
+	assert.NoError(t, err, "discovery must succeed")
+	tags, err := LoadTagFile(tagFile)
+	assert.NoError(t, err, "tag file must be readable")
+	assert.Contains(t, tags, "work/meetings", "pseudo-tags must be discovered")
+	assert.NotContains(t, tags, "work", "tagged notes must not get a pseudo-tag")
+}
+
+func TestMigrateNotesCategories(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"note.md": "#work/project/alpha\nText\n",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, nil)
+	defer os.RemoveAll(to)
+
+	// The generated tag file renames nested tags after their last component
+	tagFile := filepath.Join(to, "tags.yaml")
+	assert.NoError(t, DiscoverNotes(context.Background(), from, tagFile, DiscoverOptions{}), "discovery must succeed")
+	report, err := MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), tagFile, MigrateOptions{Keywords: KeywordOptions{Categories: "categories"}})
+	assert.NoError(t, err, "migration must succeed")
+	assert.Empty(t, report.Errors, "there must be no error")
+	content, err := ioutil.ReadFile(filepath.Join(to, "notes", "work", "project", "alpha", "note.md"))
+	assert.NoError(t, err, "note must be migrated")
+	assert.Equal(t, "---\ncategories:\n  - work\n  - project\n  - alpha\n---\n#alpha\nText\n", string(content), "categories must come from the path of the tag")
+}
+
+func TestMigrateNotesKeywordsNesting(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"note.md": "#work/project/alpha\nText\n",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, nil)
+	defer os.RemoveAll(to)
+
+	tagFile := filepath.Join(to, "tags.yaml")
+	assert.NoError(t, DiscoverNotes(context.Background(), from, tagFile, DiscoverOptions{}), "discovery must succeed")
+	for nesting, expected := range map[string]string{
+		NestingPath:      "  - work/project/alpha\n",
+		NestingFlat:      "  - work_project_alpha\n",
+		NestingHierarchy: "  - work\n  - work/project\n  - work/project/alpha\n",
+	} {
+		dir := filepath.Join(to, nesting)
+		report, err := MigrateNotes(context.Background(), from, dir, tagFile, MigrateOptions{Keywords: KeywordOptions{Field: "tags", Nesting: nesting, Delimiter: "_"}})
+		assert.NoError(t, err, "migration must succeed")
+		assert.Empty(t, report.Errors, "there must be no error")
+		content, err := ioutil.ReadFile(filepath.Join(dir, "work", "project", "alpha", "note.md"))
+		assert.NoError(t, err, "note must be migrated")
+		assert.Equal(t, "---\ntags:\n"+expected+"---\n#alpha\nText\n", string(content), "nested tags must be written from their path (%s)", nesting)
+	}
+}
+
+func TestDiscoverNotesStrategies(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"trip.md":     "#travel\n![](trip/1.jpg) ![](trip/2.jpg) ![](trip/3.jpg) ![](trip/4.jpg)\n",
+		"trip/1.jpg":  "JPG",
+		"trip/2.jpg":  "JPG",
+		"trip/3.jpg":  "JPG",
+		"trip/4.jpg":  "JPG",
+		"beach.md":    "#travel\n![](beach/1.jpg) ![](beach/2.jpg)\n",
+		"beach/1.jpg": "JPG",
+		"beach/2.jpg": "JPG",
+		"idea.md":     "#ideas #travel\nNo attachment\n",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, nil)
+	defer os.RemoveAll(to)
+
+	tagFile := filepath.Join(to, "tags.yaml")
+	err := DiscoverNotes(context.Background(), from, tagFile, DiscoverOptions{OneNotePerFolderThreshold: 2})
+	assert.NoError(t, err, "discovery must succeed")
+	tags, err := LoadTagFile(tagFile)
+	assert.NoError(t, err, "tag file must be readable")
+	assert.Equal(t, StrategyOneNotePerFolder, tags["travel"].HandlingStrategy, "notes with many attachments must get a folder each")
+	assert.Equal(t, StrategySameFolder, tags["ideas"].HandlingStrategy, "notes without attachments must share a folder")
+	content, _ := ioutil.ReadFile(tagFile)
+	assert.Contains(t, string(content), "# one-note-per-folder: 2.0 images and attachments per note on average (3 notes, 2 or more)\ntravel:\n", "the reasoning must be recorded")
+	assert.Contains(t, string(content), "# same-folder: 0.0 images and attachments per note on average (1 notes, less than 2)\nideas:\n", "the reasoning must be recorded")
+}
+
+func TestDiscoverNotesNumericTags(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"note.md": "#2023/01 see issue #1\n",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, nil)
+	defer os.RemoveAll(to)
+
+	tagFile := filepath.Join(to, "tags.yaml")
+	err := DiscoverNotes(context.Background(), from, tagFile, DiscoverOptions{Parse: ParseOptions{NumericTags: true}})
+	assert.NoError(t, err, "discovery must succeed")
+	tags, err := LoadTagFile(tagFile)
+	assert.NoError(t, err, "tag file must be readable")
+	assert.Equal(t, TagOptions{TargetTagName: "1"}, tags["1"], "purely numeric tags must be left unclassified")
+	assert.Equal(t, StrategySameFolder, tags["2023/01"].HandlingStrategy, "other numeric tags must be classified")
+	content, _ := ioutil.ReadFile(tagFile)
+	assert.Contains(t, string(content), "# unclassified: purely numeric tags are most likely false positives (issue #1), set a handling strategy and a target directory to route their notes\n\"1\":\n", "the reason must be recorded")
+
+	report, err := MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), tagFile, MigrateOptions{Parse: ParseOptions{NumericTags: true}})
+	assert.NoError(t, err, "migration must succeed")
+	assert.Empty(t, report.Errors, "there must be no error")
+	content, err = ioutil.ReadFile(filepath.Join(to, "notes", "2023", "01", "note.md"))
+	assert.NoError(t, err, "notes must be routed by their classified tags")
+	assert.Equal(t, "#01 see issue #1\n", string(content), "unclassified tags must be left as-is")
+}
+
+func TestMigrateNotesTitleRules(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"Meeting with Bob.md":   "No tag here\n",
+		"Meeting with Alice.md": "#home\n",
+		"Recipe - Pancakes.md":  "No tag either\n",
+		"Random thoughts.md":    "Nothing to match\n",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml": "_settings:\n  title_rules:\n    - pattern: ^Meeting\n      handling_strategy: same-folder\n      target_directory: meetings\n      target_tag_name: meeting\n    - pattern: (?i)^recipe\n      handling_strategy: same-folder\n      target_directory: recipes\nhome:\n  handling_strategy: same-folder\n  target_directory: Home\n  target_tag_name: home\n",
+	})
+	defer os.RemoveAll(to)
+
+	tags, err := LoadTagFile(filepath.Join(to, "tags.yaml"))
+	assert.NoError(t, err, "tag file must be read")
+	assert.NotContains(t, tags, "_settings", "the title rules are not a tag")
+
+	report, err := MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{Keywords: KeywordOptions{Field: "tags"}})
+	assert.NoError(t, err, "migration must succeed")
+	assert.Empty(t, report.Errors, "there must be no error")
+	content, err := ioutil.ReadFile(filepath.Join(to, "notes", "meetings", "Meeting with Bob.md"))
+	assert.NoError(t, err, "untagged notes must be routed by their title")
+	assert.Equal(t, "---\ntags:\n  - meeting\n---\nNo tag here\n", string(content), "the target tag name of the rule must only appear in the front matter")
+	assert.FileExists(t, filepath.Join(to, "notes", "Home", "Meeting with Alice.md"), "tagged notes must be routed by their tags")
+	assert.FileExists(t, filepath.Join(to, "notes", "recipes", "Recipe - Pancakes.md"), "the first matching rule must apply")
+	assert.FileExists(t, filepath.Join(to, "notes", "Random thoughts.md"), "notes matching no rule must not be routed")
+	assert.Empty(t, report.RenamedTags, "title rules rename no tag")
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(to, "tags.yaml"), []byte("_settings:\n  title_rules:\n    - pattern: ^Meeting(\n"), 0644), "tag file must be written")
+	_, err = MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{})
+	assert.Error(t, err, "invalid title rules must be rejected")
+}
+
+func TestMigrateNotesSimilarImages(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"note.md":     "#work\n![](note/a.png)\n",
+		"note/a.png":  encodeTestImage(t, 1, 64, false),
+		"other.md":    "#work\n![](other/b.jpg) ![](other/c.png)\n",
+		"other/b.jpg": encodeTestImage(t, 1, 128, true),
+		"other/c.png": encodeTestImage(t, 2, 64, false),
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml": "work:\n  handling_strategy: same-folder\n  target_directory: work\n",
+	})
+	defer os.RemoveAll(to)
+
+	report, err := MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{SimilarImages: true})
+	assert.NoError(t, err, "migration must succeed")
+	assert.Equal(t, []ImageCluster{{Images: []string{filepath.Join(to, "notes", "work", "a.png"), filepath.Join(to, "notes", "work", "b.jpg")}}}, report.SimilarImages, "similar images must be reported")
+	assert.FileExists(t, filepath.Join(to, "notes", "work", "b.jpg"), "similar images must not be deleted")
+
+	// The last tile of the altered copy changes 2 bits of its hash
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(from, "other", "c.png"), []byte(alterTestImage(t, encodeTestImage(t, 1, 64, false), 200)), 0644), "image must be written")
+	altered := filepath.Join(to, "altered", "work", "c.png")
+	for _, testCase := range []struct {
+		distance int
+		similar  bool
+	}{{-1, true}, {0, false}, {2, true}} {
+		report, err = MigrateNotes(context.Background(), from, filepath.Join(to, "altered"), filepath.Join(to, "tags.yaml"), MigrateOptions{SimilarImages: true, SimilarImageDistance: testCase.distance})
+		assert.NoError(t, err, "migration must succeed")
+		if assert.Len(t, report.SimilarImages, 1, "similar images must be reported") {
+			assert.Equal(t, testCase.similar, containsString(report.SimilarImages[0].Images, altered), "the distance %d must be honored", testCase.distance)
+		}
+	}
+}
+
+// alterTestImage paints the bottom right tile of an image encoded by
+// encodeTestImage (PNG) with the given gray.
+func alterTestImage(t *testing.T, content string, gray uint8) string {
+	img, err := png.Decode(strings.NewReader(content))
+	assert.NoError(t, err, "image must be decoded")
+	altered := image.NewGray(img.Bounds())
+	draw.Draw(altered, altered.Bounds(), img, image.Point{}, draw.Src)
+	size := img.Bounds().Dx()
+	draw.Draw(altered, image.Rect(size*7/8, size*7/8, size, size), image.NewUniform(color.Gray{Y: gray}), image.Point{}, draw.Src)
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, altered), "image must be encoded")
+	return buf.String()
+}
+
+func TestMigrateNotesNoteExtension(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"note.md":  "#work\nSee [other](other.md#heading), [remote](https://example.test/page.md) and [[other]]\n",
+		"other.md": "#work\n",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml": "work:\n  handling_strategy: same-folder\n  target_directory: work\n  target_tag_name: work\n",
+	})
+	defer os.RemoveAll(to)
+
+	_, err := MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{NoteExtension: "markdown"})
+	assert.NoError(t, err, "migration must succeed")
+	content, err := ioutil.ReadFile(filepath.Join(to, "notes", "work", "note.markdown"))
+	assert.NoError(t, err, "notes must have the chosen extension")
+	assert.Equal(t, "#work\nSee [other](other.markdown#heading), [remote](https://example.test/page.md) and [[other]]\n", string(content), "links between notes must follow the extension")
+	assert.FileExists(t, filepath.Join(to, "notes", "work", "other.markdown"), "notes must have the chosen extension")
+
+	_, err = MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{NoteExtension: "../md"})
+	assert.Error(t, err, "invalid extensions must be rejected")
+}
+
+func TestMigrateNotesFailedDirectory(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"ok.md":          "#work\n",
+		"sub/unknown.md": "#unknown\n",
+		"blocked.md":     "#blocked\n",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml":     "work:\n  handling_strategy: same-folder\n  target_directory: work\n  target_tag_name: job\nblocked:\n  handling_strategy: same-folder\n  target_directory: blocked\n  target_tag_name: blocked\n",
+		"notes/blocked": "not a directory",
+	})
+	defer os.RemoveAll(to)
+
+	report, err := MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{FailedDirectory: DefaultFailedDirectory, SkipPreflight: true})
+	assert.NoError(t, err, "migration must succeed")
+	assert.Len(t, report.Errors, 2, "failed notes must be reported")
+	content, err := ioutil.ReadFile(filepath.Join(to, "notes", "_failed", "sub", "unknown.md"))
+	assert.NoError(t, err, "notes failing the planning must be copied")
+	assert.Equal(t, "#unknown\n", string(content), "failed notes must be copied unmodified")
+	content, err = ioutil.ReadFile(filepath.Join(to, "notes", "_failed", "sub", "unknown.md.error.txt"))
+	assert.NoError(t, err, "failed notes must be described")
+	assert.Contains(t, string(content), "unknown tag", "the errors of the note must be described")
+	content, err = ioutil.ReadFile(filepath.Join(to, "notes", "_failed", "blocked.md"))
+	assert.NoError(t, err, "notes failing the migration must be copied")
+	assert.Equal(t, "#blocked\n", string(content), "failed notes must be copied unmodified")
+	assert.FileExists(t, filepath.Join(to, "notes", "_failed", "blocked.md.error.txt"), "failed notes must be described")
+	assert.NoFileExists(t, filepath.Join(to, "notes", "_failed", "ok.md"), "migrated notes must not be copied")
+}
+
+// testAltText describes images by their content, as an OCR would.
+type testAltText struct{}
+
+func (testAltText) AltText(ctx context.Context, path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil || string(content) == "BROKEN" {
+		return "", fmt.Errorf("cannot recognize %s", filepath.Base(path))
+	}
+	return string(content), nil
+}
+
+func TestMigrateNotesAltText(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"note.md":         "#work\n![](note/scan.png)\n![Kept](note/kept.png)\n![](note/broken.png)\n",
+		"note/scan.png":   "Invoice [2020]\n  Total:\t42 €\n",
+		"note/kept.png":   "Some text",
+		"note/broken.png": "BROKEN",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml": "work:\n  handling_strategy: same-folder\n  target_directory: work\n  target_tag_name: work\n",
+	})
+	defer os.RemoveAll(to)
+
+	report, err := MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{AltText: testAltText{}})
+	assert.NoError(t, err, "migration must succeed")
+	content, err := ioutil.ReadFile(filepath.Join(to, "notes", "work", "note.md"))
+	assert.NoError(t, err, "notes must be migrated")
+	assert.Equal(t, "#work\n![Invoice 2020 Total: 42 €](scan.png)\n![Kept](kept.png)\n![](broken.png)\n", string(content), "images without alternative text must get one")
+	assert.Len(t, report.Warnings, 1, "failures must be reported")
+	assert.True(t, errors.Is(report.Warnings[0], ErrAltTextFailed), "failures must be reported")
+
+	_, err = MigrateNotes(context.Background(), from, filepath.Join(to, "none"), filepath.Join(to, "tags.yaml"), MigrateOptions{AltText: NoAltText})
+	assert.NoError(t, err, "migration must succeed")
+	content, err = ioutil.ReadFile(filepath.Join(to, "none", "work", "note.md"))
+	assert.NoError(t, err, "notes must be migrated")
+	assert.Equal(t, "#work\n![](scan.png)\n![Kept](kept.png)\n![](broken.png)\n", string(content), "the default provider must leave images as-is")
+}
+
+func TestCheckMigration(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"note.md":        "# Été\n#work ::important:: see [the site](https://example.test) and [[other]]\n![](note/image.png)\n<a href='note/file.pdf'>file.pdf</a>\n",
+		"note/image.png": "PNG",
+		"note/file.pdf":  "PDF",
+		"other.md":       "#work\nSome text\n",
+		"lost.md":        "#work\nSome important text\n",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml": "work:\n  handling_strategy: same-folder\n  target_directory: work\n  target_tag_name: job\n",
+	})
+	defer os.RemoveAll(to)
+
+	// Notes are numbered by creation date
+	for i, name := range []string{"note.md", "other.md", "lost.md"} {
+		date := time.Date(2020, 1, i+1, 0, 0, 0, 0, time.UTC)
+		assert.NoError(t, os.Chtimes(filepath.Join(from, name), date, date), "dates must be set")
+	}
+	transforms, err := LookupTransforms([]string{"highlights"})
+	assert.NoError(t, err, "transforms must exist")
+	options := MigrateOptions{Transforms: transforms, SourceLink: SourceLinkFooter, Keywords: KeywordOptions{Field: "tags"}, Numbering: NumberingSequence}
+	_, err = MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), options)
+	assert.NoError(t, err, "migration must succeed")
+
+	report, err := CheckMigration(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), options)
+	assert.NoError(t, err, "check must succeed")
+	assert.Equal(t, 3, report.Notes, "all notes must be checked")
+	assert.Equal(t, 3, report.Verified, "migrated notes must be intact")
+	assert.Empty(t, report.Errors, "migrated notes must be intact")
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(to, "notes", "work", "003 - lost.md"), []byte("#job\nSome text\n"), 0644), "note must be written")
+	assert.NoError(t, os.Remove(filepath.Join(to, "notes", "work", "002 - other.md")), "note must be removed")
+	report, err = CheckMigration(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), options)
+	assert.NoError(t, err, "check must succeed")
+	assert.Equal(t, 1, report.Verified, "only intact notes must be verified")
+	assert.Len(t, report.Errors, 2, "altered notes must be reported")
+	assert.True(t, errors.Is(report.Errors[0], ErrContentMismatch), "altered notes must be reported")
+	assert.Contains(t, report.Errors[0].Error(), "1 words lost (important)", "lost words must be reported")
+	assert.True(t, errors.Is(report.Errors[1], ErrReadFailed), "missing notes must be reported")
+}
+
+func TestCheckMigrationHTML(t *testing.T) {
+	if _, err := exec.LookPath("pandoc"); err != nil {
+		t.Skip("pandoc is not available")
+	}
+	from := writeTestFiles(t, map[string]string{
+		"note.html": "<html><body><p>Some <b>important</b> text</p></body></html>\n",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml": "{}\n",
+	})
+	defer os.RemoveAll(to)
+
+	options := MigrateOptions{ConvertHTML: true}
+	_, err := MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), options)
+	assert.NoError(t, err, "migration must succeed")
+	report, err := CheckMigration(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), options)
+	assert.NoError(t, err, "check must succeed")
+	assert.Equal(t, 1, report.Verified, "HTML notes must be compared once converted")
+	assert.Empty(t, report.Errors, "HTML notes must be compared once converted")
+}
+
+func TestMigrateNotesHeadingLinks(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"note.md":       "#work\nSee [[Other note/Second part]], [[Other note/Gone|gone]], [[Missing/Part]] and [Intro](bear://x-callback-url/open-note?title=Other%20note&header=introduction!)\n",
+		"Other note.md": "# Other note\n## Introduction\n## Second part\n#work\n",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml": "work:\n  handling_strategy: same-folder\n  target_directory: work\n  target_tag_name: work\n",
+	})
+	defer os.RemoveAll(to)
+
+	report, err := MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{HeadingLinks: true})
+	assert.NoError(t, err, "migration must succeed")
+	content, err := ioutil.ReadFile(filepath.Join(to, "notes", "work", "note.md"))
+	assert.NoError(t, err, "notes must be migrated")
+	assert.Equal(t, "#work\nSee [[Other note#Second part]], [[Other note|gone]], [[Missing/Part]] and [[Other note#Introduction|Intro]]\n", string(content), "links to headings must be rewritten")
+	assert.Len(t, report.Warnings, 1, "links to missing headings must be reported")
+	assert.True(t, errors.Is(report.Warnings[0], ErrHeadingMissing), "links to missing headings must be reported")
+}
+
+func TestMigrateNotesGlobalOptions(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"note.md":        "#work\n![](note/image.png)\n",
+		"note/image.png": "PNG",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml": "_settings:\n  global:\n    handling_strategy: one-note-per-folder\n    asset_directory: assets\nwork:\n  target_directory: work\n  target_tag_name: work\n",
+	})
+	defer os.RemoveAll(to)
+
+	_, err := MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{})
+	assert.NoError(t, err, "migration must succeed")
+	content, err := ioutil.ReadFile(filepath.Join(to, "notes", "work", "note", "note.md"))
+	assert.NoError(t, err, "the default handling strategy must apply")
+	assert.Equal(t, "#work\n![](assets/image.png)\n", string(content), "links must point to the asset directory")
+	assert.FileExists(t, filepath.Join(to, "notes", "work", "note", "assets", "image.png"), "assets must go to the asset directory")
+
+	_, err = MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{DefaultHandlingStrategy: "unknown"})
+	assert.Error(t, err, "unknown handling strategies must be rejected")
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(to, "global.yaml"), []byte("global:\n  asset_directory: assets\nwork:\n  target_tag_name: work\n"), 0644), "tag file must be written")
+	_, err = MigrateNotes(context.Background(), from, filepath.Join(to, "global"), filepath.Join(to, "global.yaml"), MigrateOptions{})
+	assert.NoError(t, err, "migration must succeed")
+	assert.FileExists(t, filepath.Join(to, "global", "image.png"), "a top-level global entry must not hold settings")
+}
+
+func TestMigrateNotesTagTransforms(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"clipped.md": "#clippings\n<div>Hello&nbsp;<b>world</b></div>\n",
+		"note.md":    "#work\n<div>kept</div>\n",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml": "clippings:\n  handling_strategy: same-folder\n  target_directory: clippings\n  target_tag_name: clippings\n  transforms: [strip-html]\nwork:\n  handling_strategy: same-folder\n  target_directory: work\n  target_tag_name: work\n",
+	})
+	defer os.RemoveAll(to)
+
+	report, err := MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{})
+	assert.NoError(t, err, "migration must succeed")
+	assert.Equal(t, 5, report.HTMLRemoved, "removed elements must be reported")
+	content, err := ioutil.ReadFile(filepath.Join(to, "notes", "clippings", "clipped.md"))
+	assert.NoError(t, err, "note must be migrated")
+	assert.Equal(t, "#clippings\nHello **world**\n\n", string(content), "the transforms of the tag must apply")
+	content, err = ioutil.ReadFile(filepath.Join(to, "notes", "work", "note.md"))
+	assert.NoError(t, err, "note must be migrated")
+	assert.Equal(t, "#work\n<div>kept</div>\n", string(content), "the transforms of other tags must not apply")
+
+	tagFile := filepath.Join(to, "unknown.yaml")
+	assert.NoError(t, ioutil.WriteFile(tagFile, []byte("work:\n  transforms: [unknown]\n"), 0644), "tag file must be written")
+	_, err = MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), tagFile, MigrateOptions{})
+	assert.Error(t, err, "unknown transforms must be rejected")
+}
+
+func TestMigrateNotesSizeRules(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"fleeting.md":  "#idea\nA short thought\n",
+		"permanent.md": "#idea\n" + strings.Repeat("A longer developed thought. ", 20) + "\n",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml": "idea:\n  handling_strategy: same-folder\n  target_directory: zettelkasten\n  target_tag_name: idea\n  size_rules:\n    - max_words: 50\n      target_directory: inbox\n",
+	})
+	defer os.RemoveAll(to)
+
+	_, err := MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{})
+	assert.NoError(t, err, "migration must succeed")
+	assert.FileExists(t, filepath.Join(to, "notes", "inbox", "fleeting.md"), "short notes must follow the size rule")
+	assert.FileExists(t, filepath.Join(to, "notes", "zettelkasten", "permanent.md"), "long notes must follow the tag")
+
+	tagFile := filepath.Join(to, "invalid.yaml")
+	assert.NoError(t, ioutil.WriteFile(tagFile, []byte("idea:\n  size_rules:\n    - max_words: 50\n"), 0644), "tag file must be written")
+	_, err = MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), tagFile, MigrateOptions{})
+	assert.Error(t, err, "size rules without override must be rejected")
+}
+
+func TestMigrateNotesTimezone(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"note.md": "#foo\n",
+	})
+	defer os.RemoveAll(from)
+	created := time.Date(2020, 1, 1, 23, 30, 0, 0, time.UTC)
+	os.Chtimes(filepath.Join(from, "note.md"), created, created)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml": "foo:\n  target_directory: foo\n  target_tag_name: foo\n",
+	})
+	defer os.RemoveAll(to)
+
+	_, err := MigrateNotes(context.Background(), from, filepath.Join(to, "hugo"), filepath.Join(to, "tags.yaml"), MigrateOptions{Layout: LayoutHugo, Timezone: "Asia/Tokyo"})
+	assert.NoError(t, err, "migration must succeed")
+	content, err := ioutil.ReadFile(filepath.Join(to, "hugo", "content", "foo", "note.md"))
+	assert.NoError(t, err, "note must be migrated")
+	assert.Contains(t, string(content), "date: \"2020-01-02T08:30:00+09:00\"", "dates must be in the time zone")
+
+	_, err = MigrateNotes(context.Background(), from, filepath.Join(to, "numbered"), filepath.Join(to, "tags.yaml"), MigrateOptions{Numbering: NumberingDate, Timezone: "UTC"})
+	assert.NoError(t, err, "migration must succeed")
+	assert.FileExists(t, filepath.Join(to, "numbered", "2020-01-01 note.md"), "filenames must be in the time zone")
+
+	_, err = MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{Timezone: "Nowhere/Unknown"})
+	assert.Error(t, err, "unknown time zones must be rejected")
+}
+
+func TestMigrateNotesAssetDirectories(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"note.md":        "#work\n![](note/image.png)\n<a href='note/paper.pdf'>paper.pdf</a>\n<a href='note/song.mp3'>song.mp3</a>\n",
+		"note/image.png": "PNG",
+		"note/paper.pdf": "PDF",
+		"note/song.mp3":  "MP3",
+		"other.md":       "#music\n<a href='other/tune.mp3'>tune.mp3</a>\n",
+		"other/tune.mp3": "MP3",
+		"talk.md":        "#music\n<a href='talk/paper.pdf'>paper.pdf</a>\n",
+		"talk/paper.pdf": "PDF 2",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml": "work:\n  handling_strategy: same-folder\n  target_directory: work\n  target_tag_name: work\nmusic:\n  handling_strategy: same-folder\n  target_directory: music\n  target_tag_name: music\n  asset_directories:\n    audio: sounds\n",
+	})
+	defer os.RemoveAll(to)
+
+	_, err := MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{AssetDirectories: map[string]string{"pdf": "/library", "audio": "/audio"}})
+	assert.NoError(t, err, "migration must succeed")
+	content, err := ioutil.ReadFile(filepath.Join(to, "notes", "work", "note.md"))
+	assert.NoError(t, err, "note must be migrated")
+	assert.Equal(t, "#work\n![](image.png)\n[paper.pdf](../library/paper.pdf)\n[song.mp3](../audio/song.mp3)\n", string(content), "links must follow the asset type")
+	assert.FileExists(t, filepath.Join(to, "notes", "work", "image.png"), "images must stay next to the note")
+	assert.FileExists(t, filepath.Join(to, "notes", "library", "paper.pdf"), "PDFs must go to the library")
+	assert.FileExists(t, filepath.Join(to, "notes", "music", "sounds", "tune.mp3"), "the rules of the tags must take precedence")
+	content, _ = ioutil.ReadFile(filepath.Join(to, "notes", "music", "talk.md"))
+	assert.Equal(t, "#music\n[paper.pdf](../library/paper-2.pdf)\n", string(content), "assets of the same name must be numbered in the library")
+	content, _ = ioutil.ReadFile(filepath.Join(to, "notes", "library", "paper-2.pdf"))
+	assert.Equal(t, "PDF 2", string(content), "assets of the same name must not overwrite each other")
+
+	_, err = MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{AssetDirectories: map[string]string{"unknown": "dir"}})
+	assert.Error(t, err, "unknown asset types must be rejected")
+}
+
+func TestMigrateNotesOverrides(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"skipped.md":  "#work\n",
+		"moved.md":    "#work\n",
+		"sub/kept.md": "#work\n",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml": "work:\n  handling_strategy: same-folder\n  target_directory: work\n  target_tag_name: work\n",
+	})
+	defer os.RemoveAll(to)
+
+	overridesFile := filepath.Join(to, "overrides.yaml")
+	overrides, err := LoadOverrides(overridesFile)
+	assert.NoError(t, err, "missing overrides files must be empty")
+	overrides["skipped.md"] = NoteOverride{Skip: true}
+	overrides["moved.md"] = NoteOverride{TargetDirectory: "elsewhere"}
+	overrides["sub/kept.md"] = NoteOverride{}
+	assert.NoError(t, SaveOverrides(overridesFile, overrides), "overrides must be saved")
+	overrides, err = LoadOverrides(overridesFile)
+	assert.NoError(t, err, "overrides must be loaded")
+	assert.Equal(t, Overrides{"skipped.md": {Skip: true}, "moved.md": {TargetDirectory: "elsewhere"}}, overrides, "notes that are not adjusted must be left out")
+
+	report, err := MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{Overrides: overrides})
+	assert.NoError(t, err, "migration must succeed")
+	assert.Equal(t, 1, report.Skipped, "skipped notes must be reported")
+	assert.NoFileExists(t, filepath.Join(to, "notes", "work", "skipped.md"), "skipped notes must not be migrated")
+	assert.FileExists(t, filepath.Join(to, "notes", "elsewhere", "moved.md"), "the target directory must be overridden")
+	assert.FileExists(t, filepath.Join(to, "notes", "work", "kept.md"), "other notes must follow their tags")
+}
+
+func TestMigrateNotesCorruptNotes(t *testing.T) {
+	from := writeTestFiles(t, map[string]string{
+		"corrupt.md": "#work\nbroken \xFF\x00 text\n",
+		"bom.md":     "\xEF\xBB\xBF#work\n",
+	})
+	defer os.RemoveAll(from)
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml": "work:\n  handling_strategy: same-folder\n  target_directory: work\n  target_tag_name: job\n",
+	})
+	defer os.RemoveAll(to)
+
+	report, err := MigrateNotes(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{})
+	assert.NoError(t, err, "migration must succeed")
+	assert.Len(t, report.Errors, 1, "corrupt notes must be reported")
+	assert.True(t, errors.Is(report.Errors[0], ErrCorruptNote), "corrupt notes must be reported")
+	assert.NoFileExists(t, filepath.Join(to, "notes", "work", "corrupt.md"), "corrupt notes must not be migrated")
+	content, err := ioutil.ReadFile(filepath.Join(to, "notes", "work", "bom.md"))
+	assert.NoError(t, err, "notes with a byte order mark must be migrated")
+	assert.Equal(t, "#job\n", string(content), "the byte order mark must be removed")
+
+	_, err = MigrateNotes(context.Background(), from, filepath.Join(to, "repaired"), filepath.Join(to, "tags.yaml"), MigrateOptions{RepairEncoding: true})
+	assert.NoError(t, err, "migration must succeed")
+	content, err = ioutil.ReadFile(filepath.Join(to, "repaired", "work", "corrupt.md"))
+	assert.NoError(t, err, "corrupt notes must be repaired")
+	assert.Equal(t, "#job\nbroken � text\n", string(content), "invalid sequences and null bytes must be repaired")
+
+	d := newDiscovery(DiscoverOptions{})
+	for _, name := range []string{"corrupt.md", "bom.md"} {
+		content, err := ioutil.ReadFile(filepath.Join(from, name))
+		assert.NoError(t, err, "note must be readable")
+		d.addNote(name, content)
+	}
+	assert.Equal(t, map[string]string{"corrupt.md": "1 invalid UTF-8 sequences (first at line 2), 1 null bytes"}, d.corrupt, "only corrupt notes must be discovered as such")
+	assert.Contains(t, d.tags, "work", "the tags of notes with a byte order mark must be discovered")
+}
+
+func BenchmarkMigrateNotes(b *testing.B) {
+	files := map[string]string{
+		"tags.yaml": "work:\n  handling_strategy: one-note-per-folder\n  target_directory: work\n  target_tag_name: job\n",
+	}
+	for i := 0; i < 100; i++ {
+		note := fmt.Sprintf("note %d", i)
+		files[note+".md"] = "# Title\n#work\n" + strings.Repeat("Some text with #work tags.\n![image]("+note+"/image.png)\n\n", 20)
+		files[note+"/image.png"] = "PNG"
+	}
+	from := writeTestFiles(b, files)
+	defer os.RemoveAll(from)
+	to, err := ioutil.TempDir("", "bearnotes")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(to)
+
+	options := MigrateOptions{SkipPreflight: true, Logger: log.New(ioutil.Discard, "", 0)}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		report, err := MigrateNotes(context.Background(), from, filepath.Join(to, strconv.Itoa(i)), filepath.Join(from, "tags.yaml"), options)
+		if err != nil || len(report.Errors) > 0 {
+			b.Fatalf("migration failed: %v %v", err, report.Errors)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package bearnotes
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Logger receives the messages of a migration (see MigrateOptions.Logger).
+// *log.Logger satisfies this interface.
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+// migrationLogger sends the messages of a migration to its Logger, or to
+// the standard output and the standard logger if it has none, and copies
+// them to the migration log file, if any. A nil *migrationLogger uses the
+// standard output and the standard logger.
+type migrationLogger struct {
+	console Logger
+	file    *log.Logger // Migration log file, if any
+}
+
+// Printf logs a message (warnings, errors, notes being processed) as the
+// standard logger does.
+func (l *migrationLogger) Printf(format string, args ...interface{}) {
+	if l == nil {
+		log.Printf(format, args...)
+		return
+	}
+	message := fmt.Sprintf(format, args...)
+	if l.console == nil {
+		log.Print(message)
+	} else {
+		l.console.Printf("%s", strings.TrimSuffix(message, "\n"))
+	}
+	l.debugf("%s", message)
+}
+
+// printf prints a message on the standard output (or sends it to the
+// Logger of the migration) and copies it to the migration log file.
+func (l *migrationLogger) printf(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if l == nil || l.console == nil {
+		fmt.Print(message)
+	} else if strings.TrimSpace(message) != "" {
+		l.console.Printf("%s", strings.TrimSuffix(message, "\n"))
+	}
+	if strings.TrimSpace(message) != "" {
+		l.debugf("%s", message)
+	}
+}
+
+// debugf writes a message to the migration log file only.
+func (l *migrationLogger) debugf(format string, args ...interface{}) {
+	if l != nil && l.file != nil {
+		l.file.Printf(format, args...)
+	}
+}
+
+// openMigrationLog opens the log file at p, to which the messages of the
+// migration are appended, until the returned function is called. The file
+// (and its directory) is created with the permissions fileMode (and
+// dirMode) if needed.
+func openMigrationLog(p string, arguments []string, dirMode os.FileMode, fileMode os.FileMode) (*log.Logger, func(), error) {
+	err := os.MkdirAll(filepath.Dir(p), dirMode)
+	if err != nil {
+		return nil, nil, err
+	}
+	fd, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_APPEND, fileMode)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logger := log.New(fd, "", log.LstdFlags|log.Lmicroseconds)
+	logger.Printf("bearnotes %s: %s\n", Version, strings.Join(arguments, " "))
+	return logger, func() { fd.Close() }, nil
+}
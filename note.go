@@ -7,24 +7,46 @@
 // Note: there are some Unicode normalization issues between the filenames
 // in the filesystem and paths in the Markdown file. It is up to the caller
 // to normalize strings when required.
+//
+// Optional settings are grouped in option structs (MigrateOptions,
+// DiscoverOptions, ParseOptions, etc.), whose zero value is the default
+// behavior: each field enables or tunes a feature. The exception is
+// MigrateOptions.SimilarImageDistance, where 0 only groups identical images
+// and a negative value stands for the default.
 package bearnotes
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
+	"io"
 	"net/url"
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
 	"unicode"
 	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
 )
 
-// Regular expression to detect Bear tags.
+// Regular expression to detect Bear tags. As in Bear, tags can end with
+// hashes, also before a nested tag (programming languages). Trailing hashes
+// are only kept after a one-letter name (see validTagEnd).
 // Examples:
 //  - #foo
 //  - #bar/baz
+//  - #c++
+//  - #c#/linq
 var reTag *regexp.Regexp
 
+// Regular expression to detect Bear tags, including those starting with a digit.
+// Examples:
+//  - #2023/01
+//  - #1password
+var reNumericTag *regexp.Regexp
+
 // Regular expression to detect file attachments.
 // Example: <a href='my%20file.pdf'>my file.pdf</a>
 var reFile *regexp.Regexp
@@ -33,15 +55,27 @@ var reFile *regexp.Regexp
 // Example: ![](note/my-image.png)
 var reImage *regexp.Regexp
 
+// Regular expression to detect the optional title at the end of the
+// location of an embedded image.
+// Example: ![](note/my-image.png "My title")
+var reImageTitle *regexp.Regexp
+
+// Regular expression to detect Markdown headings.
+// Example: ## Tags
+var reHeading *regexp.Regexp
+
 func init() {
 	// This regex has a catch: it matches a leading and trailing extra character.
 	// This is because Go does not support look-ahead/look-behind markers.
 	// So we need to implement look-ahead/look-behind by ourself.
-	reTag = regexp.MustCompile(`(^|.?)#([\p{L}][-\p{L}\p{N}/$_§%=+°({[\\@]*)(.?|$)`)
+	reTag = regexp.MustCompile(`(^|.?)#([\p{L}](?:[-\p{L}\p{N}/$_§%=+°({[\\@]|#+/)*#*)(.?|$)`)
+	reNumericTag = regexp.MustCompile(`(^|.?)#([\p{L}\p{N}](?:[-\p{L}\p{N}/$_§%=+°({[\\@]|#+/)*#*)(.?|$)`)
 
 	// Those two regex are straightforward
 	reFile = regexp.MustCompile(`<a +href=['"]([^'"]+)['"]>([^<]+)</a>`)
 	reImage = regexp.MustCompile(`!\[([^\]]*)]\(([^())]+|[^(]+\([^)]+\)[^)]+)\)`)
+	reImageTitle = regexp.MustCompile(`^(.*?)\s+(?:"((?:[^"\\]|\\.)*)"|'((?:[^'\\]|\\.)*)')$`)
+	reHeading = regexp.MustCompile(`(?m)^(#{1,6})[ \t]+(.*?)[ \t]*$`)
 }
 
 // Tag represents a Bear tag (#foo)
@@ -59,27 +93,57 @@ type Tag struct {
 // NewTag creates a Tag from its content (including leading and trailing
 // characters) and position in file.
 func NewTag(content string, position []int) Tag {
+	return newTag([]byte(content), position, reTag)
+}
+
+// newTag is the []byte variant of NewTag, using the regular expression re.
+func newTag(content []byte, position []int, re *regexp.Regexp) Tag {
+	match := re.FindSubmatchIndex(content)
+	if match == nil {
+		return Tag{}
+	}
+	return tagFromMatch(content, match, position)
+}
+
+// tagFromMatch creates a Tag from the submatch indexes (match) of a tag
+// regular expression in content.
+func tagFromMatch(content []byte, match []int, position []int) Tag {
 	var tag Tag
-	parts := reTag.FindStringSubmatch(content)
-	if len(parts) > 0 {
-		beforeIsEmpty := len(parts[1]) == 0
-		before, _ := utf8.DecodeRuneInString(parts[1])
-		beforeIsSpace := unicode.IsSpace(before)
-		afterIsEmpty := len(parts[3]) == 0
-		after, _ := utf8.DecodeRuneInString(parts[3])
-		afterIsSpace := unicode.IsSpace(after)
-
-		// A valid tag is surrounded by either a space character or nothing
-		if (beforeIsEmpty || beforeIsSpace) && (afterIsEmpty || afterIsSpace) {
-			tag.position = position
-			tag.before = parts[1]
-			tag.Name = parts[2]
-			tag.after = parts[3]
-		}
+	before := content[match[2]:match[3]]
+	after := content[match[6]:match[7]]
+	beforeRune, _ := utf8.DecodeRune(before)
+	afterRune, _ := utf8.DecodeRune(after)
+
+	// A valid tag is surrounded by either a space character or nothing
+	name := string(content[match[4]:match[5]])
+	if (len(before) == 0 || unicode.IsSpace(beforeRune)) && (len(after) == 0 || unicode.IsSpace(afterRune)) && validTagEnd(name) {
+		tag.position = position
+		tag.before = string(before)
+		tag.Name = name
+		tag.after = string(after)
 	}
 	return tag
 }
 
+// validTagEnd returns true if the tag name does not end with hashes or if
+// they follow a one-letter name, as in the names of programming languages
+// (#c#, #lang/f#). Otherwise (#work#), the hash closes a multi-word tag.
+func validTagEnd(name string) bool {
+	trimmed := strings.TrimRight(name, "#")
+	if trimmed == name {
+		return true
+	}
+	last := trimmed[strings.LastIndex(trimmed, "/")+1:]
+	r, size := utf8.DecodeRuneInString(last)
+	return size == len(last) && unicode.IsLetter(r)
+}
+
+// isNumeric returns true if the tag name starts with a digit.
+func (tag *Tag) isNumeric() bool {
+	r, _ := utf8.DecodeRuneInString(tag.Name)
+	return unicode.IsDigit(r)
+}
+
 // String converts the Tag back to string.
 func (tag *Tag) String() string {
 	if len(tag.Name) == 0 {
@@ -98,13 +162,25 @@ type File struct {
 
 // NewFile creates a File from the Markdown content and position in file.
 func NewFile(content string, position []int) File {
-	var file File
-	parts := reFile.FindStringSubmatch(content)
-	if len(parts) > 0 {
-		file.Location, _ = url.PathUnescape(parts[1])
-		file.Name = parts[2]
-		file.position = position
+	return newFile([]byte(content), position)
+}
+
+// newFile is the []byte variant of NewFile.
+func newFile(content []byte, position []int) File {
+	match := reFile.FindSubmatchIndex(content)
+	if match == nil {
+		return File{}
 	}
+	return fileFromMatch(content, match, position)
+}
+
+// fileFromMatch creates a File from the submatch indexes (match) of reFile
+// in content.
+func fileFromMatch(content []byte, match []int, position []int) File {
+	var file File
+	file.Location, _ = url.PathUnescape(string(content[match[2]:match[3]]))
+	file.Name = string(content[match[4]:match[5]])
+	file.position = position
 	return file
 }
 
@@ -131,53 +207,235 @@ func (file *File) String() string {
 type Image struct {
 	Location    string // The path to the embedded image
 	Description string // The alternative text for the image
+	Title       string // The title of the image ("My title"), if any
 	position    []int  // The position in the Markdown file
 }
 
 // NewImage creates an Image from the Markdown content and position in file.
 func NewImage(content string, position []int) Image {
+	return newImage([]byte(content), position)
+}
+
+// newImage is the []byte variant of NewImage.
+func newImage(content []byte, position []int) Image {
+	match := reImage.FindSubmatchIndex(content)
+	if match == nil {
+		return Image{}
+	}
+	return imageFromMatch(content, match, position)
+}
+
+// imageFromMatch creates an Image from the submatch indexes (match) of
+// reImage in content.
+func imageFromMatch(content []byte, match []int, position []int) Image {
 	var image Image
-	parts := reImage.FindStringSubmatch(content)
-	if len(parts) > 0 {
-		image.Location, _ = url.PathUnescape(parts[2])
-		image.Description = parts[1]
-		image.position = position
+	location := string(content[match[4]:match[5]])
+	if title := reImageTitle.FindStringSubmatch(location); title != nil {
+		location = title[1]
+		image.Title = unescapeTitle.Replace(title[2] + title[3])
 	}
+	image.Location, _ = url.PathUnescape(location)
+	image.Description = string(content[match[2]:match[3]])
+	image.position = position
 	return image
 }
 
+// Escaping of the quotes and backslashes of image titles
+var (
+	escapeTitle   = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	unescapeTitle = strings.NewReplacer(`\\`, `\`, `\"`, `"`, `\'`, `'`)
+)
+
 // String converts an image back to Markdown syntax suitable for Zettlr.
 func (image *Image) String() string {
+	if image.Title != "" {
+		return fmt.Sprintf("![%s](%s \"%s\")", image.Description, escapePath(image.Location), escapeTitle.Replace(image.Title))
+	}
 	return fmt.Sprintf("![%s](%s)", image.Description, escapePath(image.Location))
 }
 
 // Note represents a Bear note with its tags, file attachments and embedded images.
 type Note struct {
-	Tags    []Tag   // All the tags
-	Files   []File  // All the file attachments
-	Images  []Image // All the embedded images
-	content string  // The full note content
+	Tags        []Tag             // All the tags
+	Files       []File            // All the file attachments
+	Images      []Image           // All the embedded images
+	FrontMatter map[string]string // Front matter fields added to the note
+
+	// FrontMatterLists holds the list fields added to the front matter (tags: [...])
+	FrontMatterLists map[string][]string
+
+	// FrontMatterFlags holds the boolean fields added to the front matter (draft: true)
+	FrontMatterFlags map[string]bool
+
+	// Footer is a line appended to the note (e.g. a link back to Bear)
+	Footer string
+
+	content []byte // The full note content
+}
+
+// ParseOptions specifies how a Bear note is parsed.
+type ParseOptions struct {
+	// TagSection, when not empty, is the title of the heading (e.g. "Tags")
+	// of the section holding the tags of the note. Only tags found in that
+	// section are parsed, hashtags elsewhere in the note are left untouched.
+	TagSection string
+
+	// NumericTags accepts tags starting with a digit (#2023, #2023/01,
+	// #1password). Since this is prone to false positives ("issue #1"),
+	// such tags are left untouched during migration unless they are present
+	// in the tag file.
+	NumericTags bool
+
+	// CaseSensitiveTags considers tags differing only by case (#Work and
+	// #work) as distinct tags, with their own entry in the tag file.
+	// By default, tags are case-insensitive, as in Bear.
+	CaseSensitiveTags bool
+
+	// StopList holds the tags (#a, #rt, #x) that are noise from prose
+	// rather than real tags. They are left untouched.
+	StopList []string
+
+	// MinTagLength is the minimum number of characters of a tag. Shorter
+	// tags are left untouched.
+	MinTagLength int
+}
+
+// isNoise returns true if the tag is in the stop-list or is too short.
+func (options ParseOptions) isNoise(tagName string) bool {
+	if options.MinTagLength > 0 && utf8.RuneCountInString(tagName) < options.MinTagLength {
+		return true
+	}
+	key := tagKey(tagName, options.CaseSensitiveTags)
+	for _, stop := range options.StopList {
+		if tagKey(strings.TrimPrefix(stop, "#"), options.CaseSensitiveTags) == key {
+			return true
+		}
+	}
+	return false
 }
 
 // LoadNote parses a Bear note in Markdown format and returns a Note object.
 func LoadNote(content string) *Note {
+	return LoadNoteBytes([]byte(content))
+}
+
+// LoadNoteBytes parses a Bear note in Markdown format and returns a Note object.
+// Unlike LoadNote, it does not copy the note content, so content must not be
+// modified afterwards.
+func LoadNoteBytes(content []byte) *Note {
+	return LoadNoteWithOptions(content, ParseOptions{})
+}
+
+// LoadNoteWithOptions parses a Bear note in Markdown format, as specified by
+// options, and returns a Note object. As LoadNoteBytes, it does not copy the
+// note content.
+func LoadNoteWithOptions(content []byte, options ParseOptions) *Note {
 	var note Note
 	note.content = content
-	for _, match := range reTag.FindAllStringIndex(content, -1) {
-		tag := NewTag(content[match[0]:match[1]], match)
-		if len(tag.Name) > 0 {
-			note.Tags = append(note.Tags, tag)
+
+	// Math regions ($...$ and $$...$$) are left untouched
+	math := mathRegions(content)
+	note.Tags = parseTags(content, options, math)
+	for _, match := range reFile.FindAllSubmatchIndex(content, -1) {
+		if !inRegions(math, match[0]) {
+			note.Files = append(note.Files, fileFromMatch(content, match, match[0:2]))
 		}
 	}
-	for _, match := range reFile.FindAllStringIndex(content, -1) {
-		note.Files = append(note.Files, NewFile(content[match[0]:match[1]], match))
-	}
-	for _, match := range reImage.FindAllStringIndex(content, -1) {
-		note.Images = append(note.Images, NewImage(content[match[0]:match[1]], match))
+	for _, match := range reImage.FindAllSubmatchIndex(content, -1) {
+		if !inRegions(math, match[0]) {
+			note.Images = append(note.Images, imageFromMatch(content, match, match[0:2]))
+		}
 	}
 	return &note
 }
 
+// StripTrailingTagLine removes the last line of the note when it holds only
+// tags, as many Bear notes end with such a line. The tags of this line are
+// removed from the note, so they must be processed (routing, front matter)
+// beforehand. Tags embedded in prose are left untouched.
+// It returns true if the note had a trailing tag-line.
+func (note *Note) StripTrailingTagLine() bool {
+	end := len(bytes.TrimRightFunc(note.content, unicode.IsSpace))
+	start := bytes.LastIndexByte(note.content[:end], '\n') + 1
+	if start == end {
+		return false
+	}
+
+	// The line must consist of tags and whitespace only
+	var kept []Tag
+	current := start
+	for _, tag := range note.Tags {
+		if tag.position[1] <= start {
+			kept = append(kept, tag)
+			continue
+		}
+		// The leading whitespace of the tag may be the end of the previous line
+		if tag.position[0] > current && len(bytes.TrimSpace(note.content[current:tag.position[0]])) > 0 {
+			return false
+		}
+		current = tag.position[1]
+	}
+	if current == start || (current < end && len(bytes.TrimSpace(note.content[current:end])) > 0) {
+		return false
+	}
+
+	// The blank lines before the tag-line are removed as well
+	// (but not the end of the last line of text)
+	last := len(bytes.TrimRightFunc(note.content[:start], unicode.IsSpace))
+	if eol := bytes.IndexByte(note.content[last:start], '\n'); last > 0 && eol >= 0 {
+		last += eol + 1
+	}
+	note.content = note.content[:last]
+	note.Tags = kept
+	return true
+}
+
+// parseTags returns the tags of content, as specified by options, skipping
+// the math regions.
+func parseTags(content []byte, options ParseOptions, math [][]int) []Tag {
+	// By default, tags are searched in the whole note
+	tagSection := []int{0, len(content)}
+	if options.TagSection != "" {
+		tagSection = findSection(content, options.TagSection)
+	}
+
+	re := reTag
+	if options.NumericTags {
+		re = reNumericTag
+	}
+	// Submatches are extracted in a single pass over the note
+	var tags []Tag
+	for _, match := range re.FindAllSubmatchIndex(content, -1) {
+		tag := tagFromMatch(content, match, match[0:2])
+		start := match[0] + len(tag.before)
+		if len(tag.Name) > 0 && start >= tagSection[0] && start < tagSection[1] && !options.isNoise(tag.Name) && !inRegions(math, start) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// findSection returns the position of the content of the section whose heading
+// is title (case insensitive). The section ends with the next heading of the
+// same or higher level. If there is no such section, an empty range is returned.
+func findSection(content []byte, title string) []int {
+	headings := reHeading.FindAllSubmatchIndex(content, -1)
+	for i, heading := range headings {
+		if !strings.EqualFold(string(content[heading[4]:heading[5]]), title) {
+			continue
+		}
+
+		level := heading[3] - heading[2]
+		for _, next := range headings[i+1:] {
+			if next[3]-next[2] <= level {
+				return []int{heading[1], next[0]}
+			}
+		}
+		return []int{heading[1], len(content)}
+	}
+	return []int{0, 0}
+}
+
 // updatedItem is used to sort tags, images and files by their order
 // of appearance in the file.
 type updatedItem struct {
@@ -185,10 +443,30 @@ type updatedItem struct {
 	position []int  // position in file
 }
 
+// writerPool holds the buffered writers used by WriteTo.
+var writerPool = sync.Pool{
+	New: func() interface{} {
+		return bufio.NewWriterSize(nil, 32*1024)
+	},
+}
+
 // WriteNote converts the note back into a format suitable for Zettlr.
-func (note *Note) WriteNote() string {
+// An error is returned if the note is not valid (see Validate).
+func (note *Note) WriteNote() (string, error) {
+	var newContent strings.Builder
+	newContent.Grow(len(note.content))
+	_, err := note.WriteTo(&newContent)
+	if err != nil {
+		return "", err
+	}
+	return newContent.String(), nil
+}
+
+// items returns the tags, images and files of the note, sorted by their
+// order of appearance in the file.
+func (note *Note) items() []updatedItem {
 	// Tags, Images and Files are all stored into a common list
-	var items []updatedItem
+	items := make([]updatedItem, 0, len(note.Tags)+len(note.Files)+len(note.Images))
 	for _, item := range note.Tags {
 		items = append(items, updatedItem{item.String(), item.position})
 	}
@@ -199,22 +477,176 @@ func (note *Note) WriteNote() string {
 		items = append(items, updatedItem{item.String(), item.position})
 	}
 	// And sorted by their order of appearance in the file
-	// Note: this only works when items do not overlap (which hopefully
-	// is the case in most, if not all, markdown files).
 	sort.Slice(items, func(i, j int) bool {
-		return items[i].position[0] < items[j].position[1]
+		return items[i].position[0] < items[j].position[0]
 	})
+	return items
+}
+
+// Validate checks that the tags, images and file attachments of the note
+// are within the bounds of the note and do not overlap (a tag inside the
+// alternative text of an image, for instance), since the note could not be
+// written back without being corrupted.
+func (note *Note) Validate() error {
+	err := validateItems(note.items(), len(note.content))
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidNote, err)
+	}
+	return nil
+}
+
+// validateItems checks that the sorted items are within [0, length]
+// and do not overlap.
+func validateItems(items []updatedItem, length int) error {
+	current := 0
+	for _, item := range items {
+		if len(item.position) != 2 || item.position[0] < 0 || item.position[1] < item.position[0] || item.position[1] > length {
+			return fmt.Errorf("'%s' at %v is out of bounds (%d bytes)", item.content, item.position, length)
+		}
+		if item.position[0] < current {
+			return fmt.Errorf("'%s' at %v overlaps with the previous item", item.content, item.position)
+		}
+		current = item.position[1]
+	}
+	return nil
+}
+
+// Regular expression to detect the front matter at the start of a note,
+// with Unix or Windows line endings. Its fields are the first group.
+var reFrontMatter = regexp.MustCompile(`(?s)\A---[ \t]*\r?\n(.*?\n)??(?:---|\.\.\.)[ \t]*(?:\r?\n|\z)`)
+
+// rewriteExcerpt returns the content of the note between start and end,
+// with the items found there rewritten, along with the other items.
+func (note *Note) rewriteExcerpt(items []updatedItem, start int, end int) ([]byte, []updatedItem) {
+	var excerpt bytes.Buffer
+	var others []updatedItem
+	current := start
+	for _, item := range items {
+		if item.position[0] < start || item.position[1] > end {
+			others = append(others, item)
+			continue
+		}
+		excerpt.Write(note.content[current:item.position[0]])
+		excerpt.WriteString(item.content)
+		current = item.position[1]
+	}
+	excerpt.Write(note.content[current:end])
+	return excerpt.Bytes(), others
+}
+
+// mergeFrontMatter returns the fields of the existing front matter (in
+// YAML) updated with fields: existing keys get their new value, the other
+// keys are added after them, sorted.
+func mergeFrontMatter(existing []byte, fields map[string]interface{}) ([]byte, error) {
+	added, err := yaml.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(existing)) == 0 {
+		return added, nil
+	}
+
+	var document, update yaml.Node
+	err = yaml.Unmarshal(existing, &document)
+	if err != nil {
+		return nil, err
+	}
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("not a mapping")
+	}
+	err = yaml.Unmarshal(added, &update)
+	if err != nil {
+		return nil, err
+	}
+	mapping, pairs := document.Content[0], update.Content[0].Content
+	for i := 0; i+1 < len(pairs); i += 2 {
+		replaced := false
+		for j := 0; j+1 < len(mapping.Content); j += 2 {
+			if mapping.Content[j].Value == pairs[i].Value {
+				mapping.Content[j+1] = pairs[i+1]
+				replaced = true
+			}
+		}
+		if !replaced {
+			mapping.Content = append(mapping.Content, pairs[i], pairs[i+1])
+		}
+	}
+	return yaml.Marshal(&document)
+}
+
+// WriteTo writes the note in a format suitable for Zettlr to w.
+// The original excerpts of the note are written as-is, without intermediate copies.
+// Nothing is written if the note is not valid (see Validate).
+func (note *Note) WriteTo(w io.Writer) (int64, error) {
+	items := note.items()
+	err := validateItems(items, len(note.content))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidNote, err)
+	}
+
+	bw := writerPool.Get().(*bufio.Writer)
+	bw.Reset(w)
+	defer func() {
+		bw.Reset(nil)
+		writerPool.Put(bw)
+	}()
+
+	var written int64
+	var current int
+	if len(note.FrontMatter) > 0 || len(note.FrontMatterLists) > 0 || len(note.FrontMatterFlags) > 0 {
+		fields := make(map[string]interface{}, len(note.FrontMatter)+len(note.FrontMatterLists)+len(note.FrontMatterFlags))
+		for key, value := range note.FrontMatter {
+			fields[key] = value
+		}
+		for key, values := range note.FrontMatterLists {
+			fields[key] = values
+		}
+		for key, value := range note.FrontMatterFlags {
+			fields[key] = value
+		}
+		// Fields are merged into the existing front matter, if any, once
+		// its items are rewritten
+		var existing []byte
+		if loc := reFrontMatter.FindSubmatchIndex(note.content); loc != nil {
+			if loc[2] >= 0 {
+				existing, items = note.rewriteExcerpt(items, loc[2], loc[3])
+			}
+			current = loc[1]
+		}
+		frontMatter, err := mergeFrontMatter(existing, fields)
+		if err != nil {
+			return 0, fmt.Errorf("%w: front matter: %s", ErrInvalidNote, err)
+		}
+		n, _ := bw.WriteString("---\n")
+		written += int64(n)
+		n, _ = bw.Write(frontMatter)
+		written += int64(n)
+		n, _ = bw.WriteString("---\n")
+		written += int64(n)
+	}
 
 	// Go through all items and copy the updated version of the item along
 	// with the interleaved original excerpts
-	var current int
-	var newContent strings.Builder
 	for _, item := range items {
-		newContent.WriteString(note.content[current:item.position[0]])
-		newContent.WriteString(item.content)
+		n, _ := bw.Write(note.content[current:item.position[0]])
+		written += int64(n)
+		n, _ = bw.WriteString(item.content)
+		written += int64(n)
 		current = item.position[1]
 	}
-	newContent.WriteString(note.content[current:len(note.content)])
+	n, _ := bw.Write(note.content[current:])
+	written += int64(n)
+
+	// The footer starts on its own paragraph
+	if note.Footer != "" {
+		separator := "\n\n"
+		if bytes.HasSuffix(note.content, []byte("\n")) {
+			separator = "\n"
+		}
+		n, _ = bw.WriteString(separator + note.Footer + "\n")
+		written += int64(n)
+	}
 
-	return newContent.String()
+	// bufio.Writer keeps the first error and returns it on Flush
+	return written, bw.Flush()
 }
@@ -1,6 +1,8 @@
 package bearnotes
 
 import (
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -19,7 +21,7 @@ func TestNewTag(t *testing.T) {
 }
 
 func TestNewTagLookAround(t *testing.T) {
-	testCases := [][]string{{" #test/123 ", "test/123"}, {"/#trap ", ""}, {" #trap#", ""}, {"#ok", "ok"}}
+	testCases := [][]string{{" #test/123 ", "test/123"}, {"/#trap ", ""}, {" #trap#", ""}, {" #trap#x", ""}, {" #c#", "c#"}, {" #lang/f#", "lang/f#"}, {"#ok", "ok"}}
 	for _, testCase := range testCases {
 		tagContent := testCase[0]
 		expected := testCase[1]
@@ -46,6 +48,22 @@ func TestNewImage(t *testing.T) {
 
 	// Back to string
 	assert.Equal(t, "![my image](note/image%202.jpg)", image.String(), "image content must be equal")
+	testCases := []struct {
+		content  string
+		location string
+		title    string
+		expected string
+	}{
+		{`![](note/image%202.jpg "My title")`, "note/image 2.jpg", "My title", `![](note/image%202.jpg "My title")`},
+		{`![](note/image.jpg 'It\'s "quoted"')`, "note/image.jpg", `It's "quoted"`, `![](note/image.jpg "It's \"quoted\"")`},
+		{`![](https://example.test/image.jpg "Title (with parentheses)")`, "https://example.test/image.jpg", "Title (with parentheses)", `![](https://example.test/image.jpg "Title (with parentheses)")`},
+	}
+	for _, testCase := range testCases {
+		image := NewImage(testCase.content, []int{0, len(testCase.content)})
+		assert.Equal(t, testCase.location, image.Location, "image title must not be part of the location")
+		assert.Equal(t, testCase.title, image.Title, "image title must be parsed")
+		assert.Equal(t, testCase.expected, image.String(), "image title must be kept")
+	}
 }
 
 func TestLoadNote(t *testing.T) {
@@ -150,6 +168,313 @@ Traps, traps, traps... #trap#trap
 #two-tags #one-after-another
 
 #not-really`
-	newNote := note.WriteNote()
+	newNote, err := note.WriteNote()
+	assert.NoError(t, err, "note must be written")
 	assert.Equal(t, expectedMd, newNote, "notes must be equal")
 }
+
+func TestWriteTo(t *testing.T) {
+	md := "#foo and ![image](note/image%202.jpg) and #bar"
+	note := LoadNoteBytes([]byte(md))
+	note.Tags[0].Name = "baz"
+	note.Images[0].Location = "image 2.jpg"
+
+	var buffer strings.Builder
+	n, err := note.WriteTo(&buffer)
+	assert.NoError(t, err, "note must be written")
+	assert.Equal(t, "#baz and ![image](image%202.jpg) and #bar", buffer.String(), "notes must be equal")
+	assert.Equal(t, int64(buffer.Len()), n, "written bytes must be counted")
+	assert.Equal(t, buffer.String(), mustWriteNote(t, note), "WriteNote and WriteTo must be consistent")
+}
+
+func TestLoadNoteSymbolTags(t *testing.T) {
+	md := "#c++ and #c# for #objective-c++, #c#/linq and #f##\nbut not #trap#x, #work# nor #multi word#\n"
+	note := LoadNoteBytes([]byte(md))
+	var names []string
+	for _, tag := range note.Tags {
+		names = append(names, tag.Name)
+	}
+	assert.Equal(t, []string{"c++", "c#", "c#/linq", "f##", "multi"}, names, "tags must keep their trailing symbols")
+	assert.Equal(t, md, mustWriteNote(t, note), "notes must be written back unchanged")
+
+	tags := map[string]TagOptions{"c++": {TargetTagName: "cpp"}, "c#": {TargetTagName: "csharp"}, "c#/linq": {TargetTagName: "csharp/linq"}, "f##": {TargetTagName: "fsharp"}, "multi": {TargetTagName: "multi"}}
+	_, err := applyTagOptions(note, tags, false, nil)
+	assert.NoError(t, err, "tags must be found in the tag file")
+	assert.Equal(t, "#cpp and #csharp for #objective-c++, #csharp/linq and #fsharp\nbut not #trap#x, #work# nor #multi word#\n", mustWriteNote(t, note), "tags must be rewritten with their trailing symbols")
+}
+
+func TestLoadNoteNumericTags(t *testing.T) {
+	md := "#2023/01 #1password #foo and issue #1"
+	note := LoadNoteBytes([]byte(md))
+	assert.Len(t, note.Tags, 1, "There must be 1 tag by default")
+
+	note = LoadNoteWithOptions([]byte(md), ParseOptions{NumericTags: true})
+	assert.Len(t, note.Tags, 4, "There must be 4 tags")
+	assert.Equal(t, "2023/01", note.Tags[0].Name, "first tag must be '2023/01'")
+	assert.Equal(t, "1password", note.Tags[1].Name, "second tag must be '1password'")
+	assert.Equal(t, "1", note.Tags[3].Name, "fourth tag must be '1'")
+
+	// Unknown numeric tags are left untouched
+	tags := map[string]TagOptions{"foo": {TargetTagName: "bar"}, "1password": {TargetTagName: "passwords"}}
+	_, err := applyTagOptions(note, tags, false, nil)
+	assert.NoError(t, err, "unknown numeric tags must be skipped")
+	assert.Equal(t, "#2023/01 #passwords #bar and issue #1", mustWriteNote(t, note), "notes must be equal")
+}
+
+func TestLoadNoteStopList(t *testing.T) {
+	md := "#RT this #x it is #interesting and #ok"
+	note := LoadNoteWithOptions([]byte(md), ParseOptions{StopList: []string{"#rt"}, MinTagLength: 3})
+	if assert.Len(t, note.Tags, 1, "noise tags must be skipped") {
+		assert.Equal(t, "interesting", note.Tags[0].Name, "tag must be 'interesting'")
+	}
+	assert.Len(t, LoadNoteWithOptions([]byte(md), ParseOptions{StopList: []string{"rt"}, CaseSensitiveTags: true}).Tags, 4, "stop-list must be case-sensitive")
+}
+
+func TestLoadNoteMath(t *testing.T) {
+	md := "#foo $f(x) = #a + [b](c)$ and\n$$\n#b ![x](y.png)\n$$\ncosts $5 and #bar $10, \\$x #c y$"
+	note := LoadNoteBytes([]byte(md))
+	var tags []string
+	for _, tag := range note.Tags {
+		tags = append(tags, tag.Name)
+	}
+	assert.Equal(t, []string{"foo", "bar", "c"}, tags, "tags in math regions must be skipped")
+	assert.Len(t, note.Images, 0, "images in math regions must be skipped")
+}
+
+func TestLoadNoteTagSection(t *testing.T) {
+	md := `# My note
+
+Issue #1 was fixed in #release.
+
+## Tags
+
+#foo #bar/baz
+
+## Other section
+
+#not-a-tag`
+	note := LoadNoteWithOptions([]byte(md), ParseOptions{TagSection: "tags"})
+	assert.Len(t, note.Tags, 2, "There must be 2 tags")
+	assert.Equal(t, "foo", note.Tags[0].Name, "first tag must be 'foo'")
+	assert.Equal(t, "bar/baz", note.Tags[1].Name, "second tag must be 'bar/baz'")
+
+	note = LoadNoteWithOptions([]byte("#foo\n"), ParseOptions{TagSection: "tags"})
+	assert.Len(t, note.Tags, 0, "There must be no tag without a tag section")
+}
+
+// benchmarkSizes holds the number of paragraphs of the small, medium and
+// huge notes of the benchmarks.
+var benchmarkSizes = []struct {
+	name       string
+	paragraphs int
+}{
+	{"small", 2},
+	{"medium", 200},
+	{"huge", 20000},
+}
+
+func BenchmarkLoadNote(b *testing.B) {
+	paragraph := "Some text with #foo and #bar/baz tags.\n![image](note/image.png)\n<a href='note/my%20file.pdf'>my file.pdf</a>\n\n"
+	for _, size := range benchmarkSizes {
+		content := []byte(strings.Repeat(paragraph, size.paragraphs))
+		b.Run(size.name, func(b *testing.B) {
+			b.SetBytes(int64(len(content)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				LoadNoteBytes(content)
+			}
+		})
+	}
+}
+
+func BenchmarkWriteNote(b *testing.B) {
+	paragraph := "Some text with #foo and #bar/baz tags.\n![image](note/image.png)\n<a href='note/my%20file.pdf'>my file.pdf</a>\n\n"
+	for _, size := range benchmarkSizes {
+		content := []byte(strings.Repeat(paragraph, size.paragraphs))
+		note := LoadNoteBytes(content)
+		for i := range note.Tags {
+			note.Tags[i].Name = "baz"
+		}
+		for i := range note.Images {
+			note.Images[i].Location = "assets/image.png"
+		}
+		b.Run(size.name, func(b *testing.B) {
+			b.SetBytes(int64(len(content)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, _ = note.WriteNote()
+			}
+		})
+	}
+}
+
+func BenchmarkExtractTags(b *testing.B) {
+	paragraph := "Some text with #foo and #bar/baz tags.\n![image](note/image.png)\n<a href='note/my%20file.pdf'>my file.pdf</a>\n\n"
+	content := []byte(strings.Repeat(paragraph, 200))
+	b.SetBytes(int64(len(content)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ExtractTagsWithOptions(content, ParseOptions{})
+	}
+}
+
+func TestWriteFrontMatter(t *testing.T) {
+	tags := map[string]TagOptions{
+		"book": {TargetTagName: "book", FrontMatter: map[string]string{"type": "literature-note"}},
+		"todo": {TargetTagName: "todo", FrontMatter: map[string]string{"type": "task", "status": "open"}},
+	}
+	converted, err := ConvertNote([]byte("# Title\n#book #todo\n"), tags)
+	assert.NoError(t, err, "note must be converted")
+	assert.Equal(t, "---\nstatus: open\ntype: literature-note\n---\n# Title\n#book #todo\n", converted, "front matter must be added")
+
+	converted, err = ConvertNote([]byte("---\ntitle: Title\n---\n#book\n"), tags)
+	assert.NoError(t, err, "note must be converted")
+	assert.Equal(t, "---\ntitle: Title\ntype: literature-note\n---\n#book\n", converted, "front matter must be merged")
+
+	converted, err = ConvertNote([]byte("---\ntype: draft # from Bear\ntitle: Title\n---\n#book\n"), tags)
+	assert.NoError(t, err, "note must be converted")
+	assert.Equal(t, "---\ntype: literature-note\ntitle: Title\n---\n#book\n", converted, "existing keys must be replaced, not duplicated")
+
+	converted, err = ConvertNote([]byte("---\r\ntitle: Title\r\n---\r\n#book\r\n"), tags)
+	assert.NoError(t, err, "note must be converted")
+	assert.Equal(t, "---\ntitle: Title\ntype: literature-note\n---\n#book\r\n", converted, "front matter with Windows line endings must be merged")
+
+	converted, err = ConvertNote([]byte("---\n---\n#book\n"), tags)
+	assert.NoError(t, err, "note must be converted")
+	assert.Equal(t, "---\ntype: literature-note\n---\n#book\n", converted, "empty front matter must be filled")
+
+	tags["old"] = TagOptions{TargetTagName: "new"}
+	converted, err = ConvertNote([]byte("---\ntitle: Title # see #old\n---\n#book\n"), tags)
+	assert.NoError(t, err, "note must be converted")
+	assert.Equal(t, "---\ntitle: Title # see #new\ntype: literature-note\n---\n#book\n", converted, "tags of the front matter must be rewritten")
+
+	_, err = ConvertNote([]byte("---\n- item\n---\n#book\n"), tags)
+	assert.True(t, errors.Is(err, ErrInvalidNote), "front matter that is not a mapping must be rejected")
+}
+
+func TestWriteKeywords(t *testing.T) {
+	tags := []string{"work/projects/alpha", "work", "home"}
+	testCases := []struct {
+		options  KeywordOptions
+		expected string
+	}{
+		{KeywordOptions{}, "#x\n"},
+		{KeywordOptions{Field: "tags"}, "---\ntags:\n  - work/projects/alpha\n  - work\n  - home\n---\n#x\n"},
+		{KeywordOptions{Field: "keywords", Nesting: NestingFlat, Scalar: true}, "---\nkeywords: work-projects-alpha, work, home\n---\n#x\n"},
+		{KeywordOptions{Field: "tags", Nesting: NestingFlat, Delimiter: "_"}, "---\ntags:\n  - work_projects_alpha\n  - work\n  - home\n---\n#x\n"},
+		{KeywordOptions{Field: "tags", Nesting: NestingHierarchy, Scalar: true}, "---\ntags: work, work/projects, work/projects/alpha, home\n---\n#x\n"},
+		{KeywordOptions{Categories: "categories"}, "---\ncategories:\n  - work\n  - projects\n  - alpha\n---\n#x\n"},
+		{KeywordOptions{Field: "keywords", Scalar: true, Categories: "categories"}, "---\ncategories:\n  - work\n  - projects\n  - alpha\nkeywords: work/projects/alpha, work, home\n---\n#x\n"},
+	}
+	for _, testCase := range testCases {
+		note := LoadNoteBytes([]byte("#x\n"))
+		testCase.options.apply(note, tags)
+		assert.Equal(t, testCase.expected, mustWriteNote(t, note), "keywords must be written (%+v)", testCase.options)
+	}
+	assert.Error(t, checkKeywordOptions(KeywordOptions{Nesting: "unknown"}), "unknown representations must be rejected")
+}
+
+func TestAddSourceLink(t *testing.T) {
+	note := LoadNoteBytes([]byte("some text\n"))
+	addSourceLink(note, "My note & more", SourceLinkFooter)
+	assert.Equal(t, "some text\n\n[Open in Bear](bear://x-callback-url/open-note?title=My%20note%20%26%20more)\n", mustWriteNote(t, note), "footer must be added")
+
+	note = LoadNoteBytes([]byte("some text"))
+	addSourceLink(note, "Title", SourceLinkFrontMatter)
+	assert.Equal(t, "---\nbear_url: bear://x-callback-url/open-note?title=Title\n---\nsome text", mustWriteNote(t, note), "front matter field must be added")
+
+	assert.Error(t, checkSourceLink("header"), "unknown locations must be rejected")
+}
+
+func TestStripTrailingTagLine(t *testing.T) {
+	testCases := []struct {
+		input    string
+		stripped bool
+		expected string
+		tags     int
+	}{
+		{"some #inline text\n\n#foo #bar/baz\n", true, "some #inline text\n", 1},
+		{"some text\n#foo\t#bar  \n\n", true, "some text\n", 0},
+		{"some text\n#foo and more text\n", false, "some text\n#foo and more text\n", 1},
+		{"some text\n", false, "some text\n", 0},
+		{"#foo", true, "", 0},
+	}
+	for _, testCase := range testCases {
+		note := LoadNoteBytes([]byte(testCase.input))
+		assert.Equal(t, testCase.stripped, note.StripTrailingTagLine(), "tag-line of %q", testCase.input)
+		assert.Equal(t, testCase.expected, mustWriteNote(t, note), "note %q must be rewritten", testCase.input)
+		assert.Len(t, note.Tags, testCase.tags, "tags of %q", testCase.input)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	note := LoadNoteBytes([]byte("![my #foo picture](a.png) and #bar"))
+	assert.Len(t, note.Tags, 2, "the tag in the alternative text is parsed")
+	assert.True(t, errors.Is(note.Validate(), ErrInvalidNote), "overlapping items must be detected")
+	_, err := note.WriteNote()
+	assert.True(t, errors.Is(err, ErrInvalidNote), "overlapping items must not be written")
+
+	note = LoadNoteBytes([]byte("#foo and ![image](a.png)"))
+	assert.NoError(t, note.Validate(), "note must be valid")
+	note.Images[0].position = []int{20, 40}
+	assert.True(t, errors.Is(note.Validate(), ErrInvalidNote), "out of bounds items must be detected")
+}
+
+// mustWriteNote converts the note back, failing the test on error.
+func mustWriteNote(t *testing.T, note *Note) string {
+	t.Helper()
+	content, err := note.WriteNote()
+	assert.NoError(t, err, "note must be written")
+	return content
+}
+
+func TestFixLinkText(t *testing.T) {
+	file := NewFile("<a href='note/doc.pdf'>note/doc.pdf</a>", nil)
+	assert.NoError(t, fixLinkText(&file, "doc.pdf", LinkTextKeep), "texts must be kept by default")
+	err := fixLinkText(&file, "doc.pdf", LinkTextCheck)
+	if assert.Error(t, err, "old paths must be reported") {
+		assert.Contains(t, err.Error(), "old path", "old paths must be reported")
+	}
+	assert.Error(t, fixLinkText(&file, "doc 2.pdf", LinkTextCheck), "different names must be reported")
+	assert.NoError(t, fixLinkText(&file, "doc.pdf", LinkTextFilename), "texts must be regenerated")
+	assert.Equal(t, "doc.pdf", file.Name, "texts must be regenerated")
+	assert.NoError(t, fixLinkText(&file, "doc.pdf", LinkTextCheck), "matching texts must not be reported")
+	assert.Error(t, checkLinkText("unknown"), "unknown handlings must be rejected")
+}
+
+func TestExtractTags(t *testing.T) {
+	md := "#Foo and #bar/baz then #foo again\n![#not-a-tag](image.png) $#math$ #2023"
+	assert.Equal(t, []string{"foo", "bar/baz"}, ExtractTags(md), "tags must be extracted")
+	assert.Equal(t, []string{"Foo", "bar/baz", "foo", "2023"}, ExtractTagsWithOptions([]byte(md), ParseOptions{CaseSensitiveTags: true, NumericTags: true}), "tags must be extracted as specified by options")
+
+	for _, content := range []string{md, "no tag", "#a #b #c #a"} {
+		var names []string
+		for _, tag := range LoadNote(content).Tags {
+			if !containsString(names, tagKey(tag.Name, false)) {
+				names = append(names, tagKey(tag.Name, false))
+			}
+		}
+		assert.Equal(t, names, ExtractTags(content), "ExtractTags and LoadNote must be consistent for %q", content)
+	}
+}
+
+func TestCheckIntegrity(t *testing.T) {
+	testCases := []struct {
+		input    string
+		issues   string
+		corrupt  bool
+		repaired string
+	}{
+		{"#tag\nsome text", "", false, "#tag\nsome text"},
+		{"\xEF\xBB\xBF#tag\n", "byte order mark", false, "#tag\n"},
+		{"#tag\nbad \xC3\x28 byte\nand \xFF", "2 invalid UTF-8 sequences (first at line 2)", true, "#tag\nbad �( byte\nand �"},
+		{"#tag\x00\x00\n", "2 null bytes", true, "#tag\n"},
+		{"\xFF\xFE#\x00t\x00a\x00g\x00", "UTF-16 encoding", true, "#tag"},
+	}
+	for _, testCase := range testCases {
+		check := checkIntegrity([]byte(testCase.input))
+		assert.Equal(t, testCase.issues, check.String(), "issues of %q must be found", testCase.input)
+		assert.Equal(t, testCase.corrupt, check.corrupt(), "%q must be told corrupt", testCase.input)
+		assert.Equal(t, testCase.repaired, string(check.repair([]byte(testCase.input))), "%q must be repaired", testCase.input)
+	}
+}
@@ -0,0 +1,51 @@
+package bearnotes
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultNoteExtension is the extension of the migrated notes.
+const DefaultNoteExtension = ".md"
+
+// Regular expression to detect the Markdown links to other notes, by their
+// relative path, with an optional anchor.
+// Examples:
+//  - [My note](My%20note.md)
+//  - [Some heading](../Work/My%20note.md#some-heading)
+var reNoteLink = regexp.MustCompile(`(\]\()([^()\s:]+)\.md((?:#[^()\s]*)?\))`)
+
+// Regular expression to validate note extensions
+var reNoteExtension = regexp.MustCompile(`^\.[a-zA-Z0-9]+$`)
+
+// noteExtension returns the extension of the migrated notes (with the
+// leading dot), as given by MigrateOptions.NoteExtension.
+func noteExtension(ext string) string {
+	if ext == "" {
+		return DefaultNoteExtension
+	}
+	if !strings.HasPrefix(ext, ".") {
+		return "." + ext
+	}
+	return ext
+}
+
+// checkNoteExtension returns an error if the extension of the migrated
+// notes is not made of letters and digits.
+func checkNoteExtension(ext string) error {
+	if !reNoteExtension.MatchString(noteExtension(ext)) {
+		return fmt.Errorf("invalid note extension '%s' (e.g. md, markdown or txt)", ext)
+	}
+	return nil
+}
+
+// rewriteNoteLinks changes the extension of the Markdown links to other
+// notes ([My note](My%20note.md)) to ext. Links to remote notes
+// (https://...) are left untouched.
+func rewriteNoteLinks(content []byte, ext string) []byte {
+	if ext == DefaultNoteExtension {
+		return content
+	}
+	return reNoteLink.ReplaceAll(content, []byte("${1}${2}"+ext+"${3}"))
+}
@@ -0,0 +1,214 @@
+package bearnotes
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Numbering schemes of the migrated notes (see MigrateOptions.Numbering)
+const (
+	NumberingNone     = ""
+	NumberingSequence = "sequence" // 001 - Title.md
+	NumberingDate     = "date"     // 2020-12-31 Title.md
+)
+
+// numberedNote is a planned note to be renamed by the numbering scheme.
+type numberedNote struct {
+	path    string       // Destination of the note, or of its folder
+	created time.Time    // Creation date of the original note
+	planned *PlannedNote // Planned note, whose paths follow the renaming
+}
+
+// numbering collects the planned notes by target directory, so that they
+// can be numbered once all of them are known.
+type numbering struct {
+	scheme string
+	notes  map[string][]numberedNote // target directory => notes
+}
+
+// newNumbering creates a numbering, returning an error if the scheme is unknown.
+func newNumbering(scheme string) (*numbering, error) {
+	if scheme != NumberingNone && scheme != NumberingSequence && scheme != NumberingDate {
+		return nil, fmt.Errorf("unknown numbering scheme '%s' (available schemes: %s, %s)", scheme, NumberingSequence, NumberingDate)
+	}
+	return &numbering{scheme: scheme, notes: make(map[string][]numberedNote)}, nil
+}
+
+// add records a planned note, numbered within its target directory.
+func (n *numbering) add(planned *PlannedNote) {
+	if n.scheme == NumberingNone {
+		return
+	}
+	n.notes[planned.numberingDir] = append(n.notes[planned.numberingDir], numberedNote{path: planned.numberedPath(), created: planned.created, planned: planned})
+}
+
+// numberedPath returns the path renamed by the numbering of the note: its
+// folder with the one-note-per-folder strategy, the note itself otherwise.
+func (planned *PlannedNote) numberedPath() string {
+	dir := filepath.Dir(planned.Destination)
+	if planned.strategy == StrategyOneNotePerFolder && filepath.Dir(dir) == planned.numberingDir {
+		return dir
+	}
+	return planned.Destination
+}
+
+// rename updates the paths of the note and of its assets once the note (or
+// its folder) is renamed from one path to another.
+func (planned *PlannedNote) rename(from string, to string) {
+	renamed := func(p string) string {
+		if p == from || strings.HasPrefix(p, from+string(filepath.Separator)) {
+			return to + strings.TrimPrefix(p, from)
+		}
+		return p
+	}
+	planned.Destination = renamed(planned.Destination)
+	for i := range planned.Assets {
+		planned.Assets[i].Destination = renamed(planned.Assets[i].Destination)
+	}
+}
+
+// apply numbers the planned notes, ordered by creation date within each
+// target directory. With the one-note-per-folder strategy, the folder of
+// the note is renamed, along with the images and file attachments it
+// holds. The links between the notes (with the ext extension) follow
+// the numbered notes.
+func (n *numbering) apply(notes []*PlannedNote, ext string, report *MigrationReport) {
+	if n.scheme == NumberingNone {
+		return
+	}
+
+	// Destinations of the notes, and the folders holding them, so that a
+	// numbered note never overwrites another one
+	taken := make(map[string]bool)
+	for _, planned := range notes {
+		for p := planned.Destination; p != filepath.Dir(p); p = filepath.Dir(p) {
+			taken[p] = true
+		}
+	}
+
+	originals := make(map[*PlannedNote]string, len(notes)) // note => destination before numbering
+	for _, planned := range notes {
+		originals[planned] = planned.Destination
+	}
+	for _, numbered := range n.notes {
+		sort.SliceStable(numbered, func(i, j int) bool {
+			if numbered[i].created.Equal(numbered[j].created) {
+				return filepath.Base(numbered[i].path) < filepath.Base(numbered[j].path)
+			}
+			return numbered[i].created.Before(numbered[j].created)
+		})
+
+		width := len(strconv.Itoa(len(numbered)))
+		if width < 3 {
+			width = 3
+		}
+		for i, note := range numbered {
+			var prefix string
+			if n.scheme == NumberingSequence {
+				prefix = fmt.Sprintf("%0*d - ", width, i+1)
+			} else {
+				prefix = note.created.Format("2006-01-02") + " "
+			}
+
+			name := filepath.Base(note.path)
+			destination := filepath.Join(filepath.Dir(note.path), prefix+name)
+			if taken[destination] {
+				report.warn(note.planned.name, ErrNameCollision, fmt.Errorf("cannot number the note since another note goes to %s", destination))
+				continue
+			}
+			taken[destination] = true
+			note.planned.rename(note.path, destination)
+		}
+	}
+
+	renamed := make(map[string]string) // destination before numbering => numbered destination
+	for planned, original := range originals {
+		if planned.Destination != original {
+			renamed[original] = planned.Destination
+		}
+	}
+	if len(renamed) == 0 {
+		return
+	}
+	reLink := regexp.MustCompile(`(\]\()([^()\s:]+)` + regexp.QuoteMeta(ext) + `((?:#[^()\s]*)?\))`)
+	for _, planned := range notes {
+		dir := filepath.Dir(originals[planned])
+		planned.Note.relinkNotes(reLink, func(link string) (string, bool) {
+			target, err := url.PathUnescape(link)
+			if err != nil {
+				return "", false
+			}
+			destination, ok := renamed[filepath.Join(dir, filepath.FromSlash(target)+ext)]
+			if !ok {
+				return "", false
+			}
+			rel, err := filepath.Rel(filepath.Dir(planned.Destination), destination)
+			if err != nil {
+				return "", false
+			}
+			return escapePath(strings.TrimSuffix(filepath.ToSlash(rel), ext)), true
+		})
+	}
+}
+
+// relinkNotes rewrites the links to other notes (matched by reLink, the
+// path without extension being its second group) as given by relink. The
+// tags, images and file attachments of the note are moved accordingly.
+func (note *Note) relinkNotes(reLink *regexp.Regexp, relink func(link string) (string, bool)) {
+	items := note.items()
+	type edit struct {
+		end   int // End of the rewritten link, in the original content
+		shift int // Difference of length
+	}
+	var edits []edit
+	var content bytes.Buffer
+	current := 0
+	for _, match := range reLink.FindAllSubmatchIndex(note.content, -1) {
+		start, end := match[4], match[5]
+		overlaps := false
+		for _, item := range items {
+			if item.position[0] < end && start < item.position[1] {
+				overlaps = true
+			}
+		}
+		link, ok := relink(string(note.content[start:end]))
+		if overlaps || !ok {
+			continue
+		}
+		content.Write(note.content[current:start])
+		content.WriteString(link)
+		current = end
+		edits = append(edits, edit{end: end, shift: len(link) - (end - start)})
+	}
+	if len(edits) == 0 {
+		return
+	}
+	content.Write(note.content[current:])
+	note.content = content.Bytes()
+
+	moved := func(position []int) []int {
+		shift := 0
+		for _, edit := range edits {
+			if edit.end <= position[0] {
+				shift += edit.shift
+			}
+		}
+		return []int{position[0] + shift, position[1] + shift}
+	}
+	for i := range note.Tags {
+		note.Tags[i].position = moved(note.Tags[i].position)
+	}
+	for i := range note.Files {
+		note.Files[i].position = moved(note.Files[i].position)
+	}
+	for i := range note.Images {
+		note.Images[i].position = moved(note.Images[i].position)
+	}
+}
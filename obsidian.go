@@ -0,0 +1,82 @@
+package bearnotes
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// obsidianAppFile is the path, relative to the vault, of the "Files and
+// links" settings of Obsidian.
+var obsidianAppFile = filepath.Join(".obsidian", "app.json")
+
+// obsidianApp is the content of the "Files and links" settings of
+// Obsidian, restricted to those depending on the migration.
+type obsidianApp struct {
+	AttachmentFolderPath string `json:"attachmentFolderPath"`
+	NewLinkFormat        string `json:"newLinkFormat"`
+	UseMarkdownLinks     bool   `json:"useMarkdownLinks"`
+}
+
+// obsidianAttachmentFolder returns the location of the new attachments in
+// Obsidian matching the asset directory of the images: "./" for the folder
+// of the note, "./assets" for a subfolder of the folder of the note and
+// "library" for a folder of the vault.
+func obsidianAttachmentFolder(options MigrateOptions) string {
+	dir := options.AssetDirectory
+	if imageDir, ok := options.AssetDirectories[AssetTypeImage]; ok {
+		dir = imageDir
+	}
+	dir = filepath.ToSlash(dir)
+	if strings.HasPrefix(dir, "/") {
+		if dir = strings.Trim(path.Clean(dir), "/"); dir == "" {
+			return "/"
+		}
+		return dir
+	}
+	if dir = path.Clean(dir); dir == "." {
+		return "./"
+	}
+	return "./" + dir
+}
+
+// writeObsidianConfig writes the "Files and links" settings of Obsidian
+// (.obsidian/app.json) in every destination directory, so that the new
+// attachments go where the migration put the existing ones and the new
+// links are wiki links ([[My note]]), as the links migrated from Bear.
+// Existing settings are left untouched.
+func (plan *Plan) writeObsidianConfig() error {
+	content, err := json.MarshalIndent(obsidianApp{
+		AttachmentFolderPath: obsidianAttachmentFolder(plan.options),
+		NewLinkFormat:        "shortest",
+		UseMarkdownLinks:     false,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return plan.writeObsidianFile(obsidianAppFile, content)
+}
+
+// writeObsidianFile writes a settings file of Obsidian (relative to the
+// vault) in every destination directory that has none yet, not to lose the
+// settings made in Obsidian.
+func (plan *Plan) writeObsidianFile(name string, content []byte) error {
+	for _, dir := range plan.options.destinations(plan.From, plan.To) {
+		p := filepath.Join(dir, name)
+		if _, err := os.Stat(p); err == nil {
+			continue
+		}
+		err := os.MkdirAll(filepath.Dir(p), plan.options.dirMode())
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(p, content, plan.options.fileMode())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package bearnotes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObsidianAttachmentFolder(t *testing.T) {
+	for _, testCase := range []struct {
+		options  MigrateOptions
+		expected string
+	}{
+		{MigrateOptions{}, "./"},
+		{MigrateOptions{AssetDirectory: "assets/"}, "./assets"},
+		{MigrateOptions{AssetDirectory: "assets", AssetDirectories: map[string]string{AssetTypeImage: "/library/images"}}, "library/images"},
+		{MigrateOptions{AssetDirectory: "assets", AssetDirectories: map[string]string{AssetTypePDF: "/library"}}, "./assets"},
+		{MigrateOptions{AssetDirectories: map[string]string{AssetTypeImage: "/"}}, "/"},
+	} {
+		assert.Equal(t, testCase.expected, obsidianAttachmentFolder(testCase.options), "attachments must go to the asset directory of the images (%v)", testCase.options.AssetDirectories)
+	}
+}
@@ -0,0 +1,74 @@
+package bearnotes
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// NoteOverride adjusts the migration of a single note, as reviewed by the
+// user (see MigrateOptions.Overrides).
+type NoteOverride struct {
+	// Skip leaves the note out of the migration
+	Skip bool `yaml:"skip,omitempty"`
+
+	// TargetDirectory replaces the target directory given by the tags of
+	// the note (relative to the destination directory). Notes having no
+	// handling strategy are stored in the same folder.
+	TargetDirectory string `yaml:"target_directory,omitempty"`
+}
+
+// Overrides maps the notes, by path relative to the Bear notes directory
+// (with forward slashes), to their adjustments.
+type Overrides map[string]NoteOverride
+
+// LoadOverrides reads an overrides file. A missing file holds no override.
+func LoadOverrides(p string) (Overrides, error) {
+	fileContent, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return Overrides{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	overrides := make(Overrides)
+	err = yaml.Unmarshal(fileContent, &overrides)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	return overrides, nil
+}
+
+// SaveOverrides writes an overrides file, leaving out the notes that are
+// not adjusted.
+func SaveOverrides(p string, overrides Overrides) error {
+	kept := make(Overrides)
+	for notePath, override := range overrides {
+		if override != (NoteOverride{}) {
+			kept[notePath] = override
+		}
+	}
+	fileContent, err := yaml.Marshal(kept)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p, fileContent, 0644)
+}
+
+// lookup returns the override of the note at relPath.
+func (overrides Overrides) lookup(relPath string) (NoteOverride, bool) {
+	override, ok := overrides[filepath.ToSlash(relPath)]
+	return override, ok
+}
+
+// RelativePath returns the path of the note, relative to the Bear notes
+// directory (with forward slashes), as used by the overrides.
+func (plan *Plan) RelativePath(planned *PlannedNote) string {
+	relPath, err := filepath.Rel(plan.From, planned.Source)
+	if err != nil {
+		return filepath.ToSlash(planned.Source)
+	}
+	return filepath.ToSlash(relPath)
+}
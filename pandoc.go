@@ -0,0 +1,69 @@
+package bearnotes
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// pandocExtensions maps pandoc output formats to file extensions,
+// when they differ from the format name.
+var pandocExtensions = map[string]string{
+	"latex":    "tex",
+	"markdown": "md",
+	"html5":    "html",
+	"asciidoc": "adoc",
+}
+
+// Exporter exports the migrated notes in the formats listed by their tags
+// (export_formats), see MigrateOptions.Exporter.
+type Exporter interface {
+	// Export converts the note at source to the given format and stores
+	// the result in the directory dir, created if needed.
+	Export(source string, dir string, format string) error
+}
+
+// pandocExporter is the default Exporter, using pandoc.
+type pandocExporter struct {
+	dirMode os.FileMode
+}
+
+// Export converts the note at source with pandoc (see pandocExport).
+func (exporter pandocExporter) Export(source string, dir string, format string) error {
+	return pandocExport(source, dir, format, exporter.dirMode)
+}
+
+// pandocExport converts the note at source to the given pandoc format and
+// stores the result in the directory dir, created with the permissions
+// dirMode if needed. Relative paths of images and file attachments are
+// resolved from the directory of source.
+func pandocExport(source string, dir string, format string, dirMode os.FileMode) error {
+	err := os.MkdirAll(dir, dirMode)
+	if err != nil {
+		return err
+	}
+
+	ext, ok := pandocExtensions[format]
+	if !ok {
+		ext = format
+	}
+	name := strings.TrimSuffix(filepath.Base(source), filepath.Ext(source))
+	destination, err := filepath.Abs(filepath.Join(dir, name+"."+ext))
+	if err != nil {
+		return err
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("pandoc", "--from", "markdown", "--to", format, "--output", destination, filepath.Base(source))
+	cmd.Dir = filepath.Dir(source)
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("pandoc --to %s: %w: %s", format, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
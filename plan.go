@@ -0,0 +1,1092 @@
+package bearnotes
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Plan describes what a migration will do: where each note goes, which
+// images and file attachments are copied and how notes are rewritten.
+// Nothing is written until Execute is called.
+type Plan struct {
+	From    string         // The Bear notes directory
+	To      string         // The destination directory
+	TagFile string         // The tag configuration file
+	Notes   []*PlannedNote // The notes to migrate, in walk order
+
+	// Warnings holds the issues that do not affect a single note
+	// (see MigrateOptions.MaxFolders and MigrateOptions.MaxFolderDepth)
+	Warnings []error
+
+	options MigrateOptions
+	report  MigrationReport       // Notes that cannot be migrated
+	failed  []failedNote          // Notes that cannot be migrated, with their source
+	tags    map[string]TagOptions // Entries of the tag file
+	renamer tagRenamer            // Rename rules of the tag file
+}
+
+// PlannedNote describes the migration of a single note.
+type PlannedNote struct {
+	Source        string           // Path of the Bear note
+	Destination   string           // Path of the migrated note
+	Note          *Note            // The note, with its tags and assets rewritten
+	Assets        []PlannedAsset   // Embedded images and file attachments to copy
+	ExportFormats []string         // Pandoc formats in which the note is exported
+	Tags          []string         // Tags of the migrated note
+	Metadata      FilenameMetadata // Metadata embedded in the filename (see MigrateOptions.Filenames)
+
+	// TargetDirectory is the target directory of the note, given by its
+	// tags or its override (relative to the destination directory)
+	TargetDirectory string
+
+	name         string           // Filename of the Bear note, for the report
+	exportDir    string           // Directory holding the pandoc exports
+	numberingDir string           // Directory in which the note is numbered
+	root         string           // Destination directory (of the vault)
+	strategy     HandlingStrategy // Handling strategy of the note
+	siteRoot     string           // Directory served at the root of the static site, if any
+	created      time.Time        // Creation date of the Bear note
+	original     []byte           // Original content, for the backup in InPlace mode
+}
+
+// PlannedAsset describes the copy of an embedded image or a file attachment.
+type PlannedAsset struct {
+	Source      string // Path of the asset (URL for remote images)
+	Destination string // Path of the copy
+	Image       bool   // Whether the asset is an embedded image or a file attachment
+	Remote      bool   // Whether the image has to be downloaded first
+
+	index int // Index of the asset in Note.Images or Note.Files
+}
+
+// Errors returns the errors that prevent some notes from being migrated
+// (unknown tags, unreadable notes, etc.). They are also part of the report
+// returned by Execute.
+func (plan *Plan) Errors() []error {
+	return plan.report.Errors
+}
+
+// PlanMigration takes a source directory (from), a destination directory (to)
+// and a tag configuration file (tagFile) and computes the Bear to Zettlr
+// migration specified by options, without writing anything.
+//
+// Errors affecting a single note do not stop the planning: they are
+// recorded in the plan (see Plan.Errors).
+func PlanMigration(ctx context.Context, from string, to string, tagFile string, options MigrateOptions) (*Plan, error) {
+	if options.log == nil {
+		options.log = &migrationLogger{console: options.Logger}
+	}
+	tagFiles := append([]string{tagFile}, options.TagFileOverrides...)
+	options.log.printf("Reading the tag file from %s...\n", strings.Join(tagFiles, ", "))
+	tags, tagFileWarnings, err := loadTagFiles(tagFiles)
+	if err != nil {
+		return nil, err
+	}
+	renameRules, titleRules, err := loadLayeredSettings(tagFiles, &options)
+	if err != nil {
+		return nil, err
+	}
+
+	numbers, err := newNumbering(options.Numbering)
+	if err != nil {
+		return nil, err
+	}
+	_, err = newCopyThrottle(options.BandwidthLimit, options.ProgressThreshold)
+	if err != nil {
+		return nil, err
+	}
+	err = checkTracePatterns(options.Trace)
+	if err != nil {
+		return nil, err
+	}
+	err = checkAssetMode(options.LinkAssets)
+	if err != nil {
+		return nil, err
+	}
+	err = checkLayout(options.Layout)
+	if err != nil {
+		return nil, err
+	}
+	err = checkKeywordOptions(options.Keywords)
+	if err != nil {
+		return nil, err
+	}
+	err = checkSourceLink(options.SourceLink)
+	if err != nil {
+		return nil, err
+	}
+	err = checkZettlrOptions(options.Zettlr)
+	if err != nil {
+		return nil, err
+	}
+	err = checkLinkText(options.LinkText)
+	if err != nil {
+		return nil, err
+	}
+	err = checkConflicts(options.Conflicts)
+	if err != nil {
+		return nil, err
+	}
+	err = checkNoteExtension(options.NoteExtension)
+	if err != nil {
+		return nil, err
+	}
+	err = checkDefaultHandlingStrategy(options.DefaultHandlingStrategy)
+	if err != nil {
+		return nil, err
+	}
+	location, err := loadTimezone(options.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	err = checkTagTransforms(tags)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", tagFile, err)
+	}
+	err = checkSizeRules(tags)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", tagFile, err)
+	}
+	err = checkTagColors(tags)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", tagFile, err)
+	}
+	renamer, err := newTagRenamer(renameRules)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", tagFile, err)
+	}
+	router, err := newTitleRouter(titleRules)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", tagFile, err)
+	}
+	err = checkAssetDirectories(options.AssetDirectories)
+	if err != nil {
+		return nil, err
+	}
+	for tagName, tagOption := range tags {
+		err = checkAssetDirectories(tagOption.AssetDirectories)
+		if err != nil {
+			return nil, fmt.Errorf("%s: tag '%s': %w", tagFile, tagName, err)
+		}
+	}
+	suffixes, err := compileAssetSuffixes(options.AssetSuffixes)
+	if err != nil {
+		return nil, err
+	}
+	if options.FinderTags && !finderTagsSupported {
+		return nil, setFinderTags("", nil)
+	}
+
+	err = checkExportFormat(ctx, from, options.ConvertHTML, options.log)
+	if err != nil {
+		return nil, err
+	}
+
+	if !options.InPlace && !options.AllowNested {
+		err = checkNesting(from, options.destinations(from, to))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	skipped := make(map[string]bool)
+	if options.SkipDuplicates {
+		threshold := options.DuplicateThreshold
+		if threshold <= 0 {
+			threshold = 1
+		}
+		options.log.printf("Looking for duplicate notes...\n")
+		clusters, err := FindDuplicates(ctx, from, threshold)
+		if err != nil {
+			return nil, err
+		}
+		for _, cluster := range clusters {
+			for _, notePath := range cluster.Notes[1:] {
+				skipped[notePath] = true
+			}
+		}
+	}
+
+	if options.ExportDirectory == "" {
+		options.ExportDirectory = "exports"
+	}
+
+	var assets *assetIndex
+	if !options.InPlace {
+		options.log.printf("Indexing images and file attachments...\n")
+		assets, err = buildAssetIndex(ctx, from)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var headings headingIndex
+	if options.HeadingLinks {
+		options.log.printf("Indexing the headings of the notes...\n")
+		headings, err = buildHeadingIndex(ctx, from, options.ConvertHTML)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	plan := &Plan{From: from, To: to, TagFile: tagFile, options: options, tags: tags, renamer: renamer}
+	plan.report.log = options.log
+	report := &plan.report
+	for _, warning := range tagFileWarnings {
+		options.log.Printf("WARNING: %s\n", warning)
+		report.Warnings = append(report.Warnings, warning)
+	}
+
+	// Notable and static site generators expect the tags in the front matter
+	keywords := options.Keywords
+	if (options.Layout == LayoutNotable || isStaticSite(options.Layout)) && keywords.Field == "" {
+		keywords.Field = "tags"
+	}
+
+	// Notes are rewritten in place with their extension
+	ext := noteExtension(options.NoteExtension)
+	if options.InPlace {
+		ext = DefaultNoteExtension
+	}
+
+	// Filenames of the assets, once cleaned
+	names := newAssetNames(suffixes)
+	if options.SlugifyAssets {
+		names.slug = &options.Slug
+	}
+
+	// Destinations of the notes, so that a note never overwrites another
+	// one going to the same file
+	destinations := make(map[string]bool)
+
+	// Entries and target directories of the tag file used by the notes
+	usedEntries := make(map[string]bool)
+	usedDirectories := make(map[string]bool)
+
+	options.log.printf("Planning the migration of Bear notes from %s...\n", from)
+	err = filepath.Walk(from, plan.recordFailures(
+		func(p string, info os.FileInfo, err error) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			if err != nil {
+				report.fail(p, ErrReadFailed, err)
+				return nil
+			}
+
+			// If it's not a markdown file, skip it.
+			if info.IsDir() || !isNoteFile(info.Name(), options.ConvertHTML) {
+				return nil
+			}
+
+			relPath, _ := filepath.Rel(from, p)
+			trace := newTracer(options.log, options.Trace, relPath)
+
+			// Skip duplicates, if asked to
+			if skipped[relPath] {
+				options.log.Printf("Skipping duplicate note %s...\n", relPath)
+				report.Skipped++
+				return nil
+			}
+			override, _ := options.Overrides.lookup(relPath)
+			if override.Skip {
+				options.log.Printf("Skipping note %s, as overridden...\n", relPath)
+				report.Skipped++
+				return nil
+			}
+
+			report.Notes++
+
+			// Load the note. Since notes are kept until the plan is
+			// executed, each note gets its own buffer.
+			content, err := readNoteFile(p, new(bytes.Buffer))
+			if err != nil {
+				report.fail(info.Name(), ErrReadFailed, err)
+				return nil
+			}
+			// Corrupted exports would be parsed as garbage. The original
+			// content is kept for the backup, in place.
+			text := content
+			if check := checkIntegrity(content); check.String() != "" {
+				if check.corrupt() && !options.RepairEncoding {
+					trace("corrupt note: %s", check)
+					report.fail(info.Name(), ErrCorruptNote, fmt.Errorf("%s (see --repair-encoding)", check))
+					return nil
+				}
+				text = check.repair(content)
+				report.warn(info.Name(), ErrCorruptNote, fmt.Errorf("%s, repaired", check))
+			}
+			noteName := strings.TrimSuffix(info.Name(), filepath.Ext(info.Name()))
+			if isConflictTitle(noteName) {
+				report.warn(info.Name(), ErrConflictedCopy, fmt.Errorf("the title of the note looks like a conflicted copy"))
+			}
+			// Conflict markers are resolved before parsing, so that the
+			// tags and assets of the discarded side are left out
+			resolved, conflicts := resolveConflicts(text, options.Conflicts)
+			if conflicts > 0 && options.Conflicts == ConflictKeep {
+				report.warn(info.Name(), ErrConflictedCopy, fmt.Errorf("the note has %d blocks of content between conflict markers", conflicts))
+			} else if conflicts > 0 {
+				trace("%d conflicts resolved, keeping the %s side", conflicts, options.Conflicts)
+			}
+			if headings != nil {
+				var errs []error
+				resolved, errs = headings.rewriteHeadingLinks(resolved)
+				for _, err := range errs {
+					report.warn(info.Name(), ErrHeadingMissing, err)
+				}
+			}
+			var htmlRemoved int
+			note := LoadNoteWithOptions(rewriteNoteLinks(applyTransforms(resolved, countHTMLRemoval(options.Transforms, &htmlRemoved)), ext), options.Parse)
+			// Tags are renamed by the rename rules before anything is
+			// looked up in the tag file
+			originalTags := renamer.renameTags(note.Tags, options.Parse.CaseSensitiveTags)
+			// The transforms of the tags of the note (or of its folder or
+			// title pseudo-tag) are applied on top, the note being parsed
+			// again
+			noteTags, noteTagOptions := note.Tags, tags
+			if options.FolderTags && len(noteTags) == 0 {
+				if tag, ok := folderTag(relPath); ok {
+					noteTags = []Tag{tag}
+					renamer.renameTags(noteTags, options.Parse.CaseSensitiveTags)
+				}
+			}
+			if len(noteTags) == 0 {
+				if tag, titleTagOptions, ok := router.route(noteName, options.Parse.CaseSensitiveTags); ok {
+					noteTags, noteTagOptions = []Tag{tag}, titleTagOptions
+				}
+			}
+			extra, _ := tagTransforms(noteTags, noteTagOptions, options.Parse.CaseSensitiveTags, options.Transforms)
+			if len(extra) > 0 {
+				var names []string
+				for _, t := range extra {
+					names = append(names, t.Name())
+				}
+				trace("transforms of the tags: %s", strings.Join(names, ", "))
+				htmlRemoved = 0
+				transforms := append(append([]Transform(nil), options.Transforms...), extra...)
+				note = LoadNoteWithOptions(rewriteNoteLinks(applyTransforms(resolved, countHTMLRemoval(transforms, &htmlRemoved)), ext), options.Parse)
+				originalTags = renamer.renameTags(note.Tags, options.Parse.CaseSensitiveTags)
+			}
+			if htmlRemoved > 0 {
+				trace("%d HTML elements removed", htmlRemoved)
+				report.HTMLRemoved += htmlRemoved
+			}
+			trace("%d tags, %d images, %d file attachments", len(note.Tags), len(note.Images), len(note.Files))
+			// The pseudo-tag of untagged notes is routed as any other tag,
+			// but it is not part of the content. The pseudo-tag of a title
+			// rule is looked up in the options of the rule only.
+			pseudoTagged, titleRouted, routingTags := false, false, tags
+			if options.FolderTags && len(note.Tags) == 0 {
+				if tag, ok := folderTag(relPath); ok {
+					trace("untagged note, using the pseudo-tag #%s of its folder", tag.Name)
+					note.Tags = []Tag{tag}
+					originalTags = renamer.renameTags(note.Tags, options.Parse.CaseSensitiveTags)
+					pseudoTagged = true
+				}
+			}
+			if len(note.Tags) == 0 {
+				if tag, titleTagOptions, ok := router.route(noteName, options.Parse.CaseSensitiveTags); ok {
+					trace("untagged note, routed by the title rule '%s'", strings.TrimPrefix(tag.Name, "title:"))
+					note.Tags, routingTags = []Tag{tag}, titleTagOptions
+					originalTags = []string{tag.Name}
+					pseudoTagged, titleRouted = true, true
+				}
+			}
+			for i, tag := range note.Tags {
+				if tag.Name != originalTags[i] {
+					trace("tag #%s renamed to #%s by the rename rules", originalTags[i], tag.Name)
+				}
+				entry, tagOption, ok := lookupTagEntry(routingTags, tagKey(tag.Name, options.Parse.CaseSensitiveTags), !tag.isNumeric())
+				if !ok {
+					trace("tag #%s is not in the tag file", tag.Name)
+					continue
+				}
+				if !titleRouted {
+					usedEntries[entry] = true
+				}
+				trace("tag #%s: ignore=%t handling_strategy='%s' target_directory='%s' target_tag_name='%s' vault='%s'", tag.Name, tagOption.Ignore, tagOption.HandlingStrategy, tagOption.TargetDirectory, tagOption.TargetTagName, tagOption.Vault)
+				if len(tagOption.SizeRules) > 0 {
+					words, characters := noteSize(note.content)
+					sized := tagOption.withSizeRules(words, characters)
+					trace("tag #%s: %d words, %d characters, size rules give handling_strategy='%s' target_directory='%s'", tag.Name, words, characters, sized.HandlingStrategy, sized.TargetDirectory)
+				}
+			}
+
+			routing, err := applyTagOptions(note, routingTags, options.Parse.CaseSensitiveTags, options.log)
+			if err != nil {
+				trace("unknown tag: %s", err)
+				report.fail(info.Name(), ErrUnknownTag, err)
+				return nil
+			}
+			for i, tag := range note.Tags {
+				if tag.Name != originalTags[i] && !titleRouted {
+					report.renameTag(originalTags[i], tag.Name)
+				}
+			}
+			// Keywords and categories keep the full path of nested tags,
+			// the target tag names being often their last component.
+			// Pseudo-tags are not tags of the note, only their target
+			// tag names are.
+			keywordTags := routing.sourceTags
+			if pseudoTagged {
+				note.Tags = nil
+				keywordTags = routing.tags
+			}
+			keywords.apply(note, keywordTags)
+			if options.StripTagLine && note.StripTrailingTagLine() {
+				trace("trailing tag-line removed")
+			}
+			// Notes that cannot be written back are left out before
+			// copying anything
+			err = validateItems(note.items(), len(note.content))
+			if err != nil {
+				trace("invalid note: %s", err)
+				report.fail(info.Name(), ErrInvalidNote, err)
+				return nil
+			}
+			addSourceLink(note, noteName, options.SourceLink)
+			trace("target directory '%s', handling strategy '%s', vault '%s', export formats %v", routing.targetDirectory, routing.handlingStrategy, routing.vault, routing.exportFormats)
+			// Without handling strategy, the target directory is not used
+			if routing.handlingStrategy != "" || options.DefaultHandlingStrategy != "" {
+				usedDirectories[routing.targetDirectory] = true
+			}
+			targetDir := routing.targetDirectory
+			handlingStrategy := routing.handlingStrategy
+			vault := routing.vault
+			if handlingStrategy == "" && options.DefaultHandlingStrategy != "" {
+				handlingStrategy = options.DefaultHandlingStrategy
+				trace("default handling strategy '%s'", handlingStrategy)
+			}
+
+			planned := &PlannedNote{
+				Source:  p,
+				Note:    note,
+				Tags:    routing.tags,
+				name:    info.Name(),
+				created: creationTime(info).In(location),
+			}
+
+			// Dates embedded in filenames are more reliable than the
+			// creation date of the exported file
+			if options.Filenames != nil {
+				planned.Metadata = options.Filenames.ParseInLocation(noteName, location)
+				if !planned.Metadata.Date.IsZero() {
+					planned.created = planned.Metadata.Date
+				}
+			}
+
+			// In place, only the note content is rewritten
+			// HTML notes are converted to a Markdown file next to them.
+			if options.InPlace {
+				planned.Destination = filepath.Join(filepath.Dir(p), noteName+".md")
+				planned.original = content
+				trace("rewriting in place to %s", planned.Destination)
+				plan.Notes = append(plan.Notes, planned)
+				return nil
+			}
+
+			// Notes whose tags are all ignored would silently go to the
+			// root of the target directory
+			if routing.allIgnored {
+				report.Unclassified++
+				if options.UnclassifiedDirectory != "" {
+					targetDir, handlingStrategy = options.UnclassifiedDirectory, StrategySameFolder
+					report.warn(info.Name(), ErrTagsIgnored, fmt.Errorf("the note goes to the '%s' directory", targetDir))
+				} else {
+					report.warn(info.Name(), ErrTagsIgnored, fmt.Errorf("the note goes to the root of the target directory"))
+				}
+			}
+
+			// The target directory of the overrides replaces the one of
+			// the tags
+			if override.TargetDirectory != "" {
+				targetDir = override.TargetDirectory
+				if handlingStrategy == StrategyNone {
+					handlingStrategy = StrategySameFolder
+				}
+				trace("target directory '%s', as overridden", targetDir)
+			}
+			planned.TargetDirectory = targetDir
+
+			// Find the root directory of the vault
+			root := to
+			if vault != "" {
+				var ok bool
+				root, ok = options.Vaults[vault]
+				if !ok {
+					report.fail(info.Name(), ErrUnknownVault, fmt.Errorf("'%s' has no destination directory", vault))
+					return nil
+				}
+			}
+
+			// Compute the final target directory, based on the handling strategy
+			if handlingStrategy == StrategyOneNotePerFolder {
+				targetDir = path.Join(root, targetDir, noteName)
+			} else if handlingStrategy == StrategyGroupByInitial {
+				targetDir = path.Join(root, targetDir, initial(noteName))
+			} else if handlingStrategy == StrategySameFolder {
+				targetDir = path.Join(root, targetDir)
+			} else {
+				// If no tag set an handling strategy or if the note has no tag,
+				// then it goes at the root of the target directory
+				targetDir = root
+			}
+
+			// Notes are numbered within the tag directory, not the note directory
+			planned.numberingDir = targetDir
+			if handlingStrategy == StrategyOneNotePerFolder || handlingStrategy == StrategyGroupByInitial {
+				planned.numberingDir = filepath.Dir(targetDir)
+			}
+			planned.root, planned.strategy = root, handlingStrategy
+
+			// In the Notable layout, notes are stored in a single directory,
+			// assets in a sibling directory and tags in the front matter
+			assetDir := filepath.Join(targetDir, options.AssetDirectory)
+			if options.Layout == LayoutNotable {
+				targetDir = filepath.Join(root, "notes")
+				assetDir = filepath.Join(root, "attachments")
+				planned.numberingDir = targetDir
+				if note.FrontMatter == nil {
+					note.FrontMatter = make(map[string]string)
+				}
+				if _, ok := note.FrontMatter["title"]; !ok {
+					note.FrontMatter["title"] = noteName
+				}
+			}
+
+			// Static sites have their own layout, filenames are slugified
+			// and assets are linked from the root of the site
+			fileName := noteName
+			if options.Layout == LayoutHugo {
+				section := siteSection(routing.targetDirectory, options.Slug)
+				targetDir = filepath.Join(root, "content", section)
+				assetDir = filepath.Join(root, "static", section)
+				planned.siteRoot = filepath.Join(root, "static")
+			} else if options.Layout == LayoutJekyll {
+				targetDir = filepath.Join(root, "_drafts")
+				assetDir = filepath.Join(root, "assets")
+				planned.siteRoot = root
+			}
+			if isStaticSite(options.Layout) {
+				fileName = siteFilename(noteName, options.Slug)
+				planned.numberingDir = targetDir
+				setSiteFrontMatter(note, options.Layout, noteName, planned.created)
+			}
+
+			// Crafted target directories (../../) must not write outside
+			// of the destination directory
+			if err := checkConfined(targetDir, root); err != nil {
+				trace("target directory: %s", err)
+				report.fail(info.Name(), ErrPathTraversal, err)
+				return nil
+			}
+			if err := checkConfined(assetDir, root); err != nil {
+				trace("asset directory: %s", err)
+				report.fail(info.Name(), ErrPathTraversal, err)
+				return nil
+			}
+
+			trace("migrating to %s", targetDir)
+			planned.Destination = filepath.Join(targetDir, fileName+ext)
+			for n := 2; destinations[planned.Destination]; n++ {
+				planned.Destination = filepath.Join(targetDir, numberedName(fileName+ext, n))
+			}
+			if name := filepath.Base(planned.Destination); name != fileName+ext {
+				trace("another note goes to %s, renamed to %s", fileName+ext, name)
+				report.warn(info.Name(), ErrNameCollision, fmt.Errorf("another note goes to %s, the note is renamed to %s", filepath.Join(targetDir, fileName+ext), name))
+			}
+			destinations[planned.Destination] = true
+
+			// Asset directory rules of the tags take precedence over the
+			// rules of the migration. Static sites have their own layout.
+			assetDirectories := make(map[string]string)
+			if !isStaticSite(options.Layout) {
+				for kind, dir := range options.AssetDirectories {
+					assetDirectories[kind] = dir
+				}
+				for kind, dir := range routing.assetDirectories {
+					assetDirectories[kind] = dir
+				}
+			}
+			assetDirFor := func(fileName string, image bool) (string, error) {
+				dir, ok := assetDirectory(assetDirectories, fileName, image)
+				if !ok {
+					return assetDir, nil
+				}
+				dir = resolveAssetDirectory(dir, targetDir, root)
+				return dir, checkConfined(dir, root)
+			}
+
+			// Plan the copy of embedded images
+			for i, image := range note.Images {
+				// Remote images are left untouched, unless asked otherwise.
+				// Their link is rewritten once downloaded.
+				if isRemote(image.Location) {
+					if !options.DownloadRemoteImages {
+						continue
+					}
+					imageFileName := remoteFileName(image.Location)
+					dir, err := assetDirFor(imageFileName, true)
+					if err != nil {
+						trace("image '%s': asset directory: %s", image.Location, err)
+						report.fail(info.Name(), ErrPathTraversal, err)
+						return nil
+					}
+					destination := filepath.Join(dir, names.clean(dir, imageFileName, image.Location))
+					trace("image '%s': download -> %s", image.Location, destination)
+					planned.Assets = append(planned.Assets, PlannedAsset{Source: image.Location, Destination: destination, Image: true, Remote: true, index: i})
+					continue
+				}
+
+				// Normalize filenames to prevent 'file not found' errors
+				// Crafted links (../../) must not read outside of the source directory
+				imageFileName := filepath.Base(norm.NFC.String(image.Location))
+				source := filepath.Join(from, norm.NFC.String(image.Location))
+				if err := checkConfined(source, from); err != nil {
+					trace("image '%s': %s", image.Location, err)
+					report.fail(info.Name(), ErrPathTraversal, err)
+					return nil
+				}
+				source = assets.resolve(source, noteName)
+				if options.InferExtensions && filepath.Ext(imageFileName) == "" {
+					imageFileName += inferExtension(source)
+				}
+				dir, err := assetDirFor(imageFileName, true)
+				if err != nil {
+					trace("image '%s': asset directory: %s", image.Location, err)
+					report.fail(info.Name(), ErrPathTraversal, err)
+					return nil
+				}
+				imageFileName = names.clean(dir, imageFileName, source)
+				destination := filepath.Join(dir, imageFileName)
+				trace("image '%s': %s -> %s", image.Location, source, destination)
+				planned.Assets = append(planned.Assets, PlannedAsset{Source: source, Destination: destination, Image: true, index: i})
+				note.Images[i].Location = planned.link(destination)
+				if options.AltText != nil && strings.TrimSpace(image.Description) == "" {
+					text, err := options.AltText.AltText(ctx, source)
+					if err != nil {
+						report.warn(info.Name(), ErrAltTextFailed, fmt.Errorf("image '%s': %w", image.Location, err))
+					} else if text = cleanAltText(text); text != "" {
+						trace("image '%s': alternative text '%s'", image.Location, text)
+						note.Images[i].Description = text
+					}
+				}
+			}
+
+			// Plan the copy of file attachments
+			for i, file := range note.Files {
+				// Normalize filenames to prevent 'file not found' errors
+				fileName := filepath.Base(norm.NFC.String(file.Location))
+				source := filepath.Join(from, noteName, norm.NFC.String(file.Location))
+				if err := checkConfined(source, from); err != nil {
+					trace("file attachment '%s': %s", file.Location, err)
+					report.fail(info.Name(), ErrPathTraversal, err)
+					return nil
+				}
+				source = assets.resolve(source, noteName)
+				if options.InferExtensions && filepath.Ext(fileName) == "" {
+					fileName += inferExtension(source)
+				}
+				dir, err := assetDirFor(fileName, false)
+				if err != nil {
+					trace("file attachment '%s': asset directory: %s", file.Location, err)
+					report.fail(info.Name(), ErrPathTraversal, err)
+					return nil
+				}
+				fileName = names.clean(dir, fileName, source)
+				destination := filepath.Join(dir, fileName)
+				trace("file attachment '%s': %s -> %s", file.Location, source, destination)
+				planned.Assets = append(planned.Assets, PlannedAsset{Source: source, Destination: destination, index: i})
+				note.Files[i].Location = planned.link(destination)
+				if err := fixLinkText(&note.Files[i], fileName, options.LinkText); err != nil {
+					report.warn(info.Name(), ErrLinkTextMismatch, err)
+				}
+			}
+
+			// Plan the pandoc exports
+			if options.Pandoc && len(routing.exportFormats) > 0 {
+				relDir, _ := filepath.Rel(root, targetDir)
+				planned.exportDir = filepath.Join(root, options.ExportDirectory, relDir)
+				planned.ExportFormats = routing.exportFormats
+			}
+
+			plan.Notes = append(plan.Notes, planned)
+			return nil
+		}))
+	if err != nil {
+		return plan, err
+	}
+
+	if options.Filenames != nil {
+		applyFilenameMetadata(plan.Notes, &plan.report, !options.InPlace, options.Slug)
+	}
+	// Notes are numbered once their names are final, so that the links
+	// to them can follow
+	if !options.InPlace {
+		for _, planned := range plan.Notes {
+			numbers.add(planned)
+		}
+		numbers.apply(plan.Notes, ext, &plan.report)
+	}
+	plan.checkFolderGuards()
+	report.UnusedTags, report.UnusedDirectories = unusedTagEntries(tags, usedEntries, usedDirectories)
+
+	return plan, nil
+}
+
+// Execute performs the migration described by the plan.
+//
+// Errors affecting a single note do not stop the migration: they are
+// recorded in the returned report as *NoteError values, along with the
+// errors found when planning the migration.
+//
+// When ctx is cancelled, the migration stops after the current note and
+// the partial report is returned along with the context error.
+func (plan *Plan) Execute(ctx context.Context) (*MigrationReport, error) {
+	options := plan.options
+	report := plan.report
+	started := time.Now()
+	report.Errors = append([]error(nil), plan.report.Errors...)
+
+	var err error
+	if !options.SkipPreflight {
+		options.log.printf("Checking destination directories...\n")
+		err = preflight(ctx, plan.From, options.destinations(plan.From, plan.To), options.dirMode())
+		if err != nil {
+			return &report, err
+		}
+	}
+
+	if options.Pandoc && options.Exporter == nil {
+		if _, err := exec.LookPath("pandoc"); err != nil {
+			options.log.Printf("WARNING: pandoc cannot be found, notes will not be exported: %s\n", err)
+			options.Pandoc = false
+		}
+	}
+
+	throttle, err := newCopyThrottle(options.BandwidthLimit, options.ProgressThreshold)
+	if err != nil {
+		return nil, err
+	}
+	throttle.log = options.log
+
+	var downloader *imageDownloader
+	if options.DownloadRemoteImages {
+		downloader, err = newImageDownloader(options.RemoteImageTimeout, options.RemoteImageMaxSize)
+		if err != nil {
+			return nil, err
+		}
+		defer downloader.close()
+	}
+
+	if options.InPlace {
+		options.log.printf("Rewriting Bear notes in %s...\n", plan.From)
+	} else {
+		options.log.printf("Migrating Bear notes from %s to %s...\n", plan.From, plan.To)
+	}
+	denied := make(map[string]error) // Directories that cannot be written
+	failed := append([]failedNote(nil), plan.failed...)
+	for _, planned := range plan.Notes {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+			break
+		}
+
+		// Notes going to a directory that cannot be written are reported
+		// without trying (and logging) each of them
+		dir := filepath.Dir(planned.Destination)
+		if cause, ok := denied[dir]; ok {
+			e := &NoteError{Note: planned.name, Kind: ErrWriteFailed, Err: cause}
+			report.Errors = append(report.Errors, e)
+			failed = append(failed, failedNote{source: planned.Source, errors: []error{e}})
+			continue
+		}
+
+		options.log.Printf("Processing %s...\n", planned.name)
+		before := len(report.Errors)
+		if planned.execute(ctx, options, downloader, throttle, &report) {
+			report.Successes++
+			continue
+		}
+		if len(report.Errors) > before {
+			failed = append(failed, failedNote{source: planned.Source, errors: append([]error(nil), report.Errors[before:]...)})
+		}
+		if cause := permissionError(report.Errors); cause != nil {
+			if options.AbortOnPermissionError {
+				err = fmt.Errorf("%s is not writable: %w", dir, cause)
+				break
+			}
+			options.log.Printf("WARNING: %s is not writable, skipping the other notes going there\n", dir)
+			denied[dir] = cause
+		}
+	}
+
+	// Failed notes are kept, unmodified, along with the cause of the failure
+	var quarantined int
+	if !options.InPlace && options.FailedDirectory != "" && len(failed) > 0 {
+		quarantined = plan.quarantine(failed)
+	}
+
+	if err == nil && options.SimilarImages {
+		options.log.printf("Looking for similar images...\n")
+		report.SimilarImages, err = plan.similarImages(ctx)
+	}
+
+	options.log.printf("\n")
+	options.log.printf("Processed %d notes with %d successes and %d failures\n", report.Notes, report.Successes, report.Failures())
+	if report.Skipped > 0 {
+		options.log.printf("Skipped %d notes (duplicates or overrides)\n", report.Skipped)
+	}
+	if quarantined > 0 {
+		options.log.printf("Copied %d failed notes to %s\n", quarantined, filepath.Join(plan.To, options.FailedDirectory))
+	}
+	if report.Retries > 0 {
+		options.log.printf("Retried %d writes because of transient errors\n", report.Retries)
+	}
+	if len(denied) > 0 {
+		options.log.printf("Skipped the notes going to %d directories that are not writable\n", len(denied))
+	}
+	if report.Unclassified > 0 {
+		options.log.printf("Found %d notes whose tags are all ignored\n", report.Unclassified)
+	}
+	if report.HTMLRemoved > 0 {
+		options.log.printf("Removed %d HTML elements and entities\n", report.HTMLRemoved)
+	}
+	if len(report.UnusedTags) > 0 {
+		options.log.printf("Found %d tag file entries matching no note: %s\n", len(report.UnusedTags), strings.Join(report.UnusedTags, ", "))
+	}
+	if len(report.UnusedDirectories) > 0 {
+		options.log.printf("Found %d target directories receiving no note: %s\n", len(report.UnusedDirectories), strings.Join(report.UnusedDirectories, ", "))
+	}
+	if len(report.SimilarImages) > 0 {
+		options.log.printf("Found %d groups of visually similar images:\n", len(report.SimilarImages))
+		for _, cluster := range report.SimilarImages {
+			options.log.printf("- %s\n", strings.Join(cluster.Images, ", "))
+		}
+	}
+
+	// Zettlr settings of the created directories
+	if err == nil && !options.InPlace && options.Zettlr.Sorting != "" {
+		err = plan.writeZettlrDirectories()
+		if err != nil {
+			return &report, err
+		}
+	}
+
+	// Colors of the tags in the Obsidian graph view
+	if err == nil && !options.InPlace && options.ObsidianGraph {
+		err = plan.writeObsidianGraph()
+		if err != nil {
+			return &report, err
+		}
+	}
+
+	// Settings of the Obsidian vaults
+	if err == nil && !options.InPlace && options.ObsidianConfig {
+		err = plan.writeObsidianConfig()
+		if err != nil {
+			return &report, err
+		}
+	}
+
+	// Record how the migration was run, along with the migrated notes
+	if err == nil && !options.InPlace {
+		err = plan.writeSnapshot(started, &report)
+		if err != nil {
+			return &report, err
+		}
+	}
+
+	if options.GitCommit && err == nil {
+		message := fmt.Sprintf("Migration of Bear notes from %s\n\nProcessed %d notes with %d successes, %d failures and %d warnings.\n", plan.From, report.Notes, report.Successes, report.Failures(), len(report.Warnings))
+		for _, dir := range options.destinations(plan.From, plan.To) {
+			options.log.printf("Committing changes in %s...\n", dir)
+			err = gitCommit(dir, message)
+			if err != nil {
+				return &report, err
+			}
+		}
+	}
+
+	return &report, err
+}
+
+// similarImages returns the groups of visually identical images among the
+// images of the plan (see MigrateOptions.SimilarImages).
+func (plan *Plan) similarImages(ctx context.Context) ([]ImageCluster, error) {
+	distance := plan.options.SimilarImageDistance
+	if distance < 0 {
+		distance = DefaultImageDistance
+	}
+	var paths []string
+	seen := make(map[string]bool)
+	for _, planned := range plan.Notes {
+		for _, asset := range planned.Assets {
+			if asset.Image && !seen[asset.Destination] {
+				seen[asset.Destination] = true
+				paths = append(paths, asset.Destination)
+			}
+		}
+	}
+	return clusterImages(ctx, paths, distance, plan.options.log)
+}
+
+// execute migrates a single note and returns true on success.
+func (planned *PlannedNote) execute(ctx context.Context, options MigrateOptions, downloader *imageDownloader, throttle *copyThrottle, report *MigrationReport) bool {
+	// In place, only the note content is rewritten
+	if options.InPlace {
+		err := options.retry(ctx, report, func() error {
+			return rewriteInPlace(planned.Destination, planned.original, planned.Note, !options.NoBackup && planned.Destination == planned.Source, options.fileMode())
+		})
+		if err != nil {
+			report.fail(planned.name, ErrWriteFailed, err)
+			return false
+		}
+		if options.FinderTags {
+			planned.setFinderTags(report)
+		}
+		return true
+	}
+
+	// Creates all the directory hierarchy
+	err := os.MkdirAll(filepath.Dir(planned.Destination), options.dirMode())
+	if err != nil {
+		report.fail(planned.name, ErrWriteFailed, err)
+		return false
+	}
+
+	for _, asset := range planned.Assets {
+		source := asset.Source
+		if asset.Remote {
+			source, err = downloader.fetch(ctx, asset.Source)
+			if err != nil {
+				report.warn(planned.name, ErrAssetMissing, fmt.Errorf("remote image '%s' cannot be downloaded: %w", asset.Source, err))
+				continue
+			}
+		}
+
+		kind, shortKind, fileName := "file attachment", "file", filepath.Base(asset.Destination)
+		if asset.Image {
+			kind, shortKind = "embedded image", "image"
+		}
+		if filepath.Dir(asset.Destination) != filepath.Dir(planned.Destination) {
+			err := os.MkdirAll(filepath.Dir(asset.Destination), options.dirMode())
+			if err != nil {
+				report.fail(planned.name, ErrWriteFailed, err)
+				return false
+			}
+		}
+		_, err := os.Stat(asset.Destination)
+		if os.IsNotExist(err) {
+			// Copy the asset only if we don't overwrite an existing one
+			err = options.retry(ctx, report, func() error {
+				return transferAsset(ctx, source, asset.Destination, options.LinkAssets, options.fileMode(), throttle)
+			})
+			if os.IsNotExist(err) {
+				report.warn(planned.name, ErrAssetMissing, fmt.Errorf("source %s '%s' cannot be found", shortKind, fileName))
+			} else if err != nil {
+				report.fail(planned.name, ErrWriteFailed, fmt.Errorf("copy %s -> %s: %w", source, asset.Destination, err))
+				return false
+			} else if info, err := os.Stat(asset.Destination); err == nil {
+				report.BytesCopied += info.Size()
+			}
+		} else if err != nil {
+			report.fail(planned.name, ErrWriteFailed, err)
+			return false
+		} else if same, err := sameContent(source, asset.Destination); err != nil {
+			report.warn(planned.name, ErrAssetConflict, fmt.Errorf("%s '%s' already exists in the target directory %s and cannot be compared: %w", kind, fileName, asset.Destination, err))
+		} else if !same {
+			// Identical assets (from a previous run) are skipped silently
+			report.warn(planned.name, ErrAssetConflict, fmt.Errorf("a different %s '%s' already exists in the target directory %s", kind, fileName, asset.Destination))
+		}
+
+		if asset.Remote {
+			planned.Note.Images[asset.index].Location = planned.link(asset.Destination)
+		}
+	}
+
+	// Write back the updated note
+	err = options.retry(ctx, report, func() error {
+		return writeNote(planned.Destination, planned.Note, options.fileMode())
+	})
+	if err != nil {
+		report.fail(planned.name, ErrWriteFailed, err)
+		return false
+	}
+	if options.FinderTags {
+		planned.setFinderTags(report)
+	}
+
+	// Export the note with pandoc, unless asked otherwise
+	if options.Pandoc {
+		var exporter Exporter = pandocExporter{options.dirMode()}
+		if options.Exporter != nil {
+			exporter = options.Exporter
+		}
+		for _, format := range planned.ExportFormats {
+			err = exporter.Export(planned.Destination, planned.exportDir, format)
+			if err != nil {
+				report.warn(planned.name, ErrExportFailed, err)
+			}
+		}
+	}
+
+	return true
+}
+
+// setFinderTags applies the tags of the migrated note as Finder tags.
+func (planned *PlannedNote) setFinderTags(report *MigrationReport) {
+	if len(planned.Tags) == 0 {
+		return
+	}
+	err := setFinderTags(planned.Destination, planned.Tags)
+	if err != nil {
+		report.warn(planned.name, ErrWriteFailed, fmt.Errorf("finder tags: %w", err))
+	}
+}
+
+// permissionError returns the last error of errs if it is caused by
+// missing permissions, nil otherwise.
+func permissionError(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	last := errs[len(errs)-1]
+	if !errors.Is(last, os.ErrPermission) {
+		return nil
+	}
+	return errors.Unwrap(last)
+}
+
+// link returns the link from the migrated note to the asset at assetPath:
+// relative to the note or, for static sites, absolute from the site root.
+func (planned *PlannedNote) link(assetPath string) string {
+	if planned.siteRoot != "" {
+		link, err := filepath.Rel(planned.siteRoot, assetPath)
+		if err == nil {
+			return "/" + filepath.ToSlash(link)
+		}
+	}
+	return relativeLink(planned.Destination, assetPath)
+}
+
+// relativeLink returns the location of an asset, relative to the note
+// linking to it.
+func relativeLink(notePath string, assetPath string) string {
+	link, err := filepath.Rel(filepath.Dir(notePath), assetPath)
+	if err != nil {
+		return filepath.Base(assetPath)
+	}
+	return filepath.ToSlash(link)
+}
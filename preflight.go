@@ -0,0 +1,169 @@
+package bearnotes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// ErrInsufficientSpace is returned by the pre-flight checks when a destination
+// directory has not enough free space to hold the migrated notes.
+var ErrInsufficientSpace = errors.New("insufficient disk space")
+
+// ErrNestedDirectories is returned when a destination directory is inside
+// the source directory, or the other way around.
+var ErrNestedDirectories = errors.New("source and destination directories are nested")
+
+// canonicalPath returns the absolute path of p, with symbolic links resolved
+// when p exists.
+func canonicalPath(p string) (string, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved, nil
+	}
+	return abs, nil
+}
+
+// isInside returns true if the path child is dir or a subdirectory of dir.
+func isInside(child string, dir string) bool {
+	rel, err := filepath.Rel(dir, child)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// checkConfined returns an error if p, built from a link of a note or from
+// the tag file, is outside of root (../../ path traversal).
+func checkConfined(p string, root string) error {
+	if !isInside(p, root) {
+		return fmt.Errorf("'%s' is outside of '%s'", p, root)
+	}
+	return nil
+}
+
+// checkNesting verifies that no destination directory is inside the source
+// directory (the migration would process its own output) or contains it
+// (assets could be copied onto themselves).
+func checkNesting(from string, destinations []string) error {
+	source, err := canonicalPath(from)
+	if err != nil {
+		return err
+	}
+	for _, dir := range destinations {
+		destination, err := canonicalPath(dir)
+		if err != nil {
+			return err
+		}
+		if isInside(destination, source) || isInside(source, destination) {
+			return fmt.Errorf("%w: %s and %s", ErrNestedDirectories, from, dir)
+		}
+	}
+	return nil
+}
+
+// estimateSize walks through the Bear notes directory and returns the number
+// of bytes that a migration would write (notes, embedded images and file
+// attachments).
+func estimateSize(ctx context.Context, from string) (int64, error) {
+	var total int64
+	assets := make(map[string]bool)
+
+	// addAsset accounts for the size of an asset, only once and only if it exists
+	addAsset := func(p string) {
+		if assets[p] {
+			return
+		}
+		assets[p] = true
+		info, err := os.Stat(p)
+		if err == nil && info.Mode().IsRegular() {
+			total += info.Size()
+		}
+	}
+
+	err := filepath.Walk(from,
+		func(p string, info os.FileInfo, err error) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			// Errors are reported during the migration, not here
+			if err != nil || info.IsDir() || !strings.HasSuffix(info.Name(), ".md") {
+				return nil
+			}
+
+			content, err := ioutil.ReadFile(p)
+			if err != nil {
+				return nil
+			}
+			total += info.Size()
+
+			note := LoadNoteBytes(content)
+			noteName := strings.TrimSuffix(info.Name(), ".md")
+			for _, image := range note.Images {
+				if !isRemote(image.Location) {
+					addAsset(filepath.Join(from, norm.NFC.String(image.Location)))
+				}
+			}
+			for _, file := range note.Files {
+				addAsset(filepath.Join(from, noteName, norm.NFC.String(file.Location)))
+			}
+
+			return nil
+		})
+
+	return total, err
+}
+
+// checkWritable creates the destination directory if needed (with the
+// permissions dirMode) and verifies that a file can be created in it.
+func checkWritable(dir string, dirMode os.FileMode) error {
+	err := os.MkdirAll(dir, dirMode)
+	if err != nil {
+		return err
+	}
+
+	fd, err := ioutil.TempFile(dir, ".bearnotes-preflight")
+	if err != nil {
+		return err
+	}
+	fd.Close()
+
+	return os.Remove(fd.Name())
+}
+
+// preflight verifies, before copying anything, that all the destination
+// directories are writable and have enough free space to hold the migrated
+// notes. Missing destination directories are created with the permissions
+// dirMode.
+func preflight(ctx context.Context, from string, destinations []string, dirMode os.FileMode) error {
+	size, err := estimateSize(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range destinations {
+		err := checkWritable(dir, dirMode)
+		if err != nil {
+			return fmt.Errorf("destination %s is not writable: %w", dir, err)
+		}
+
+		free, err := freeSpace(dir)
+		if err != nil {
+			return fmt.Errorf("cannot compute free space of %s: %w", dir, err)
+		}
+
+		// A negative value means free space is unknown on this platform
+		if free >= 0 && free < size {
+			return fmt.Errorf("%w: %s has %d bytes available but the migration requires %d bytes", ErrInsufficientSpace, dir, free, size)
+		}
+	}
+
+	return nil
+}
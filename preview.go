@@ -0,0 +1,227 @@
+package bearnotes
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines around the changes of a
+// unified diff
+const diffContext = 3
+
+// maxDiffCells is the maximum size of the table of the longest common
+// subsequence (8 MB). Beyond, the changed lines are replaced as a whole.
+const maxDiffCells = 1 << 20
+
+// diffLine is a line of a diff: an unchanged (' '), removed ('-') or
+// added ('+') line.
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// Preview writes a unified diff between the Bear notes whose name or path
+// (relative to the notes directory) matches one of the patterns (see
+// filepath.Match) and their rewritten content, so that the rewriting of
+// tags and links can be reviewed before executing the plan. It returns the
+// number of notes matching the patterns.
+func (plan *Plan) Preview(w io.Writer, patterns []string) (int, error) {
+	err := checkTracePatterns(patterns)
+	if err != nil {
+		return 0, err
+	}
+
+	var matched int
+	var buf bytes.Buffer
+	for _, planned := range plan.Notes {
+		relPath, _ := filepath.Rel(plan.From, planned.Source)
+		if !matchesPattern(patterns, relPath) {
+			continue
+		}
+		matched++
+
+		original, err := readNoteFile(planned.Source, &buf)
+		if err != nil {
+			return matched, err
+		}
+		rewritten, err := planned.Note.WriteNote()
+		if err != nil {
+			return matched, err
+		}
+		err = writeUnifiedDiff(w, planned.Source, planned.Destination, string(original), rewritten)
+		if err != nil {
+			return matched, err
+		}
+	}
+	return matched, nil
+}
+
+// splitLines splits s into lines, keeping their line ending.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns the shortest edit script turning a into b, computed
+// from their longest common subsequence. The common prefix and suffix are
+// left out of the computation, since rewrites seldom change many lines.
+// Lines changed over a region too large for the table of the longest
+// common subsequence (see maxDiffCells) are all removed, then added.
+func diffLines(a, b []string) []diffLine {
+	var prefix, suffix int
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	middleA, middleB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	var lines []diffLine
+	for _, line := range a[:prefix] {
+		lines = append(lines, diffLine{' ', line})
+	}
+	if (len(middleA)+1)*(len(middleB)+1) > maxDiffCells {
+		for _, line := range middleA {
+			lines = append(lines, diffLine{'-', line})
+		}
+		for _, line := range middleB {
+			lines = append(lines, diffLine{'+', line})
+		}
+	} else {
+		lines = append(lines, diffMiddle(middleA, middleB)...)
+	}
+	for _, line := range a[len(a)-suffix:] {
+		lines = append(lines, diffLine{' ', line})
+	}
+	return lines
+}
+
+// diffMiddle returns the shortest edit script turning a into b, computed
+// from their longest common subsequence (see diffLines).
+func diffMiddle(a, b []string) []diffLine {
+	// lcs[i][j] is the length of the longest common subsequence of
+	// a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		}
+	}
+	return lines
+}
+
+// writeUnifiedDiff writes the differences between a and b in the unified
+// format, nothing if they are identical.
+func writeUnifiedDiff(w io.Writer, fromName string, toName string, a string, b string) error {
+	if a == b {
+		return nil
+	}
+	lines := diffLines(splitLines(a), splitLines(b))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+	lineA, lineB := 1, 1 // Line numbers of lines[start] in a and b
+	for start := 0; start < len(lines); {
+		// Skip the unchanged lines until the next change
+		if lines[start].op == ' ' {
+			lineA++
+			lineB++
+			start++
+			continue
+		}
+
+		// Extend the hunk while changes are closer than twice the context
+		end := start
+		for unchanged := 0; end < len(lines) && unchanged <= 2*diffContext; end++ {
+			if lines[end].op == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+		}
+		for end > start && lines[end-1].op == ' ' {
+			end--
+		}
+
+		// Add the context around the changes
+		first := start - diffContext
+		if first < 0 {
+			first = 0
+		}
+		last := end + diffContext
+		if last > len(lines) {
+			last = len(lines)
+		}
+		hunkA, hunkB := lineA-(start-first), lineB-(start-first)
+		var countA, countB int
+		for _, line := range lines[first:last] {
+			if line.op != '+' {
+				countA++
+			}
+			if line.op != '-' {
+				countB++
+			}
+		}
+		// Empty ranges start at the line before them
+		if countA == 0 {
+			hunkA--
+		}
+		if countB == 0 {
+			hunkB--
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", hunkA, countA, hunkB, countB)
+		for _, line := range lines[first:last] {
+			out.WriteByte(line.op)
+			out.WriteString(line.text)
+			if !strings.HasSuffix(line.text, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		for _, line := range lines[start:last] {
+			if line.op != '+' {
+				lineA++
+			}
+			if line.op != '-' {
+				lineB++
+			}
+		}
+		start = last
+	}
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
@@ -0,0 +1,86 @@
+package bearnotes
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Profile bundles sensible defaults for a target application, so that a
+// working migration does not require to learn every option.
+type Profile struct {
+	// Name of the profile, as used on the command line
+	Name string
+
+	// Transforms holds the names of the transforms to apply (see LookupTransforms)
+	Transforms []string
+
+	// Directories specifies how default target directories are generated
+	Directories DirectoryOptions
+
+	// Layout of the target directory (see MigrateOptions.Layout)
+	Layout string
+}
+
+// profiles holds all the target application profiles.
+var profiles = map[string]Profile{
+	// Bear notes, as-is
+	"generic": {
+		Name: "generic",
+	},
+	// Zettlr understands highlights but neither Bear multi-word tags nor {{TOC}}.
+	// It renders the alternative text of images as a caption (pandoc).
+	"zettlr": {
+		Name:       "zettlr",
+		Transforms: []string{"highlights", "tasks", "headings", "tag-style", "separators", "strip-toc", "captions"},
+	},
+	// Obsidian has the same syntax as Zettlr for highlights and tags,
+	// but captions need HTML figures
+	"obsidian": {
+		Name:       "obsidian",
+		Transforms: []string{"highlights", "tasks", "headings", "tag-style", "separators", "strip-toc", "captions-html"},
+	},
+	// Logseq stores all pages in a single directory
+	"logseq": {
+		Name:        "logseq",
+		Transforms:  []string{"highlights", "tasks", "tag-style", "separators", "strip-toc"},
+		Directories: DirectoryOptions{Flatten: true, Slugify: true},
+	},
+	// Notable (and Typora) keep notes and attachments in two directories
+	"notable": {
+		Name:       "notable",
+		Transforms: []string{"highlights", "tasks", "headings", "separators", "strip-toc", "captions-html"},
+		Layout:     LayoutNotable,
+	},
+	// Static site generators render captions from the alternative text
+	// and ignore raw HTML by default (Hugo)
+	"hugo": {
+		Name:       "hugo",
+		Transforms: []string{"tasks", "headings", "separators", "strip-toc", "captions"},
+		Layout:     LayoutHugo,
+	},
+	"jekyll": {
+		Name:       "jekyll",
+		Transforms: []string{"tasks", "headings", "separators", "strip-toc", "captions"},
+		Layout:     LayoutJekyll,
+	},
+}
+
+// ProfileNames returns the names of all the available profiles, sorted.
+func ProfileNames() []string {
+	var names []string
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupProfile returns the profile having the given name.
+func LookupProfile(name string) (Profile, error) {
+	profile, ok := profiles[strings.ToLower(name)]
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown profile '%s' (available profiles: %s)", name, strings.Join(ProfileNames(), ", "))
+	}
+	return profile, nil
+}
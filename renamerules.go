@@ -0,0 +1,90 @@
+package bearnotes
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// renameRulesEntry is the entry of the settings of the tag file (see
+// settingsEntry) holding the rename rules.
+const renameRulesEntry = "rename_rules"
+
+// RenameRule renames the tags whose name matches a regular expression,
+// before they are looked up in the tag file, so that a large taxonomy can be
+// reshaped with a handful of rules instead of an entry per tag:
+//
+//  _settings:
+//    rename_rules:
+//      - pattern: ^people/(.*)$
+//        replacement: contacts/$1
+//
+// Patterns are matched against the tag names as looked up in the tag file
+// (lowercase, unless tags are case-sensitive) and the replacement may refer
+// to the submatches of the pattern ($1, ${name}, see regexp.Expand). Only
+// the first matching rule applies.
+type RenameRule struct {
+	Pattern     string `yaml:"pattern"`
+	Replacement string `yaml:"replacement"`
+}
+
+// LoadRenameRules reads the rename rules of a tag configuration file.
+// Tag files in CSV format have no rename rules.
+func LoadRenameRules(tagFile string) ([]RenameRule, error) {
+	var rules []RenameRule
+	err := loadSettingsEntry(tagFile, renameRulesEntry, &rules)
+	return rules, err
+}
+
+// tagRenamer applies compiled rename rules to the tags of the notes.
+type tagRenamer []compiledRenameRule
+
+// compiledRenameRule is a RenameRule whose pattern has been compiled.
+type compiledRenameRule struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// newTagRenamer compiles the rename rules, returning an error if a pattern
+// is not a valid regular expression.
+func newTagRenamer(rules []RenameRule) (tagRenamer, error) {
+	var renamer tagRenamer
+	for i, rule := range rules {
+		if rule.Pattern == "" {
+			return nil, fmt.Errorf("rename rule %d: no pattern", i+1)
+		}
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rename rule %d: %w", i+1, err)
+		}
+		renamer = append(renamer, compiledRenameRule{pattern: pattern, replacement: rule.Replacement})
+	}
+	return renamer, nil
+}
+
+// rename returns the new name of a tag (as looked up in the tag file, see
+// tagKey) according to the first matching rule, and whether a rule matched.
+func (renamer tagRenamer) rename(tagName string) (string, bool) {
+	for _, rule := range renamer {
+		match := rule.pattern.FindStringSubmatchIndex(tagName)
+		if match == nil {
+			continue
+		}
+		var name []byte
+		name = rule.pattern.ExpandString(name, rule.replacement, tagName, match)
+		return tagName[:match[0]] + string(name) + tagName[match[1]:], true
+	}
+	return tagName, false
+}
+
+// renameTags renames the tags matching a rule, in place, and returns their
+// names before renaming.
+func (renamer tagRenamer) renameTags(tags []Tag, caseSensitive bool) []string {
+	original := make([]string, len(tags))
+	for i, tag := range tags {
+		original[i] = tag.Name
+		if name, ok := renamer.rename(tagKey(tag.Name, caseSensitive)); ok {
+			tags[i].Name = name
+		}
+	}
+	return original
+}
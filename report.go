@@ -0,0 +1,57 @@
+package bearnotes
+
+// MigrationReport summarizes the outcome of a migration.
+type MigrationReport struct {
+	Notes        int     // Number of notes processed
+	Successes    int     // Number of notes successfully migrated
+	Skipped      int     // Number of notes skipped (duplicates or overrides)
+	Unclassified int     // Number of notes whose tags are all ignored
+	Retries      int     // Number of retried writes (transient errors)
+	HTMLRemoved  int     // Number of HTML elements and entities removed (strip-html)
+	BytesCopied  int64   // Size of the images and file attachments transferred
+	Errors       []error // Errors that prevented a note from being migrated
+	Warnings     []error // Issues that did not prevent a note from being migrated
+
+	// RenamedTags maps the tags, as written in the notes (original case),
+	// to their new name ("" when removed)
+	RenamedTags map[string]string
+
+	// UnusedTags lists the entries of the tag file matching no tag of the
+	// notes, and UnusedDirectories the target directories of the tag file
+	// receiving no note, so that the tag file can be pruned
+	UnusedTags        []string
+	UnusedDirectories []string
+
+	// SimilarImages holds the groups of visually identical images among
+	// the migrated images (see MigrateOptions.SimilarImages)
+	SimilarImages []ImageCluster
+
+	log *migrationLogger // Receives the errors and warnings, as they occur
+}
+
+// Failures returns the number of notes that could not be migrated.
+func (report *MigrationReport) Failures() int {
+	return report.Notes - report.Successes
+}
+
+// renameTag records that the tag named from (original case) has been renamed.
+func (report *MigrationReport) renameTag(from string, to string) {
+	if report.RenamedTags == nil {
+		report.RenamedTags = make(map[string]string)
+	}
+	report.RenamedTags[from] = to
+}
+
+// fail logs and records an error that prevented a note from being migrated.
+func (report *MigrationReport) fail(note string, kind error, err error) {
+	e := &NoteError{Note: note, Kind: kind, Err: err}
+	report.log.Printf("ERROR: %s\n", e)
+	report.Errors = append(report.Errors, e)
+}
+
+// warn logs and records an issue that did not prevent a note from being migrated.
+func (report *MigrationReport) warn(note string, kind error, err error) {
+	e := &NoteError{Note: note, Kind: kind, Err: err}
+	report.log.Printf("WARNING: %s\n", e)
+	report.Warnings = append(report.Warnings, e)
+}
@@ -0,0 +1,49 @@
+package bearnotes
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Default settings of the retries (see MigrateOptions.Retries)
+const defaultRetryDelay = 500 * time.Millisecond
+
+// isTransient returns true if err is likely to disappear when retried,
+// as the busy or timeout errors of network and cloud drives.
+func isTransient(err error) bool {
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		switch errno {
+		case syscall.EBUSY, syscall.ETIMEDOUT, syscall.EAGAIN, syscall.EINTR, syscall.EIO:
+			return true
+		}
+	}
+	return os.IsTimeout(err)
+}
+
+// retry calls f until it succeeds or fails with an error that is not
+// transient, at most options.Retries more times. The delay between two
+// attempts starts at options.RetryDelay and doubles each time. Retries are
+// counted in the report.
+func (options MigrateOptions) retry(ctx context.Context, report *MigrationReport, f func() error) error {
+	delay := options.RetryDelay
+	if delay <= 0 {
+		delay = defaultRetryDelay
+	}
+	err := f()
+	for attempt := 0; attempt < options.Retries && err != nil && isTransient(err); attempt++ {
+		options.log.Printf("WARNING: %s, retrying in %s...\n", err, delay)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		report.Retries++
+		delay *= 2
+		err = f()
+	}
+	return err
+}
@@ -0,0 +1,333 @@
+package bearnotes
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Arrow keys, as given to Review.HandleKey (from the private use area of
+// Unicode, as macOS does). Terminals send them as escape sequences, to be
+// translated by the caller.
+const (
+	KeyUp    = '\uF700'
+	KeyDown  = '\uF701'
+	KeyRight = '\uF702'
+	KeyLeft  = '\uF703'
+)
+
+// ReviewOutcome tells whether a review goes on, or how it ended (see
+// Review.HandleKey).
+type ReviewOutcome int
+
+// Outcomes of a review
+const (
+	// ReviewPending waits for the next key
+	ReviewPending ReviewOutcome = iota
+
+	// ReviewSaved ends the review, the overrides are to be saved
+	ReviewSaved
+
+	// ReviewAbandoned ends the review, the overrides are to be discarded
+	ReviewAbandoned
+)
+
+// reviewNode is a directory or a note of the tree of planned destinations.
+type reviewNode struct {
+	name     string
+	note     *PlannedNote // nil for directories
+	source   string       // Path of the note, relative to the Bear notes directory
+	children []*reviewNode
+	expanded bool
+	depth    int
+}
+
+// notes returns the notes of the node and of its children.
+func (node *reviewNode) notes() []*reviewNode {
+	if node.note != nil {
+		return []*reviewNode{node}
+	}
+	var notes []*reviewNode
+	for _, child := range node.children {
+		notes = append(notes, child.notes()...)
+	}
+	return notes
+}
+
+// child returns the directory of the node having the given name, created
+// if needed.
+func (node *reviewNode) child(name string) *reviewNode {
+	for _, child := range node.children {
+		if child.note == nil && child.name == name {
+			return child
+		}
+	}
+	child := &reviewNode{name: name, depth: node.depth + 1}
+	node.children = append(node.children, child)
+	return child
+}
+
+// sort sorts the children of the node, directories first.
+func (node *reviewNode) sort() {
+	sort.Slice(node.children, func(i, j int) bool {
+		a, b := node.children[i], node.children[j]
+		if (a.note == nil) != (b.note == nil) {
+			return a.note == nil
+		}
+		return a.name < b.name
+	})
+	for _, child := range node.children {
+		child.sort()
+	}
+}
+
+// Review lists the planned destinations of the notes in a tree, to be
+// reviewed in a terminal: the keys of the user skip notes or change their
+// target directory, and the adjustments are recorded in overrides. The
+// terminal itself (raw mode, escape sequences) is left to the caller.
+type Review struct {
+	overrides Overrides
+	root      *reviewNode
+	rows      []*reviewNode // Visible rows
+	cursor    int
+	offset    int    // First visible row
+	editing   bool   // Whether the target directory is being edited
+	input     []rune // Target directory being edited
+}
+
+// NewReview builds the tree of the planned destinations of the plan,
+// relative to its destination directory. The plan is expected to be made
+// without overrides, so that skipped notes are listed and overridden
+// target directories can be restored.
+func NewReview(plan *Plan, overrides Overrides) *Review {
+	root := &reviewNode{name: plan.To, expanded: true, depth: -1}
+	for _, planned := range plan.Notes {
+		destination, err := filepath.Rel(plan.To, planned.Destination)
+		if err != nil || strings.HasPrefix(destination, "..") {
+			destination = planned.Destination
+		}
+		node := root
+		components := strings.Split(filepath.ToSlash(destination), "/")
+		for _, component := range components[:len(components)-1] {
+			if component != "" {
+				node = node.child(component)
+			}
+		}
+		node.children = append(node.children, &reviewNode{
+			name:   components[len(components)-1],
+			note:   planned,
+			source: plan.RelativePath(planned),
+			depth:  node.depth + 1,
+		})
+	}
+	root.sort()
+	r := &Review{overrides: overrides, root: root}
+	r.refresh()
+	return r
+}
+
+// refresh computes the visible rows of the tree.
+func (r *Review) refresh() {
+	r.rows = nil
+	var walk func(node *reviewNode)
+	walk = func(node *reviewNode) {
+		for _, child := range node.children {
+			r.rows = append(r.rows, child)
+			if child.expanded {
+				walk(child)
+			}
+		}
+	}
+	walk(r.root)
+	if r.cursor >= len(r.rows) {
+		r.cursor = len(r.rows) - 1
+	}
+	if r.cursor < 0 {
+		r.cursor = 0
+	}
+}
+
+// label returns the text of a row.
+func (r *Review) label(node *reviewNode) string {
+	indent := strings.Repeat("  ", node.depth)
+	if node.note == nil {
+		marker := "+"
+		if node.expanded {
+			marker = "-"
+		}
+		notes := node.notes()
+		var skipped int
+		for _, note := range notes {
+			if r.overrides[note.source].Skip {
+				skipped++
+			}
+		}
+		label := fmt.Sprintf("%s%s %s/ (%d notes", indent, marker, node.name, len(notes))
+		if skipped > 0 {
+			label += fmt.Sprintf(", %d skipped", skipped)
+		}
+		return label + ")"
+	}
+	override := r.overrides[node.source]
+	label := indent + "  " + node.name
+	if override.Skip {
+		label = indent + "x " + node.name + " (skipped)"
+	}
+	if override.TargetDirectory != "" && override.TargetDirectory != node.note.TargetDirectory {
+		label += " -> " + override.TargetDirectory
+	}
+	return label
+}
+
+// Render returns the screen of the review, for a terminal of the given
+// height: the help line, the visible rows (the current one highlighted)
+// and the target directory being edited, if any. Lines end with "\r\n",
+// as expected by a terminal in raw mode.
+func (r *Review) Render(height int) string {
+	rows := height - 3
+	if rows < 1 {
+		rows = 1
+	}
+	if r.cursor < r.offset {
+		r.offset = r.cursor
+	} else if r.cursor >= r.offset+rows {
+		r.offset = r.cursor - rows + 1
+	}
+
+	var screen strings.Builder
+	screen.WriteString("Migration plan: up/down move, left/right fold, space skip, e change target directory, w save, q quit\r\n\r\n")
+	for i := r.offset; i < len(r.rows) && i < r.offset+rows; i++ {
+		if i == r.cursor {
+			screen.WriteString("\x1b[7m" + r.label(r.rows[i]) + "\x1b[0m\r\n")
+		} else {
+			screen.WriteString(r.label(r.rows[i]) + "\r\n")
+		}
+	}
+	if r.editing {
+		screen.WriteString("Target directory: " + string(r.input))
+	}
+	return screen.String()
+}
+
+// toggleSkip skips the notes of the current row or, if they are all
+// skipped already, migrates them again.
+func (r *Review) toggleSkip() {
+	notes := r.rows[r.cursor].notes()
+	skip := false
+	for _, note := range notes {
+		if !r.overrides[note.source].Skip {
+			skip = true
+		}
+	}
+	for _, note := range notes {
+		override := r.overrides[note.source]
+		override.Skip = skip
+		r.overrides[note.source] = override
+	}
+}
+
+// editTargetDirectory starts editing the target directory of the notes of
+// the current row, from the target directory of the note, if the row is a
+// note.
+func (r *Review) editTargetDirectory() {
+	node := r.rows[r.cursor]
+	r.editing = true
+	r.input = nil
+	if node.note != nil {
+		r.input = []rune(r.overrides[node.source].TargetDirectory)
+		if len(r.input) == 0 {
+			r.input = []rune(node.note.TargetDirectory)
+		}
+	}
+}
+
+// setTargetDirectory records the edited target directory for the notes of
+// the current row. An empty target directory restores the target directory
+// of their tags.
+func (r *Review) setTargetDirectory() {
+	targetDirectory := strings.TrimSpace(string(r.input))
+	for _, note := range r.rows[r.cursor].notes() {
+		override := r.overrides[note.source]
+		override.TargetDirectory = targetDirectory
+		if override.TargetDirectory == note.note.TargetDirectory {
+			override.TargetDirectory = ""
+		}
+		r.overrides[note.source] = override
+	}
+}
+
+// handleEditKey handles a key while the target directory is edited: Enter
+// records it, Escape cancels.
+func (r *Review) handleEditKey(key rune) {
+	switch key {
+	case '\x1b', '\x03':
+		r.editing = false
+	case '\r', '\n':
+		r.setTargetDirectory()
+		r.editing = false
+	case '\x7f', '\b':
+		if len(r.input) > 0 {
+			r.input = r.input[:len(r.input)-1]
+		}
+	case KeyUp, KeyDown, KeyRight, KeyLeft:
+	default:
+		if key >= ' ' {
+			r.input = append(r.input, key)
+		}
+	}
+}
+
+// HandleKey applies a key of the user (arrow keys or h/j/k/l move and
+// fold, space skips, e edits the target directory, w saves and q quits)
+// and returns whether the review goes on.
+func (r *Review) HandleKey(key rune) ReviewOutcome {
+	if r.editing {
+		r.handleEditKey(key)
+		return ReviewPending
+	}
+	switch key {
+	case 'w':
+		return ReviewSaved
+	case 'q', '\x03':
+		return ReviewAbandoned
+	}
+	if len(r.rows) == 0 {
+		return ReviewPending
+	}
+
+	switch key {
+	case KeyUp, 'k':
+		if r.cursor > 0 {
+			r.cursor--
+		}
+	case KeyDown, 'j':
+		if r.cursor < len(r.rows)-1 {
+			r.cursor++
+		}
+	case KeyRight, 'l', '\r', '\n':
+		node := r.rows[r.cursor]
+		if node.note == nil {
+			node.expanded = key == KeyRight || key == 'l' || !node.expanded
+		}
+	case KeyLeft, 'h':
+		node := r.rows[r.cursor]
+		if node.note == nil && node.expanded {
+			node.expanded = false
+		} else {
+			// Moves to the parent directory
+			for i := r.cursor - 1; i >= 0; i-- {
+				if r.rows[i].depth < node.depth {
+					r.cursor = i
+					break
+				}
+			}
+		}
+	case ' ':
+		r.toggleSkip()
+	case 'e':
+		r.editTargetDirectory()
+	}
+	r.refresh()
+	return ReviewPending
+}
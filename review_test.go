@@ -0,0 +1,109 @@
+package bearnotes
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// planReview plans the migration of a few notes and opens their review. The
+// source and destination directories are returned, to be removed.
+func planReview(t *testing.T, overrides Overrides) (*Review, string, string) {
+	from := writeTestFiles(t, map[string]string{
+		"meeting.md":     "#work\n",
+		"report.md":      "#work\n",
+		"Drafts/idea.md": "No tag here\n",
+	})
+	to := writeTestFiles(t, map[string]string{
+		"tags.yaml": "work:\n  handling_strategy: same-folder\n  target_directory: work\n  target_tag_name: work\n",
+	})
+
+	plan, err := PlanMigration(context.Background(), from, filepath.Join(to, "notes"), filepath.Join(to, "tags.yaml"), MigrateOptions{})
+	assert.NoError(t, err, "migration must be planned")
+	return NewReview(plan, overrides), from, to
+}
+
+// rows returns the rows rendered by the review, the current one marked
+// with a '>'.
+func rows(review *Review) []string {
+	lines := strings.Split(review.Render(24), "\r\n")
+	var rows []string
+	for _, line := range lines[2 : len(lines)-1] {
+		if strings.HasPrefix(line, "\x1b[7m") {
+			line = ">" + strings.TrimSuffix(strings.TrimPrefix(line, "\x1b[7m"), "\x1b[0m")
+		}
+		rows = append(rows, line)
+	}
+	return rows
+}
+
+func TestReviewRender(t *testing.T) {
+	review, from, to := planReview(t, Overrides{})
+	defer os.RemoveAll(from)
+	defer os.RemoveAll(to)
+	assert.Equal(t, []string{">+ work/ (2 notes)", "  idea.md"}, rows(review), "directories must be listed first, folded")
+
+	review.HandleKey(KeyRight)
+	assert.Equal(t, []string{">- work/ (2 notes)", "    meeting.md", "    report.md", "  idea.md"}, rows(review), "directories must unfold")
+	review.HandleKey(KeyDown)
+	review.HandleKey(KeyLeft)
+	assert.Equal(t, []string{">- work/ (2 notes)", "    meeting.md", "    report.md", "  idea.md"}, rows(review), "left must move to the parent directory")
+	review.HandleKey(KeyLeft)
+	assert.Equal(t, []string{">+ work/ (2 notes)", "  idea.md"}, rows(review), "left must fold directories")
+
+	review.HandleKey('l')
+	for i := 0; i < 5; i++ {
+		review.HandleKey('j')
+	}
+	screen := review.Render(5)
+	assert.NotContains(t, screen, "work/", "rows must scroll to the current row")
+	assert.Contains(t, screen, "\x1b[7m  idea.md\x1b[0m", "the current row must be highlighted")
+}
+
+func TestReviewOverrides(t *testing.T) {
+	overrides := Overrides{}
+	review, from, to := planReview(t, overrides)
+	defer os.RemoveAll(from)
+	defer os.RemoveAll(to)
+
+	// Skipping a directory skips its notes, twice migrates them again
+	review.HandleKey(' ')
+	assert.Equal(t, Overrides{"meeting.md": {Skip: true}, "report.md": {Skip: true}}, overrides, "the notes of the directory must be skipped")
+	assert.Equal(t, ">+ work/ (2 notes, 2 skipped)", rows(review)[0], "skipped notes must be counted")
+	review.HandleKey(' ')
+	assert.Equal(t, Overrides{"meeting.md": {}, "report.md": {}}, overrides, "the notes of the directory must be migrated again")
+
+	// The target directory of a note is edited from its current value
+	review.HandleKey('j')
+	assert.Equal(t, ReviewPending, review.HandleKey('e'), "the review must go on")
+	assert.Contains(t, review.Render(24), "Target directory: ", "the target directory must be edited")
+	for _, key := range "ideas" {
+		review.HandleKey(key)
+	}
+	review.HandleKey('\x7f')
+	review.HandleKey(KeyUp)
+	assert.True(t, strings.HasSuffix(review.Render(24), "Target directory: idea"), "keys must edit the target directory")
+	review.HandleKey('\r')
+	assert.Equal(t, "idea", overrides["Drafts/idea.md"].TargetDirectory, "the target directory must be recorded")
+	assert.Equal(t, ">  idea.md -> idea", rows(review)[1], "the target directory must be shown")
+
+	// Escape cancels, an empty target directory restores the one of the tags
+	review.HandleKey('e')
+	review.HandleKey('x')
+	review.HandleKey('\x1b')
+	assert.Equal(t, "idea", overrides["Drafts/idea.md"].TargetDirectory, "escape must cancel the edition")
+	review.HandleKey('e')
+	for i := 0; i < 4; i++ {
+		review.HandleKey('\b')
+	}
+	review.HandleKey('\n')
+	assert.Equal(t, NoteOverride{}, overrides["Drafts/idea.md"], "the target directory must be restored")
+
+	assert.Equal(t, ReviewSaved, review.HandleKey('w'), "w must save the overrides")
+	assert.Equal(t, ReviewAbandoned, review.HandleKey('q'), "q must abandon the review")
+	assert.Equal(t, ReviewAbandoned, review.HandleKey('\x03'), "Ctrl-C must abandon the review")
+}
@@ -0,0 +1,175 @@
+package bearnotes
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// noteRouting holds the directives computed from the tags of a note.
+type noteRouting struct {
+	targetDirectory  string
+	handlingStrategy HandlingStrategy
+	vault            string
+	exportFormats    []string
+	assetDirectories map[string]string // Asset directory rules, by asset type
+	tags             []string          // Names of the rewritten tags, without duplicates
+	sourceTags       []string          // Names of the kept tags before their rewriting (full paths), without duplicates
+	allIgnored       bool              // Whether the note has tags, all of them ignored
+}
+
+// applyTagOptions rewrites the tags of the note as instructed by the tag
+// options and computes the target directory, handling strategy and vault of
+// the note. An error is returned if a tag of the note is not present in tags,
+// either explicitly, through a wildcard entry or through the defaults entry.
+//
+// Since a note can have multiple tags, the first tag that defines a valid (non-empty)
+// target directory and/or handling strategy sets the value.
+// If another one specifies a different value, we issue a warning to logger.
+// The same goes for each front matter field, which is added to the note.
+//
+// Size rules of the tags are applied before, based on the size of the note.
+//
+// Tags are looked up case-insensitively, unless caseSensitive is true.
+func applyTagOptions(note *Note, tags map[string]TagOptions, caseSensitive bool, logger *migrationLogger) (noteRouting, error) {
+	var routing noteRouting
+	var considered, ignored int
+	words, characters := noteSize(note.content)
+	for i, tag := range note.Tags {
+		tagName := tagKey(tag.Name, caseSensitive)
+
+		// Tags starting with a digit are prone to false positives,
+		// so they are only considered when present in the tag file
+		tagOption, ok := lookupTagOptions(tags, tagName, !tag.isNumeric())
+		if !ok && tag.isNumeric() {
+			continue
+		}
+		if !ok {
+			return routing, fmt.Errorf("'%s' (re-run the discover command)", tagName)
+		}
+
+		tagOption = tagOption.withSizeRules(words, characters)
+
+		considered++
+		if tagOption.Ignore {
+			ignored++
+			continue
+		}
+
+		// Rewrite the tag name as instructed
+		if tagOption.TargetTagName != "" && !containsString(routing.sourceTags, tag.Name) {
+			routing.sourceTags = append(routing.sourceTags, tag.Name)
+		}
+		note.Tags[i].Name = tagOption.TargetTagName
+		if tagOption.TargetTagName != "" && !containsString(routing.tags, tagOption.TargetTagName) {
+			routing.tags = append(routing.tags, tagOption.TargetTagName)
+		}
+
+		if tagOption.TargetDirectory != "" && routing.targetDirectory != "" && routing.targetDirectory != tagOption.TargetDirectory {
+			logger.Printf("WARNING: Target directory '%s' for tag '%s' conflict with directives (%s) from another tag. Continuing with existing value.\n", tagOption.TargetDirectory, tagName, routing.targetDirectory)
+		} else if routing.targetDirectory == "" {
+			routing.targetDirectory = tagOption.TargetDirectory
+		}
+
+		if tagOption.HandlingStrategy != "" && routing.handlingStrategy != "" && routing.handlingStrategy != tagOption.HandlingStrategy {
+			logger.Printf("WARNING: Handling strategy '%s' for tag '%s' conflict with directives (%s) from another tag. Continuing with existing value.\n", tagOption.HandlingStrategy, tagName, routing.handlingStrategy)
+		} else if routing.handlingStrategy == "" {
+			if tagOption.HandlingStrategy.known() {
+				routing.handlingStrategy = tagOption.HandlingStrategy
+			} else {
+				logger.Printf("WARNING: Unknown handling strategy '%s' for tag '%s'.\n", tagOption.HandlingStrategy, tagName)
+			}
+		}
+
+		// Export formats of all tags are combined
+		for _, format := range tagOption.ExportFormats {
+			if !containsString(routing.exportFormats, format) {
+				routing.exportFormats = append(routing.exportFormats, format)
+			}
+		}
+
+		// Front matter fields are added to the note
+		for key, value := range tagOption.FrontMatter {
+			if existing, ok := note.FrontMatter[key]; ok && existing != value {
+				logger.Printf("WARNING: Front matter field '%s: %s' for tag '%s' conflict with directives (%s) from another tag. Continuing with existing value.\n", key, value, tagName, existing)
+			} else if !ok {
+				if note.FrontMatter == nil {
+					note.FrontMatter = make(map[string]string)
+				}
+				note.FrontMatter[key] = value
+			}
+		}
+
+		// Asset directory rules are combined, by asset type
+		for kind, dir := range tagOption.AssetDirectories {
+			if existing, ok := routing.assetDirectories[kind]; ok && existing != dir {
+				logger.Printf("WARNING: Asset directory '%s: %s' for tag '%s' conflict with directives (%s) from another tag. Continuing with existing value.\n", kind, dir, tagName, existing)
+			} else if !ok {
+				if routing.assetDirectories == nil {
+					routing.assetDirectories = make(map[string]string)
+				}
+				routing.assetDirectories[kind] = dir
+			}
+		}
+
+		if tagOption.Vault != "" && routing.vault != "" && routing.vault != tagOption.Vault {
+			logger.Printf("WARNING: Vault '%s' for tag '%s' conflict with directives (%s) from another tag. Continuing with existing value.\n", tagOption.Vault, tagName, routing.vault)
+		} else if routing.vault == "" {
+			routing.vault = tagOption.Vault
+		}
+	}
+
+	routing.allIgnored = considered > 0 && ignored == considered
+	return routing, nil
+}
+
+// tagKey returns the key of a tag in the tag configuration. Tag names are
+// normalized to prevent file not found errors because of Unicode encoding,
+// and made lowercase (since all tags are lower-case in Bear) unless
+// caseSensitive is true.
+func tagKey(name string, caseSensitive bool) string {
+	name = norm.NFC.String(name)
+	if caseSensitive {
+		return name
+	}
+	return strings.ToLower(name)
+}
+
+// folderTag returns the pseudo-tag derived from the parent folder of the
+// note at relPath (relative to the notes directory), for the notes exported
+// by tag into subfolders. Notes at the root of the directory have none.
+func folderTag(relPath string) (Tag, bool) {
+	dir := filepath.ToSlash(filepath.Dir(relPath))
+	if dir == "." {
+		return Tag{}, false
+	}
+	return Tag{Name: norm.NFC.String(dir)}, true
+}
+
+// containsString returns true if s is in list.
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ConvertNote converts a Bear note to a format suitable for Zettlr, rewriting
+// its tags as instructed by the tag options (when tags is not nil).
+//
+// Unlike MigrateNotes, it does not access the filesystem: embedded images and
+// file attachments are left where they are.
+func ConvertNote(content []byte, tags map[string]TagOptions) (string, error) {
+	note := LoadNoteBytes(content)
+	if tags != nil {
+		_, err := applyTagOptions(note, tags, false, nil)
+		if err != nil {
+			return "", fmt.Errorf("%w: %s", ErrUnknownTag, err)
+		}
+	}
+	return note.WriteNote()
+}
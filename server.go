@@ -0,0 +1,199 @@
+package bearnotes
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Default settings of the HTTP API server
+const (
+	defaultMaxNoteSize   = 10 * 1024 * 1024
+	defaultMaxUploadSize = 512 * 1024 * 1024
+)
+
+// ServerOptions holds the optional settings of the HTTP API server.
+type ServerOptions struct {
+	// Tags holds the tag configuration used to rewrite tags in /convert.
+	// When nil, tags are left untouched.
+	Tags map[string]TagOptions
+
+	// Parse specifies how notes are parsed
+	Parse ParseOptions
+
+	// Discover holds the settings of the /discover endpoint
+	Discover DiscoverOptions
+
+	// MaxNoteSize is the maximum size in bytes of a note sent to /convert,
+	// or of each note of the archive sent to /discover (defaults to 10 MB).
+	MaxNoteSize int64
+
+	// MaxUploadSize is the maximum size in bytes of a zip archive sent to
+	// /discover (defaults to 512 MB).
+	MaxUploadSize int64
+}
+
+// ConvertResponse is the response of the /convert endpoint.
+type ConvertResponse struct {
+	Markdown         string           `json:"markdown"`
+	Tags             []string         `json:"tags"`
+	Images           []ImageSummary   `json:"images"`
+	Files            []FileSummary    `json:"files"`
+	TargetDirectory  string           `json:"target_directory,omitempty"`
+	HandlingStrategy HandlingStrategy `json:"handling_strategy,omitempty"`
+	Vault            string           `json:"vault,omitempty"`
+}
+
+// ImageSummary describes an embedded image in a ConvertResponse.
+type ImageSummary struct {
+	Location    string `json:"location"`
+	Description string `json:"description"`
+}
+
+// FileSummary describes a file attachment in a ConvertResponse.
+type FileSummary struct {
+	Location string `json:"location"`
+	Name     string `json:"name"`
+}
+
+// server implements the HTTP API.
+type server struct {
+	options ServerOptions
+}
+
+// NewServer returns an HTTP handler exposing the conversion and discovery
+// features over a REST API:
+//
+//   - POST /convert: the request body is a Bear note, the response is the
+//     converted note along with its tags, images and file attachments (JSON).
+//   - POST /discover: the request body is a zip archive of Bear notes, the
+//     response is the tag configuration file (YAML).
+func NewServer(options ServerOptions) http.Handler {
+	if options.MaxNoteSize <= 0 {
+		options.MaxNoteSize = defaultMaxNoteSize
+	}
+	if options.MaxUploadSize <= 0 {
+		options.MaxUploadSize = defaultMaxUploadSize
+	}
+	s := &server{options: options}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/convert", s.convert)
+	mux.HandleFunc("/discover", s.discover)
+	return mux
+}
+
+// readBody reads the request body, up to maxSize bytes.
+func readBody(w http.ResponseWriter, r *http.Request, maxSize int64) ([]byte, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
+	return body, true
+}
+
+// convert handles the /convert endpoint.
+func (s *server) convert(w http.ResponseWriter, r *http.Request) {
+	body, ok := readBody(w, r, s.options.MaxNoteSize)
+	if !ok {
+		return
+	}
+
+	note := LoadNoteWithOptions(body, s.options.Parse)
+	response := ConvertResponse{
+		Tags:   []string{},
+		Images: []ImageSummary{},
+		Files:  []FileSummary{},
+	}
+	for _, tag := range note.Tags {
+		response.Tags = append(response.Tags, tag.Name)
+	}
+	for _, image := range note.Images {
+		response.Images = append(response.Images, ImageSummary{Location: image.Location, Description: image.Description})
+	}
+	for _, file := range note.Files {
+		response.Files = append(response.Files, FileSummary{Location: file.Location, Name: file.Name})
+	}
+
+	if s.options.Tags != nil {
+		routing, err := applyTagOptions(note, s.options.Tags, s.options.Parse.CaseSensitiveTags, nil)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%s: %s", ErrUnknownTag, err), http.StatusUnprocessableEntity)
+			return
+		}
+		response.TargetDirectory = routing.targetDirectory
+		response.HandlingStrategy = routing.handlingStrategy
+		response.Vault = routing.vault
+	}
+	markdown, err := note.WriteNote()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	response.Markdown = markdown
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Printf("convert: %s\n", err)
+	}
+}
+
+// discover handles the /discover endpoint.
+func (s *server) discover(w http.ResponseWriter, r *http.Request) {
+	body, ok := readBody(w, r, s.options.MaxUploadSize)
+	if !ok {
+		return
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	discoverOptions := s.options.Discover
+	discoverOptions.Parse = s.options.Parse
+	d := newDiscovery(discoverOptions)
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() || !strings.HasSuffix(file.Name, ".md") {
+			continue
+		}
+		fd, err := file.Open()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// The size of the note is read rather than taken from the
+		// archive, so that larger notes are never truncated
+		content, err := ioutil.ReadAll(io.LimitReader(fd, s.options.MaxNoteSize+1))
+		fd.Close()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if int64(len(content)) > s.options.MaxNoteSize {
+			http.Error(w, fmt.Sprintf("%s: note larger than %d bytes", file.Name, s.options.MaxNoteSize), http.StatusRequestEntityTooLarge)
+			return
+		}
+		d.addNote(file.Name, content)
+	}
+
+	tagFile, err := d.tagFile()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(tagFile)
+}
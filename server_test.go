@@ -0,0 +1,55 @@
+package bearnotes
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerConvert(t *testing.T) {
+	tags := map[string]TagOptions{"foo/bar": {HandlingStrategy: "same-folder", TargetDirectory: "foo/bar", TargetTagName: "bar"}}
+	server := NewServer(ServerOptions{Tags: tags})
+
+	req := httptest.NewRequest(http.MethodPost, "/convert", strings.NewReader("#foo/bar\n<a href='note/my%20file.pdf'>my file.pdf</a>\n"))
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code, "request must succeed")
+
+	var response ConvertResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response), "response must be JSON")
+	assert.Equal(t, "#bar\n[my file.pdf](note/my%20file.pdf)\n", response.Markdown, "note must be converted")
+	assert.Equal(t, []string{"foo/bar"}, response.Tags, "tags must be extracted")
+	assert.Equal(t, "foo/bar", response.TargetDirectory, "target directory must be computed")
+	assert.Len(t, response.Files, 1, "files must be extracted")
+}
+
+func TestServerDiscover(t *testing.T) {
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	fd, _ := zw.Create("notes/note.md")
+	fd.Write([]byte("#foo/bar\n"))
+	zw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/discover", &archive)
+	w := httptest.NewRecorder()
+	NewServer(ServerOptions{}).ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code, "request must succeed")
+	assert.Contains(t, w.Body.String(), "foo/bar:", "tag file must contain the tag")
+
+	archive.Reset()
+	zw = zip.NewWriter(&archive)
+	fd, _ = zw.Create("notes/large.md")
+	fd.Write([]byte("#foo\n" + strings.Repeat("a", 64)))
+	zw.Close()
+	req = httptest.NewRequest(http.MethodPost, "/discover", &archive)
+	w = httptest.NewRecorder()
+	NewServer(ServerOptions{MaxNoteSize: 64}).ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code, "notes larger than the limit must be rejected")
+	assert.Contains(t, w.Body.String(), "notes/large.md", "the note must be named")
+}
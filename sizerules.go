@@ -0,0 +1,90 @@
+package bearnotes
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf8"
+)
+
+// SizeRule overrides the routing of the notes of a tag based on their size,
+// for instance to separate fleeting notes from permanent notes:
+//
+//  fleeting:
+//    handling_strategy: same-folder
+//    target_directory: zettelkasten
+//    size_rules:
+//      - max_words: 50
+//        target_directory: inbox
+//
+// A rule matches the notes whose size is within all its bounds (zero
+// meaning no bound). The first matching rule of a tag applies.
+type SizeRule struct {
+	MinWords      int `yaml:"min_words,omitempty"`
+	MaxWords      int `yaml:"max_words,omitempty"`
+	MinCharacters int `yaml:"min_characters,omitempty"`
+	MaxCharacters int `yaml:"max_characters,omitempty"`
+
+	// HandlingStrategy and TargetDirectory replace the ones of the tag,
+	// when not empty
+	HandlingStrategy HandlingStrategy `yaml:"handling_strategy,omitempty"`
+	TargetDirectory  string `yaml:"target_directory,omitempty"`
+}
+
+// matches returns true if a note of the given size is within the bounds of
+// the rule.
+func (rule SizeRule) matches(words int, characters int) bool {
+	return (rule.MinWords == 0 || words >= rule.MinWords) &&
+		(rule.MaxWords == 0 || words <= rule.MaxWords) &&
+		(rule.MinCharacters == 0 || characters >= rule.MinCharacters) &&
+		(rule.MaxCharacters == 0 || characters <= rule.MaxCharacters)
+}
+
+// noteSize returns the number of words and characters of the content of a
+// note. Hashtags count as words.
+func noteSize(content []byte) (int, int) {
+	return len(bytes.Fields(content)), utf8.RuneCount(bytes.TrimSpace(content))
+}
+
+// withSizeRules returns the tag options, overridden by the first size rule
+// matching a note of the given size.
+func (tagOption TagOptions) withSizeRules(words int, characters int) TagOptions {
+	for _, rule := range tagOption.SizeRules {
+		if !rule.matches(words, characters) {
+			continue
+		}
+		if rule.HandlingStrategy != "" {
+			tagOption.HandlingStrategy = rule.HandlingStrategy
+		}
+		if rule.TargetDirectory != "" {
+			tagOption.TargetDirectory = rule.TargetDirectory
+		}
+		break
+	}
+	return tagOption
+}
+
+// checkSizeRules returns an error if a size rule of the tag file has no
+// bound, inconsistent bounds or nothing to override.
+func checkSizeRules(tags map[string]TagOptions) error {
+	for tagName, tagOption := range tags {
+		for i, rule := range tagOption.SizeRules {
+			var err error
+			switch {
+			case rule.MinWords < 0 || rule.MaxWords < 0 || rule.MinCharacters < 0 || rule.MaxCharacters < 0:
+				err = fmt.Errorf("negative bound")
+			case rule.MinWords == 0 && rule.MaxWords == 0 && rule.MinCharacters == 0 && rule.MaxCharacters == 0:
+				err = fmt.Errorf("no bound (min_words, max_words, min_characters or max_characters)")
+			case rule.MaxWords > 0 && rule.MinWords > rule.MaxWords, rule.MaxCharacters > 0 && rule.MinCharacters > rule.MaxCharacters:
+				err = fmt.Errorf("minimum greater than maximum")
+			case rule.HandlingStrategy == "" && rule.TargetDirectory == "":
+				err = fmt.Errorf("nothing to override (handling_strategy or target_directory)")
+			case !rule.HandlingStrategy.known():
+				err = fmt.Errorf("unknown handling strategy '%s'", rule.HandlingStrategy)
+			}
+			if err != nil {
+				return fmt.Errorf("tag '%s': size rule %d: %w", tagName, i+1, err)
+			}
+		}
+	}
+	return nil
+}
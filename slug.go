@@ -0,0 +1,101 @@
+package bearnotes
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// SlugOptions specifies how slugs (lowercase names made of letters, numbers
+// and separators, suitable for URLs) are generated.
+type SlugOptions struct {
+	// Transliterate replaces accented letters with their ASCII letter
+	// (é => e, ß => ss) and drops the other non-ASCII characters (emojis,
+	// non-Latin scripts), for targets hosted on web servers
+	Transliterate bool
+
+	// MaxLength limits the number of characters of the slug (0 means no
+	// limit). Slugs are preferably cut at a separator.
+	MaxLength int
+
+	// Separator replaces any sequence of characters that are not letters or
+	// numbers (defaults to a dash)
+	Separator string
+}
+
+// transliterations holds the letters that are not accented letters but
+// still have an ASCII equivalent.
+var transliterations = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'ø': "o", 'đ': "d", 'ð': "d",
+	'ł': "l", 'þ': "th", 'ı': "i", 'ŋ': "n",
+}
+
+// Slugify returns the slug of s, with the default options: s is
+// lowercased and any sequence of characters that are not letters or
+// numbers is replaced with a single dash.
+func Slugify(s string) string {
+	return SlugOptions{}.Slugify(s)
+}
+
+// Slugify returns the slug of s, as specified by the options.
+func (options SlugOptions) Slugify(s string) string {
+	separator := options.Separator
+	if separator == "" {
+		separator = "-"
+	}
+
+	s = strings.ToLower(s)
+	if options.Transliterate {
+		s = transliterate(s)
+	}
+
+	var slug strings.Builder
+	pending := false
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			if pending && slug.Len() > 0 {
+				slug.WriteString(separator)
+			}
+			slug.WriteRune(r)
+			pending = false
+		} else {
+			pending = true
+		}
+	}
+
+	result := slug.String()
+	if options.MaxLength > 0 && utf8.RuneCountInString(result) > options.MaxLength {
+		runes := []rune(result)
+		cut := string(runes[:options.MaxLength])
+		// The slug is cut after the last complete word, if any
+		if !strings.HasPrefix(string(runes[options.MaxLength:]), separator) {
+			if i := strings.LastIndex(cut, separator); i > 0 {
+				cut = cut[:i]
+			}
+		}
+		result = strings.TrimSuffix(cut, separator)
+	}
+	return result
+}
+
+// transliterate replaces the accented letters of s with their ASCII letter
+// and drops the other non-ASCII letters and numbers.
+func transliterate(s string) string {
+	var result strings.Builder
+	for _, r := range norm.NFD.String(s) {
+		switch {
+		case r < utf8.RuneSelf:
+			result.WriteRune(r)
+		case unicode.Is(unicode.Mn, r):
+			// Accents, once decomposed
+		case transliterations[r] != "":
+			result.WriteString(transliterations[r])
+		default:
+			// Separates the words around emojis and other scripts
+			result.WriteRune(' ')
+		}
+	}
+	return result.String()
+}
@@ -0,0 +1,94 @@
+package bearnotes
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Version of the tool, recorded in the run snapshots. It is set at build
+// time with -ldflags "-X github.com/nmasse-itix/bearnotes.Version=1.2.3".
+var Version = "dev"
+
+// snapshotFile is the name of the file recording how a migration was run,
+// in the root of each destination directory.
+const snapshotFile = ".bearnotes-migration.yaml"
+
+// runSnapshot records how a migration was run, so that the destination
+// directory can be understood months later.
+type runSnapshot struct {
+	Version       string            `yaml:"version"`
+	Arguments     []string          `yaml:"arguments,omitempty"`
+	From          string            `yaml:"from"`
+	To            string            `yaml:"to"`
+	TagFile       string            `yaml:"tag_file"`
+	TagFileSHA256 string            `yaml:"tag_file_sha256"`
+	TagOverrides  []snapshotTagFile `yaml:"tag_file_overrides,omitempty"`
+	Transforms    []string          `yaml:"transforms,omitempty"`
+	Started       time.Time         `yaml:"started"`
+	Finished      time.Time         `yaml:"finished"`
+	Notes         int               `yaml:"notes"`
+	Successes     int               `yaml:"successes"`
+	Failures      int               `yaml:"failures"`
+	Warnings      int               `yaml:"warnings"`
+}
+
+// snapshotTagFile records a tag file layered on top of the base tag file,
+// along with its checksum, since each layer changes the outcome.
+type snapshotTagFile struct {
+	Path   string `yaml:"path"`
+	SHA256 string `yaml:"sha256"`
+}
+
+// writeSnapshot writes the run snapshot of the plan, executed from started
+// with the given report, in the root of each destination directory.
+func (plan *Plan) writeSnapshot(started time.Time, report *MigrationReport) error {
+	snapshot := runSnapshot{
+		Version:   Version,
+		Arguments: plan.options.Arguments,
+		From:      plan.From,
+		To:        plan.To,
+		TagFile:   plan.TagFile,
+		Started:   started,
+		Finished:  time.Now(),
+		Notes:     report.Notes,
+		Successes: report.Successes,
+		Failures:  report.Failures(),
+		Warnings:  len(report.Warnings),
+	}
+	for _, t := range plan.options.Transforms {
+		snapshot.Transforms = append(snapshot.Transforms, t.Name())
+	}
+	checksum, err := fileChecksum(plan.TagFile)
+	if err != nil {
+		return err
+	}
+	snapshot.TagFileSHA256 = hex.EncodeToString(checksum)
+	for _, tagFile := range plan.options.TagFileOverrides {
+		checksum, err := fileChecksum(tagFile)
+		if err != nil {
+			return err
+		}
+		snapshot.TagOverrides = append(snapshot.TagOverrides, snapshotTagFile{Path: tagFile, SHA256: hex.EncodeToString(checksum)})
+	}
+
+	content, err := yaml.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	for _, dir := range plan.options.destinations(plan.From, plan.To) {
+		err = os.MkdirAll(dir, plan.options.dirMode())
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(filepath.Join(dir, snapshotFile), content, plan.options.fileMode())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package bearnotes
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Locations of the link back to Bear (see MigrateOptions.SourceLink)
+const (
+	SourceLinkNone        = ""             // No link
+	SourceLinkFrontMatter = "front-matter" // bear_url field in the front matter
+	SourceLinkFooter      = "footer"       // Last line of the note
+)
+
+// checkSourceLink returns an error if the location of the link back to
+// Bear is unknown.
+func checkSourceLink(location string) error {
+	if location != SourceLinkNone && location != SourceLinkFrontMatter && location != SourceLinkFooter {
+		return fmt.Errorf("unknown source link location '%s' (available locations: %s, %s)", location, SourceLinkFrontMatter, SourceLinkFooter)
+	}
+	return nil
+}
+
+// bearURL returns the callback URL opening the note having this title in
+// Bear. Markdown exports do not carry the identifier of the notes, so they
+// are opened by title.
+func bearURL(title string) string {
+	query := url.Values{"title": {title}}
+	// Bear expects %20 instead of + for spaces
+	return "bear://x-callback-url/open-note?" + strings.ReplaceAll(query.Encode(), "+", "%20")
+}
+
+// addSourceLink adds the link back to Bear to the note, as specified by location.
+func addSourceLink(note *Note, title string, location string) {
+	switch location {
+	case SourceLinkFrontMatter:
+		if note.FrontMatter == nil {
+			note.FrontMatter = make(map[string]string)
+		}
+		note.FrontMatter["bear_url"] = bearURL(title)
+	case SourceLinkFooter:
+		note.Footer = fmt.Sprintf("[Open in Bear](%s)", bearURL(title))
+	}
+}
@@ -0,0 +1,34 @@
+//go:build darwin
+// +build darwin
+
+package bearnotes
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"sort"
+)
+
+// spotlightNotes locates the notes (Markdown and, if convertHTML is true,
+// HTML files) in dir with Spotlight, which is much faster than a walk in
+// huge iCloud directories. Paths are returned sorted.
+func spotlightNotes(ctx context.Context, dir string, convertHTML bool) ([]string, error) {
+	query := `kMDItemFSName == "*.md"c`
+	if convertHTML {
+		query += ` || kMDItemFSName == "*.html"c`
+	}
+	output, err := exec.CommandContext(ctx, "mdfind", "-0", "-onlyin", dir, query).Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, p := range bytes.Split(output, []byte{0}) {
+		if len(p) > 0 {
+			paths = append(paths, string(p))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
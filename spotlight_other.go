@@ -0,0 +1,14 @@
+//go:build !darwin
+// +build !darwin
+
+package bearnotes
+
+import (
+	"context"
+	"errors"
+)
+
+// spotlightNotes is not supported on this platform.
+func spotlightNotes(ctx context.Context, dir string, convertHTML bool) ([]string, error) {
+	return nil, errors.New("Spotlight is only available on macOS")
+}
@@ -0,0 +1,91 @@
+package bearnotes
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// HandlingStrategy specifies how the notes having a tag are stored on the
+// filesystem (see TagOptions.HandlingStrategy).
+type HandlingStrategy string
+
+// Handling strategies of the notes
+const (
+	// StrategyNone specifies no handling: the notes go to the root of the
+	// target directory, unless another tag sets a strategy
+	StrategyNone HandlingStrategy = ""
+
+	// StrategySameFolder stores all the notes having the tag in its
+	// target directory, along with their images and file attachments
+	StrategySameFolder HandlingStrategy = "same-folder"
+
+	// StrategyOneNotePerFolder gives each note a sub-folder of the target
+	// directory, along with its images and file attachments
+	StrategyOneNotePerFolder HandlingStrategy = "one-note-per-folder"
+
+	// StrategyGroupByInitial buckets the notes in sub-folders of the target
+	// directory named after their initial (A, B, ..., 0-9 or #)
+	StrategyGroupByInitial HandlingStrategy = "group-by-initial"
+)
+
+// handlingStrategies lists the handling strategies, in the order of the
+// error messages.
+var handlingStrategies = []HandlingStrategy{StrategySameFolder, StrategyOneNotePerFolder, StrategyGroupByInitial}
+
+// ParseHandlingStrategy returns the handling strategy having this name,
+// or an error if there is none. The empty string is StrategyNone.
+func ParseHandlingStrategy(name string) (HandlingStrategy, error) {
+	strategy := HandlingStrategy(name)
+	if !strategy.known() {
+		return StrategyNone, fmt.Errorf("unknown handling strategy '%s' (available strategies: %s)", name, strategyNames())
+	}
+	return strategy, nil
+}
+
+// known returns true if the handling strategy is StrategyNone or one of the
+// handling strategies.
+func (strategy HandlingStrategy) known() bool {
+	if strategy == StrategyNone {
+		return true
+	}
+	for _, s := range handlingStrategies {
+		if strategy == s {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the name of the handling strategy, as in the tag file.
+func (strategy HandlingStrategy) String() string {
+	return string(strategy)
+}
+
+// MarshalYAML writes the handling strategy by name.
+func (strategy HandlingStrategy) MarshalYAML() (interface{}, error) {
+	return string(strategy), nil
+}
+
+// UnmarshalYAML reads a handling strategy by name, returning an error if
+// it is unknown, so that a typo in the tag file is reported on load.
+func (strategy *HandlingStrategy) UnmarshalYAML(value *yaml.Node) error {
+	var name string
+	err := value.Decode(&name)
+	if err != nil {
+		return err
+	}
+	*strategy, err = ParseHandlingStrategy(name)
+	return err
+}
+
+// strategyNames returns the names of the handling strategies, separated by
+// commas.
+func strategyNames() string {
+	names := make([]string, len(handlingStrategies))
+	for i, strategy := range handlingStrategies {
+		names[i] = string(strategy)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,113 @@
+package bearnotes
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Regular expression to validate the colors of the tags (#rrggbb)
+var reTagColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// obsidianGraphFile is the path, relative to the vault, of the settings of
+// the Obsidian graph view.
+var obsidianGraphFile = filepath.Join(".obsidian", "graph.json")
+
+// obsidianGraph is the content of the settings of the Obsidian graph view,
+// restricted to the color groups.
+type obsidianGraph struct {
+	ColorGroups []obsidianColorGroup `json:"colorGroups"`
+}
+
+// obsidianColorGroup colors the notes matching a search query in the
+// Obsidian graph view.
+type obsidianColorGroup struct {
+	Query string `json:"query"`
+	Color struct {
+		A   int   `json:"a"`
+		RGB int64 `json:"rgb"`
+	} `json:"color"`
+}
+
+// checkTagColors returns an error if the color of a tag is not an RGB color
+// in hexadecimal notation (#rrggbb).
+func checkTagColors(tags map[string]TagOptions) error {
+	for tagName, tagOption := range tags {
+		if tagOption.Color != "" && !reTagColor.MatchString(tagOption.Color) {
+			return fmt.Errorf("tag '%s': invalid color '%s' (expected #rrggbb)", tagName, tagOption.Color)
+		}
+	}
+	return nil
+}
+
+// tagIcons returns the icons of the target directories of the tags, by
+// target directory (relative to the root of the vault, with slashes).
+func tagIcons(tags map[string]TagOptions) map[string]string {
+	icons := make(map[string]string)
+	var tagNames []string
+	for tagName := range tags {
+		tagNames = append(tagNames, tagName)
+	}
+	sort.Strings(tagNames)
+	for _, tagName := range tagNames {
+		tagOption := tags[tagName]
+		if tagOption.Icon == "" || tagOption.TargetDirectory == "" {
+			continue
+		}
+		dir := path.Clean(filepath.ToSlash(tagOption.TargetDirectory))
+		if _, ok := icons[dir]; !ok {
+			icons[dir] = tagOption.Icon
+		}
+	}
+	return icons
+}
+
+// obsidianColorGroups returns the color groups of the Obsidian graph view
+// matching the colors of the tags, by migrated tag name. Tags that are
+// removed from the notes have no color group.
+func obsidianColorGroups(tags map[string]TagOptions) []obsidianColorGroup {
+	var tagNames []string
+	for tagName := range tags {
+		tagNames = append(tagNames, tagName)
+	}
+	sort.Strings(tagNames)
+
+	var groups []obsidianColorGroup
+	seen := make(map[string]bool)
+	for _, tagName := range tagNames {
+		tagOption := tags[tagName]
+		if tagOption.Color == "" || tagOption.Ignore || tagOption.TargetTagName == "" || strings.Contains(tagOption.TargetTagName, "*") {
+			continue
+		}
+		query := "tag:#" + tagOption.TargetTagName
+		if seen[query] {
+			continue
+		}
+		seen[query] = true
+		group := obsidianColorGroup{Query: query}
+		group.Color.A = 1
+		group.Color.RGB, _ = strconv.ParseInt(tagOption.Color[1:], 16, 32)
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// writeObsidianGraph writes the colors of the tags as color groups of the
+// Obsidian graph view in every destination directory. Existing settings are
+// left untouched, not to lose the settings made in Obsidian.
+func (plan *Plan) writeObsidianGraph() error {
+	groups := obsidianColorGroups(plan.tags)
+	if len(groups) == 0 {
+		return nil
+	}
+	content, err := json.MarshalIndent(obsidianGraph{ColorGroups: groups}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return plan.writeObsidianFile(obsidianGraphFile, content)
+}
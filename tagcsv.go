@@ -0,0 +1,150 @@
+package bearnotes
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// csvHeader lists the columns of a tag configuration file in CSV format.
+var csvHeader = []string{"tag", "ignore", "handling_strategy", "target_directory", "target_tag_name", "vault", "export_formats", "front_matter", "transforms", "color", "icon"}
+
+// isCSV returns true if the tag configuration file is in CSV format,
+// based on its extension.
+func isCSV(tagFile string) bool {
+	return strings.HasSuffix(strings.ToLower(tagFile), ".csv")
+}
+
+// WriteTagFileCSV writes the tag configuration in CSV format, sorted by tag name.
+// Export formats and transforms are separated by semicolons, as front matter
+// fields (key=value).
+func WriteTagFileCSV(w io.Writer, tags map[string]TagOptions) error {
+	var tagNames []string
+	for tagName := range tags {
+		tagNames = append(tagNames, tagName)
+	}
+	sort.Strings(tagNames)
+
+	cw := csv.NewWriter(w)
+	err := cw.Write(csvHeader)
+	if err != nil {
+		return err
+	}
+	for _, tagName := range tagNames {
+		tag := tags[tagName]
+		err = cw.Write([]string{
+			tagName,
+			strconv.FormatBool(tag.Ignore),
+			tag.HandlingStrategy.String(),
+			tag.TargetDirectory,
+			tag.TargetTagName,
+			tag.Vault,
+			strings.Join(tag.ExportFormats, ";"),
+			formatFrontMatterCSV(tag.FrontMatter),
+			strings.Join(tag.Transforms, ";"),
+			tag.Color,
+			tag.Icon,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ParseTagFileCSV parses the content of a tag configuration file in CSV format.
+// Columns are identified by the header line, so they can be in any order
+// and missing columns get their default value.
+func ParseTagFileCSV(fileContent []byte) (map[string]TagOptions, error) {
+	records, err := csv.NewReader(bytes.NewReader(fileContent)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("missing CSV header")
+	}
+
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.TrimSpace(name)] = i
+	}
+	if _, ok := columns["tag"]; !ok {
+		return nil, fmt.Errorf("missing 'tag' column in CSV header")
+	}
+
+	tags := make(map[string]TagOptions)
+	for line, record := range records[1:] {
+		field := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return record[i]
+		}
+
+		if field("tag") == settingsEntry {
+			return nil, fmt.Errorf("line %d: tag: '%s' is a reserved name", line+2, field("tag"))
+		}
+
+		var tag TagOptions
+		if ignore := field("ignore"); ignore != "" {
+			tag.Ignore, err = strconv.ParseBool(ignore)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: ignore: %w", line+2, err)
+			}
+		}
+		tag.HandlingStrategy, err = ParseHandlingStrategy(field("handling_strategy"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: handling_strategy: %w", line+2, err)
+		}
+		tag.TargetDirectory = field("target_directory")
+		tag.TargetTagName = field("target_tag_name")
+		tag.Vault = field("vault")
+		if formats := field("export_formats"); formats != "" {
+			tag.ExportFormats = strings.Split(formats, ";")
+		}
+		if frontMatter := field("front_matter"); frontMatter != "" {
+			tag.FrontMatter, err = parseFrontMatterCSV(frontMatter)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: front_matter: %w", line+2, err)
+			}
+		}
+		if transforms := field("transforms"); transforms != "" {
+			tag.Transforms = strings.Split(transforms, ";")
+		}
+		tag.Color = field("color")
+		tag.Icon = field("icon")
+		tags[field("tag")] = tag
+	}
+
+	return tags, nil
+}
+
+// formatFrontMatterCSV formats front matter fields as key=value pairs,
+// sorted by key and separated by semicolons.
+func formatFrontMatterCSV(frontMatter map[string]string) string {
+	var fields []string
+	for key, value := range frontMatter {
+		fields = append(fields, key+"="+value)
+	}
+	sort.Strings(fields)
+	return strings.Join(fields, ";")
+}
+
+// parseFrontMatterCSV parses front matter fields formatted by formatFrontMatterCSV.
+func parseFrontMatterCSV(s string) (map[string]string, error) {
+	frontMatter := make(map[string]string)
+	for _, field := range strings.Split(s, ";") {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("'%s' is not a key=value pair", field)
+		}
+		frontMatter[strings.TrimSpace(parts[0])] = parts[1]
+	}
+	return frontMatter, nil
+}
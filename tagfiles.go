@@ -0,0 +1,146 @@
+package bearnotes
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// tagEntrySource locates an entry of a tag configuration file.
+type tagEntrySource struct {
+	file string
+	line int
+}
+
+// String returns the location of the entry (file:line).
+func (source tagEntrySource) String() string {
+	if source.line == 0 {
+		return source.file
+	}
+	return fmt.Sprintf("%s:%d", source.file, source.line)
+}
+
+// LoadTagFiles reads tag configuration files layered in order: a base file
+// (shared conventions) followed by overrides (personal settings). The
+// entries of a file replace the entries of the same name of the previous
+// files, as a whole. Entries replaced by different options are reported as
+// warnings, with the file and line of both entries (see ErrTagFileOverride).
+func LoadTagFiles(tagFiles []string) (map[string]TagOptions, error) {
+	tags, warnings, err := loadTagFiles(tagFiles)
+	for _, warning := range warnings {
+		log.Printf("WARNING: %s\n", warning)
+	}
+	return tags, err
+}
+
+// loadTagFiles reads layered tag configuration files (see LoadTagFiles)
+// and returns the issues found in their entries, to be reported along with
+// the migration.
+func loadTagFiles(tagFiles []string) (map[string]TagOptions, []error, error) {
+	var warnings []error
+	tags := make(map[string]TagOptions)
+	sources := make(map[string]tagEntrySource)
+	for _, tagFile := range tagFiles {
+		layer, err := LoadTagFile(tagFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		lines, err := tagEntryLines(tagFile)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var tagNames []string
+		for tagName := range layer {
+			tagNames = append(tagNames, tagName)
+		}
+		sort.Strings(tagNames)
+		for _, tagName := range tagNames {
+			source := tagEntrySource{file: tagFile, line: lines[tagName]}
+			if existing, ok := tags[tagName]; ok && !reflect.DeepEqual(existing, layer[tagName]) {
+				warnings = append(warnings, &NoteError{Note: source.String(), Kind: ErrTagFileOverride, Err: fmt.Errorf("entry '%s' overrides the entry of %s", tagName, sources[tagName])})
+			}
+			tags[tagName] = layer[tagName]
+			sources[tagName] = source
+		}
+	}
+	return tags, warnings, nil
+}
+
+// loadLayeredSettings reads the global options, the rename rules and the
+// title rules of tag configuration files layered in order (see
+// LoadTagFiles). The global options of a file take precedence over those
+// of the previous files, field by field, and so do its rules, which are
+// tried first.
+func loadLayeredSettings(tagFiles []string, options *MigrateOptions) ([]RenameRule, []TitleRule, error) {
+	var renameRules []RenameRule
+	var titleRules []TitleRule
+	for i := len(tagFiles) - 1; i >= 0; i-- {
+		global, err := LoadGlobalOptions(tagFiles[i])
+		if err != nil {
+			return nil, nil, err
+		}
+		global.apply(options)
+		renameLayer, err := LoadRenameRules(tagFiles[i])
+		if err != nil {
+			return nil, nil, err
+		}
+		renameRules = append(renameRules, renameLayer...)
+		titleLayer, err := LoadTitleRules(tagFiles[i])
+		if err != nil {
+			return nil, nil, err
+		}
+		titleRules = append(titleRules, titleLayer...)
+	}
+	return renameRules, titleRules, nil
+}
+
+// tagEntryLines returns the line of each entry of a tag configuration
+// file, by tag name.
+func tagEntryLines(tagFile string) (map[string]int, error) {
+	fileContent, err := ioutil.ReadFile(tagFile)
+	if err != nil {
+		return nil, err
+	}
+	lines := make(map[string]int)
+
+	if isCSV(tagFile) {
+		records, err := csv.NewReader(bytes.NewReader(fileContent)).ReadAll()
+		if err != nil || len(records) == 0 {
+			return lines, nil
+		}
+		column := -1
+		for i, name := range records[0] {
+			if strings.TrimSpace(name) == "tag" {
+				column = i
+			}
+		}
+		for line, record := range records[1:] {
+			if column >= 0 && column < len(record) {
+				lines[record[column]] = line + 2
+			}
+		}
+		return lines, nil
+	}
+
+	var doc yaml.Node
+	err = yaml.Unmarshal(fileContent, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", tagFile, err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return lines, nil
+	}
+	entries := doc.Content[0].Content
+	for i := 0; i+1 < len(entries); i += 2 {
+		lines[entries[i].Value] = entries[i].Line
+	}
+	return lines, nil
+}
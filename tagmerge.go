@@ -0,0 +1,112 @@
+package bearnotes
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MergeTagFile adds the tags that are not yet configured (neither by an
+// entry of their own, nor by a wildcard or defaults entry) to an existing
+// tag configuration file, which is created if it does not exist.
+// Existing entries are left untouched and, in YAML, so are the comments
+// and the order of the entries. It returns the number of added tags.
+func MergeTagFile(tagFile string, tags map[string]TagOptions) (int, error) {
+	fileContent, err := ioutil.ReadFile(tagFile)
+	if os.IsNotExist(err) {
+		return len(tags), SaveTagFile(tagFile, tags)
+	} else if err != nil {
+		return 0, err
+	}
+
+	existing, err := LoadTagFile(tagFile)
+	if err != nil {
+		return 0, err
+	}
+	var newTags []string
+	for tagName := range tags {
+		if reservedEntries[tagName] {
+			continue
+		}
+		if _, ok := lookupTagOptions(existing, tagName, true); !ok {
+			newTags = append(newTags, tagName)
+		}
+	}
+	sort.Strings(newTags)
+	if len(newTags) == 0 {
+		return 0, nil
+	}
+
+	// CSV files have no comments to preserve
+	if isCSV(tagFile) {
+		for _, tagName := range newTags {
+			existing[tagName] = tags[tagName]
+		}
+		return len(newTags), SaveTagFile(tagFile, existing)
+	}
+
+	content, err := mergeTagFileYAML(fileContent, tags, newTags)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", tagFile, err)
+	}
+	return len(newTags), ioutil.WriteFile(tagFile, content, 0644)
+}
+
+// mergeTagFileYAML appends the entries of newTags to the YAML tag
+// configuration file, using the node API of yaml.v3 so that comments and
+// ordering survive the rewrite.
+func mergeTagFileYAML(fileContent []byte, tags map[string]TagOptions, newTags []string) ([]byte, error) {
+	var doc yaml.Node
+	err := yaml.Unmarshal(fileContent, &doc)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Kind == 0 {
+		// Empty file
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("the tag file is not a mapping of tag names")
+	}
+
+	// Entries are appended in block style, even to an empty flow mapping ({})
+	root.Style &^= yaml.FlowStyle
+	for i, tagName := range newTags {
+		key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: tagName}
+		if i == 0 {
+			key.HeadComment = "New tags"
+		}
+		if reason := tags[tagName].reason; reason != "" {
+			key.HeadComment = strings.TrimPrefix(key.HeadComment+"\n"+reason, "\n")
+		}
+		entry, err := yaml.Marshal(tags[tagName])
+		if err != nil {
+			return nil, err
+		}
+		var value yaml.Node
+		err = yaml.Unmarshal(entry, &value)
+		if err != nil {
+			return nil, err
+		}
+		root.Content = append(root.Content, key, value.Content[0])
+	}
+
+	var content bytes.Buffer
+	encoder := yaml.NewEncoder(&content)
+	encoder.SetIndent(4)
+	err = encoder.Encode(&doc)
+	if err != nil {
+		return nil, err
+	}
+	err = encoder.Close()
+	if err != nil {
+		return nil, err
+	}
+	return content.Bytes(), nil
+}
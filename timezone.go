@@ -0,0 +1,20 @@
+package bearnotes
+
+import (
+	"fmt"
+	"time"
+)
+
+// loadTimezone returns the location of the dates written in the front
+// matter and filenames of the notes (see MigrateOptions.Timezone): the
+// named IANA time zone or, if name is empty, the local time zone.
+func loadTimezone(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone '%s' (e.g. UTC or Europe/Paris): %w", name, err)
+	}
+	return location, nil
+}
@@ -0,0 +1,82 @@
+package bearnotes
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// titleRulesEntry is the entry of the settings of the tag file (see
+// settingsEntry) holding the title rules.
+const titleRulesEntry = "title_rules"
+
+// TitleRule routes the untagged notes whose title matches a regular
+// expression as if they had a tag having the given options, for the notes
+// following naming conventions instead of being tagged:
+//
+//  _settings:
+//    title_rules:
+//      - pattern: ^Meeting
+//        handling_strategy: same-folder
+//        target_directory: meetings
+//
+// The title of a note is its filename, without extension. Only the first
+// matching rule applies, and only to the notes having no tag (nor folder
+// pseudo-tag, see MigrateOptions.FolderTags). The note gets the target tag
+// name of the rule in its front matter keywords, if any (see
+// KeywordOptions), but not in its content.
+type TitleRule struct {
+	Pattern    string `yaml:"pattern"`
+	TagOptions `yaml:",inline"`
+}
+
+// LoadTitleRules reads the title rules of a tag configuration file.
+// Tag files in CSV format have no title rules.
+func LoadTitleRules(tagFile string) ([]TitleRule, error) {
+	var rules []TitleRule
+	err := loadSettingsEntry(tagFile, titleRulesEntry, &rules)
+	return rules, err
+}
+
+// titleRouter applies compiled title rules to the untagged notes.
+type titleRouter []compiledTitleRule
+
+// compiledTitleRule is a TitleRule whose pattern has been compiled.
+type compiledTitleRule struct {
+	pattern *regexp.Regexp
+	options TagOptions
+}
+
+// newTitleRouter compiles the title rules, returning an error if a pattern
+// is not a valid regular expression or if a rule lists unknown transforms.
+func newTitleRouter(rules []TitleRule) (titleRouter, error) {
+	var router titleRouter
+	for i, rule := range rules {
+		if rule.Pattern == "" {
+			return nil, fmt.Errorf("title rule %d: no pattern", i+1)
+		}
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("title rule %d: %w", i+1, err)
+		}
+		_, err = LookupTransforms(rule.Transforms)
+		if err != nil {
+			return nil, fmt.Errorf("title rule %d: %w", i+1, err)
+		}
+		router = append(router, compiledTitleRule{pattern: pattern, options: rule.TagOptions})
+	}
+	return router, nil
+}
+
+// route returns the pseudo-tag of an untagged note matching a title rule,
+// named after the pattern of the rule, along with the tag configuration
+// holding the options of the rule, to look up the pseudo-tag instead of the
+// tag file. If no rule matches the title, ok is false.
+func (router titleRouter) route(title string, caseSensitive bool) (Tag, map[string]TagOptions, bool) {
+	for _, rule := range router {
+		if rule.pattern.MatchString(title) {
+			tag := Tag{Name: "title:" + rule.pattern.String()}
+			return tag, map[string]TagOptions{tagKey(tag.Name, caseSensitive): rule.options}, true
+		}
+	}
+	return Tag{}, nil, false
+}
@@ -0,0 +1,47 @@
+package bearnotes
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// tracer prints the decision trail of a note, if it has been asked for.
+type tracer func(format string, args ...interface{})
+
+// checkTracePatterns returns an error if a trace pattern is malformed.
+func checkTracePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("trace pattern '%s': %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// newTracer returns a tracer for the note at relPath (relative to the notes
+// directory), printing to logger. It prints nothing unless the name or the path of the note
+// matches one of the patterns (see filepath.Match), but the decision trail
+// of every note goes to the migration log file, if any.
+func newTracer(logger *migrationLogger, patterns []string, relPath string) tracer {
+	if matchesPattern(patterns, relPath) {
+		return func(format string, args ...interface{}) {
+			logger.Printf("TRACE %s: %s\n", relPath, fmt.Sprintf(format, args...))
+		}
+	}
+	return func(format string, args ...interface{}) {
+		logger.debugf("DEBUG %s: %s\n", relPath, fmt.Sprintf(format, args...))
+	}
+}
+
+// matchesPattern returns true if the name or the path of the note at relPath
+// matches one of the patterns (see filepath.Match).
+func matchesPattern(patterns []string, relPath string) bool {
+	for _, pattern := range patterns {
+		nameMatches, _ := filepath.Match(pattern, filepath.Base(relPath))
+		pathMatches, _ := filepath.Match(pattern, relPath)
+		if nameMatches || pathMatches {
+			return true
+		}
+	}
+	return false
+}
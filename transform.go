@@ -0,0 +1,435 @@
+package bearnotes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Transform rewrites the Markdown content of a note, once converted.
+type Transform interface {
+	// Name returns the name of the transform, as used on the command line
+	Name() string
+	// Apply returns the transformed content
+	Apply(content []byte) []byte
+}
+
+// regexpTransform is a Transform that replaces all matches of a regular
+// expression with a template (see regexp.Expand).
+type regexpTransform struct {
+	name        string
+	re          *regexp.Regexp
+	replacement []byte
+}
+
+// Name implements the Transform interface.
+func (t *regexpTransform) Name() string {
+	return t.name
+}
+
+// Apply implements the Transform interface.
+func (t *regexpTransform) Apply(content []byte) []byte {
+	return t.re.ReplaceAll(content, t.replacement)
+}
+
+// funcTransform is a Transform backed by a function.
+type funcTransform struct {
+	name  string
+	apply func(content []byte) []byte
+}
+
+// Name implements the Transform interface.
+func (t *funcTransform) Name() string {
+	return t.name
+}
+
+// Apply implements the Transform interface.
+func (t *funcTransform) Apply(content []byte) []byte {
+	return t.apply(content)
+}
+
+// transforms holds all the named transforms.
+var transforms map[string]Transform = make(map[string]Transform)
+
+// registerTransform makes a transform available by its name.
+func registerTransform(t Transform) {
+	transforms[t.Name()] = t
+}
+
+func init() {
+	// Bear highlights (::text::) become ==text==
+	registerTransform(&regexpTransform{
+		name:        "highlights",
+		re:          regexp.MustCompile(`::([^:\n]+)::`),
+		replacement: []byte("==$1=="),
+	})
+
+	// Task lists use a consistent syntax: "- [ ]" and "- [x]"
+	registerTransform(&funcTransform{
+		name:  "tasks",
+		apply: normalizeTasks,
+	})
+
+	// Headings have no closing sequence and are preceded by a blank line
+	registerTransform(&funcTransform{
+		name:  "headings",
+		apply: normalizeHeadings,
+	})
+
+	// Bear multi-word tags (#multi word tag#) become #multi-word-tag
+	registerTransform(&funcTransform{
+		name:  "tag-style",
+		apply: convertMultiWordTags,
+	})
+
+	// Bear separators (---) become *** so that they cannot be mistaken for
+	// a setext heading or a front matter delimiter
+	registerTransform(&regexpTransform{
+		name:        "separators",
+		re:          regexp.MustCompile(`(?m)^[ \t]*-{3,}[ \t]*$`),
+		replacement: []byte("***"),
+	})
+
+	// Images without alternative text get one, generated from their filename
+	registerTransform(&funcTransform{
+		name: "alt-text",
+		apply: func(content []byte) []byte {
+			return generateAltText(content, "")
+		},
+	})
+
+	// Images without alternative text get the title of the note (its first heading)
+	registerTransform(&funcTransform{
+		name: "alt-text-title",
+		apply: func(content []byte) []byte {
+			var title string
+			if heading := reHeading.FindSubmatch(content); heading != nil {
+				title = string(heading[2])
+			}
+			return generateAltText(content, title)
+		},
+	})
+
+	// Image captions (an italic line right after the image) become the
+	// alternative text of the image, which pandoc renders as a caption
+	registerTransform(&funcTransform{
+		name: "captions",
+		apply: func(content []byte) []byte {
+			return convertCaptions(content, false)
+		},
+	})
+
+	// Image captions become HTML figures (<figure><figcaption>)
+	registerTransform(&funcTransform{
+		name: "captions-html",
+		apply: func(content []byte) []byte {
+			return convertCaptions(content, true)
+		},
+	})
+
+	// Quotes starting with a marker (> Note: ...) become callouts (> [!note])
+	registerTransform(&funcTransform{
+		name:  "callouts",
+		apply: convertCallouts,
+	})
+
+	// Bear table of contents placeholders ({{TOC}}) are removed
+	registerTransform(&regexpTransform{
+		name:        "strip-toc",
+		re:          regexp.MustCompile(`(?mi)^[ \t]*\{\{TOC\}\}[ \t]*(\n|$)`),
+		replacement: []byte(""),
+	})
+
+	// HTML residue of notes clipped from emails or web pages (<div>,
+	// <span style=...>, &nbsp;) is removed or converted to Markdown
+	registerTransform(&funcTransform{
+		name: stripHTMLTransform,
+		apply: func(content []byte) []byte {
+			content, _ = stripHTML(content)
+			return content
+		},
+	})
+}
+
+// TransformNames returns the names of all the available transforms, sorted.
+func TransformNames() []string {
+	var names []string
+	for name := range transforms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupTransforms returns the transforms having the given names, in order.
+func LookupTransforms(names []string) ([]Transform, error) {
+	var result []Transform
+	for _, name := range names {
+		t, ok := transforms[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown transform '%s' (available transforms: %s)", name, strings.Join(TransformNames(), ", "))
+		}
+		result = append(result, t)
+	}
+	return result, nil
+}
+
+// checkTagTransforms returns an error if a tag of the tag file lists an
+// unknown transform.
+func checkTagTransforms(tags map[string]TagOptions) error {
+	for tagName, tagOption := range tags {
+		_, err := LookupTransforms(tagOption.Transforms)
+		if err != nil {
+			return fmt.Errorf("tag '%s': %w", tagName, err)
+		}
+	}
+	return nil
+}
+
+// tagTransforms returns the transforms listed by the tag options of the
+// tags, in order and without duplicates. Transforms that are already in
+// skip (the transforms applied to all notes) are left out.
+func tagTransforms(tags []Tag, tagOptions map[string]TagOptions, caseSensitive bool, skip []Transform) ([]Transform, error) {
+	applied := make(map[string]bool)
+	for _, t := range skip {
+		applied[t.Name()] = true
+	}
+	var names []string
+	for _, tag := range tags {
+		tagOption, ok := lookupTagOptions(tagOptions, tagKey(tag.Name, caseSensitive), !tag.isNumeric())
+		if !ok || tagOption.Ignore {
+			continue
+		}
+		for _, name := range tagOption.Transforms {
+			if !applied[name] {
+				applied[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return LookupTransforms(names)
+}
+
+// Regular expression to detect fenced code blocks.
+var reFencedCode = regexp.MustCompile("(?ms)^[ \t]*```.*?^[ \t]*```[^\n]*$|^[ \t]*~~~.*?^[ \t]*~~~[^\n]*$")
+
+// applyTransforms applies all transforms to content, in order.
+// Fenced code blocks and math regions are left untouched.
+func applyTransforms(content []byte, transforms []Transform) []byte {
+	if len(transforms) == 0 {
+		return content
+	}
+
+	transform := func(excerpt []byte) []byte {
+		for _, t := range transforms {
+			excerpt = t.Apply(excerpt)
+		}
+		return excerpt
+	}
+	apply := func(excerpt []byte) []byte {
+		var result []byte
+		var current int
+		for _, region := range mathRegions(excerpt) {
+			result = append(result, transform(excerpt[current:region[0]])...)
+			result = append(result, excerpt[region[0]:region[1]]...)
+			current = region[1]
+		}
+		return append(result, transform(excerpt[current:])...)
+	}
+
+	var result []byte
+	var current int
+	for _, block := range reFencedCode.FindAllIndex(content, -1) {
+		result = append(result, apply(content[current:block[0]])...)
+		result = append(result, content[block[0]:block[1]]...)
+		current = block[1]
+	}
+	return append(result, apply(content[current:])...)
+}
+
+var reTask = regexp.MustCompile(`(?m)^([ \t]*)[-*+][ \t]+\[([ xX])\]`)
+
+// normalizeTasks rewrites task list items as "- [ ]" or "- [x]".
+func normalizeTasks(content []byte) []byte {
+	return reTask.ReplaceAllFunc(content, func(match []byte) []byte {
+		parts := reTask.FindSubmatch(match)
+		state := " "
+		if !bytes.Equal(parts[2], []byte(" ")) {
+			state = "x"
+		}
+		return []byte(fmt.Sprintf("%s- [%s]", parts[1], state))
+	})
+}
+
+var reClosingHashes = regexp.MustCompile(`(?m)^(#{1,6}[ \t]+.*?)[ \t]+#+[ \t]*$`)
+var reHeadingWithoutBlankLine = regexp.MustCompile(`(?m)([^\n]\n)(#{1,6}[ \t])`)
+
+// normalizeHeadings removes the closing sequence of headings (## Title ##)
+// and inserts a blank line before headings when missing.
+func normalizeHeadings(content []byte) []byte {
+	content = reClosingHashes.ReplaceAll(content, []byte("$1"))
+	return reHeadingWithoutBlankLine.ReplaceAll(content, []byte("$1\n$2"))
+}
+
+var reMultiWordTag = regexp.MustCompile(`(^|[ \t])#([\p{L}\p{N}][^#\n]*[ \t][^#\n]*[^ \t#])#([ \t\n]|$)`)
+
+// convertMultiWordTags converts Bear multi-word tags (#multi word tag#)
+// to single-word tags (#multi-word-tag).
+func convertMultiWordTags(content []byte) []byte {
+	return reMultiWordTag.ReplaceAllFunc(content, func(match []byte) []byte {
+		parts := reMultiWordTag.FindSubmatch(match)
+		name := strings.Join(strings.Fields(string(parts[2])), "-")
+		return []byte(fmt.Sprintf("%s#%s%s", parts[1], name, parts[3]))
+	})
+}
+
+// generateAltText sets the alternative text of images having none to text
+// or, if text is empty, to their cleaned-up filename.
+func generateAltText(content []byte, text string) []byte {
+	return reImage.ReplaceAllFunc(content, func(match []byte) []byte {
+		image := newImage(match, nil)
+		if strings.TrimSpace(image.Description) != "" {
+			return match
+		}
+		altText := text
+		if altText == "" {
+			altText = altTextFromFilename(image.Location)
+		}
+		altText = strings.NewReplacer("[", "", "]", "").Replace(altText)
+		parts := reImage.FindSubmatchIndex(match)
+		return []byte(fmt.Sprintf("![%s](%s)", altText, match[parts[4]:parts[5]]))
+	})
+}
+
+// altTextFromFilename turns the filename of an image into a human readable
+// text (path, extension, dashes and underscores are removed).
+func altTextFromFilename(location string) string {
+	name := path.Base(location)
+	name = strings.TrimSuffix(name, path.Ext(name))
+	name = strings.NewReplacer("-", " ", "_", " ", ".", " ").Replace(name)
+	return strings.Join(strings.Fields(name), " ")
+}
+
+var reCaption = regexp.MustCompile(`(?m)^[ \t]*!\[[^\]\n]*\]\(([^)\n]+)\)[ \t]*\n[ \t]*(?:\*([^*\n]+)\*|_([^_\n]+)_)[ \t]*$`)
+
+// convertCaptions detects the captions of images (an italic line right
+// after a standalone image) and turns them into the alternative text of the
+// image or, if figure is true, into an HTML figure. In the latter case, the
+// image is kept in Markdown so that it is still migrated with the note.
+func convertCaptions(content []byte, figure bool) []byte {
+	return reCaption.ReplaceAllFunc(content, func(match []byte) []byte {
+		parts := reCaption.FindSubmatch(match)
+		caption := string(parts[2]) + string(parts[3])
+		image := fmt.Sprintf("![%s](%s)", strings.NewReplacer("[", "", "]", "").Replace(caption), parts[1])
+		if !figure {
+			return []byte(image)
+		}
+		return []byte(fmt.Sprintf("<figure>\n\n%s\n\n<figcaption>%s</figcaption>\n</figure>", image, html.EscapeString(caption)))
+	})
+}
+
+// calloutTypes lists the markers of quotes that are converted to callouts,
+// as understood by Obsidian and Zettlr.
+var calloutTypes = []string{"note", "abstract", "summary", "info", "todo", "tip", "hint", "important", "success", "question", "warning", "caution", "failure", "danger", "error", "bug", "example", "quote"}
+
+var reCallout = regexp.MustCompile(`(?mi)^([ \t]*>[ \t]*)(?:\*\*|__)?(` + strings.Join(calloutTypes, "|") + `)(?:[ \t]*:(?:\*\*|__)|(?:\*\*|__)?[ \t]*:)[ \t]*(.*)$`)
+
+// convertCallouts converts the quotes whose first line starts with a marker
+// (> Note: text, > **Warning:** text) to callouts (> [!note]), the text of
+// the first line being kept as the first line of the callout.
+func convertCallouts(content []byte) []byte {
+	var result []byte
+	var current int
+	for _, match := range reCallout.FindAllSubmatchIndex(content, -1) {
+		// Only the first line of a quote can be a marker
+		if match[0] > 0 {
+			previous := content[:match[0]-1]
+			previous = previous[bytes.LastIndexByte(previous, '\n')+1:]
+			if bytes.HasPrefix(bytes.TrimLeft(previous, " \t"), []byte(">")) {
+				continue
+			}
+		}
+
+		prefix := string(content[match[2]:match[3]])
+		kind := strings.ToLower(string(content[match[4]:match[5]]))
+		text := content[match[6]:match[7]]
+		result = append(result, content[current:match[0]]...)
+		result = append(result, fmt.Sprintf("%s[!%s]", prefix, kind)...)
+		if len(bytes.TrimSpace(text)) > 0 {
+			result = append(result, '\n')
+			result = append(result, prefix...)
+			result = append(result, text...)
+		}
+		current = match[1]
+	}
+	return append(result, content[current:]...)
+}
+
+// TransformNotes applies the transforms to all the Markdown files of dir,
+// in place, without relocating them. The original files are saved with a
+// .bak extension if backup is true.
+func TransformNotes(ctx context.Context, dir string, transforms []Transform, backup bool) (*MigrationReport, error) {
+	var report MigrationReport
+
+	fmt.Printf("Transforming Markdown files in %s...\n", dir)
+	err := filepath.Walk(dir,
+		func(p string, info os.FileInfo, err error) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			if err != nil {
+				report.fail(p, ErrReadFailed, err)
+				return nil
+			}
+
+			if info.IsDir() || !strings.HasSuffix(info.Name(), ".md") {
+				return nil
+			}
+
+			log.Printf("Processing %s...\n", info.Name())
+			report.Notes++
+
+			content, err := ioutil.ReadFile(p)
+			if err != nil {
+				report.fail(info.Name(), ErrReadFailed, err)
+				return nil
+			}
+
+			newContent := applyTransforms(content, transforms)
+			if bytes.Equal(content, newContent) {
+				report.Successes++
+				return nil
+			}
+
+			if backup {
+				err = writeBackup(p, content, 0644)
+				if err != nil {
+					report.fail(info.Name(), ErrWriteFailed, err)
+					return nil
+				}
+			}
+			err = ioutil.WriteFile(p, newContent, 0644)
+			if err != nil {
+				report.fail(info.Name(), ErrWriteFailed, err)
+				return nil
+			}
+			report.Successes++
+
+			return nil
+		})
+
+	fmt.Println()
+	fmt.Printf("Processed %d files with %d successes and %d failures\n", report.Notes, report.Successes, report.Failures())
+
+	return &report, err
+}
@@ -0,0 +1,153 @@
+package bearnotes
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransforms(t *testing.T) {
+	testCases := []struct {
+		transform string
+		input     string
+		expected  string
+	}{
+		{"highlights", "some ::highlighted text:: here", "some ==highlighted text== here"},
+		{"tasks", "* [ ] todo\n  + [X] done\n- [x] done", "- [ ] todo\n  - [x] done\n- [x] done"},
+		{"headings", "# Title #\nsome text\n## Section", "# Title\nsome text\n\n## Section"},
+		{"tag-style", "#multi word tag# and #simple and #not a tag", "#multi-word-tag and #simple and #not a tag"},
+		{"highlights", "```\n::code::\n```\n::text::", "```\n::code::\n```\n==text=="},
+		{"highlights", "$a::b::c$ and ::text::", "$a::b::c$ and ==text=="},
+		{"separators", "some text\n---\nmore text\n- item", "some text\n***\nmore text\n- item"},
+		{"alt-text", "![](note/my_nice-image%201.png) ![kept](a.png)", "![my nice image 1](note/my_nice-image%201.png) ![kept](a.png)"},
+		{"alt-text-title", "# My title\n![](note/image.png)", "# My title\n![My title](note/image.png)"},
+		{"captions", "![](a.png)\n*My caption*\n**not a caption**", "![My caption](a.png)\n**not a caption**"},
+		{"captions", "![alt](a.png)\n_My caption_\n![](b.png)\ntext", "![My caption](a.png)\n![](b.png)\ntext"},
+		{"captions-html", "![](a.png)\n*A & B*", "<figure>\n\n![A & B](a.png)\n\n<figcaption>A &amp; B</figcaption>\n</figure>"},
+		{"callouts", "> Note: some text\n> more text\n\n> **Warning:** careful\n\n>Tip:\n> text", "> [!note]\n> some text\n> more text\n\n> [!warning]\n> careful\n\n>[!tip]\n> text"},
+		{"callouts", "> a quote\n> Note: not a callout\n\nNote: not a quote", "> a quote\n> Note: not a callout\n\nNote: not a quote"},
+		{"strip-toc", "# Title\n{{TOC}}\nsome text {{TOC}}", "# Title\nsome text {{TOC}}"},
+		{"strip-html", "<div><span style=\"color: red\">Hello</span>&nbsp;<STRONG>world</STRONG><br/>line</div><div><br></div>\n\n\n<a href='f.pdf'>f.pdf</a>", "Hello **world**\nline\n\n<a href='f.pdf'>f.pdf</a>"},
+		{"strip-html", "```\n<div>code</div>\n```\n<p>text</p>", "```\n<div>code</div>\n```\ntext\n"},
+	}
+	for _, testCase := range testCases {
+		transforms, err := LookupTransforms([]string{testCase.transform})
+		assert.NoError(t, err, "transform must exist")
+		assert.Equal(t, testCase.expected, string(applyTransforms([]byte(testCase.input), transforms)), "content must be transformed by %s", testCase.transform)
+	}
+
+	_, err := LookupTransforms([]string{"unknown"})
+	assert.Error(t, err, "unknown transforms must be rejected")
+}
+
+func TestTransformNotes(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"note.md":      "some ::highlighted text:: here\n",
+		"work/todo.md": "::first:: and ::second::\n",
+		"plain.md":     "nothing to change\n",
+		"notes.txt":    "::not a note::\n",
+	})
+	defer os.RemoveAll(dir)
+	transforms, err := LookupTransforms([]string{"highlights"})
+	assert.NoError(t, err, "transform must exist")
+
+	report, err := TransformNotes(context.Background(), dir, transforms, true)
+	assert.NoError(t, err, "transformation must succeed")
+	assert.Equal(t, 3, report.Notes, "only Markdown files must be transformed")
+	assert.Equal(t, 3, report.Successes, "all notes must be transformed")
+	assert.Empty(t, report.Errors, "there must be no error")
+	content, _ := ioutil.ReadFile(filepath.Join(dir, "work", "todo.md"))
+	assert.Equal(t, "==first== and ==second==\n", string(content), "notes must be transformed in place")
+	content, _ = ioutil.ReadFile(filepath.Join(dir, "work", "todo.md.bak"))
+	assert.Equal(t, "::first:: and ::second::\n", string(content), "the original note must be saved")
+	assert.NoFileExists(t, filepath.Join(dir, "plain.md.bak"), "unchanged notes must not be saved")
+	content, _ = ioutil.ReadFile(filepath.Join(dir, "notes.txt"))
+	assert.Equal(t, "::not a note::\n", string(content), "other files must be left untouched")
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "note.md"), []byte("::again::\n"), 0644), "note must be written")
+	report, err = TransformNotes(context.Background(), dir, transforms, false)
+	assert.NoError(t, err, "transformation must succeed")
+	assert.Equal(t, 3, report.Successes, "all notes must be transformed")
+	content, _ = ioutil.ReadFile(filepath.Join(dir, "note.md"))
+	assert.Equal(t, "==again==\n", string(content), "notes must be transformed in place")
+	assert.NoFileExists(t, filepath.Join(dir, "note.md-2.bak"), "notes must not be saved without backup")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = TransformNotes(ctx, dir, transforms, false)
+	assert.Equal(t, context.Canceled, err, "cancellation must stop the transformation")
+}
+
+func TestStripHTML(t *testing.T) {
+	content, removed := stripHTML([]byte("<p>Some <i>text</i>&#160;here</p>"))
+	assert.Equal(t, "Some *text* here\n", string(content), "HTML must be converted to Markdown")
+	assert.Equal(t, 5, removed, "removed elements must be counted")
+
+	content, removed = stripHTML([]byte("no HTML <here> & there"))
+	assert.Equal(t, "no HTML <here> & there", string(content), "other content must be left untouched")
+	assert.Equal(t, 0, removed, "nothing must be counted")
+}
+
+func TestLookupProfile(t *testing.T) {
+	for _, name := range ProfileNames() {
+		profile, err := LookupProfile(name)
+		assert.NoError(t, err, "profile %s must exist", name)
+		_, err = LookupTransforms(profile.Transforms)
+		assert.NoError(t, err, "transforms of profile %s must exist", name)
+	}
+	_, err := LookupProfile("unknown")
+	assert.Error(t, err, "unknown profiles must be rejected")
+}
+
+func TestCountTasks(t *testing.T) {
+	counts := countTasks([]byte("- [ ] todo\n  * [x] done\n+ [X] done\nnot a [ ] task\n- [ ] another todo"))
+	assert.Equal(t, taskCounts{open: 2, completed: 2}, counts, "tasks must be counted")
+	assert.Equal(t, "2 open and 2 completed tasks", counts.String(), "task counts must be summarized")
+}
+
+func TestResolveConflicts(t *testing.T) {
+	content := "before\n<<<<<<< local\nmine #foo\n=======\ntheirs #bar\n>>>>>>> remote\nafter\n<<<<<<< unterminated\n"
+	testCases := []struct {
+		side     string
+		expected string
+	}{
+		{ConflictKeep, content},
+		{ConflictFirst, "before\nmine #foo\nafter\n<<<<<<< unterminated\n"},
+		{ConflictSecond, "before\ntheirs #bar\nafter\n<<<<<<< unterminated\n"},
+	}
+	for _, testCase := range testCases {
+		resolved, conflicts := resolveConflicts([]byte(content), testCase.side)
+		assert.Equal(t, 1, conflicts, "conflicts must be counted")
+		assert.Equal(t, testCase.expected, string(resolved), "conflicts must be resolved with side '%s'", testCase.side)
+	}
+
+	assert.True(t, isConflictTitle("My note - conflict"), "conflict titles must be detected")
+	assert.True(t, isConflictTitle("My note - Conflict 2"), "conflict titles must be detected")
+	assert.False(t, isConflictTitle("Conflict resolution"), "regular titles must not be detected")
+	assert.Error(t, checkConflicts("both"), "unknown resolutions must be rejected")
+}
+
+func TestScanBearisms(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"notes/note.md":       "# Note\nSee [other](bear://x-callback-url/open-note?id=1234) and ::this::.\n#multi word tag#\n```\n::code::\n```\n<a href='f.pdf'>f.pdf</a>\n",
+		"notes/clean.md":      "# Clean\n==highlight== and #multi-word-tag\n",
+		"notes/image.png":     "::not a note::",
+		".obsidian/hidden.md": "::hidden::",
+		"_failed/failed.md":   "::failed::",
+	})
+	defer os.RemoveAll(dir)
+
+	bearisms, err := ScanBearisms(context.Background(), dir)
+	assert.NoError(t, err, "scan must succeed")
+	note := filepath.Join(dir, "notes", "note.md")
+	assert.Equal(t, []Bearism{
+		{File: note, Line: 2, Kind: "x-callback link", Text: "bear://x-callback-url/open-note?id=1234"},
+		{File: note, Line: 2, Kind: "highlight", Text: "::this::", Transform: "highlights"},
+		{File: note, Line: 3, Kind: "multi-word tag", Text: "#multi word tag#", Transform: "tag-style"},
+		{File: note, Line: 7, Kind: "HTML attachment", Text: "<a href='f.pdf'>f.pdf</a>"},
+	}, bearisms, "Bear syntax must be found outside of code blocks, hidden directories and failed notes")
+}
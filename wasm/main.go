@@ -0,0 +1,52 @@
+//go:build js && wasm
+// +build js,wasm
+
+// Command wasm exposes the Bear note conversion to JavaScript, so that it can
+// run in a web browser.
+//
+// Build it with:
+//
+//	GOOS=js GOARCH=wasm go build -o bearnotes.wasm ./wasm
+//
+// Once loaded, it defines a global function:
+//
+//	bearnotesConvert(note, tagFile) => { markdown: "...", error: "..." }
+//
+// where note is the content of a Bear note and tagFile is the (optional)
+// content of a tag configuration file.
+package main
+
+import (
+	"syscall/js"
+
+	"github.com/nmasse-itix/bearnotes"
+)
+
+// convert is the JavaScript binding of bearnotes.ConvertNote.
+func convert(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return map[string]interface{}{"error": "missing note content"}
+	}
+
+	var tags map[string]bearnotes.TagOptions
+	if len(args) > 1 && args[1].Type() == js.TypeString && args[1].String() != "" {
+		var err error
+		tags, err = bearnotes.ParseTagFile([]byte(args[1].String()))
+		if err != nil {
+			return map[string]interface{}{"error": err.Error()}
+		}
+	}
+
+	markdown, err := bearnotes.ConvertNote([]byte(args[0].String()), tags)
+	if err != nil {
+		return map[string]interface{}{"error": err.Error()}
+	}
+	return map[string]interface{}{"markdown": markdown}
+}
+
+func main() {
+	js.Global().Set("bearnotesConvert", js.FuncOf(convert))
+
+	// Keep the Go runtime alive so that the function can be called
+	select {}
+}
@@ -0,0 +1,119 @@
+package bearnotes
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Sorting methods of the Zettlr directories (see ZettlrOptions)
+const (
+	ZettlrSortNameUp   = "name-up"
+	ZettlrSortNameDown = "name-down"
+	ZettlrSortTimeUp   = "time-up"
+	ZettlrSortTimeDown = "time-down"
+)
+
+// zettlrDirectoryFile is the name of the file holding the settings of a
+// Zettlr directory.
+const zettlrDirectoryFile = ".ztr-directory"
+
+// ZettlrOptions specifies the Zettlr settings (.ztr-directory files) of the
+// directories created by the migration. The zero value writes no setting.
+type ZettlrOptions struct {
+	// Sorting is the sorting method of the directories: ZettlrSortNameUp,
+	// ZettlrSortNameDown, ZettlrSortTimeUp or ZettlrSortTimeDown. If Sorting
+	// is the empty string, no .ztr-directory file is written.
+	Sorting string
+
+	// Projects turns the top-level directories into Zettlr projects,
+	// exported in ProjectFormats (defaults to html and chromium-pdf).
+	Projects       bool
+	ProjectFormats []string
+}
+
+// ztrDirectory is the content of a .ztr-directory file.
+type ztrDirectory struct {
+	Sorting string      `json:"sorting"`
+	Project *ztrProject `json:"project"`
+	Icon    *string     `json:"icon"`
+}
+
+// ztrProject holds the settings of a Zettlr project.
+type ztrProject struct {
+	Title     string   `json:"title"`
+	Formats   []string `json:"formats"`
+	Filters   []string `json:"filters"`
+	CSLStyle  string   `json:"cslStyle"`
+	Templates struct {
+		TeX  string `json:"tex"`
+		HTML string `json:"html"`
+	} `json:"templates"`
+}
+
+// checkZettlrOptions returns an error if the sorting method is unknown.
+func checkZettlrOptions(options ZettlrOptions) error {
+	switch options.Sorting {
+	case "", ZettlrSortNameUp, ZettlrSortNameDown, ZettlrSortTimeUp, ZettlrSortTimeDown:
+		return nil
+	}
+	return fmt.Errorf("unknown sorting method '%s' (available methods: %s, %s, %s, %s)", options.Sorting, ZettlrSortNameUp, ZettlrSortNameDown, ZettlrSortTimeUp, ZettlrSortTimeDown)
+}
+
+// writeZettlrDirectories writes a .ztr-directory file in every directory
+// holding a migrated note, and their parents up to the root of their vault.
+// The target directories of the tags get the icon of their tag, if any.
+// Existing files are left untouched, not to lose the settings made in Zettlr.
+func (plan *Plan) writeZettlrDirectories() error {
+	options := plan.options.Zettlr
+	roots := make(map[string]string) // directory => root of its vault
+	for _, planned := range plan.Notes {
+		if _, err := os.Stat(planned.Destination); err != nil {
+			continue
+		}
+		for dir := filepath.Dir(planned.Destination); ; dir = filepath.Dir(dir) {
+			roots[dir] = planned.root
+			if dir == planned.root || dir == filepath.Dir(dir) {
+				break
+			}
+		}
+	}
+
+	var dirs []string
+	for dir := range roots {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	icons := tagIcons(plan.tags)
+	for _, dir := range dirs {
+		p := filepath.Join(dir, zettlrDirectoryFile)
+		if _, err := os.Stat(p); err == nil {
+			continue
+		}
+
+		settings := ztrDirectory{Sorting: options.Sorting}
+		if options.Projects && filepath.Dir(dir) == roots[dir] {
+			settings.Project = &ztrProject{Title: filepath.Base(dir), Formats: options.ProjectFormats, Filters: []string{}}
+			if len(settings.Project.Formats) == 0 {
+				settings.Project.Formats = []string{"html", "chromium-pdf"}
+			}
+		}
+		if rel, err := filepath.Rel(roots[dir], dir); err == nil {
+			if icon, ok := icons[filepath.ToSlash(rel)]; ok {
+				settings.Icon = &icon
+			}
+		}
+		content, err := json.Marshal(settings)
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(p, content, plan.options.fileMode())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}